@@ -0,0 +1,195 @@
+// Package client is a Go client for the system-stats-backend API.
+//
+//	c, err := client.New("http://localhost:3000")
+//	stats, err := c.GetStats(ctx, client.StatsOptions{TopProcs: 10})
+//
+//	events, err := c.StreamStats(ctx, client.StreamOptions{Interval: 5 * time.Second})
+//	for event := range events {
+//		fmt.Println(event.Stats.CPUUsage)
+//	}
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the API of one server
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	token      string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests. Its timeout also
+// applies to streams, so it should have none when StreamStats is used.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken sets the admin token sent as a bearer token
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// New creates a client for the server at baseURL, e.g. "http://localhost:3000"
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	c := &Client{baseURL: u, httpClient: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// APIError is returned for responses with a non-2xx status code
+type APIError struct {
+	StatusCode int
+	// Message is the plain text error written by the server
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("system-stats-backend: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// StatsOptions selects the fields and processes of GetStats
+type StatsOptions struct {
+	// Fields lists the SystemStats JSON fields to collect (all when empty).
+	// Fields that are not selected are left zero.
+	Fields []string
+	// TopProcs only includes the N heaviest processes (all when 0), up to
+	// the cap of the server
+	TopProcs int
+	// SortBy is the key used to pick the heaviest processes: cpu or mem
+	SortBy string
+	// Fresh collects a new sample instead of returning the latest one
+	Fresh bool
+}
+
+func (o StatsOptions) query() url.Values {
+	q := url.Values{}
+	if len(o.Fields) > 0 {
+		q.Set("fields", strings.Join(o.Fields, ","))
+	}
+	if o.TopProcs > 0 {
+		q.Set("topProcs", strconv.Itoa(o.TopProcs))
+	}
+	if o.SortBy != "" {
+		q.Set("sortBy", o.SortBy)
+	}
+	if o.Fresh {
+		q.Set("fresh", "true")
+	}
+	return q
+}
+
+// GetStats returns the latest system statistics
+func (c *Client) GetStats(ctx context.Context, opts ...StatsOptions) (*SystemStats, error) {
+	var q url.Values
+	if len(opts) > 0 {
+		q = opts[0].query()
+	}
+	var stats SystemStats
+	if err := c.getJSON(ctx, "/api/stats", q, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetHistory returns the samples recorded between from and to. Zero times
+// leave the range open.
+func (c *Client) GetHistory(ctx context.Context, from, to time.Time) ([]Sample, error) {
+	q := url.Values{}
+	if !from.IsZero() {
+		q.Set("from", from.Format(time.RFC3339Nano))
+	}
+	if !to.IsZero() {
+		q.Set("to", to.Format(time.RFC3339Nano))
+	}
+	var samples []Sample
+	if err := c.getJSON(ctx, "/api/history", q, &samples); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// GetVersion returns the build information of the server
+func (c *Client) GetVersion(ctx context.Context) (*VersionInfo, error) {
+	var info VersionInfo
+	if err := c.getJSON(ctx, "/api/version", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Ready reports whether the server's readiness probe passes
+func (c *Client) Ready(ctx context.Context) (bool, error) {
+	resp, err := c.do(ctx, "/readyz", nil, "application/json")
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// getJSON decodes the JSON response of a GET request into v
+func (c *Client) getJSON(ctx context.Context, path string, q url.Values, v interface{}) error {
+	resp, err := c.do(ctx, path, q, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding %s response: %w", path, err)
+	}
+	return nil
+}
+
+// do sends a GET request
+func (c *Client) do(ctx context.Context, path string, q url.Values, accept string, headers ...string) (*http.Response, error) {
+	u := c.baseURL.JoinPath(path)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	return c.httpClient.Do(req)
+}
+
+// checkResponse turns a non-2xx response into an *APIError
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+}
@@ -0,0 +1,23 @@
+package client
+
+import (
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// The API payloads, shared with the server
+type (
+	SystemStats = models.SystemStats
+	ProcessInfo = models.ProcessInfo
+	Sample      = models.Sample
+	VersionInfo = models.VersionInfo
+)
+
+// StatsEvent is a sample received from the SSE stream
+type StatsEvent struct {
+	Seq       uint64
+	Timestamp time.Time
+	Host      string
+	Stats     SystemStats
+}
@@ -0,0 +1,233 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// defaultRetry is the reconnection delay used until the server advertises one
+const defaultRetry = 3 * time.Second
+
+// StreamOptions configures StreamStats
+type StreamOptions struct {
+	// Interval between events; the server's default when zero
+	Interval time.Duration
+	// Topics lists the subsystems to include (cpu, mem, disk, net,
+	// processes); all when empty
+	Topics []string
+	// TopProcs only includes the N heaviest processes (all when 0), up to
+	// the cap of the server
+	TopProcs int
+	// SortBy is the key used to pick the heaviest processes: cpu or mem
+	SortBy string
+	// OnError is called with the errors that cause a reconnection and with
+	// the collection errors reported by the server. It may be nil.
+	OnError func(error)
+}
+
+func (o StreamOptions) query() url.Values {
+	q := url.Values{}
+	if o.Interval > 0 {
+		q.Set("interval", o.Interval.String())
+	}
+	if len(o.Topics) > 0 {
+		q.Set("topics", strings.Join(o.Topics, ","))
+	}
+	if o.TopProcs > 0 {
+		q.Set("topProcs", strconv.Itoa(o.TopProcs))
+	}
+	if o.SortBy != "" {
+		q.Set("sortBy", o.SortBy)
+	}
+	return q
+}
+
+// StreamError is a collection error reported by the server on the stream
+type StreamError struct {
+	Message string
+}
+
+func (e *StreamError) Error() string {
+	return "system-stats-backend: collection failed: " + e.Message
+}
+
+// StreamStats subscribes to the SSE stream and delivers its samples on the
+// returned channel until ctx is cancelled, when the channel is closed. Lost
+// connections, including the server shutting down, are re-established after
+// the delay advertised by the server, resuming from the last sample received
+// so that samples still in the server's history are not missed.
+//
+// The error of the first connection attempt is returned, so that invalid
+// options are reported immediately.
+func (c *Client) StreamStats(ctx context.Context, opts StreamOptions) (<-chan StatsEvent, error) {
+	s := &stream{client: c, opts: opts, query: opts.query(), retry: defaultRetry}
+	resp, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan StatsEvent)
+	go func() {
+		defer close(ch)
+		for {
+			err := s.read(ctx, resp, ch)
+			if ctx.Err() != nil {
+				return
+			}
+			s.report(err)
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(s.retry):
+				}
+				if resp, err = s.connect(ctx); err == nil {
+					break
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				s.report(err)
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// stream is the state of a StreamStats subscription across reconnections
+type stream struct {
+	client *Client
+	opts   StreamOptions
+	query  url.Values
+	// lastID is the ID of the last stats event received
+	lastID string
+	retry  time.Duration
+}
+
+func (s *stream) report(err error) {
+	if err != nil && s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+}
+
+// connect opens the stream, resuming after the last event received
+func (s *stream) connect(ctx context.Context) (*http.Response, error) {
+	var headers []string
+	if s.lastID != "" {
+		headers = []string{"Last-Event-ID", s.lastID}
+	}
+	resp, err := s.client.do(ctx, "/api/events", s.query, "text/event-stream", headers...)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp); err != nil {
+		// Too many clients: honor the server's Retry-After
+		if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil && seconds > 0 {
+			s.retry = time.Duration(seconds) * time.Second
+		}
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// sseEvent is the envelope of every event of the stream
+type sseEvent struct {
+	Seq       uint64          `json:"seq"`
+	Timestamp time.Time       `json:"timestamp"`
+	Host      string          `json:"host"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// read delivers the stats events of one connection until it ends
+func (s *stream) read(ctx context.Context, resp *http.Response, ch chan<- StatsEvent) error {
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var id, eventType string
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// A blank line dispatches the event
+			if data.Len() > 0 {
+				if err := s.dispatch(ctx, id, eventType, data.String(), ch); err != nil {
+					return err
+				}
+				if eventType == "shutdown" {
+					return nil
+				}
+			}
+			id, eventType = "", ""
+			data.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // Comment, e.g. a heartbeat
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			eventType = value
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms > 0 {
+				s.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// dispatch handles one complete event
+func (s *stream) dispatch(ctx context.Context, id, eventType, data string, ch chan<- StatsEvent) error {
+	var event sseEvent
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return err
+	}
+
+	switch eventType {
+	case "stats":
+		stats := StatsEvent{Seq: event.Seq, Timestamp: event.Timestamp, Host: event.Host}
+		if err := json.Unmarshal(event.Data, &stats.Stats); err != nil {
+			return err
+		}
+		select {
+		case ch <- stats:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if id != "" {
+			s.lastID = id
+		}
+	case "error":
+		var payload models.ErrorData
+		json.Unmarshal(event.Data, &payload)
+		s.report(&StreamError{Message: payload.Message})
+	case "shutdown":
+		var payload models.ShutdownData
+		if json.Unmarshal(event.Data, &payload) == nil && payload.RetryMs > 0 {
+			s.retry = time.Duration(payload.RetryMs) * time.Millisecond
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Command system-stats-backend serves the system stats API.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/server"
+)
+
+// @title System Stats API
+// @version 1.0
+// @description API for monitoring system resources and processes
+// @host localhost:3000
+// @BasePath /api
+// @securityDefinitions.apikey AdminToken
+// @in header
+// @name Authorization
+// @description Token of the admin role (admin.token or an auth.tokens entry) sent as "Bearer <token>"
+// @securityDefinitions.apikey AgentToken
+// @in header
+// @name Authorization
+// @description Aggregator token sent by agents as "Bearer <token>"
+
+func main() {
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to the YAML config file, also read by -check")
+	check := flag.String("check", "", "run a Nagios-style check of a metric (cpu, mem, disk, processes) with the collector settings of -config and exit")
+	warn := flag.String("warn", "", "warning threshold for -check")
+	crit := flag.String("crit", "", "critical threshold for -check")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	logLevel := flag.String("log-level", "", "minimum log level: debug, info, warn, or error (overrides the config file)")
+	logFormat := flag.String("log-format", "", "log format: text or json (overrides the config file)")
+	demo := flag.Bool("demo", false, "serve simulated, randomly evolving stats instead of the host's")
+	genTypes := flag.String("gen-types", "", "write TypeScript definitions of the API models to a file (- for stdout) and exit")
+	hashPassword := flag.Bool("hash-password", false, "print the bcrypt hash of the password read from stdin, for basicAuth.passwordHash, and exit")
+	flag.Parse()
+
+	if *showVersion {
+		info := server.BuildVersionInfo()
+		fmt.Printf("system-stats-backend %s (commit %s, built %s, %s %s)\n",
+			info.Version, info.Commit, info.BuildDate, info.GoVersion, info.Platform)
+		return
+	}
+
+	if *genTypes != "" {
+		runGenTypesCommand(*genTypes)
+		return
+	}
+
+	if *hashPassword {
+		server.RunHashPasswordCommand()
+	}
+
+	if *demo {
+		collector.UseDemo()
+	}
+
+	if *check != "" {
+		server.RunCheckCommand(*configPath, *check, *warn, *crit)
+	}
+
+	cfg, err := server.LoadConfig(*configPath)
+	if err != nil {
+		fatal(err)
+	}
+	if *logLevel != "" {
+		cfg.Log.Level = *logLevel
+	}
+	if *logFormat != "" {
+		cfg.Log.Format = *logFormat
+	}
+	if err := server.SetupLogger(cfg.Log); err != nil {
+		fatal(err)
+	}
+	if *demo {
+		slog.Warn("Demo mode: serving simulated stats")
+	}
+
+	// Create and start server
+	srv, err := server.New(cfg)
+	if err != nil {
+		fatal(err)
+	}
+
+	if err := srv.Start(); err != nil {
+		fatal(err)
+	}
+}
+
+// fatal logs err and exits
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
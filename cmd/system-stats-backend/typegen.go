@@ -0,0 +1,169 @@
+package main
+
+//go:generate go run . -gen-types ../../server/ui/api.d.ts
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+	"github.com/thatbeautifuldream/system-stats-backend/server"
+)
+
+// apiTypes are the payloads written as TypeScript interfaces by -gen-types.
+// Struct types they reference are included as well.
+var apiTypes = []interface{}{
+	models.SystemStats{},
+	models.Sample{},
+	models.Event{},
+	models.ErrorData{},
+	models.ShutdownData{},
+	models.VersionInfo{},
+	models.ZFSStats{},
+	models.MDRaidStats{},
+	models.Pressure{},
+	models.HugePages{},
+	models.NUMAStats{},
+	server.HealthStatus{},
+	server.ReadinessStatus{},
+	server.SelfStats{},
+	server.RuntimeStats{},
+	server.ProcessList{},
+	server.ProcessDetail{},
+	server.ProcessGroup{},
+	server.ProcessNode{},
+	server.ProcessFiles{},
+	server.ProcessConnections{},
+	server.SignalRequest{},
+	server.SignalResult{},
+	server.PriorityRequest{},
+	server.PriorityResult{},
+	server.Watch{},
+	server.WatchHistory{},
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// typeScriptGenerator converts Go struct types to TypeScript interfaces
+// following their encoding/json representation
+type typeScriptGenerator struct {
+	buf  bytes.Buffer
+	seen map[reflect.Type]bool
+	// queue holds the referenced struct types not written yet
+	queue []reflect.Type
+}
+
+// generateTypeScript returns the TypeScript declarations of apiTypes
+func generateTypeScript() []byte {
+	g := &typeScriptGenerator{seen: map[reflect.Type]bool{}}
+	g.buf.WriteString("// Code generated by system-stats-backend -gen-types. DO NOT EDIT.\n")
+	for _, v := range apiTypes {
+		g.enqueue(reflect.TypeOf(v))
+	}
+	for len(g.queue) > 0 {
+		t := g.queue[0]
+		g.queue = g.queue[1:]
+		g.writeInterface(t)
+	}
+	return g.buf.Bytes()
+}
+
+func (g *typeScriptGenerator) enqueue(t reflect.Type) {
+	if !g.seen[t] {
+		g.seen[t] = true
+		g.queue = append(g.queue, t)
+	}
+}
+
+func (g *typeScriptGenerator) writeInterface(t reflect.Type) {
+	fmt.Fprintf(&g.buf, "\nexport interface %s {\n", t.Name())
+	g.writeFields(t)
+	g.buf.WriteString("}\n")
+}
+
+// writeFields writes the exported fields of t, flattening embedded structs
+// the way encoding/json does
+func (g *typeScriptGenerator) writeFields(t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.writeFields(f.Type)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		optional := ""
+		if strings.Contains(","+opts+",", ",omitempty,") {
+			optional = "?"
+		}
+		tsType := g.tsType(f.Type)
+		if f.Type.Kind() == reflect.Pointer && optional == "" {
+			tsType += " | null"
+		}
+		if strings.Contains(","+opts+",", ",string,") {
+			tsType = "string"
+		}
+		fmt.Fprintf(&g.buf, "  %s%s: %s;\n", name, optional, tsType)
+	}
+}
+
+// tsType returns the TypeScript type of the JSON encoding of t
+func (g *typeScriptGenerator) tsType(t reflect.Type) string {
+	if t == timeType {
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.tsType(t.Elem())
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string" // base64
+		}
+		elem := g.tsType(t.Elem())
+		if strings.Contains(elem, " ") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	case reflect.Map:
+		return "Record<string, " + g.tsType(t.Elem()) + ">"
+	case reflect.Struct:
+		if t.Name() == "" {
+			return "unknown"
+		}
+		g.enqueue(t)
+		return t.Name()
+	}
+	return "unknown"
+}
+
+// runGenTypesCommand writes the TypeScript declarations to path, or to
+// stdout when path is "-"
+func runGenTypesCommand(path string) {
+	out := generateTypeScript()
+	if path == "-" {
+		os.Stdout.Write(out)
+		return
+	}
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		fatal(err)
+	}
+}
@@ -0,0 +1,282 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+func init() {
+	Register(cpuCollector{})
+	Register(memCollector{})
+	Register(diskCollector{})
+	Register(available(netCollector{}, netAvailable))
+	Register(available(processCollector{}, processesAvailable))
+}
+
+// cpuCollector reports the total CPU usage percentage, in a container also
+// relative to its CPU quota
+type cpuCollector struct{}
+
+func (cpuCollector) Name() string { return TopicCPU }
+
+func (cpuCollector) Collect(ctx context.Context) (interface{}, error) {
+	cpuPercentages, err := cpu.PercentWithContext(ctx, 0, false)
+	if err != nil {
+		return nil, fmt.Errorf("error getting CPU stats: %w", err)
+	}
+	if len(cpuPercentages) == 0 {
+		return nil, fmt.Errorf("no CPU statistics available")
+	}
+	if usage, ok := containerCPU(cpuPercentages[0]); ok {
+		return usage, nil
+	}
+	return cpuPercentages[0], nil
+}
+
+// memCollector reports the used memory percentage and bytes, in a container
+// also relative to its memory limit
+type memCollector struct{}
+
+func (memCollector) Name() string { return TopicMem }
+
+func (memCollector) Collect(ctx context.Context) (interface{}, error) {
+	memStats, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting memory stats: %w", err)
+	}
+	host := Usage{Percent: memStats.UsedPercent, Used: memStats.Used}
+	if usage, ok := containerMem(host, memStats.Total); ok {
+		return usage, nil
+	}
+	return host, nil
+}
+
+// diskCollector reports the used percentage and bytes of the monitored
+// filesystems, by default every real one. The first is the filesystem of
+// SystemStats.DiskUsage.
+type diskCollector struct{}
+
+func (diskCollector) Name() string { return TopicDisk }
+
+func (diskCollector) Collect(ctx context.Context) (interface{}, error) {
+	var filesystems []models.Filesystem
+	if paths := DiskPaths(); len(paths) > 0 {
+		// Paths on network filesystems take the slow path, which reports
+		// them stale rather than failing when unreachable
+		mounts, _ := disk.PartitionsWithContext(ctx, true)
+		for _, path := range paths {
+			if mount, ok := mountOf(mounts, path); ok && isNetworkFstype(mount.Fstype) {
+				filesystems = append(filesystems, networkFilesystems(ctx, []disk.PartitionStat{{Mountpoint: path, Fstype: mount.Fstype}})...)
+				continue
+			}
+			diskStats, err := disk.UsageWithContext(ctx, usagePath(path))
+			if err != nil {
+				return nil, fmt.Errorf("error getting disk stats of %s: %w", path, err)
+			}
+			filesystems = append(filesystems, filesystem(path, "", diskStats))
+		}
+	} else {
+		var err error
+		if filesystems, err = realFilesystems(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if len(filesystems) == 0 {
+		return nil, fmt.Errorf("no filesystems to report")
+	}
+	return DiskUsage{
+		Usage:       Usage{Percent: filesystems[0].UsedPercent, Used: filesystems[0].Used},
+		Filesystems: filesystems,
+	}, nil
+}
+
+// ignoredFstypes are the read-only image filesystems, which are always full
+var ignoredFstypes = []string{"squashfs", "iso9660", "udf"}
+
+// realFilesystems returns the usage of the filesystems on devices, once per
+// device, with the root filesystem (the system drive on Windows) first, then
+// of the network filesystems when monitored. Local filesystems whose usage
+// cannot be read, e.g. for lack of permission, are left out.
+func realFilesystems(ctx context.Context) ([]models.Filesystem, error) {
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("error listing filesystems: %w", err)
+	}
+	// On Linux, the partitions on devices leave out the network filesystems
+	monitorNetwork, _ := NetworkFilesystems()
+	if monitorNetwork {
+		all, err := disk.PartitionsWithContext(ctx, true)
+		if err != nil {
+			return nil, fmt.Errorf("error listing filesystems: %w", err)
+		}
+		for _, partition := range all {
+			if isNetworkFstype(partition.Fstype) && !slices.ContainsFunc(partitions, func(p disk.PartitionStat) bool { return p.Mountpoint == partition.Mountpoint }) {
+				partitions = append(partitions, partition)
+			}
+		}
+	}
+
+	root := "/"
+	if runtime.GOOS == "windows" {
+		root = os.Getenv("SystemDrive")
+	}
+	var filesystems []models.Filesystem
+	var network []disk.PartitionStat
+	devices := map[string]bool{}
+	for _, partition := range partitions {
+		if devices[partition.Device] || slices.Contains(ignoredFstypes, partition.Fstype) || skipPartition(partition) {
+			continue
+		}
+		if isNetworkFstype(partition.Fstype) {
+			if monitorNetwork {
+				devices[partition.Device] = true
+				network = append(network, partition)
+			}
+			continue
+		}
+		diskStats, err := disk.UsageWithContext(ctx, usagePath(partition.Mountpoint))
+		if err != nil || diskStats.Total == 0 {
+			continue
+		}
+		devices[partition.Device] = true
+		fs := filesystem(partition.Mountpoint, partition.Device, diskStats)
+		// The mount table names the filesystem more precisely than statfs,
+		// e.g. ext4 rather than ext2/ext3
+		if partition.Fstype != "" {
+			fs.Fstype = partition.Fstype
+		}
+		if strings.EqualFold(strings.TrimRight(partition.Mountpoint, `\`), root) {
+			filesystems = append([]models.Filesystem{fs}, filesystems...)
+		} else {
+			filesystems = append(filesystems, fs)
+		}
+	}
+	return append(filesystems, networkFilesystems(ctx, network)...), nil
+}
+
+// filesystem converts the usage of the filesystem mounted at mountpoint
+func filesystem(mountpoint, device string, diskStats *disk.UsageStat) models.Filesystem {
+	return models.Filesystem{
+		Mountpoint:  mountpoint,
+		Device:      device,
+		Fstype:      diskStats.Fstype,
+		Total:       diskStats.Total,
+		Used:        diskStats.Used,
+		UsedPercent: diskStats.UsedPercent,
+	}
+}
+
+var (
+	diskPathsMu sync.RWMutex
+	diskPaths   []string
+)
+
+// SetDiskPaths sets the paths whose filesystems the disk collector reports,
+// in order. Empty paths report every real filesystem.
+func SetDiskPaths(paths []string) {
+	diskPathsMu.Lock()
+	defer diskPathsMu.Unlock()
+	diskPaths = slices.Clone(paths)
+}
+
+// DiskPaths returns the paths set by SetDiskPaths
+func DiskPaths() []string {
+	diskPathsMu.RLock()
+	defer diskPathsMu.RUnlock()
+	return diskPaths
+}
+
+// netCollector reports the bytes received and sent by the interfaces
+// selected by SetInterfaces, by default all
+type netCollector struct{}
+
+func (netCollector) Name() string { return TopicNet }
+
+func (netCollector) Collect(ctx context.Context) (interface{}, error) {
+	include, exclude := Interfaces()
+	if len(include) == 0 && len(exclude) == 0 {
+		netStats, err := net.IOCountersWithContext(ctx, false)
+		if err != nil {
+			return nil, fmt.Errorf("error getting network stats: %w", err)
+		}
+		if len(netStats) == 0 {
+			return nil, fmt.Errorf("no network statistics available")
+		}
+		return int64(netStats[0].BytesRecv + netStats[0].BytesSent), nil
+	}
+
+	netStats, err := net.IOCountersWithContext(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("error getting network stats: %w", err)
+	}
+	var total int64
+	selected := 0
+	for _, nic := range netStats {
+		if (len(include) > 0 && !matchAny(include, nic.Name)) || matchAny(exclude, nic.Name) {
+			continue
+		}
+		total += int64(nic.BytesRecv + nic.BytesSent)
+		selected++
+	}
+	if selected == 0 {
+		return nil, fmt.Errorf("no network interface matches the configured patterns")
+	}
+	return total, nil
+}
+
+// matchAny reports whether name matches one of the glob patterns
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	interfacesMu sync.RWMutex
+	// includeInterfaces and excludeInterfaces are glob patterns of interface
+	// names
+	includeInterfaces []string
+	excludeInterfaces []string
+)
+
+// SetInterfaces selects the network interfaces whose traffic the net
+// collector sums: those matching a glob pattern of include (every interface
+// when it is empty) and none of exclude, e.g. include nothing and exclude
+// lo, docker0, and veth*
+func SetInterfaces(include, exclude []string) {
+	interfacesMu.Lock()
+	defer interfacesMu.Unlock()
+	includeInterfaces = slices.Clone(include)
+	excludeInterfaces = slices.Clone(exclude)
+}
+
+// Interfaces returns the patterns set by SetInterfaces
+func Interfaces() (include, exclude []string) {
+	interfacesMu.RLock()
+	defer interfacesMu.RUnlock()
+	return includeInterfaces, excludeInterfaces
+}
+
+// processCollector reports the slim process list
+type processCollector struct{}
+
+func (processCollector) Name() string { return TopicProcesses }
+
+func (processCollector) Collect(ctx context.Context) (interface{}, error) {
+	return listProcesses(ctx)
+}
@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	Register(memoryPressureCollector{})
+	// Apple silicon Macs expose no thermal level to sysctl
+	if _, err := unix.SysctlUint32("machdep.xcpm.cpu_thermal_level"); err == nil {
+		Register(thermalCollector{})
+	}
+}
+
+// memoryPressureLevels names the levels of kern.memorystatus_vm_pressure_level
+var memoryPressureLevels = map[uint32]string{
+	1: "normal",
+	2: "warn",
+	4: "critical",
+}
+
+// memoryPressureCollector reports the memory pressure level
+type memoryPressureCollector struct{}
+
+func (memoryPressureCollector) Name() string { return TopicMemoryPressure }
+
+func (memoryPressureCollector) Collect(ctx context.Context) (interface{}, error) {
+	level, err := unix.SysctlUint32("kern.memorystatus_vm_pressure_level")
+	if err != nil {
+		return nil, fmt.Errorf("error getting memory pressure: %w", err)
+	}
+	available, err := unix.SysctlUint32("kern.memorystatus_level")
+	if err != nil {
+		return nil, fmt.Errorf("error getting available memory: %w", err)
+	}
+	name, ok := memoryPressureLevels[level]
+	if !ok {
+		name = fmt.Sprintf("unknown (%d)", level)
+	}
+	return MemoryPressure{Level: name, Available: available}, nil
+}
+
+// thermalCollector reports the thermal throttling of the CPU
+type thermalCollector struct{}
+
+func (thermalCollector) Name() string { return TopicThermal }
+
+func (thermalCollector) Collect(ctx context.Context) (interface{}, error) {
+	level, err := unix.SysctlUint32("machdep.xcpm.cpu_thermal_level")
+	if err != nil {
+		return nil, fmt.Errorf("error getting thermal level: %w", err)
+	}
+	state := "nominal"
+	if level > 0 {
+		state = "throttled"
+	}
+	return ThermalState{Level: level, State: state}, nil
+}
@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"github.com/shirou/gopsutil/v3/mem"
+	"golang.org/x/sys/windows"
+)
+
+func init() {
+	Register(servicesCollector{})
+	Register(pageFileCollector{})
+}
+
+// serviceStates names the states of SERVICE_STATUS_PROCESS.CurrentState
+var serviceStates = map[uint32]string{
+	windows.SERVICE_STOPPED:          "stopped",
+	windows.SERVICE_START_PENDING:    "start-pending",
+	windows.SERVICE_STOP_PENDING:     "stop-pending",
+	windows.SERVICE_RUNNING:          "running",
+	windows.SERVICE_CONTINUE_PENDING: "continue-pending",
+	windows.SERVICE_PAUSE_PENDING:    "pause-pending",
+	windows.SERVICE_PAUSED:           "paused",
+}
+
+// serviceStartTypes names the start types of QUERY_SERVICE_CONFIG
+var serviceStartTypes = map[uint32]string{
+	windows.SERVICE_BOOT_START:   "boot",
+	windows.SERVICE_SYSTEM_START: "system",
+	windows.SERVICE_AUTO_START:   "auto",
+	windows.SERVICE_DEMAND_START: "manual",
+	windows.SERVICE_DISABLED:     "disabled",
+}
+
+// servicesCollector reports the state of the Windows services
+type servicesCollector struct{}
+
+func (servicesCollector) Name() string { return TopicServices }
+
+// Collect enumerates the services with their state in one call, then reads
+// the start type of each selected one. It only needs the rights of a
+// regular user.
+func (servicesCollector) Collect(ctx context.Context) (interface{}, error) {
+	scm, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_CONNECT|windows.SC_MANAGER_ENUMERATE_SERVICE)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to the service control manager: %w", err)
+	}
+	defer windows.CloseServiceHandle(scm)
+
+	var buf []byte
+	var bytesNeeded, returned uint32
+	for {
+		var p *byte
+		if len(buf) > 0 {
+			p = &buf[0]
+		}
+		err = windows.EnumServicesStatusEx(scm, windows.SC_ENUM_PROCESS_INFO, windows.SERVICE_WIN32,
+			windows.SERVICE_STATE_ALL, p, uint32(len(buf)), &bytesNeeded, &returned, nil, nil)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.ERROR_MORE_DATA) || bytesNeeded <= uint32(len(buf)) {
+			return nil, fmt.Errorf("error listing services: %w", err)
+		}
+		buf = make([]byte, bytesNeeded)
+	}
+
+	services := []Service{}
+	if returned == 0 {
+		return services, nil
+	}
+	for _, s := range unsafe.Slice((*windows.ENUM_SERVICE_STATUS_PROCESS)(unsafe.Pointer(&buf[0])), int(returned)) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		name := windows.UTF16PtrToString(s.ServiceName)
+		if !serviceSelected(name) {
+			continue
+		}
+		services = append(services, Service{
+			Name:        name,
+			DisplayName: windows.UTF16PtrToString(s.DisplayName),
+			State:       serviceStates[s.ServiceStatusProcess.CurrentState],
+			StartType:   serviceStartType(scm, s.ServiceName),
+			PID:         s.ServiceStatusProcess.ProcessId,
+		})
+	}
+	return services, nil
+}
+
+// serviceStartType returns the start type of a service, or an empty string
+// when its config cannot be read
+func serviceStartType(scm windows.Handle, name *uint16) string {
+	service, err := windows.OpenService(scm, name, windows.SERVICE_QUERY_CONFIG)
+	if err != nil {
+		return ""
+	}
+	defer windows.CloseServiceHandle(service)
+
+	size := uint32(1024)
+	for {
+		buf := make([]byte, size)
+		config := (*windows.QUERY_SERVICE_CONFIG)(unsafe.Pointer(&buf[0]))
+		err := windows.QueryServiceConfig(service, config, size, &size)
+		if err == nil {
+			return serviceStartTypes[config.StartType]
+		}
+		if !errors.Is(err, syscall.ERROR_INSUFFICIENT_BUFFER) || size <= uint32(len(buf)) {
+			return ""
+		}
+	}
+}
+
+// pageFileCollector reports the usage of the page files. The swap memory of
+// gopsutil is the commit charge on Windows, which also counts the physical
+// memory, so the page files are enumerated instead.
+type pageFileCollector struct{}
+
+func (pageFileCollector) Name() string { return TopicPageFile }
+
+func (pageFileCollector) Collect(ctx context.Context) (interface{}, error) {
+	devices, err := mem.SwapDevicesWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting page file stats: %w", err)
+	}
+	usage := PageFileUsage{Files: []PageFile{}}
+	for _, device := range devices {
+		file := PageFile{Path: device.Name, Total: device.UsedBytes + device.FreeBytes, Used: device.UsedBytes}
+		usage.Files = append(usage.Files, file)
+		usage.Total += file.Total
+		usage.Used += file.Used
+	}
+	if usage.Total > 0 {
+		usage.UsedPercent = float64(usage.Used) / float64(usage.Total) * 100
+	}
+	return usage, nil
+}
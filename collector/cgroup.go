@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// ContainerUsage is the value of the cpu and mem collectors when the backend
+// runs in a container whose cgroup can be read
+type ContainerUsage struct {
+	// Used is the CPU cores or memory bytes used by the container
+	Used float64
+	// Limit is the CPU quota in cores or the memory limit in bytes, 0 when
+	// unlimited
+	Limit float64
+	// Capacity is the CPUs in cores or the memory in bytes of the host
+	Capacity float64
+	// Host is the usage of the whole host
+	Host Usage
+}
+
+// resource converts the usage for SystemStats.Runtime
+func (u ContainerUsage) resource() *models.ContainerResource {
+	r := &models.ContainerResource{Limit: u.Limit, Used: u.Used, HostUsage: u.Host.Percent}
+	if u.Capacity > 0 {
+		r.OfHost = min(u.Used/u.Capacity*100, 100)
+	}
+	if u.Limit > 0 {
+		ofLimit := min(u.Used/u.Limit*100, 100)
+		r.OfLimit = &ofLimit
+	}
+	return r
+}
+
+var (
+	cgroupMu       sync.RWMutex
+	cgroupRelative = true
+)
+
+// SetCgroupRelative sets whether the headline CPU and memory usage in a
+// container is that of the container, relative to its limits (or to the
+// host when unlimited), rather than of the host. Both are reported in
+// SystemStats.Runtime either way.
+func SetCgroupRelative(relative bool) {
+	cgroupMu.Lock()
+	defer cgroupMu.Unlock()
+	cgroupRelative = relative
+}
+
+// CgroupRelative returns the setting of SetCgroupRelative
+func CgroupRelative() bool {
+	cgroupMu.RLock()
+	defer cgroupMu.RUnlock()
+	return cgroupRelative
+}
+
+// setRuntime stores the value of the cpu or mem collector in
+// stats.Runtime, and in the headline usage when it is a ContainerUsage
+func setRuntime(stats *models.SystemStats, topic string, value interface{}) {
+	if stats.Runtime == nil {
+		info := runtimeInfo()
+		stats.Runtime = &info
+	}
+	v, ok := value.(ContainerUsage)
+	if !ok {
+		return
+	}
+	r := v.resource()
+	usage := v.Host
+	if CgroupRelative() {
+		usage = Usage{Percent: r.OfHost, Used: uint64(v.Used)}
+		if r.OfLimit != nil {
+			usage.Percent = *r.OfLimit
+		}
+	}
+	switch topic {
+	case TopicCPU:
+		stats.Runtime.CPU = r
+		stats.CPUUsage = usage.Percent
+	case TopicMem:
+		stats.Runtime.Memory = r
+		stats.MemUsage, stats.MemUsed = usage.Percent, usage.Used
+	}
+}
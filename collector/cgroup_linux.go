@@ -0,0 +1,335 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// cgroupRoot is where the cgroup hierarchies are mounted
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupV1Unlimited is the smallest memory.limit_in_bytes of cgroup v1 taken
+// as unlimited, which is reported as the largest page-aligned int64
+const cgroupV1Unlimited = 1 << 62
+
+// cgroup locates the cgroup files of the process
+type cgroup struct {
+	version int
+	// path is the cgroup of the process, of the memory controller on v1
+	path string
+	// cpuDir holds the CPU usage, quotaDir the CPU quota, and memDir the
+	// memory usage and limit; all are the cgroup directory on v2
+	cpuDir, quotaDir, memDir string
+}
+
+// containerEngine returns the engine the process runs in, or "" outside
+// containers, by the markers left by Kubernetes, Docker, and Podman
+var containerEngine = sync.OnceValue(func() string {
+	switch {
+	case os.Getenv("KUBERNETES_SERVICE_HOST") != "":
+		return "kubernetes"
+	case fileExists("/.dockerenv"):
+		return "docker"
+	case fileExists("/run/.containerenv"):
+		return "podman"
+	}
+	// Set by systemd-nspawn, LXC, and Podman
+	return os.Getenv("container")
+})
+
+// containerCgroup returns the cgroup of the process when it runs in a
+// container, or nil
+var containerCgroup = sync.OnceValue(func() *cgroup {
+	if containerEngine() == "" {
+		return nil
+	}
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return nil
+	}
+	// Each line is hierarchy-ID:controllers:path; cgroup v2 alone has the
+	// only line 0::<path>
+	paths := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+
+	if fileExists(filepath.Join(cgroupRoot, "cgroup.controllers")) {
+		dir := cgroupDir("", paths[""], "cpu.stat")
+		return &cgroup{version: 2, path: paths[""], cpuDir: dir, quotaDir: dir, memDir: dir}
+	}
+	if _, ok := paths["memory"]; ok {
+		return &cgroup{
+			version:  1,
+			path:     paths["memory"],
+			cpuDir:   cgroupDir("cpuacct", paths["cpuacct"], "cpuacct.usage"),
+			quotaDir: cgroupDir("cpu", paths["cpu"], "cpu.cfs_quota_us"),
+			memDir:   cgroupDir("memory", paths["memory"], "memory.usage_in_bytes"),
+		}
+	}
+	return nil
+})
+
+// cgroupDir returns the directory of the cgroup path under the mount of a
+// controller (none on v2). Within a cgroup namespace, or when the host
+// hierarchy is not mounted, the cgroup of the process is the root of the
+// mount.
+func cgroupDir(controller, path, file string) string {
+	dir := filepath.Join(cgroupRoot, controller, path)
+	if !fileExists(filepath.Join(dir, file)) {
+		dir = filepath.Join(cgroupRoot, controller)
+	}
+	return dir
+}
+
+// fileExists reports whether a file exists
+func fileExists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// runtimeInfo returns whether the process runs in a container, and its
+// cgroup
+func runtimeInfo() models.RuntimeInfo {
+	info := models.RuntimeInfo{Engine: containerEngine()}
+	info.Container = info.Engine != ""
+	if cg := containerCgroup(); cg != nil {
+		info.CgroupVersion, info.CgroupPath = cg.version, cg.path
+	}
+	return info
+}
+
+// cgroupCPUTracker keeps the CPU time of the cgroup between readings, so
+// that its usage is measured over the interval since the previous one
+type cgroupCPUTracker struct {
+	mu sync.Mutex
+	// usec is the CPU time used by the cgroup at the previous reading, at
+	// when it was read, and cores the usage measured then
+	usec     uint64
+	at       time.Time
+	cores    float64
+	measured bool
+}
+
+var cgroupCPU = &cgroupCPUTracker{}
+
+func init() {
+	// Read the CPU time once, so that the first sample has a usage
+	if cg := containerCgroup(); cg != nil {
+		if usec, err := cg.cpuUsec(); err == nil {
+			cgroupCPU.usage(usec, time.Now())
+		}
+	}
+}
+
+// usage returns the cores used by the cgroup since the previous reading.
+// Readings closer than minCPUInterval to it, e.g. a fresh request racing the
+// periodic collection, report the previous usage instead of resetting the
+// baseline. It reports false until a usage has been measured.
+func (t *cgroupCPUTracker) usage(usec uint64, now time.Time) (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	elapsed := now.Sub(t.at)
+	if !t.at.IsZero() && elapsed < minCPUInterval && usec >= t.usec {
+		return t.cores, t.measured
+	}
+	if t.at.IsZero() || usec < t.usec {
+		// The first reading, or the counter was reset
+		t.usec, t.at, t.measured = usec, now, false
+		return 0, false
+	}
+	t.cores = float64(usec-t.usec) / float64(elapsed.Microseconds())
+	t.usec, t.at, t.measured = usec, now, true
+	return t.cores, true
+}
+
+// cpuUsec returns the CPU time used by the cgroup in microseconds
+func (cg *cgroup) cpuUsec() (uint64, error) {
+	if cg.version == 2 {
+		stat, err := readCgroupKeys(filepath.Join(cg.cpuDir, "cpu.stat"))
+		return stat["usage_usec"], err
+	}
+	nsec, err := readUintFile(filepath.Join(cg.cpuDir, "cpuacct.usage"))
+	return nsec / 1000, err
+}
+
+// cpuLimit returns the CPU quota of the cgroup in cores, 0 when unlimited
+func (cg *cgroup) cpuLimit() (float64, error) {
+	var quota, period string
+	if cg.version == 2 {
+		// The quota and period in microseconds, or max and the period
+		data, err := os.ReadFile(filepath.Join(cg.quotaDir, "cpu.max"))
+		if err != nil {
+			return 0, err
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 {
+			return 0, fmt.Errorf("invalid cpu.max %q", data)
+		}
+		if fields[0] == "max" {
+			return 0, nil
+		}
+		quota, period = fields[0], fields[1]
+	} else {
+		// The quota is -1 when unlimited
+		q, err := os.ReadFile(filepath.Join(cg.quotaDir, "cpu.cfs_quota_us"))
+		if err != nil {
+			return 0, err
+		}
+		p, err := os.ReadFile(filepath.Join(cg.quotaDir, "cpu.cfs_period_us"))
+		if err != nil {
+			return 0, err
+		}
+		quota, period = strings.TrimSpace(string(q)), strings.TrimSpace(string(p))
+		if quota == "-1" {
+			return 0, nil
+		}
+	}
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil {
+		return 0, err
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil {
+		return 0, err
+	}
+	if q <= 0 || p <= 0 {
+		return 0, fmt.Errorf("invalid CPU quota %s/%s", quota, period)
+	}
+	return q / p, nil
+}
+
+// memUsed returns the memory used by the cgroup in bytes, less the inactive
+// page cache, which is reclaimed before the limit is hit
+func (cg *cgroup) memUsed() (uint64, error) {
+	current, inactive := "memory.current", "inactive_file"
+	if cg.version == 1 {
+		current, inactive = "memory.usage_in_bytes", "total_inactive_file"
+	}
+	used, err := readUintFile(filepath.Join(cg.memDir, current))
+	if err != nil {
+		return 0, err
+	}
+	if stat, err := readCgroupKeys(filepath.Join(cg.memDir, "memory.stat")); err == nil && stat[inactive] < used {
+		used -= stat[inactive]
+	}
+	return used, nil
+}
+
+// memLimit returns the memory limit of the cgroup in bytes, 0 when
+// unlimited
+func (cg *cgroup) memLimit() (uint64, error) {
+	if cg.version == 2 {
+		data, err := os.ReadFile(filepath.Join(cg.memDir, "memory.max"))
+		if err != nil {
+			return 0, err
+		}
+		value := strings.TrimSpace(string(data))
+		if value == "max" {
+			return 0, nil
+		}
+		return strconv.ParseUint(value, 10, 64)
+	}
+	limit, err := readUintFile(filepath.Join(cg.memDir, "memory.limit_in_bytes"))
+	if err != nil || limit >= cgroupV1Unlimited {
+		return 0, err
+	}
+	return limit, nil
+}
+
+// containerCPU returns the CPU usage of the container since the previous
+// reading, with the host usage. It reports false outside containers, when
+// the cgroup cannot be read, and until a usage has been measured.
+func containerCPU(host float64) (ContainerUsage, bool) {
+	cg := containerCgroup()
+	if cg == nil {
+		return ContainerUsage{}, false
+	}
+	usec, err := cg.cpuUsec()
+	if err != nil {
+		return ContainerUsage{}, false
+	}
+	limit, err := cg.cpuLimit()
+	if err != nil {
+		return ContainerUsage{}, false
+	}
+	cores, ok := cgroupCPU.usage(usec, time.Now())
+	if !ok {
+		return ContainerUsage{}, false
+	}
+	return ContainerUsage{
+		Used:     cores,
+		Limit:    limit,
+		Capacity: float64(runtime.NumCPU()),
+		Host:     Usage{Percent: host},
+	}, true
+}
+
+// containerMem returns the memory usage of the container, with the host
+// usage. It reports false outside containers and when the cgroup cannot be
+// read.
+func containerMem(host Usage, hostTotal uint64) (ContainerUsage, bool) {
+	cg := containerCgroup()
+	if cg == nil {
+		return ContainerUsage{}, false
+	}
+	used, err := cg.memUsed()
+	if err != nil {
+		return ContainerUsage{}, false
+	}
+	limit, err := cg.memLimit()
+	if err != nil {
+		return ContainerUsage{}, false
+	}
+	// A limit above the host memory does not constrain the container
+	if limit >= hostTotal {
+		limit = 0
+	}
+	return ContainerUsage{Used: float64(used), Limit: float64(limit), Capacity: float64(hostTotal), Host: host}, true
+}
+
+// readUintFile reads a file holding a number, e.g. of the cgroup
+func readUintFile(file string) (uint64, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readCgroupKeys reads a flat keyed file of the cgroup, e.g. cpu.stat
+func readCgroupKeys(file string) (map[string]uint64, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]uint64{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		if v, err := strconv.ParseUint(value, 10, 64); err == nil {
+			values[key] = v
+		}
+	}
+	return values, nil
+}
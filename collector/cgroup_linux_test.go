@@ -0,0 +1,178 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCgroupFiles writes the files of a fake cgroup directory
+func writeCgroupFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCgroupCPUTrackerUsage(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name      string
+		readings  []uint64
+		offsets   []time.Duration
+		wantCores float64
+		wantOK    bool
+	}{
+		{"first reading", []uint64{1e6}, []time.Duration{0}, 0, false},
+		{"one core", []uint64{1e6, 2e6}, []time.Duration{0, time.Second}, 1, true},
+		{"too soon before a usage", []uint64{1e6, 1.1e6}, []time.Duration{0, 100 * time.Millisecond}, 0, false},
+		{"too soon keeps the usage", []uint64{0, 2e6, 2.5e6}, []time.Duration{0, time.Second, 1100 * time.Millisecond}, 2, true},
+		{"baseline kept", []uint64{0, 1e5, 1e6}, []time.Duration{0, 100 * time.Millisecond, time.Second}, 1, true},
+		{"counter reset", []uint64{5e6, 1e6}, []time.Duration{0, time.Second}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := &cgroupCPUTracker{}
+			var cores float64
+			var ok bool
+			for i, usec := range tt.readings {
+				cores, ok = tracker.usage(usec, start.Add(tt.offsets[i]))
+			}
+			if cores != tt.wantCores || ok != tt.wantOK {
+				t.Errorf("usage() = %v, %v, want %v, %v", cores, ok, tt.wantCores, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCgroupCPU(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   int
+		files     map[string]string
+		wantUsec  uint64
+		wantLimit float64
+		wantErr   bool
+	}{
+		{
+			name:      "v2 quota",
+			version:   2,
+			files:     map[string]string{"cpu.stat": "usage_usec 123456\nuser_usec 100000\nsystem_usec 23456\n", "cpu.max": "150000 100000\n"},
+			wantUsec:  123456,
+			wantLimit: 1.5,
+		},
+		{
+			name:     "v2 unlimited",
+			version:  2,
+			files:    map[string]string{"cpu.stat": "usage_usec 42\n", "cpu.max": "max 100000\n"},
+			wantUsec: 42,
+		},
+		{
+			name:     "v2 unreadable quota",
+			version:  2,
+			files:    map[string]string{"cpu.stat": "usage_usec 42\n"},
+			wantUsec: 42,
+			wantErr:  true,
+		},
+		{
+			name:      "v1 quota",
+			version:   1,
+			files:     map[string]string{"cpuacct.usage": "5000000\n", "cpu.cfs_quota_us": "50000\n", "cpu.cfs_period_us": "100000\n"},
+			wantUsec:  5000,
+			wantLimit: 0.5,
+		},
+		{
+			name:     "v1 unlimited",
+			version:  1,
+			files:    map[string]string{"cpuacct.usage": "5000000\n", "cpu.cfs_quota_us": "-1\n", "cpu.cfs_period_us": "100000\n"},
+			wantUsec: 5000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeCgroupFiles(t, tt.files)
+			cg := &cgroup{version: tt.version, cpuDir: dir, quotaDir: dir, memDir: dir}
+
+			usec, err := cg.cpuUsec()
+			if err != nil || usec != tt.wantUsec {
+				t.Errorf("cpuUsec() = %v, %v, want %v", usec, err, tt.wantUsec)
+			}
+			limit, err := cg.cpuLimit()
+			if (err != nil) != tt.wantErr || limit != tt.wantLimit {
+				t.Errorf("cpuLimit() = %v, %v, want %v (error %v)", limit, err, tt.wantLimit, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCgroupMem(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   int
+		files     map[string]string
+		wantUsed  uint64
+		wantLimit uint64
+		wantErr   bool
+	}{
+		{
+			name:      "v2 limit",
+			version:   2,
+			files:     map[string]string{"memory.current": "1000000\n", "memory.stat": "anon 600000\ninactive_file 200000\n", "memory.max": "4194304\n"},
+			wantUsed:  800000,
+			wantLimit: 4194304,
+		},
+		{
+			name:     "v2 unlimited",
+			version:  2,
+			files:    map[string]string{"memory.current": "1000000\n", "memory.max": "max\n"},
+			wantUsed: 1000000,
+		},
+		{
+			name:     "v2 unreadable limit",
+			version:  2,
+			files:    map[string]string{"memory.current": "1000000\n"},
+			wantUsed: 1000000,
+			wantErr:  true,
+		},
+		{
+			name:     "v2 invalid limit",
+			version:  2,
+			files:    map[string]string{"memory.current": "1000000\n", "memory.max": "lots\n"},
+			wantUsed: 1000000,
+			wantErr:  true,
+		},
+		{
+			name:      "v1 limit",
+			version:   1,
+			files:     map[string]string{"memory.usage_in_bytes": "3000000\n", "memory.stat": "cache 100\ntotal_inactive_file 1000000\n", "memory.limit_in_bytes": "8388608\n"},
+			wantUsed:  2000000,
+			wantLimit: 8388608,
+		},
+		{
+			name:     "v1 unlimited",
+			version:  1,
+			files:    map[string]string{"memory.usage_in_bytes": "3000000\n", "memory.limit_in_bytes": "9223372036854771712\n"},
+			wantUsed: 3000000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeCgroupFiles(t, tt.files)
+			cg := &cgroup{version: tt.version, cpuDir: dir, quotaDir: dir, memDir: dir}
+
+			used, err := cg.memUsed()
+			if err != nil || used != tt.wantUsed {
+				t.Errorf("memUsed() = %v, %v, want %v", used, err, tt.wantUsed)
+			}
+			limit, err := cg.memLimit()
+			if (err != nil) != tt.wantErr || limit != tt.wantLimit {
+				t.Errorf("memLimit() = %v, %v, want %v (error %v)", limit, err, tt.wantLimit, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package collector
+
+import "github.com/thatbeautifuldream/system-stats-backend/models"
+
+// runtimeInfo reports no container, containers are only detected on Linux
+func runtimeInfo() models.RuntimeInfo {
+	return models.RuntimeInfo{}
+}
+
+// containerCPU reports false, cgroups are Linux only
+func containerCPU(host float64) (ContainerUsage, bool) {
+	return ContainerUsage{}, false
+}
+
+// containerMem reports false, cgroups are Linux only
+func containerMem(host Usage, hostTotal uint64) (ContainerUsage, bool) {
+	return ContainerUsage{}, false
+}
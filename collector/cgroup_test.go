@@ -0,0 +1,58 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+func TestSetRuntime(t *testing.T) {
+	defer SetCgroupRelative(CgroupRelative())
+
+	tests := []struct {
+		name        string
+		relative    bool
+		topic       string
+		value       interface{}
+		wantUsage   float64
+		wantOfLimit *float64
+	}{
+		{"host value", true, TopicCPU, 42.0, 0, nil},
+		{"cpu relative to the limit", true, TopicCPU, ContainerUsage{Used: 1, Limit: 2, Capacity: 8, Host: Usage{Percent: 30}}, 50, ptr(50.0)},
+		{"cpu relative to the host", true, TopicCPU, ContainerUsage{Used: 2, Capacity: 8, Host: Usage{Percent: 30}}, 25, nil},
+		{"cpu of the host", false, TopicCPU, ContainerUsage{Used: 1, Limit: 2, Capacity: 8, Host: Usage{Percent: 30}}, 30, ptr(50.0)},
+		{"mem relative to the limit", true, TopicMem, ContainerUsage{Used: 512, Limit: 1024, Capacity: 4096, Host: Usage{Percent: 70, Used: 2867}}, 50, ptr(50.0)},
+		{"mem over the limit", true, TopicMem, ContainerUsage{Used: 2048, Limit: 1024, Capacity: 4096}, 100, ptr(100.0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetCgroupRelative(tt.relative)
+			stats := &models.SystemStats{}
+			setRuntime(stats, tt.topic, tt.value)
+			if stats.Runtime == nil {
+				t.Fatal("Runtime is not set")
+			}
+
+			usage, resource := stats.CPUUsage, stats.Runtime.CPU
+			if tt.topic == TopicMem {
+				usage, resource = stats.MemUsage, stats.Runtime.Memory
+			}
+			if _, ok := tt.value.(ContainerUsage); !ok {
+				if resource != nil {
+					t.Errorf("resource = %+v, want none for a host value", resource)
+				}
+				return
+			}
+			if usage != tt.wantUsage {
+				t.Errorf("usage = %v, want %v", usage, tt.wantUsage)
+			}
+			if (resource.OfLimit == nil) != (tt.wantOfLimit == nil) || resource.OfLimit != nil && *resource.OfLimit != *tt.wantOfLimit {
+				t.Errorf("ofLimit = %v, want %v", resource.OfLimit, tt.wantOfLimit)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
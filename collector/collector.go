@@ -0,0 +1,189 @@
+// Package collector gathers system statistics. Each subsystem (topic) is a
+// Collector in a registry, so it can be collected on its own and other
+// collectors can be added with Register before the server starts:
+//
+//	collector.Register(collector.NewFunc("gpu", func(ctx context.Context) (interface{}, error) {
+//		return readGPUUsage(ctx)
+//	}))
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// traceKey is the context key of the TraceFunc installed by WithTrace
+type traceKey struct{}
+
+// TraceFunc is called before a subsystem is collected and returns the
+// function called with the outcome, e.g. to record a tracing span
+type TraceFunc func(ctx context.Context, name string) func(err error)
+
+// WithTrace returns a context in which Collect reports the collection of
+// each subsystem to trace
+func WithTrace(ctx context.Context, trace TraceFunc) context.Context {
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+// Stats fetches system and process stats
+func Stats(ctx context.Context) (*models.SystemStats, error) {
+	return Collect(ctx, AllTopicSet())
+}
+
+// Collect fetches only the subsystems in topics, leaving the others zero.
+// The subsystems are collected concurrently. A failed subsystem is left zero
+// and its error reported in SystemStats.Errors, so that one broken sensor does
+// not lose the others; Collect only fails when no subsystem could be
+// collected. Each subsystem is reported to the TraceFunc of ctx, if any.
+func Collect(ctx context.Context, topics TopicSet) (*models.SystemStats, error) {
+	var selected []Collector
+	for _, topic := range Topics() {
+		if topics[topic] {
+			selected = append(selected, lookup(topic))
+		}
+	}
+
+	values := make([]interface{}, len(selected))
+	errs := make([]error, len(selected))
+	var wg sync.WaitGroup
+	for i, c := range selected {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values[i], errs[i] = collectTopic(ctx, c)
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	stats := &models.SystemStats{Processes: []models.ProcessInfo{}}
+	for i, c := range selected {
+		if errs[i] == nil {
+			errs[i] = setTopic(stats, c.Name(), values[i])
+		}
+		if errs[i] != nil {
+			if stats.Errors == nil {
+				stats.Errors = map[string]string{}
+			}
+			stats.Errors[c.Name()] = errs[i].Error()
+		}
+	}
+	if len(selected) > 0 && len(stats.Errors) == len(selected) {
+		return nil, errors.Join(errs...)
+	}
+	return stats, nil
+}
+
+// collectTopic runs the collector of one subsystem within its timeout,
+// reporting it to the TraceFunc of ctx as "collect <topic>"
+func collectTopic(ctx context.Context, c Collector) (interface{}, error) {
+	trace, _ := ctx.Value(traceKey{}).(TraceFunc)
+	if trace == nil {
+		return collectWithTimeout(ctx, c)
+	}
+	end := trace(ctx, "collect "+c.Name())
+	value, err := collectWithTimeout(ctx, c)
+	end(err)
+	return value, err
+}
+
+// collectWithTimeout runs a collector with a deadline. It returns when the
+// deadline passes even if the collector ignores its context, e.g. while
+// blocked in a statfs call on a stalled NFS mount; the collector's goroutine
+// then finishes in the background.
+func collectWithTimeout(ctx context.Context, c Collector) (interface{}, error) {
+	timeout := collectTimeout(c.Name())
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		value interface{}
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := c.Collect(ctx)
+		done <- result{value, err}
+	}()
+
+	var r result
+	select {
+	case r = <-done:
+	case <-ctx.Done():
+		r.err = ctx.Err()
+	}
+	if errors.Is(r.err, context.DeadlineExceeded) && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("collector %s timed out after %s: %w", c.Name(), timeout, r.err)
+	}
+	return r.value, r.err
+}
+
+// Usage is the value of the mem and disk collectors. Collectors replacing
+// them may also return the percentage alone, as a float64.
+type Usage struct {
+	Percent float64
+	// Used is in bytes
+	Used uint64
+}
+
+// DiskUsage is the value of the disk collector: the usage of the first
+// filesystem, and of each one
+type DiskUsage struct {
+	Usage
+	Filesystems []models.Filesystem
+}
+
+// usageValue unpacks the value of the mem or disk collector
+func usageValue(value interface{}) (percent float64, used uint64, ok bool) {
+	switch v := value.(type) {
+	case Usage:
+		return v.Percent, v.Used, true
+	case DiskUsage:
+		return v.Percent, v.Used, true
+	case float64:
+		return v, 0, true
+	}
+	return 0, 0, false
+}
+
+// setTopic stores the value collected for topic in stats
+func setTopic(stats *models.SystemStats, topic string, value interface{}) error {
+	ok := true
+	if topic == TopicCPU || topic == TopicMem {
+		setRuntime(stats, topic, value)
+		if _, isContainer := value.(ContainerUsage); isContainer {
+			return nil
+		}
+	}
+	switch topic {
+	case TopicCPU:
+		stats.CPUUsage, ok = value.(float64)
+	case TopicMem:
+		stats.MemUsage, stats.MemUsed, ok = usageValue(value)
+	case TopicDisk:
+		stats.DiskUsage, stats.DiskUsed, ok = usageValue(value)
+		if v, isDisk := value.(DiskUsage); isDisk {
+			stats.Filesystems = v.Filesystems
+		}
+	case TopicNet:
+		stats.NetTraffic, ok = value.(int64)
+	case TopicProcesses:
+		stats.Processes, ok = value.([]models.ProcessInfo)
+		stats.Processes, stats.Zombies = filterProcesses(stats.Processes)
+	default:
+		if stats.Extra == nil {
+			stats.Extra = map[string]interface{}{}
+		}
+		stats.Extra[topic] = value
+	}
+	if !ok {
+		return fmt.Errorf("collector %s returned an unexpected %T", topic, value)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package collector
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// demoProcessNames are the commands of the simulated processes
+var demoProcessNames = []string{
+	"systemd", "sshd", "nginx", "postgres", "redis-server", "node", "python3",
+	"java", "dockerd", "containerd", "chrome", "code", "bash", "zsh", "cron",
+	"rsyslogd", "prometheus", "grafana", "envoy", "kubelet",
+}
+
+var demoUsers = []string{"root", "www-data", "postgres", "redis", "alice", "bob"}
+
+var demoStatuses = []string{"sleep", "sleep", "sleep", "sleep", "running", "idle"}
+
+// demoProcessCount is the average size of the simulated process list
+const demoProcessCount = 80
+
+// Sizes of the simulated memory and root filesystem
+const (
+	demoMemTotal  = 16 << 30
+	demoDiskTotal = 500 << 30
+)
+
+// demo simulates a host: CPU usage follows a sine wave, memory wanders,
+// the disk slowly fills up and is cleaned, network traffic keeps flowing,
+// and processes start, change, and exit between samples.
+type demo struct {
+	mu      sync.Mutex
+	rand    *rand.Rand
+	started time.Time
+	mem     float64
+	net     int64
+	lastNet time.Time
+	nextPID int32
+	procs   []models.ProcessInfo
+}
+
+var (
+	demoMu     sync.Mutex
+	demoActive bool
+)
+
+// UseDemo replaces the built-in collectors with simulated ones, so that the
+// API serves realistic, evolving stats where the real ones are irrelevant or
+// unavailable. Process details, files, and signals still act on the host.
+func UseDemo() {
+	demoMu.Lock()
+	defer demoMu.Unlock()
+	if demoActive {
+		return
+	}
+	demoActive = true
+
+	now := time.Now()
+	d := &demo{
+		rand:    rand.New(rand.NewSource(now.UnixNano())),
+		started: now,
+		mem:     55,
+		lastNet: now,
+		nextPID: 300,
+	}
+	for len(d.procs) < demoProcessCount {
+		d.procs = append(d.procs, d.newProcess())
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[TopicCPU] = NewFunc(TopicCPU, d.cpu)
+	registry[TopicMem] = NewFunc(TopicMem, d.memory)
+	registry[TopicDisk] = NewFunc(TopicDisk, d.disk)
+	registry[TopicNet] = NewFunc(TopicNet, d.network)
+	registry[TopicProcesses] = NewFunc(TopicProcesses, d.processes)
+}
+
+// Demo reports whether UseDemo replaced the built-in collectors
+func Demo() bool {
+	demoMu.Lock()
+	defer demoMu.Unlock()
+	return demoActive
+}
+
+// cpu oscillates between about 15% and 75% over five minutes, with noise
+func (d *demo) cpu(ctx context.Context) (interface{}, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	phase := time.Since(d.started).Seconds() / 300 * 2 * math.Pi
+	return clamp(45+30*math.Sin(phase)+d.rand.NormFloat64()*4, 0, 100), nil
+}
+
+// memory is a bounded random walk
+func (d *demo) memory(ctx context.Context) (interface{}, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mem = clamp(d.mem+d.rand.NormFloat64()*0.8, 30, 90)
+	return Usage{Percent: d.mem, Used: uint64(d.mem / 100 * demoMemTotal)}, nil
+}
+
+// disk fills from 40% by 1% a minute and drops back once it reaches 95%
+func (d *demo) disk(ctx context.Context) (interface{}, error) {
+	minutes := time.Since(d.started).Minutes()
+	percent := 40 + math.Mod(minutes, 55)
+	root := models.Filesystem{
+		Mountpoint:  "/",
+		Device:      "/dev/nvme0n1p2",
+		Fstype:      "ext4",
+		Total:       demoDiskTotal,
+		Used:        uint64(percent / 100 * demoDiskTotal),
+		UsedPercent: percent,
+	}
+	return DiskUsage{Usage: Usage{Percent: percent, Used: root.Used}, Filesystems: []models.Filesystem{root}}, nil
+}
+
+// network adds the traffic of a fluctuating rate since the previous call
+func (d *demo) network(ctx context.Context) (interface{}, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	rate := 500_000 * (1 + d.rand.ExpFloat64())
+	d.net += int64(rate * now.Sub(d.lastNet).Seconds())
+	d.lastNet = now
+	return d.net, nil
+}
+
+// processes churns the process list: a few processes exit and start, and
+// the usage of the others drifts
+func (d *demo) processes(ctx context.Context) (interface{}, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	procs := d.procs[:0]
+	for _, proc := range d.procs {
+		// PID 1 never exits
+		if proc.PID != 1 && d.rand.Float64() < 0.03 {
+			continue
+		}
+		proc.CPUPercent = clamp(proc.CPUPercent+d.rand.NormFloat64()*2, 0, 100)
+		proc.MemoryUsage = float32(clamp(float64(proc.MemoryUsage)*(1+d.rand.NormFloat64()*0.02), 1, 4096))
+		proc.VoluntaryCtxSwitches += int64(d.rand.Intn(200))
+		proc.InvoluntaryCtxSwitches += int64(d.rand.Intn(10))
+		proc.Status = demoStatuses[d.rand.Intn(len(demoStatuses))]
+		procs = append(procs, proc)
+	}
+	d.procs = procs
+	for target := demoProcessCount - 5 + d.rand.Intn(10); len(d.procs) < target; {
+		d.procs = append(d.procs, d.newProcess())
+	}
+	return append([]models.ProcessInfo(nil), d.procs...), nil
+}
+
+// newProcess returns a simulated process with a fresh PID
+func (d *demo) newProcess() models.ProcessInfo {
+	pid := d.nextPID
+	d.nextPID += 1 + int32(d.rand.Intn(50))
+	name := demoProcessNames[d.rand.Intn(len(demoProcessNames))]
+	ppid := int32(1)
+	if len(d.procs) > 0 && d.rand.Float64() < 0.5 {
+		ppid = d.procs[d.rand.Intn(len(d.procs))].PID
+	}
+	user := demoUsers[d.rand.Intn(len(demoUsers))]
+	if len(d.procs) == 0 {
+		pid, ppid, name, user = 1, 0, "systemd", "root"
+	}
+	return models.ProcessInfo{
+		PID:         pid,
+		PPID:        ppid,
+		Name:        name,
+		Username:    user,
+		CPUPercent:  d.rand.ExpFloat64() * 2,
+		MemoryUsage: float32(5 + d.rand.ExpFloat64()*80),
+		NumFDs:      int32(4 + d.rand.Intn(200)),
+		NumThreads:  int32(1 + d.rand.Intn(40)),
+		Status:      demoStatuses[d.rand.Intn(len(demoStatuses))],
+	}
+}
+
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package collector
+
+import "github.com/shirou/gopsutil/v3/disk"
+
+// skipPartition reports whether a partition is left out of the real
+// filesystems; the mount table only lists filesystems on devices already
+func skipPartition(partition disk.PartitionStat) bool {
+	return false
+}
+
+// usagePath returns the path the usage of a mountpoint is read from
+func usagePath(mountpoint string) string {
+	return mountpoint
+}
@@ -0,0 +1,27 @@
+package collector
+
+import (
+	"github.com/shirou/gopsutil/v3/disk"
+	"golang.org/x/sys/windows"
+)
+
+// skipPartition reports whether a drive is left out of the real
+// filesystems: removable, network, and optical drives are, as their usage
+// is not the host's and reading it may block
+func skipPartition(partition disk.PartitionStat) bool {
+	root, err := windows.UTF16PtrFromString(usagePath(partition.Mountpoint))
+	if err != nil {
+		return true
+	}
+	return windows.GetDriveType(root) != windows.DRIVE_FIXED
+}
+
+// usagePath returns the path the usage of a mountpoint is read from: the
+// root directory of a drive letter, as C: alone names the current directory
+// of the drive
+func usagePath(mountpoint string) string {
+	if len(mountpoint) == 2 && mountpoint[1] == ':' {
+		return mountpoint + `\`
+	}
+	return mountpoint
+}
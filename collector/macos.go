@@ -0,0 +1,27 @@
+package collector
+
+// Names of the collectors registered on macOS hosts only
+const (
+	TopicMemoryPressure = "memorypressure"
+	TopicThermal        = "thermal"
+)
+
+// MemoryPressure is the value of the memorypressure collector, the memory
+// pressure macOS shows in Activity Monitor
+type MemoryPressure struct {
+	// Level is normal, warn, or critical
+	Level string `json:"level"`
+	// Available is the percentage of memory available before the pressure
+	// rises, as reported by memory_pressure
+	Available uint32 `json:"available"`
+}
+
+// ThermalState is the value of the thermal collector, the throttling of the
+// CPU for heat. It is only reported by Intel Macs, whose thermal level the
+// kernel exposes without private frameworks.
+type ThermalState struct {
+	// Level is 0 when the CPU is not throttled, and higher as it is
+	Level uint32 `json:"level"`
+	// State is nominal or throttled
+	State string `json:"state"`
+}
@@ -0,0 +1,6 @@
+package collector
+
+// TopicMDRaid is the name of the collector of Linux software RAID arrays,
+// registered on Linux hosts with the md driver loaded. Its value is a
+// models.MDRaidStats.
+const TopicMDRaid = "mdraid"
@@ -0,0 +1,115 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// mdstat lists the software RAID arrays
+const mdstat = "/proc/mdstat"
+
+func init() {
+	// The file exists once the md driver is loaded
+	if _, err := os.Stat(mdstat); err == nil {
+		Register(mdraidCollector{})
+	}
+}
+
+// mdraidCollector reports the state of the software RAID arrays
+type mdraidCollector struct{}
+
+func (mdraidCollector) Name() string { return TopicMDRaid }
+
+func (mdraidCollector) Collect(ctx context.Context) (interface{}, error) {
+	data, err := os.ReadFile(mdstat)
+	if err != nil {
+		return nil, fmt.Errorf("error reading software RAID status: %w", err)
+	}
+	return parseMdstat(string(data)), nil
+}
+
+var (
+	// mdMember matches a member device, e.g. sda1[0] or sdb1[1](F)
+	mdMember = regexp.MustCompile(`^(\S+)\[\d+\](?:\(([A-Z])\))?$`)
+	// mdDisks matches the member counts and map, e.g. [2/1] [U_]
+	mdDisks = regexp.MustCompile(`\[(\d+)/(\d+)\] \[[U_]+\]`)
+	// mdSync matches a sync in progress, e.g.
+	// recovery = 12.6% (123456/976630336) finish=90.1min speed=150000K/sec
+	mdSync = regexp.MustCompile(`(resync|recovery|reshape|check|repair)\s*=\s*([\d.]+)%(?:.*finish=(\S+))?`)
+	// mdSyncPending matches a sync waiting for another array
+	mdSyncPending = regexp.MustCompile(`(resync|recovery|reshape|check|repair)\s*=\s*(DELAYED|PENDING)`)
+)
+
+// parseMdstat parses /proc/mdstat, e.g.
+//
+//	md1 : active raid1 sdb1[1] sda1[0](F)
+//	      976630336 blocks super 1.2 [2/1] [U_]
+//	      [==>..................]  recovery = 12.6% (123456/976630336) finish=90.1min speed=150000K/sec
+func parseMdstat(data string) models.MDRaidStats {
+	stats := models.MDRaidStats{Arrays: []models.MDArray{}}
+	var array *models.MDArray
+	for _, line := range strings.Split(data, "\n") {
+		if name, desc, ok := strings.Cut(line, " : "); ok && strings.HasPrefix(name, "md") {
+			stats.Arrays = append(stats.Arrays, parseMdArray(name, desc))
+			array = &stats.Arrays[len(stats.Arrays)-1]
+			continue
+		}
+		// The details of an array are indented on the lines after it
+		if array == nil || !strings.HasPrefix(line, " ") {
+			array = nil
+			continue
+		}
+		if m := mdDisks.FindStringSubmatch(line); m != nil {
+			array.Disks, _ = strconv.Atoi(m[1])
+			array.Active, _ = strconv.Atoi(m[2])
+		}
+		if m := mdSync.FindStringSubmatch(line); m != nil {
+			progress, _ := strconv.ParseFloat(m[2], 64)
+			array.Sync = &models.MDSync{Action: m[1], Progress: progress, Finish: m[3]}
+		} else if m := mdSyncPending.FindStringSubmatch(line); m != nil {
+			array.Sync = &models.MDSync{Action: m[1], Pending: true}
+		}
+	}
+
+	for i := range stats.Arrays {
+		array := &stats.Arrays[i]
+		array.Degraded = strings.HasPrefix(array.State, "inactive") || array.Active < array.Disks
+		if array.Degraded {
+			stats.Degraded++
+		}
+	}
+	return stats
+}
+
+// parseMdArray parses the first line of an array after its name, e.g.
+// active (auto-read-only) raid1 sdb1[1] sda1[0](F)
+func parseMdArray(name, desc string) models.MDArray {
+	array := models.MDArray{Name: strings.TrimSpace(name), Members: []string{}}
+	fields := strings.Fields(desc)
+	for i, field := range fields {
+		switch {
+		case i == 0:
+			array.State = field
+		case strings.HasPrefix(field, "("):
+			array.State += " " + field
+		case mdMember.MatchString(field):
+			m := mdMember.FindStringSubmatch(field)
+			array.Members = append(array.Members, m[1])
+			switch m[2] {
+			case "F":
+				array.Failed = append(array.Failed, m[1])
+			case "S":
+				array.Spare = append(array.Spare, m[1])
+			}
+		default:
+			array.Level = field
+		}
+	}
+	return array
+}
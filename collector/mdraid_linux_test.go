@@ -0,0 +1,140 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+func TestParseMdArray(t *testing.T) {
+	tests := []struct {
+		name string
+		desc string
+		want models.MDArray
+	}{
+		{
+			"active",
+			"active raid1 sdb1[1] sda1[0]",
+			models.MDArray{Name: "md0", State: "active", Level: "raid1", Members: []string{"sdb1", "sda1"}},
+		},
+		{
+			"read-only",
+			"active (auto-read-only) raid1 sdb1[1] sda1[0]",
+			models.MDArray{Name: "md0", State: "active (auto-read-only)", Level: "raid1", Members: []string{"sdb1", "sda1"}},
+		},
+		{
+			"failed and spare",
+			"active raid5 sdd1[3](S) sdc1[2] sdb1[1](F) sda1[0]",
+			models.MDArray{
+				Name: "md0", State: "active", Level: "raid5",
+				Members: []string{"sdd1", "sdc1", "sdb1", "sda1"},
+				Failed:  []string{"sdb1"},
+				Spare:   []string{"sdd1"},
+			},
+		},
+		{
+			"inactive",
+			"inactive sdb1[1](S) sda1[0](S)",
+			models.MDArray{Name: "md0", State: "inactive", Members: []string{"sdb1", "sda1"}, Spare: []string{"sdb1", "sda1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseMdArray("md0 ", tt.desc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMdArray() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMdstat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want models.MDRaidStats
+	}{
+		{
+			"no arrays",
+			"Personalities : \nunused devices: <none>\n",
+			models.MDRaidStats{Arrays: []models.MDArray{}},
+		},
+		{
+			"healthy and recovering",
+			`Personalities : [raid1] [raid6] [raid5] [raid4]
+md0 : active raid1 sdb1[1] sda1[0]
+      976630336 blocks super 1.2 [2/2] [UU]
+      bitmap: 0/8 pages [0KB], 65536KB chunk
+
+md1 : active raid1 sdd1[2] sdc1[0](F)
+      976630336 blocks super 1.2 [2/1] [U_]
+      [==>..................]  recovery = 12.6% (123456/976630336) finish=90.1min speed=150000K/sec
+
+unused devices: <none>
+`,
+			models.MDRaidStats{
+				Arrays: []models.MDArray{
+					{Name: "md0", State: "active", Level: "raid1", Disks: 2, Active: 2, Members: []string{"sdb1", "sda1"}},
+					{
+						Name: "md1", State: "active", Level: "raid1", Disks: 2, Active: 1,
+						Members:  []string{"sdd1", "sdc1"},
+						Failed:   []string{"sdc1"},
+						Degraded: true,
+						Sync:     &models.MDSync{Action: "recovery", Progress: 12.6, Finish: "90.1min"},
+					},
+				},
+				Degraded: 1,
+			},
+		},
+		{
+			"delayed resync",
+			`md2 : active raid5 sdg1[2] sdf1[1] sde1[0]
+      1953259520 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/3] [UUU]
+      	resync=DELAYED
+`,
+			models.MDRaidStats{
+				Arrays: []models.MDArray{{
+					Name: "md2", State: "active", Level: "raid5", Disks: 3, Active: 3,
+					Members: []string{"sdg1", "sdf1", "sde1"},
+					Sync:    &models.MDSync{Action: "resync", Pending: true},
+				}},
+			},
+		},
+		{
+			"check without finish",
+			`md0 : active raid1 sdb1[1] sda1[0]
+      976630336 blocks super 1.2 [2/2] [UU]
+      [>....................]  check =  0.5% (4096/976630336)
+`,
+			models.MDRaidStats{
+				Arrays: []models.MDArray{{
+					Name: "md0", State: "active", Level: "raid1", Disks: 2, Active: 2,
+					Members: []string{"sdb1", "sda1"},
+					Sync:    &models.MDSync{Action: "check", Progress: 0.5},
+				}},
+			},
+		},
+		{
+			"inactive",
+			`md127 : inactive sdb1[1](S)
+      976630336 blocks super 1.2
+`,
+			models.MDRaidStats{
+				Arrays: []models.MDArray{{
+					Name: "md127", State: "inactive",
+					Members:  []string{"sdb1"},
+					Spare:    []string{"sdb1"},
+					Degraded: true,
+				}},
+				Degraded: 1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseMdstat(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMdstat() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+package collector
+
+// Names of the collectors of huge pages and NUMA nodes, registered on Linux.
+// Their values are a models.HugePages and a models.NUMAStats.
+const (
+	TopicHugePages = "hugepages"
+	TopicNUMA      = "numa"
+)
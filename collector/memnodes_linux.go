@@ -0,0 +1,143 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// Directories of the huge page pools and of the NUMA nodes
+const (
+	hugePagesDir = "/sys/kernel/mm/hugepages"
+	numaNodesDir = "/sys/devices/system/node"
+)
+
+func init() {
+	if _, err := os.Stat(hugePagesDir); err == nil {
+		Register(hugePagesCollector{})
+	}
+	if _, err := os.Stat(filepath.Join(numaNodesDir, "node0")); err == nil {
+		Register(numaCollector{})
+	}
+}
+
+// hugePagesCollector reports the usage of the huge page pools
+type hugePagesCollector struct{}
+
+func (hugePagesCollector) Name() string { return TopicHugePages }
+
+func (hugePagesCollector) Collect(ctx context.Context) (interface{}, error) {
+	pools, err := hugePagePools(hugePagesDir, true)
+	if err != nil {
+		return nil, err
+	}
+	meminfo, err := readMeminfo("/proc/meminfo", "")
+	if err != nil {
+		return nil, fmt.Errorf("error reading memory stats: %w", err)
+	}
+	return models.HugePages{Pools: pools, Hugetlb: meminfo["Hugetlb"], AnonHugePages: meminfo["AnonHugePages"]}, nil
+}
+
+// numaCollector reports the memory usage of each NUMA node
+type numaCollector struct{}
+
+func (numaCollector) Name() string { return TopicNUMA }
+
+func (numaCollector) Collect(ctx context.Context) (interface{}, error) {
+	dirs, err := filepath.Glob(filepath.Join(numaNodesDir, "node[0-9]*"))
+	if err != nil || len(dirs) == 0 {
+		return nil, fmt.Errorf("error listing NUMA nodes: no nodes found")
+	}
+	stats := models.NUMAStats{Nodes: []models.NUMANode{}}
+	for _, dir := range dirs {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+		// Each line is prefixed with the node, e.g. Node 0 MemTotal: 6147400 kB
+		meminfo, err := readMeminfo(filepath.Join(dir, "meminfo"), fmt.Sprintf("Node %d ", id))
+		if err != nil {
+			return nil, fmt.Errorf("error reading memory stats of NUMA node %d: %w", id, err)
+		}
+		node := models.NUMANode{Node: id, MemTotal: meminfo["MemTotal"], MemFree: meminfo["MemFree"], MemUsed: meminfo["MemUsed"]}
+		if node.MemTotal > 0 {
+			node.UsedPercent = float64(node.MemUsed) / float64(node.MemTotal) * 100
+		}
+		if pools, err := hugePagePools(filepath.Join(dir, "hugepages"), false); err == nil {
+			// Leave out the sizes with no page on the node
+			node.HugePages = slices.DeleteFunc(pools, func(pool models.HugePagePool) bool { return pool.Total == 0 && pool.Surplus == 0 })
+		}
+		stats.Nodes = append(stats.Nodes, node)
+	}
+	slices.SortFunc(stats.Nodes, func(a, b models.NUMANode) int { return cmp.Compare(a.Node, b.Node) })
+	return stats, nil
+}
+
+// hugePagePools reads the pools of a hugepages directory, which holds a
+// hugepages-<size>kB directory per page size, smallest size first. The
+// pools of NUMA nodes have no reserved count.
+func hugePagePools(dir string, reserved bool) ([]models.HugePagePool, error) {
+	sizes, err := filepath.Glob(filepath.Join(dir, "hugepages-*kB"))
+	if err != nil || len(sizes) == 0 {
+		return nil, fmt.Errorf("error listing huge page sizes: none found in %s", dir)
+	}
+	pools := []models.HugePagePool{}
+	for _, sizeDir := range sizes {
+		kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(sizeDir), "hugepages-"), "kB"), 10, 64)
+		if err != nil {
+			continue
+		}
+		pool := models.HugePagePool{Size: kb * 1024}
+		counts := map[string]*uint64{"nr_hugepages": &pool.Total, "free_hugepages": &pool.Free, "surplus_hugepages": &pool.Surplus}
+		if reserved {
+			counts["resv_hugepages"] = &pool.Reserved
+		}
+		for file, dst := range counts {
+			if *dst, err = readUintFile(filepath.Join(sizeDir, file)); err != nil {
+				return nil, fmt.Errorf("error reading huge pages: %w", err)
+			}
+		}
+		pools = append(pools, pool)
+	}
+	slices.SortFunc(pools, func(a, b models.HugePagePool) int { return cmp.Compare(a.Size, b.Size) })
+	return pools, nil
+}
+
+// readMeminfo reads a meminfo file whose lines start with prefix, returning
+// the values in bytes for those in kB
+func readMeminfo(file, prefix string) (map[string]uint64, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]uint64{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, rest, ok := strings.Cut(strings.TrimPrefix(scanner.Text(), prefix), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			v *= 1024
+		}
+		values[key] = v
+	}
+	return values, nil
+}
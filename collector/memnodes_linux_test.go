@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// writeTree writes files at paths relative to a temporary directory
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestHugePagePools(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		reserved bool
+		want     []models.HugePagePool
+		wantErr  bool
+	}{
+		{
+			"system pools sorted by size",
+			map[string]string{
+				"hugepages-1048576kB/nr_hugepages":      "2\n",
+				"hugepages-1048576kB/free_hugepages":    "1\n",
+				"hugepages-1048576kB/surplus_hugepages": "0\n",
+				"hugepages-1048576kB/resv_hugepages":    "0\n",
+				"hugepages-2048kB/nr_hugepages":         "4096\n",
+				"hugepages-2048kB/free_hugepages":       "1024\n",
+				"hugepages-2048kB/surplus_hugepages":    "3\n",
+				"hugepages-2048kB/resv_hugepages":       "12\n",
+			},
+			true,
+			[]models.HugePagePool{
+				{Size: 2 << 20, Total: 4096, Free: 1024, Reserved: 12, Surplus: 3},
+				{Size: 1 << 30, Total: 2, Free: 1},
+			},
+			false,
+		},
+		{
+			"node pools without reserved",
+			map[string]string{
+				"hugepages-2048kB/nr_hugepages":      "8\n",
+				"hugepages-2048kB/free_hugepages":    "8\n",
+				"hugepages-2048kB/surplus_hugepages": "0\n",
+			},
+			false,
+			[]models.HugePagePool{{Size: 2 << 20, Total: 8, Free: 8}},
+			false,
+		},
+		{
+			"missing count",
+			map[string]string{
+				"hugepages-2048kB/nr_hugepages":   "8\n",
+				"hugepages-2048kB/free_hugepages": "8\n",
+			},
+			false,
+			nil,
+			true,
+		},
+		{"no pools", map[string]string{"other": ""}, true, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := hugePagePools(writeTree(t, tt.files), tt.reserved)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("hugePagePools() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hugePagePools() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMeminfo(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		prefix string
+		want   map[string]uint64
+	}{
+		{
+			"system",
+			"MemTotal:       16318412 kB\nHugePages_Total:    4096\nHugepagesize:       2048 kB\nHugetlb:         8388608 kB\n",
+			"",
+			map[string]uint64{"MemTotal": 16318412 * 1024, "HugePages_Total": 4096, "Hugepagesize": 2048 * 1024, "Hugetlb": 8388608 * 1024},
+		},
+		{
+			"node",
+			"Node 1 MemTotal:       6147400 kB\nNode 1 MemFree:         123456 kB\nNode 1 MemUsed:        6023944 kB\nNode 1 HugePages_Free:      8\n",
+			"Node 1 ",
+			map[string]uint64{"MemTotal": 6147400 * 1024, "MemFree": 123456 * 1024, "MemUsed": 6023944 * 1024, "HugePages_Free": 8},
+		},
+		{
+			"malformed lines skipped",
+			"no colon here\nEmpty:\nBad: lots kB\nGood: 1\n",
+			"",
+			map[string]uint64{"Good": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, map[string]string{"meminfo": tt.data})
+			got, err := readMeminfo(filepath.Join(dir, "meminfo"), tt.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readMeminfo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMeminfoMissing(t *testing.T) {
+	if _, err := readMeminfo(filepath.Join(t.TempDir(), "meminfo"), ""); err == nil {
+		t.Error("readMeminfo() of a missing file succeeded, want an error")
+	}
+}
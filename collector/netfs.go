@@ -0,0 +1,139 @@
+package collector
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// networkFstypes are the network filesystems. FUSE filesystems (fuse.sshfs,
+// fuse.rclone, ...) are treated alike, as they are often network backed;
+// fuseblk, used by local NTFS drives, is not.
+var networkFstypes = []string{
+	"nfs", "nfs4", "cifs", "smb3", "smbfs", "afpfs", "webdav", "davfs",
+	"9p", "afs", "ceph", "glusterfs", "lustre", "fuse", "macfuse", "osxfuse",
+}
+
+// isNetworkFstype reports whether fstype is a network or FUSE filesystem
+func isNetworkFstype(fstype string) bool {
+	return slices.Contains(networkFstypes, fstype) || strings.HasPrefix(fstype, "fuse.")
+}
+
+var (
+	networkFsMu sync.RWMutex
+	// monitorNetworkFs reports the network filesystems when no disk paths
+	// are set
+	monitorNetworkFs = true
+	networkFsTimeout = 2 * time.Second
+	// networkFsPending are the mountpoints whose usage query has not
+	// returned, e.g. on an unreachable NFS server; they are reported stale
+	// without another query piling up behind it
+	networkFsPending = map[string]bool{}
+)
+
+// SetNetworkFilesystems sets whether the disk collector reports the network
+// filesystems along with the local ones when no disk paths are set, and how
+// long the usage of each may take before it is reported stale. A zero
+// timeout keeps the default of 2s.
+func SetNetworkFilesystems(monitor bool, timeout time.Duration) {
+	networkFsMu.Lock()
+	defer networkFsMu.Unlock()
+	monitorNetworkFs = monitor
+	if timeout > 0 {
+		networkFsTimeout = timeout
+	}
+}
+
+// NetworkFilesystems returns the settings of SetNetworkFilesystems
+func NetworkFilesystems() (monitor bool, timeout time.Duration) {
+	networkFsMu.RLock()
+	defer networkFsMu.RUnlock()
+	return monitorNetworkFs, networkFsTimeout
+}
+
+// networkFilesystems reads the usage of network filesystems concurrently,
+// off the path of the local ones. statfs on a hung mount blocks regardless
+// of ctx, so a filesystem whose usage does not come back within the timeout
+// is reported stale and its query left to finish in the background.
+func networkFilesystems(ctx context.Context, partitions []disk.PartitionStat) []models.Filesystem {
+	if len(partitions) == 0 {
+		return nil
+	}
+	_, timeout := NetworkFilesystems()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	filesystems := make([]models.Filesystem, len(partitions))
+	var wg sync.WaitGroup
+	for i, partition := range partitions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			filesystems[i] = networkFilesystem(ctx, partition.Mountpoint, partition.Device, partition.Fstype)
+		}()
+	}
+	wg.Wait()
+	return filesystems
+}
+
+// networkFilesystem reads the usage of the network filesystem mounted at
+// mountpoint, or reports it stale when the query fails or ctx is done first
+func networkFilesystem(ctx context.Context, mountpoint, device, fstype string) models.Filesystem {
+	stale := models.Filesystem{Mountpoint: mountpoint, Device: device, Fstype: fstype, Network: true, Stale: true}
+	networkFsMu.Lock()
+	if networkFsPending[mountpoint] {
+		networkFsMu.Unlock()
+		return stale
+	}
+	networkFsPending[mountpoint] = true
+	networkFsMu.Unlock()
+
+	done := make(chan *disk.UsageStat, 1)
+	go func() {
+		diskStats, err := disk.Usage(usagePath(mountpoint))
+		networkFsMu.Lock()
+		delete(networkFsPending, mountpoint)
+		networkFsMu.Unlock()
+		if err != nil {
+			diskStats = nil
+		}
+		done <- diskStats
+	}()
+
+	select {
+	case diskStats := <-done:
+		if diskStats == nil {
+			return stale
+		}
+		fs := filesystem(mountpoint, device, diskStats)
+		if fstype != "" {
+			fs.Fstype = fstype
+		}
+		fs.Network = true
+		return fs
+	case <-ctx.Done():
+		return stale
+	}
+}
+
+// mountOf returns the partition on which path lies, the one with the
+// longest mountpoint containing it
+func mountOf(partitions []disk.PartitionStat, path string) (disk.PartitionStat, bool) {
+	var mount disk.PartitionStat
+	found := false
+	for _, partition := range partitions {
+		mountpoint := strings.TrimSuffix(partition.Mountpoint, "/")
+		if path != partition.Mountpoint && path != mountpoint && !strings.HasPrefix(path, mountpoint+"/") {
+			continue
+		}
+		if !found || len(partition.Mountpoint) > len(mount.Mountpoint) {
+			mount, found = partition, true
+		}
+	}
+	return mount, found
+}
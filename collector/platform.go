@@ -0,0 +1,34 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNotAvailable is the error of the subsystems the platform does not
+// provide, e.g. the process table on NetBSD, reported in SystemStats.Errors
+// like any other failure
+var ErrNotAvailable = fmt.Errorf("not available on this platform: %w", errors.ErrUnsupported)
+
+// unavailableCollector stands in for a built-in collector whose gopsutil
+// functions are not implemented on this platform
+type unavailableCollector struct {
+	name string
+}
+
+func (c unavailableCollector) Name() string { return c.name }
+
+func (unavailableCollector) Collect(ctx context.Context) (interface{}, error) {
+	return nil, ErrNotAvailable
+}
+
+// available returns c, or a collector failing with ErrNotAvailable under its
+// name when the platform lacks it. The platforms are those gopsutil
+// implements, set by the build constraints of the platform_*.go files.
+func available(c Collector, ok bool) Collector {
+	if ok {
+		return c
+	}
+	return unavailableCollector{name: c.Name()}
+}
@@ -0,0 +1,6 @@
+//go:build aix || darwin || linux || freebsd || openbsd || solaris || windows
+
+package collector
+
+// netAvailable is set on the platforms gopsutil reads the network counters of
+const netAvailable = true
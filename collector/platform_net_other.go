@@ -0,0 +1,5 @@
+//go:build !aix && !darwin && !linux && !freebsd && !openbsd && !solaris && !windows
+
+package collector
+
+const netAvailable = false
@@ -0,0 +1,6 @@
+//go:build darwin || linux || freebsd || openbsd || plan9 || solaris || windows
+
+package collector
+
+// processesAvailable is set on the platforms gopsutil lists the processes of
+const processesAvailable = true
@@ -0,0 +1,5 @@
+//go:build !darwin && !linux && !freebsd && !openbsd && !plan9 && !solaris && !windows
+
+package collector
+
+const processesAvailable = false
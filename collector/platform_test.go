@@ -0,0 +1,21 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAvailable(t *testing.T) {
+	if c := available(netCollector{}, true); c != (netCollector{}) {
+		t.Errorf("available(netCollector, true) = %#v, want the collector", c)
+	}
+
+	c := available(netCollector{}, false)
+	if c.Name() != TopicNet {
+		t.Errorf("Name() = %q, want %q", c.Name(), TopicNet)
+	}
+	if _, err := c.Collect(context.Background()); !errors.Is(err, ErrNotAvailable) || !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Collect() = %v, want ErrNotAvailable", err)
+	}
+}
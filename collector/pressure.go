@@ -0,0 +1,6 @@
+package collector
+
+// TopicPressure is the name of the collector of the Pressure Stall
+// Information, registered on Linux hosts with PSI enabled. Its value is a
+// models.Pressure.
+const TopicPressure = "pressure"
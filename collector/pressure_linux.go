@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// pressureDir holds a file of Pressure Stall Information per resource
+const pressureDir = "/proc/pressure"
+
+func init() {
+	// PSI is available from Linux 4.20 when not disabled with psi=0
+	if _, err := os.Stat(filepath.Join(pressureDir, "cpu")); err == nil {
+		Register(pressureCollector{})
+	}
+}
+
+// pressureCollector reports the Pressure Stall Information
+type pressureCollector struct{}
+
+func (pressureCollector) Name() string { return TopicPressure }
+
+func (pressureCollector) Collect(ctx context.Context) (interface{}, error) {
+	var pressure models.Pressure
+	for _, r := range []struct {
+		name string
+		dst  *models.PressureResource
+	}{{"cpu", &pressure.CPU}, {"memory", &pressure.Memory}, {"io", &pressure.IO}} {
+		data, err := os.ReadFile(filepath.Join(pressureDir, r.name))
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s pressure: %w", r.name, err)
+		}
+		if *r.dst, err = parsePressure(string(data)); err != nil {
+			return nil, fmt.Errorf("error parsing %s pressure: %w", r.name, err)
+		}
+	}
+	return pressure, nil
+}
+
+// parsePressure parses a file of /proc/pressure, e.g.
+//
+//	some avg10=2.68 avg60=2.07 avg300=2.02 total=143594988
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func parsePressure(data string) (models.PressureResource, error) {
+	var resource models.PressureResource
+	found := false
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		kind, rest, _ := strings.Cut(line, " ")
+		var averages models.PressureAverages
+		for _, field := range strings.Fields(rest) {
+			key, value, _ := strings.Cut(field, "=")
+			var err error
+			switch key {
+			case "avg10":
+				averages.Avg10, err = strconv.ParseFloat(value, 64)
+			case "avg60":
+				averages.Avg60, err = strconv.ParseFloat(value, 64)
+			case "avg300":
+				averages.Avg300, err = strconv.ParseFloat(value, 64)
+			case "total":
+				averages.Total, err = strconv.ParseUint(value, 10, 64)
+			}
+			if err != nil {
+				return resource, fmt.Errorf("invalid %s", field)
+			}
+		}
+		switch kind {
+		case "some":
+			resource.Some, found = averages, true
+		case "full":
+			resource.Full = &averages
+		}
+	}
+	if !found {
+		return resource, fmt.Errorf("no some line")
+	}
+	return resource, nil
+}
@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+func TestParsePressure(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    models.PressureResource
+		wantErr bool
+	}{
+		{
+			"some and full",
+			"some avg10=2.68 avg60=2.07 avg300=2.02 total=143594988\nfull avg10=0.50 avg60=0.25 avg300=0.10 total=1234\n",
+			models.PressureResource{
+				Some: models.PressureAverages{Avg10: 2.68, Avg60: 2.07, Avg300: 2.02, Total: 143594988},
+				Full: &models.PressureAverages{Avg10: 0.5, Avg60: 0.25, Avg300: 0.1, Total: 1234},
+			},
+			false,
+		},
+		{
+			"cpu before Linux 5.13",
+			"some avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+			models.PressureResource{},
+			false,
+		},
+		{
+			"unknown fields ignored",
+			"some avg10=1.00 avg60=2.00 avg300=3.00 total=4 extra=x\n",
+			models.PressureResource{Some: models.PressureAverages{Avg10: 1, Avg60: 2, Avg300: 3, Total: 4}},
+			false,
+		},
+		{"invalid average", "some avg10=abc avg60=0.00 avg300=0.00 total=0\n", models.PressureResource{}, true},
+		{"invalid total", "some avg10=0.00 avg60=0.00 avg300=0.00 total=-1\n", models.PressureResource{}, true},
+		{"no some line", "full avg10=0.00 avg60=0.00 avg300=0.00 total=0\n", models.PressureResource{}, true},
+		{"empty", "", models.PressureResource{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePressure(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePressure() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePressure() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
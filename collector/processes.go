@@ -0,0 +1,257 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// bytesToMB converts a byte count to megabytes
+func bytesToMB(b uint64) float32 {
+	return float32(b) / (1024 * 1024)
+}
+
+// minCPUInterval is the shortest interval the CPU usage of a process is
+// measured over. Scans closer to the previous one, e.g. a request racing the
+// periodic collection, report the previous measurement instead of a noisy one.
+const minCPUInterval = 500 * time.Millisecond
+
+// cpuSample is the CPU time a process had used at one scan
+type cpuSample struct {
+	// createTime tells a reused PID apart from the process seen before
+	createTime int64
+	// total is the user and system CPU time in seconds
+	total   float64
+	at      time.Time
+	percent float64
+}
+
+// cpuTracker keeps the CPU times of the processes between scans, so that
+// their usage is measured over the interval since the previous scan like
+// top does, rather than averaged over their lifetime
+type cpuTracker struct {
+	mu      sync.Mutex
+	samples map[int32]cpuSample
+}
+
+var processCPU = &cpuTracker{samples: map[int32]cpuSample{}}
+
+// percent returns the CPU usage of a process since the previous scan, or
+// over its lifetime when it is new. 100 is one fully used core.
+func (t *cpuTracker) percent(pid int32, createTime int64, total float64, now time.Time) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prev, ok := t.samples[pid]
+	if ok && prev.createTime == createTime {
+		elapsed := now.Sub(prev.at)
+		if elapsed < minCPUInterval {
+			return prev.percent
+		}
+		percent := max(total-prev.total, 0) / elapsed.Seconds() * 100
+		t.samples[pid] = cpuSample{createTime: createTime, total: total, at: now, percent: percent}
+		return percent
+	}
+
+	percent := 0.0
+	if lifetime := now.Sub(time.UnixMilli(createTime)).Seconds(); lifetime > 0 {
+		percent = total / lifetime * 100
+	}
+	t.samples[pid] = cpuSample{createTime: createTime, total: total, at: now, percent: percent}
+	return percent
+}
+
+// ProcessCPUPercent returns the CPU usage of a process measured like the
+// process list measures it, over the interval since the previous scan, so
+// that a single process reports the same usage as its entry in the list
+func ProcessCPUPercent(ctx context.Context, proc *process.Process) (float64, error) {
+	times, err := proc.TimesWithContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	createTime, err := proc.CreateTimeWithContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return processCPU.percent(proc.Pid, createTime, times.User+times.System, time.Now()), nil
+}
+
+// prune forgets the processes that were not seen by a scan
+func (t *cpuTracker) prune(seen map[int32]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for pid := range t.samples {
+		if !seen[pid] {
+			delete(t.samples, pid)
+		}
+	}
+}
+
+// ProcessFilter selects the processes that are collected, so that noise
+// such as idle kernel workers is left out of every payload and the history.
+// A process is kept when it matches the include lists that are not empty,
+// none of the exclude lists, and the minimums.
+type ProcessFilter struct {
+	HideKernelThreads bool
+	// CollapseZombies leaves the zombie processes out, counting them in
+	// SystemStats.Zombies
+	CollapseZombies bool
+	// IncludeNames and ExcludeNames match the process name
+	IncludeNames []*regexp.Regexp
+	ExcludeNames []*regexp.Regexp
+	IncludeUsers []string
+	ExcludeUsers []string
+	// MinCPU is in percent of one core, MinMemory in MB of resident memory
+	MinCPU    float64
+	MinMemory float32
+}
+
+// Keep reports whether the filter selects a process
+func (f *ProcessFilter) Keep(proc models.ProcessInfo) bool {
+	matches := func(patterns []*regexp.Regexp) bool {
+		return slices.ContainsFunc(patterns, func(p *regexp.Regexp) bool { return p.MatchString(proc.Name) })
+	}
+	switch {
+	case f.HideKernelThreads && proc.KernelThread, f.CollapseZombies && IsZombie(proc):
+		return false
+	case len(f.IncludeNames) > 0 && !matches(f.IncludeNames), matches(f.ExcludeNames):
+		return false
+	case len(f.IncludeUsers) > 0 && !slices.Contains(f.IncludeUsers, proc.Username), slices.Contains(f.ExcludeUsers, proc.Username):
+		return false
+	}
+	return proc.CPUPercent >= f.MinCPU && proc.MemoryUsage >= f.MinMemory
+}
+
+var (
+	processFilterMu sync.RWMutex
+	processFilter   *ProcessFilter
+)
+
+// SetProcessFilter sets the filter of the collected processes; nil keeps
+// every process
+func SetProcessFilter(f *ProcessFilter) {
+	processFilterMu.Lock()
+	defer processFilterMu.Unlock()
+	processFilter = f
+}
+
+// IsZombie reports whether a process exited without being reaped by its
+// parent
+func IsZombie(proc models.ProcessInfo) bool {
+	return slices.Contains(strings.Split(proc.Status, ","), process.Zombie)
+}
+
+// filterProcesses returns the processes selected by the filter set by
+// SetProcessFilter, and the number of zombies collapsed
+func filterProcesses(procs []models.ProcessInfo) ([]models.ProcessInfo, int) {
+	processFilterMu.RLock()
+	f := processFilter
+	processFilterMu.RUnlock()
+	if f == nil {
+		return procs, 0
+	}
+	kept := make([]models.ProcessInfo, 0, len(procs))
+	zombies := 0
+	for _, proc := range procs {
+		if f.Keep(proc) {
+			kept = append(kept, proc)
+		} else if f.CollapseZombies && IsZombie(proc) {
+			zombies++
+		}
+	}
+	return kept, zombies
+}
+
+// Processes fetches the slim process list from the processes collector,
+// filtered by the process filter, giving up when ctx is done
+func Processes(ctx context.Context) ([]models.ProcessInfo, error) {
+	procs, err := collectTopic(ctx, lookup(TopicProcesses))
+	if err != nil {
+		return nil, err
+	}
+	list, ok := procs.([]models.ProcessInfo)
+	if !ok {
+		return nil, fmt.Errorf("collector %s returned an unexpected %T", TopicProcesses, procs)
+	}
+	list, _ = filterProcesses(list)
+	return list, nil
+}
+
+// listProcesses reads the slim process list of the host, giving up when ctx
+// is done
+func listProcesses(ctx context.Context) ([]models.ProcessInfo, error) {
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting process list: %w", err)
+	}
+
+	now := time.Now()
+	seen := make(map[int32]bool, len(procs))
+	processInfo := []models.ProcessInfo{}
+	for _, proc := range procs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		name, err := proc.NameWithContext(ctx)
+		if err != nil {
+			continue // Skip this process if we can't get its name
+		}
+
+		times, err := proc.TimesWithContext(ctx)
+		if err != nil {
+			continue // Skip this process if we can't get CPU usage
+		}
+		createTime, err := proc.CreateTimeWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		seen[proc.Pid] = true
+		cpuPercent := processCPU.percent(proc.Pid, createTime, times.User+times.System, now)
+
+		memInfo, err := proc.MemoryInfoWithContext(ctx)
+		if err != nil {
+			continue // Skip this process if we can't get memory info
+		}
+
+		// A missing parent is not fatal: the process is treated as a tree root
+		ppid, _ := proc.PpidWithContext(ctx)
+		// The owner may not be resolvable (e.g. a UID without a passwd entry)
+		username, _ := proc.UsernameWithContext(ctx)
+		// FDs of processes owned by other users are unreadable without privileges
+		numFDs, _ := proc.NumFDsWithContext(ctx)
+		numThreads, _ := proc.NumThreadsWithContext(ctx)
+		status, _ := proc.StatusWithContext(ctx)
+
+		info := models.ProcessInfo{
+			PID:         proc.Pid,
+			PPID:        ppid,
+			Name:        name,
+			Username:    username,
+			CPUPercent:  cpuPercent,
+			MemoryUsage: bytesToMB(memInfo.RSS),
+			NumFDs:      numFDs,
+			NumThreads:  numThreads,
+			Status:      strings.Join(status, ","),
+			// The kernel threads of Linux are kthreadd (PID 2) and its
+			// children
+			KernelThread: runtime.GOOS == "linux" && (proc.Pid == 2 || ppid == 2),
+		}
+		if ctxSwitches, err := proc.NumCtxSwitchesWithContext(ctx); err == nil {
+			info.VoluntaryCtxSwitches = ctxSwitches.Voluntary
+			info.InvoluntaryCtxSwitches = ctxSwitches.Involuntary
+		}
+
+		processInfo = append(processInfo, info)
+	}
+	processCPU.prune(seen)
+	return processInfo, nil
+}
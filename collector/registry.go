@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Collector gathers the statistics of one subsystem. The built-in collectors
+// fill the fields of SystemStats; the values of other collectors are reported
+// under their name in SystemStats.Extra.
+type Collector interface {
+	// Name is the topic the collector is selected by, e.g. "cpu"
+	Name() string
+	// Collect returns the current value, which must encode to JSON
+	Collect(ctx context.Context) (interface{}, error)
+}
+
+// DefaultTimeout bounds the collection of one subsystem unless SetTimeout
+// changes it
+const DefaultTimeout = 5 * time.Second
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Collector{}
+	// registered lists the collector names in registration order, which is
+	// also the order of the payload
+	registered []string
+	// timeouts holds the timeouts set by SetTimeout; "" is the default
+	timeouts = map[string]time.Duration{"": DefaultTimeout}
+)
+
+// Register adds a collector. It must be called before collection starts,
+// typically from an init function, and panics if the name is empty or taken.
+func Register(c Collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	name := c.Name()
+	if name == "" {
+		panic("collector: Register called with an empty name")
+	}
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("collector: Register called twice for %q", name))
+	}
+	registry[name] = c
+	registered = append(registered, name)
+}
+
+// Topics returns the names of the registered collectors in payload order
+func Topics() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return slices.Clone(registered)
+}
+
+// SetTimeout sets how long the collector named name may run before its
+// collection fails. An empty name sets the default of the collectors without
+// a timeout of their own. A zero timeout restores the default.
+func SetTimeout(name string, timeout time.Duration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	switch {
+	case timeout > 0:
+		timeouts[name] = timeout
+	case name == "":
+		timeouts[name] = DefaultTimeout
+	default:
+		delete(timeouts, name)
+	}
+}
+
+// collectTimeout returns the timeout of the collector named name
+func collectTimeout(name string) time.Duration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	if timeout, ok := timeouts[name]; ok {
+		return timeout
+	}
+	return timeouts[""]
+}
+
+// lookup returns the collector registered under name, if any
+func lookup(name string) Collector {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return registry[name]
+}
+
+// funcCollector adapts a function to the Collector interface
+type funcCollector struct {
+	name    string
+	collect func(ctx context.Context) (interface{}, error)
+}
+
+// NewFunc returns a collector named name that calls collect
+func NewFunc(name string, collect func(ctx context.Context) (interface{}, error)) Collector {
+	return funcCollector{name: name, collect: collect}
+}
+
+func (c funcCollector) Name() string {
+	return c.name
+}
+
+func (c funcCollector) Collect(ctx context.Context) (interface{}, error) {
+	return c.collect(ctx)
+}
@@ -0,0 +1,249 @@
+package collector
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// Names of the built-in collectors, the subsystems of SystemStats
+const (
+	TopicCPU       = "cpu"
+	TopicMem       = "mem"
+	TopicDisk      = "disk"
+	TopicNet       = "net"
+	TopicProcesses = "processes"
+)
+
+// TopicFields maps each built-in subsystem to its JSON field in SystemStats.
+// The fields of other collectors are their names.
+var TopicFields = map[string]string{
+	TopicCPU:       "cpuUsage",
+	TopicMem:       "memUsage",
+	TopicDisk:      "diskUsage",
+	TopicNet:       "netTraffic",
+	TopicProcesses: "processes",
+}
+
+// TopicSet is a set of subsystems to collect
+type TopicSet map[string]bool
+
+// AllTopicSet returns a set containing every registered subsystem
+func AllTopicSet() TopicSet {
+	topics := TopicSet{}
+	for _, topic := range Topics() {
+		topics[topic] = true
+	}
+	return topics
+}
+
+// ParseTopics parses a comma-separated list of subsystems ("" means all)
+func ParseTopics(value string) (TopicSet, error) {
+	if value == "" {
+		return AllTopicSet(), nil
+	}
+
+	all := Topics()
+	topics := TopicSet{}
+	for _, topic := range strings.Split(value, ",") {
+		topic = strings.TrimSpace(topic)
+		if !slices.Contains(all, topic) {
+			return nil, fmt.Errorf("invalid topic %q: must be one of %s", topic, strings.Join(all, ", "))
+		}
+		topics[topic] = true
+	}
+	return topics, nil
+}
+
+// ParseFields parses a comma-separated list of SystemStats JSON field names
+// into the subsystems that produce them ("" means all)
+func ParseFields(value string) (TopicSet, error) {
+	if value == "" {
+		return AllTopicSet(), nil
+	}
+
+	all := Topics()
+	topics := TopicSet{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		i := slices.IndexFunc(all, func(topic string) bool { return FieldName(topic) == field })
+		if i < 0 {
+			fields := make([]string, len(all))
+			for j, topic := range all {
+				fields[j] = FieldName(topic)
+			}
+			return nil, fmt.Errorf("invalid field %q: must be one of %s", field, strings.Join(fields, ", "))
+		}
+		topics[all[i]] = true
+	}
+	return topics, nil
+}
+
+// FieldName returns the JSON field of a subsystem
+func FieldName(topic string) string {
+	if field, ok := TopicFields[topic]; ok {
+		return field
+	}
+	return topic
+}
+
+// Filter returns the JSON fields of stats selected by the set, so that
+// uncollected subsystems are omitted rather than reported as zero
+func (t TopicSet) Filter(stats *models.SystemStats) interface{} {
+	if len(t) == len(Topics()) {
+		return stats
+	}
+
+	values := map[string]interface{}{
+		TopicCPU:       stats.CPUUsage,
+		TopicMem:       stats.MemUsage,
+		TopicDisk:      stats.DiskUsage,
+		TopicNet:       stats.NetTraffic,
+		TopicProcesses: stats.Processes,
+	}
+
+	filtered := map[string]interface{}{}
+	if t[TopicProcesses] && stats.ProcessCount > 0 {
+		filtered["processCount"] = stats.ProcessCount
+	}
+	if t[TopicProcesses] && stats.Zombies > 0 {
+		filtered["zombies"] = stats.Zombies
+	}
+	if t[TopicMem] && stats.MemUsed > 0 {
+		filtered["memUsed"] = stats.MemUsed
+	}
+	if t[TopicDisk] && stats.DiskUsed > 0 {
+		filtered["diskUsed"] = stats.DiskUsed
+	}
+	if t[TopicDisk] && len(stats.Filesystems) > 0 {
+		filtered["filesystems"] = stats.Filesystems
+	}
+	if rates := t.rates(stats.Rates); rates != nil {
+		filtered["rates"] = rates
+	}
+	if stats.Runtime != nil && (t[TopicCPU] || t[TopicMem]) {
+		filtered["runtime"] = t.runtime(*stats.Runtime)
+	}
+	extra := map[string]interface{}{}
+	for topic := range t {
+		if field, ok := TopicFields[topic]; ok {
+			filtered[field] = values[topic]
+		} else if value, ok := stats.Extra[topic]; ok {
+			extra[topic] = value
+		}
+	}
+	if len(extra) > 0 {
+		filtered["extra"] = extra
+	}
+	if errs := t.errors(stats.Errors); len(errs) > 0 {
+		filtered["errors"] = errs
+	}
+	if len(stats.Labels) > 0 {
+		filtered["labels"] = stats.Labels
+	}
+	return filtered
+}
+
+// Mask zeroes the fields of stats that are not in the set
+func (t TopicSet) Mask(stats *models.SystemStats) {
+	if !t[TopicCPU] {
+		stats.CPUUsage = 0
+	}
+	if !t[TopicMem] {
+		stats.MemUsage = 0
+		stats.MemUsed = 0
+	}
+	if !t[TopicDisk] {
+		stats.DiskUsage = 0
+		stats.DiskUsed = 0
+		stats.Filesystems = nil
+	}
+	if !t[TopicNet] {
+		stats.NetTraffic = 0
+	}
+	if !t[TopicProcesses] {
+		stats.Processes = nil
+		stats.ProcessCount = 0
+		stats.Zombies = 0
+	}
+	// Replace rather than modify Extra, copies of a sample share it
+	if len(stats.Extra) > 0 {
+		extra := map[string]interface{}{}
+		for topic, value := range stats.Extra {
+			if t[topic] {
+				extra[topic] = value
+			}
+		}
+		stats.Extra = extra
+	}
+	if len(stats.Errors) > 0 {
+		stats.Errors = t.errors(stats.Errors)
+	}
+	// Replace rather than modify Runtime and Rates, like Extra
+	if stats.Runtime != nil {
+		if t[TopicCPU] || t[TopicMem] {
+			runtime := t.runtime(*stats.Runtime)
+			stats.Runtime = &runtime
+		} else {
+			stats.Runtime = nil
+		}
+	}
+	if stats.Rates != nil {
+		rates := *stats.Rates
+		if !t[TopicMem] {
+			rates.MemGrowth = 0
+		}
+		if !t[TopicDisk] {
+			rates.DiskFill = 0
+		}
+		if !t[TopicNet] {
+			rates.NetThroughput = 0
+		}
+		stats.Rates = &rates
+	}
+}
+
+// runtime returns the runtime info without the resources not in the set
+func (t TopicSet) runtime(info models.RuntimeInfo) models.RuntimeInfo {
+	if !t[TopicCPU] {
+		info.CPU = nil
+	}
+	if !t[TopicMem] {
+		info.Memory = nil
+	}
+	return info
+}
+
+// rates returns the rates of the subsystems in the set, or nil if none
+func (t TopicSet) rates(rates *models.Rates) map[string]float64 {
+	if rates == nil {
+		return nil
+	}
+	selected := map[string]float64{}
+	if t[TopicMem] {
+		selected["memGrowth"] = rates.MemGrowth
+	}
+	if t[TopicDisk] {
+		selected["diskFill"] = rates.DiskFill
+	}
+	if t[TopicNet] {
+		selected["netThroughput"] = rates.NetThroughput
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+	return selected
+}
+
+// errors returns the errors of the subsystems in the set
+func (t TopicSet) errors(errs map[string]string) map[string]string {
+	selected := map[string]string{}
+	for topic, err := range errs {
+		if t[topic] {
+			selected[topic] = err
+		}
+	}
+	return selected
+}
@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"slices"
+	"sync"
+)
+
+// Names of the collectors registered on Windows hosts only
+const (
+	TopicServices = "services"
+	TopicPageFile = "pagefile"
+)
+
+// Service is the state of a Windows service. The services collector reports
+// the services selected by SetServices.
+type Service struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	// State is stopped, start-pending, stop-pending, running,
+	// continue-pending, pause-pending, or paused
+	State string `json:"state"`
+	// StartType is boot, system, auto, manual, or disabled
+	StartType string `json:"startType"`
+	PID       uint32 `json:"pid,omitempty"`
+}
+
+// PageFileUsage is the value of the pagefile collector: the usage of the
+// page files of Windows, in bytes
+type PageFileUsage struct {
+	Total       uint64     `json:"total"`
+	Used        uint64     `json:"used"`
+	UsedPercent float64    `json:"usedPercent"`
+	Files       []PageFile `json:"files"`
+}
+
+// PageFile is the usage of one page file
+type PageFile struct {
+	Path  string `json:"path"`
+	Total uint64 `json:"total"`
+	Used  uint64 `json:"used"`
+}
+
+var (
+	servicesMu sync.RWMutex
+	// servicePatterns are glob patterns of service names
+	servicePatterns []string
+)
+
+// SetServices selects the Windows services reported by the services
+// collector by glob patterns of their names; empty patterns select every
+// service. It has no effect on other systems.
+func SetServices(patterns []string) {
+	servicesMu.Lock()
+	defer servicesMu.Unlock()
+	servicePatterns = slices.Clone(patterns)
+}
+
+// serviceSelected reports whether SetServices selected the service named name
+func serviceSelected(name string) bool {
+	servicesMu.RLock()
+	defer servicesMu.RUnlock()
+	return len(servicePatterns) == 0 || matchAny(servicePatterns, name)
+}
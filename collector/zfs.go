@@ -0,0 +1,5 @@
+package collector
+
+// TopicZFS is the name of the collector of ZFS pools, registered on Linux
+// hosts with the ZFS module loaded. Its value is a models.ZFSStats.
+const TopicZFS = "zfs"
@@ -0,0 +1,187 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// zfsKstat is the directory of the statistics of the ZFS module
+const zfsKstat = "/proc/spl/kstat/zfs"
+
+func init() {
+	// The module is loaded on the hosts with ZFS pools
+	if _, err := os.Stat(filepath.Join(zfsKstat, "arcstats")); err == nil {
+		Register(zfsCollector{})
+	}
+}
+
+// zfsCollector reports the health of the ZFS pools from the kstats of the
+// module, their scans from zpool status, and the ARC statistics
+type zfsCollector struct{}
+
+func (zfsCollector) Name() string { return TopicZFS }
+
+func (zfsCollector) Collect(ctx context.Context) (interface{}, error) {
+	pools, err := zfsPools()
+	if err != nil {
+		return nil, err
+	}
+	stats := models.ZFSStats{Pools: pools}
+	if scans, err := zpoolScans(ctx); err == nil {
+		for i := range stats.Pools {
+			stats.Pools[i].Scan = scans[stats.Pools[i].Name]
+		}
+	}
+	for _, pool := range stats.Pools {
+		if pool.Health != "ONLINE" {
+			stats.Degraded++
+		}
+	}
+	if arc, err := zfsARC(); err == nil {
+		stats.ARC = arc
+	}
+	return stats, nil
+}
+
+// zfsPools reads the health of each imported pool, the state file of its
+// kstat directory
+func zfsPools() ([]models.ZFSPool, error) {
+	entries, err := os.ReadDir(zfsKstat)
+	if err != nil {
+		return nil, fmt.Errorf("error listing ZFS pools: %w", err)
+	}
+	pools := []models.ZFSPool{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		state, err := os.ReadFile(filepath.Join(zfsKstat, entry.Name(), "state"))
+		if err != nil {
+			continue
+		}
+		pools = append(pools, models.ZFSPool{Name: entry.Name(), Health: strings.TrimSpace(string(state))})
+	}
+	return pools, nil
+}
+
+// zfsARC reads the ARC statistics
+func zfsARC() (*models.ZFSARC, error) {
+	data, err := os.ReadFile(filepath.Join(zfsKstat, "arcstats"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading ARC stats: %w", err)
+	}
+	return parseArcstats(data), nil
+}
+
+// parseArcstats parses the arcstats kstat. After two header lines, each line
+// is a name, a type, and a value.
+func parseArcstats(data []byte) *models.ZFSARC {
+	values := map[string]uint64{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 0; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if line < 2 || len(fields) != 3 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[2], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	arc := &models.ZFSARC{Size: values["size"], TargetSize: values["c"], Hits: values["hits"], Misses: values["misses"]}
+	if total := arc.Hits + arc.Misses; total > 0 {
+		arc.HitRate = float64(arc.Hits) / float64(total) * 100
+	}
+	return arc
+}
+
+// zpoolScans runs zpool status and returns the scan of each pool that ran
+// one. The kernel module exposes no scan statistics.
+func zpoolScans(ctx context.Context) (map[string]*models.ZFSScan, error) {
+	out, err := exec.CommandContext(ctx, "zpool", "status").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running zpool status: %w", err)
+	}
+	return parseZpoolStatus(string(out)), nil
+}
+
+// parseZpoolStatus parses the scan lines of zpool status, e.g.
+//
+//	scan: scrub in progress since Sun Oct 13 00:24:01 2024
+//	    1.23T / 4.56T scanned at 1.2G/s, 800G / 4.56T issued at 900M/s
+//	    0B repaired, 17.54% done, 01:10:11 to go
+//
+// or
+//
+//	scan: scrub repaired 0B in 02:13:45 with 0 errors on Sun Oct 13 02:37:46 2024
+func parseZpoolStatus(out string) map[string]*models.ZFSScan {
+	scans := map[string]*models.ZFSScan{}
+	var pool string
+	var scan *models.ZFSScan
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if name, ok := strings.CutPrefix(line, "pool: "); ok {
+			pool, scan = name, nil
+			continue
+		}
+		if desc, ok := strings.CutPrefix(line, "scan: "); ok {
+			scan = parseZpoolScan(desc)
+			if scan != nil && pool != "" {
+				scans[pool] = scan
+			}
+			continue
+		}
+		// The progress of a scan is on the lines after it, up to config:
+		if line == "config:" {
+			scan = nil
+		}
+		if scan == nil || scan.State != "in progress" {
+			continue
+		}
+		if i := strings.Index(line, "% done"); i >= 0 {
+			fields := strings.Fields(line[:i])
+			if len(fields) > 0 {
+				scan.Progress, _ = strconv.ParseFloat(fields[len(fields)-1], 64)
+			}
+		}
+	}
+	return scans
+}
+
+// parseZpoolScan parses the description of a scan, nil when none ran
+func parseZpoolScan(desc string) *models.ZFSScan {
+	function, rest, _ := strings.Cut(desc, " ")
+	switch function {
+	case "scrub":
+	case "resilver", "resilvered":
+		function = "resilver"
+	default:
+		return nil
+	}
+	scan := &models.ZFSScan{Function: function}
+	switch {
+	case strings.HasPrefix(rest, "in progress"):
+		scan.State = "in progress"
+	case strings.HasPrefix(rest, "canceled"):
+		scan.State = "canceled"
+	case strings.HasPrefix(rest, "paused"):
+		scan.State = "paused"
+	default:
+		scan.State = "finished"
+		fields := strings.Fields(rest)
+		for i, field := range fields {
+			if field == "with" && i+1 < len(fields) {
+				scan.Errors, _ = strconv.Atoi(fields[i+1])
+			}
+		}
+	}
+	return scan
+}
@@ -0,0 +1,148 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+func TestParseArcstats(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want models.ZFSARC
+	}{
+		{
+			"arcstats",
+			`13 1 0x01 123 33456 9287417429 1392867152781943
+name                            type data
+hits                            4    973
+misses                          4    27
+c                               4    17179869184
+c_min                           4    1073741824
+size                            4    8589934592
+`,
+			models.ZFSARC{Size: 8589934592, TargetSize: 17179869184, Hits: 973, Misses: 27, HitRate: 97.3},
+		},
+		{
+			"no reads",
+			"13 1 0x01 123 33456 9287417429 1392867152781943\nname type data\nsize 4 1024\n",
+			models.ZFSARC{Size: 1024},
+		},
+		{
+			"headers only",
+			"size 4 1024\nhits 4 10\n",
+			models.ZFSARC{},
+		},
+		{
+			"malformed lines",
+			"header\nname type data\nsize 4 lots\nhits 4\nmisses 4 5\n",
+			models.ZFSARC{Misses: 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseArcstats([]byte(tt.data)); *got != tt.want {
+				t.Errorf("parseArcstats() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseZpoolScan(t *testing.T) {
+	tests := []struct {
+		desc string
+		want *models.ZFSScan
+	}{
+		{"none requested", nil},
+		{"scrub in progress since Sun Oct 13 00:24:01 2024", &models.ZFSScan{Function: "scrub", State: "in progress"}},
+		{"scrub repaired 0B in 02:13:45 with 0 errors on Sun Oct 13 02:37:46 2024", &models.ZFSScan{Function: "scrub", State: "finished"}},
+		{"scrub repaired 4K in 00:01:02 with 3 errors on Sun Oct 13 02:37:46 2024", &models.ZFSScan{Function: "scrub", State: "finished", Errors: 3}},
+		{"scrub canceled on Sun Oct 13 01:00:00 2024", &models.ZFSScan{Function: "scrub", State: "canceled"}},
+		{"scrub paused since Sun Oct 13 01:00:00 2024", &models.ZFSScan{Function: "scrub", State: "paused"}},
+		{"resilver in progress since Sun Oct 13 00:24:01 2024", &models.ZFSScan{Function: "resilver", State: "in progress"}},
+		{"resilvered 1.2G in 00:10:11 with 0 errors on Sun Oct 13 00:34:12 2024", &models.ZFSScan{Function: "resilver", State: "finished"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := parseZpoolScan(tt.desc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseZpoolScan() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseZpoolStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want map[string]*models.ZFSScan
+	}{
+		{
+			"scrub in progress",
+			`  pool: tank
+ state: ONLINE
+  scan: scrub in progress since Sun Oct 13 00:24:01 2024
+	1.23T / 4.56T scanned at 1.2G/s, 800G / 4.56T issued at 900M/s
+	0B repaired, 17.54% done, 01:10:11 to go
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+
+errors: No known data errors
+`,
+			map[string]*models.ZFSScan{"tank": {Function: "scrub", State: "in progress", Progress: 17.54}},
+		},
+		{
+			"several pools",
+			`  pool: backup
+ state: DEGRADED
+  scan: resilvered 1.2G in 00:10:11 with 2 errors on Sun Oct 13 00:34:12 2024
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	backup      DEGRADED     0     0     0
+
+  pool: rpool
+ state: ONLINE
+  scan: none requested
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	rpool       ONLINE       0     0     0
+
+  pool: tank
+ state: ONLINE
+  scan: scrub repaired 0B in 02:13:45 with 0 errors on Sun Oct 13 02:37:46 2024
+config:
+`,
+			map[string]*models.ZFSScan{
+				"backup": {Function: "resilver", State: "finished", Errors: 2},
+				"tank":   {Function: "scrub", State: "finished"},
+			},
+		},
+		{
+			"progress after config ignored",
+			`  pool: tank
+  scan: scrub in progress since Sun Oct 13 00:24:01 2024
+config:
+	not a progress line, 50.00% done
+`,
+			map[string]*models.ZFSScan{"tank": {Function: "scrub", State: "in progress"}},
+		},
+		{
+			"no pools",
+			"no pools available\n",
+			map[string]*models.ZFSScan{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseZpoolStatus(tt.out); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseZpoolStatus() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
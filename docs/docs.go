@@ -15,9 +15,282 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/alerts": {
+            "get": {
+                "description": "Returns the configured alert rules with their state (ok, pending, or firing) and their last evaluation. Alerts that fire or resolve are also sent as SSE alert events.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "alerts"
+                ],
+                "summary": "List alert rules",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.AlertStatus"
+                            }
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/alerts/history": {
+            "get": {
+                "description": "Returns the alerts that fired or resolved, oldest first, optionally limited to a time range. The last alerts.historySize transitions are kept in memory, for at most retention.alerts.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "alerts"
+                ],
+                "summary": "Get alert history",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only include alerts that changed state at or after this RFC 3339 timestamp",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include alerts that changed state at or before this RFC 3339 timestamp",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.Alert"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/audit": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Returns the admin actions (signals, priority changes, watch changes) with their principal and outcome, oldest first, optionally limited to a time range or an action. Requests refused for their credentials are recorded too. The last audit.size entries are kept in memory, for at most retention.audit. Requires the admin token.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "audit"
+                ],
+                "summary": "Get audit log",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only include actions at or after this RFC 3339 timestamp",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include actions at or before this RFC 3339 timestamp",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include this action, e.g. process.signal",
+                        "name": "action",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.AuditEntry"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/check": {
+            "get": {
+                "description": "Checks a metric of the latest sample against warning and critical thresholds and returns a Nagios plugin output line. The status code reflects the state: 200 OK, 412 WARNING, 503 CRITICAL, 500 UNKNOWN.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "stats"
+                ],
+                "summary": "Nagios-style check",
+                "parameters": [
+                    {
+                        "enum": [
+                            "cpu",
+                            "mem",
+                            "disk",
+                            "processes"
+                        ],
+                        "type": "string",
+                        "description": "Metric to check",
+                        "name": "metric",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "Warning threshold, reached when the value is at or above it",
+                        "name": "warn",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Critical threshold, reached when the value is at or above it",
+                        "name": "crit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "CPU OK - cpu is 12.50% | cpu=12.5%;80;95;0;100",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "WARNING",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "UNKNOWN",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "CRITICAL",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/compare": {
+            "get": {
+                "description": "Returns the headline metrics averaged over the last span alongside the same metrics averaged over the span ending one window ago, with their deltas, to tell at a glance whether the current values are usual. A previous value is null when the in-memory history does not reach back that far; raise history.size to compare over longer windows.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "stats"
+                ],
+                "summary": "Compare now with the past",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "How far back to compare, e.g. 1h, 24h, or 168h (default 24h)",
+                        "name": "window",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Duration averaged at both ends, at most the window (default 5m)",
+                        "name": "span",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.Comparison"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/events": {
             "get": {
-                "description": "Provides Server-Sent Events (SSE) stream of system statistics",
+                "description": "Provides Server-Sent Events (SSE) stream of system statistics. Every event's data is an Event envelope with seq, timestamp, and host. Event types: \"stats\" (data is SystemStats, id is seq), \"alert\" (data is the alert that changed state), \"error\" (data is ErrorData), and \"shutdown\" (data is ShutdownData), sent once before the server closes the stream on shutdown.",
                 "produces": [
                     "text/event-stream"
                 ],
@@ -25,9 +298,69 @@ const docTemplate = `{
                     "stats"
                 ],
                 "summary": "Get real-time system statistics",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID of the last event received; missed samples still in the history buffer are replayed first",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Alternative to the Last-Event-ID header for clients that cannot set headers",
+                        "name": "lastEventId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated subsystems to include (cpu, mem, disk, net, processes); defaults to all",
+                        "name": "topics",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Update interval as a Go duration, e.g. 500ms or 10s (bounded by the server's sse.minInterval and sse.maxInterval)",
+                        "name": "interval",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only include the N heaviest processes (0 for all, up to processes.embeddedLimit)",
+                        "name": "topProcs",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "cpu",
+                            "mem"
+                        ],
+                        "type": "string",
+                        "description": "Key used to pick the heaviest processes",
+                        "name": "sortBy",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "SSE stream of SystemStats",
+                        "description": "SSE stream of Event envelopes",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/models.Event"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/models.SystemStats"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "type": "string"
                         }
@@ -37,88 +370,3667 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "503": {
+                        "description": "Too many SSE clients",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             }
         },
-        "/stats": {
+        "/fleet": {
             "get": {
-                "description": "Returns current CPU, memory, disk usage, network traffic, and process information",
+                "description": "Returns the latest stats of every node, including the aggregator itself, with the average CPU, memory, and disk usage and the total network traffic and process count of the live nodes. Only served in aggregator mode.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "stats"
+                    "nodes"
+                ],
+                "summary": "Get the statistics of the fleet",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Only include the N heaviest processes per node (0 for all, up to processes.embeddedLimit)",
+                        "name": "topProcs",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "cpu",
+                            "mem"
+                        ],
+                        "type": "string",
+                        "description": "Key used to pick the heaviest processes",
+                        "name": "sortBy",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Get current system statistics",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.SystemStats"
+                            "$ref": "#/definitions/server.FleetStats"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
                         "schema": {
                             "type": "string"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "main.ProcessInfo": {
-            "description": "Information about a single system process",
-            "type": "object",
-            "properties": {
-                "cpuPercent": {
-                    "type": "number",
-                    "example": 5.5
-                },
-                "memoryUsage": {
-                    "description": "in MB",
-                    "type": "number",
-                    "example": 256.5
-                },
-                "name": {
-                    "type": "string",
-                    "example": "chrome"
-                },
-                "pid": {
-                    "type": "integer",
-                    "example": 1234
+        },
+        "/forecast/disk": {
+            "get": {
+                "description": "Fits a trend on the disk usage of the samples of the in-memory history taken within the window and projects when each monitored filesystem fills up, the one of diskUsage first. The linear method fits a least-squares line; holt (double exponential smoothing) follows recent changes of the trend more closely.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "stats"
+                ],
+                "summary": "Forecast disk fill",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only fit the samples taken within this duration before now, e.g. 6h (default the whole history)",
+                        "name": "window",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "linear",
+                            "holt"
+                        ],
+                        "type": "string",
+                        "description": "Trend model",
+                        "name": "method",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.DiskForecast"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
                 }
             }
         },
-        "main.SystemStats": {
-            "description": "System resource usage statistics including CPU, memory, disk, network, and processes",
-            "type": "object",
-            "properties": {
-                "cpuUsage": {
-                    "type": "number",
-                    "example": 45.2
-                },
-                "diskUsage": {
-                    "type": "number",
-                    "example": 75
-                },
-                "memUsage": {
-                    "type": "number",
-                    "example": 60.5
-                },
-                "netTraffic": {
-                    "type": "integer",
-                    "example": 1048576
-                },
-                "processes": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/main.ProcessInfo"
+        "/grafana/": {
+            "get": {
+                "description": "Answers the connection test of the Grafana JSON datasource. Point the datasource at /api/grafana.",
+                "tags": [
+                    "grafana"
+                ],
+                "summary": "Grafana datasource test",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             }
+        },
+        "/grafana/annotations": {
+            "post": {
+                "description": "Returns the alerts that fired or resolved in the requested range as events to show on Grafana graphs",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "grafana"
+                ],
+                "summary": "Grafana annotations",
+                "parameters": [
+                    {
+                        "description": "Annotations request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.GrafanaAnnotationRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.GrafanaAnnotation"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/grafana/query": {
+            "post": {
+                "description": "Returns the history samples in the requested range as Grafana time series or tables, thinned to maxDataPoints",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "grafana"
+                ],
+                "summary": "Query Grafana metrics",
+                "parameters": [
+                    {
+                        "description": "Query request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.GrafanaQueryRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.GrafanaTimeSeries"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/grafana/search": {
+            "post": {
+                "description": "Returns the metric names containing the search target, for the query editor of the Grafana JSON datasource",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "grafana"
+                ],
+                "summary": "Search Grafana metrics",
+                "parameters": [
+                    {
+                        "description": "Search request",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/server.GrafanaSearchRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/history": {
+            "get": {
+                "description": "Returns the samples retained in the in-memory history buffer, optionally limited to a time range. Processes are trimmed with topProcs. The format is negotiated with the Accept header or the format parameter (JSON, MessagePack, Protobuf, or CSV). CSV reports a process count rather than the process list.",
+                "produces": [
+                    "application/json",
+                    "application/msgpack",
+                    "application/x-protobuf",
+                    "text/csv"
+                ],
+                "tags": [
+                    "stats"
+                ],
+                "summary": "Get recent samples",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only include samples taken at or after this RFC 3339 timestamp",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include samples taken at or before this RFC 3339 timestamp",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only include the N heaviest processes per sample (0 for all, up to processes.embeddedLimit)",
+                        "name": "topProcs",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "cpu",
+                            "mem"
+                        ],
+                        "type": "string",
+                        "description": "Key used to pick the heaviest processes",
+                        "name": "sortBy",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "json",
+                            "msgpack",
+                            "protobuf",
+                            "csv"
+                        ],
+                        "type": "string",
+                        "description": "Response format, overriding the Accept header",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Sample"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/mdraid": {
+            "get": {
+                "description": "Returns the Linux software RAID (md) arrays of /proc/mdstat from the last sample: their state, members with the failed and spare ones, and the resync, recovery, reshape, check, or repair in progress. Arrays missing members or inactive are counted in degraded, which alert rules watch as the mdraidDegradedArrays metric. Only available on Linux hosts with the md driver loaded.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "stats"
+                ],
+                "summary": "Get software RAID status",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.MDRaidStats"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/nodes": {
+            "get": {
+                "description": "Lists every node known to the aggregator, including itself, sorted by name, with its last-seen time, health, labels, and CPU, memory, and disk usage, e.g. for a fleet heatmap. Only served in aggregator mode.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "nodes"
+                ],
+                "summary": "List the nodes of the fleet",
+                "parameters": [
+                    {
+                        "enum": [
+                            "healthy",
+                            "degraded",
+                            "stale",
+                            "pending"
+                        ],
+                        "type": "string",
+                        "description": "Only list nodes with this health",
+                        "name": "health",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Only list nodes with this label, as name=value; repeat to require several",
+                        "name": "label",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.NodeSummary"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/nodes/{node}": {
+            "post": {
+                "security": [
+                    {
+                        "AgentToken": []
+                    }
+                ],
+                "description": "Registers the node an agent pushes samples for, or renews its registration. Only served in aggregator mode; requires the aggregator token.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "nodes"
+                ],
+                "summary": "Register an agent",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Node name",
+                        "name": "node",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Registration",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.NodeRegistration"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Too many nodes",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/nodes/{node}/samples": {
+            "post": {
+                "security": [
+                    {
+                        "AgentToken": []
+                    }
+                ],
+                "description": "Records samples collected by an agent, oldest first. The node must be registered first; 404 tells the agent to register again, e.g. after the aggregator restarted. Only served in aggregator mode; requires the aggregator token.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "nodes"
+                ],
+                "summary": "Push samples of a node",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Node name",
+                        "name": "node",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Samples",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Sample"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown node",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/nodes/{node}/stats": {
+            "get": {
+                "description": "Returns the latest sample pushed by a node, or collected by the aggregator itself for its own hostname. Only served in aggregator mode.",
+                "produces": [
+                    "application/json",
+                    "application/msgpack",
+                    "application/x-protobuf",
+                    "text/csv"
+                ],
+                "tags": [
+                    "nodes"
+                ],
+                "summary": "Get the statistics of a node",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Node name",
+                        "name": "node",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only include the N heaviest processes (0 for all, up to processes.embeddedLimit)",
+                        "name": "topProcs",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "cpu",
+                            "mem"
+                        ],
+                        "type": "string",
+                        "description": "Key used to pick the heaviest processes",
+                        "name": "sortBy",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "json",
+                            "msgpack",
+                            "protobuf",
+                            "csv"
+                        ],
+                        "type": "string",
+                        "description": "Response format, overriding the Accept header",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated fields to include (cpuUsage, memUsage, diskUsage, netTraffic, processes); defaults to all",
+                        "name": "fields",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.SystemStats"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown node",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "No sample received yet",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/openapi.json": {
+            "get": {
+                "description": "Returns the OpenAPI 3.0 document of the API, for client code generators. It is converted from the Swagger 2.0 document served at /docs/doc.json; error responses are documented as text/plain.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "system"
+                ],
+                "summary": "Get the OpenAPI 3 spec",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/processes": {
+            "get": {
+                "description": "Returns the process table filtered by name, sorted by the given key, and paginated",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "processes"
+                ],
+                "summary": "List processes",
+                "parameters": [
+                    {
+                        "enum": [
+                            "pid",
+                            "name",
+                            "cpu",
+                            "mem",
+                            "fds",
+                            "threads"
+                        ],
+                        "type": "string",
+                        "description": "Sort key",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "description": "Sort order (defaults to desc for cpu/mem/fds/threads, asc otherwise)",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Case-insensitive substring match on process name",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "running",
+                            "sleep",
+                            "stop",
+                            "idle",
+                            "zombie",
+                            "wait",
+                            "lock"
+                        ],
+                        "type": "string",
+                        "description": "Only include processes with this status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Leave out the kernel threads of Linux",
+                        "name": "hideKernelThreads",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Leave out the zombie processes, counting them in zombies",
+                        "name": "collapseZombies",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of processes to return (0 for all)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of processes to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.ProcessList"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/processes/summary": {
+            "get": {
+                "description": "Groups processes by username or executable name with summed CPU percent, memory usage, and process counts",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "processes"
+                ],
+                "summary": "Get aggregated process usage",
+                "parameters": [
+                    {
+                        "enum": [
+                            "user",
+                            "name"
+                        ],
+                        "type": "string",
+                        "description": "Grouping key (defaults to name)",
+                        "name": "groupBy",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.ProcessSummary"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/processes/tree": {
+            "get": {
+                "description": "Returns processes nested by parent/child (PPID) relationship, suitable for rendering an htop-style tree",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "processes"
+                ],
+                "summary": "Get process tree",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.ProcessNode"
+                            }
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/processes/{pid}": {
+            "get": {
+                "description": "Returns full detail for a single process including command line, working directory, user, start time, status, threads, open files, memory breakdown, and I/O counters",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "processes"
+                ],
+                "summary": "Get process detail",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Process ID",
+                        "name": "pid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.ProcessDetail"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/processes/{pid}/connections": {
+            "get": {
+                "description": "Returns the sockets owned by a process with local and remote addresses, answering \"which process is talking to that IP\"",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "processes"
+                ],
+                "summary": "List network connections of a process",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Process ID",
+                        "name": "pid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.ProcessConnections"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/processes/{pid}/files": {
+            "get": {
+                "description": "Returns the file descriptors held open by a process and the paths they refer to, to help diagnose FD leaks",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "processes"
+                ],
+                "summary": "List open files of a process",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Process ID",
+                        "name": "pid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.ProcessFiles"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/processes/{pid}/priority": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Sets the nice value of a process. Requires the admin token; raising priority (lowering nice) usually also requires the server to run as root.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "processes"
+                ],
+                "summary": "Change process priority",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Process ID",
+                        "name": "pid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New nice value",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.PriorityRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.PriorityResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/processes/{pid}/signal": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Sends TERM, KILL, HUP, or another allowlisted signal to a process. Disabled unless signals.enabled is set in the config, and requires the admin token.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "processes"
+                ],
+                "summary": "Send a signal to a process",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Process ID",
+                        "name": "pid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Signal to send",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.SignalRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.SignalResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/query": {
+            "get": {
+                "description": "Computes an aggregate of a headline metric over the samples of the in-memory history taken within the window, so that thresholds and capacity can be assessed without exporting raw samples. Samples where the subsystem of the metric failed to collect are left out. memGrowth and diskFill are in bytes per minute, netThroughput in bytes per second.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "stats"
+                ],
+                "summary": "Aggregate a metric",
+                "parameters": [
+                    {
+                        "enum": [
+                            "cpuUsage",
+                            "memUsage",
+                            "memUsed",
+                            "memGrowth",
+                            "diskUsage",
+                            "diskUsed",
+                            "diskFill",
+                            "netTraffic",
+                            "netThroughput",
+                            "processCount",
+                            "cpuPressure",
+                            "memPressure",
+                            "ioPressure",
+                            "zfsDegradedPools",
+                            "zfsArcHitRate",
+                            "mdraidDegradedArrays"
+                        ],
+                        "type": "string",
+                        "description": "Metric to aggregate",
+                        "name": "metric",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Aggregation: min, max, avg, sum, count, last, stddev, or a percentile pNN such as p95 or p99.9 (default avg)",
+                        "name": "agg",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only aggregate the samples taken within this duration before now, e.g. 15m or 1h (default the whole history)",
+                        "name": "window",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.QueryResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/self": {
+            "get": {
+                "description": "Returns the server's own operational metrics: requests per route, connected SSE clients, and collection counts and durations. The same metrics are served in the Prometheus format at /metrics.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "system"
+                ],
+                "summary": "Get server self-telemetry",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.SelfStats"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/snapshots": {
+            "get": {
+                "description": "Returns the configured snapshot schedules with the number of retained snapshots and the times of the last and next ones",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "snapshots"
+                ],
+                "summary": "List snapshot schedules",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.SnapshotScheduleStatus"
+                            }
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/snapshots/{name}": {
+            "get": {
+                "description": "Returns the retained snapshots of a schedule, oldest first, optionally limited to a time range. Stats snapshots include every process.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "snapshots"
+                ],
+                "summary": "Get scheduled snapshots",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Schedule name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include snapshots taken at or after this RFC 3339 timestamp",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include snapshots taken at or before this RFC 3339 timestamp",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.Snapshot"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/stats": {
+            "get": {
+                "description": "Returns the most recently collected CPU, memory, disk usage, network traffic, and process information. The format is negotiated with the Accept header or the format parameter (JSON, MessagePack, Protobuf as described in proto/stats.proto, or CSV). The ETag identifies the sample along with the fields, topProcs, sortBy, and format, so pollers sending If-None-Match get 304 until a new sample is collected. With fresh=true a sample is collected on demand, and shared with the requests arriving within collector.cacheTTL; it has no ETag.",
+                "produces": [
+                    "application/json",
+                    "application/msgpack",
+                    "application/x-protobuf",
+                    "text/csv"
+                ],
+                "tags": [
+                    "stats"
+                ],
+                "summary": "Get current system statistics",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Only include the N heaviest processes (0 for all, up to processes.embeddedLimit)",
+                        "name": "topProcs",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "cpu",
+                            "mem"
+                        ],
+                        "type": "string",
+                        "description": "Key used to pick the heaviest processes",
+                        "name": "sortBy",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "json",
+                            "msgpack",
+                            "protobuf",
+                            "csv"
+                        ],
+                        "type": "string",
+                        "description": "Response format, overriding the Accept header",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated fields to include (cpuUsage, memUsage, diskUsage, netTraffic, processes); defaults to all",
+                        "name": "fields",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Collect a new sample instead of serving the latest one; concurrent fresh requests share one collection",
+                        "name": "fresh",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a previously returned sample",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.SystemStats"
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/version": {
+            "get": {
+                "description": "Returns the version, git commit, build date, Go version, and enabled collectors and sinks of the running binary",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "system"
+                ],
+                "summary": "Get build information",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.VersionInfo"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/watch": {
+            "get": {
+                "description": "Returns all registered process watches with their most recent point",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "watch"
+                ],
+                "summary": "List watches",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.Watch"
+                            }
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Registers a PID or process name pattern to be tracked on every tick. Requires the admin token.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "watch"
+                ],
+                "summary": "Register a watch",
+                "parameters": [
+                    {
+                        "description": "Watch to register",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.WatchTarget"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/server.Watch"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/watch/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Unregisters a watch and discards its history. Requires the admin token.",
+                "tags": [
+                    "watch"
+                ],
+                "summary": "Remove a watch",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Watch ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/watch/{id}/history": {
+            "get": {
+                "description": "Returns the per-tick time series of combined CPU and memory usage for the processes matched by a watch",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "watch"
+                ],
+                "summary": "Get watch history",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Watch ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.WatchHistory"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/zfs": {
+            "get": {
+                "description": "Returns the health of the imported ZFS pools with their scrub or resilver in progress or last finished, and the hit rate of the ARC, from the last sample. Pools that are not ONLINE are counted in degraded, which alert rules watch as the zfsDegradedPools metric. Scans are read from zpool status and left out when it is not installed. Only available on Linux hosts with the ZFS module loaded.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "stats"
+                ],
+                "summary": "Get ZFS pool health",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ZFSStats"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "models.ContainerResource": {
+            "description": "CPU or memory usage of a container, of the host and of its limit",
+            "type": "object",
+            "properties": {
+                "hostUsage": {
+                    "description": "HostUsage is the usage percentage of the whole host",
+                    "type": "number",
+                    "example": 35.5
+                },
+                "limit": {
+                    "description": "Limit is the CPU quota in cores or the memory limit in bytes, 0 when\nunlimited",
+                    "type": "number",
+                    "example": 0.5
+                },
+                "ofHost": {
+                    "description": "OfHost is the percentage of the host CPUs or memory used by the\ncontainer",
+                    "type": "number",
+                    "example": 2
+                },
+                "ofLimit": {
+                    "description": "OfLimit is the percentage of Limit used; unset when unlimited",
+                    "type": "number",
+                    "example": 96
+                },
+                "used": {
+                    "description": "Used is the CPU cores or memory bytes used by the container. The\ninactive page cache is not counted as used memory.",
+                    "type": "number",
+                    "example": 0.48
+                }
+            }
+        },
+        "models.Event": {
+            "description": "Envelope of every SSE event. For \"stats\" events data is a SystemStats (trimmed to the requested topics) and seq equals the SSE id; \"alert\" events carry the alert that changed state; \"error\" events carry an ErrorData; the final \"shutdown\" event carries a ShutdownData.",
+            "type": "object",
+            "properties": {
+                "data": {},
+                "host": {
+                    "type": "string",
+                    "example": "web-01"
+                },
+                "seq": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "timestamp": {
+                    "type": "string",
+                    "example": "2024-01-01T12:00:00Z"
+                }
+            }
+        },
+        "models.Filesystem": {
+            "description": "Usage of a monitored filesystem",
+            "type": "object",
+            "properties": {
+                "device": {
+                    "type": "string",
+                    "example": "/dev/nvme0n1p2"
+                },
+                "fstype": {
+                    "type": "string",
+                    "example": "ext4"
+                },
+                "mountpoint": {
+                    "description": "Mountpoint is where the filesystem is mounted, or the configured path\non it",
+                    "type": "string",
+                    "example": "/"
+                },
+                "network": {
+                    "description": "Network is set on network and FUSE filesystems, e.g. NFS or CIFS",
+                    "type": "boolean",
+                    "example": false
+                },
+                "stale": {
+                    "description": "Stale is set on a network filesystem whose usage could not be read in\ntime, e.g. an unreachable NFS server; its usage is left zero",
+                    "type": "boolean",
+                    "example": false
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 536870912000
+                },
+                "used": {
+                    "type": "integer",
+                    "example": 402653184000
+                },
+                "usedPercent": {
+                    "type": "number",
+                    "example": 75
+                }
+            }
+        },
+        "models.MDArray": {
+            "description": "State of a software RAID array",
+            "type": "object",
+            "properties": {
+                "active": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "degraded": {
+                    "description": "Degraded is set when members are missing or the array is inactive",
+                    "type": "boolean",
+                    "example": false
+                },
+                "disks": {
+                    "description": "Disks is the number of members of the array and Active the number\nworking",
+                    "type": "integer",
+                    "example": 2
+                },
+                "failed": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "level": {
+                    "description": "Level is e.g. raid1, raid5, or linear; inactive arrays have none",
+                    "type": "string",
+                    "example": "raid1"
+                },
+                "members": {
+                    "description": "Members are the member devices; Failed and Spare those marked (F)\nand (S)",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "sda1",
+                        "sdb1"
+                    ]
+                },
+                "name": {
+                    "type": "string",
+                    "example": "md0"
+                },
+                "spare": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "state": {
+                    "description": "State is active or inactive, followed by the read-only mode in\nparentheses if any, e.g. active (auto-read-only)",
+                    "type": "string",
+                    "example": "active"
+                },
+                "sync": {
+                    "description": "Sync is the resync, recovery, reshape, check, or repair in progress",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.MDSync"
+                        }
+                    ]
+                }
+            }
+        },
+        "models.MDRaidStats": {
+            "description": "State of the Linux software RAID (md) arrays",
+            "type": "object",
+            "properties": {
+                "arrays": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.MDArray"
+                    }
+                },
+                "degraded": {
+                    "description": "Degraded is the number of arrays missing members or inactive",
+                    "type": "integer",
+                    "example": 0
+                }
+            }
+        },
+        "models.MDSync": {
+            "description": "Sync operation in progress on a software RAID array",
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "example": "recovery"
+                },
+                "finish": {
+                    "description": "Finish is the remaining time estimated by the kernel, e.g. 90.1min",
+                    "type": "string",
+                    "example": "90.1min"
+                },
+                "pending": {
+                    "description": "Pending is set while the action waits for another array, as\nresync=DELAYED or resync=PENDING",
+                    "type": "boolean"
+                },
+                "progress": {
+                    "description": "Progress is the percentage done, 0 while the action is delayed or\npending",
+                    "type": "number",
+                    "example": 12.6
+                }
+            }
+        },
+        "models.ProcessInfo": {
+            "description": "Information about a single system process",
+            "type": "object",
+            "properties": {
+                "cpuPercent": {
+                    "description": "since the previous sample; 100 is one core",
+                    "type": "number",
+                    "example": 5.5
+                },
+                "involuntaryCtxSwitches": {
+                    "type": "integer",
+                    "example": 320
+                },
+                "kernelThread": {
+                    "description": "KernelThread is set on the kernel threads of Linux, e.g. kworker/0:1",
+                    "type": "boolean"
+                },
+                "memoryUsage": {
+                    "description": "in MB",
+                    "type": "number",
+                    "example": 256.5
+                },
+                "name": {
+                    "type": "string",
+                    "example": "chrome"
+                },
+                "numFds": {
+                    "type": "integer",
+                    "example": 64
+                },
+                "numThreads": {
+                    "type": "integer",
+                    "example": 24
+                },
+                "pid": {
+                    "type": "integer",
+                    "example": 1234
+                },
+                "ppid": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "status": {
+                    "type": "string",
+                    "example": "sleep"
+                },
+                "username": {
+                    "type": "string",
+                    "example": "user"
+                },
+                "voluntaryCtxSwitches": {
+                    "description": "Voluntary and involuntary context switches since the process started",
+                    "type": "integer",
+                    "example": 15000
+                }
+            }
+        },
+        "models.Rates": {
+            "description": "Rates of change since the previous sample",
+            "type": "object",
+            "properties": {
+                "diskFill": {
+                    "description": "DiskFill is the change of the used disk space in bytes per minute",
+                    "type": "number",
+                    "example": -52428800
+                },
+                "memGrowth": {
+                    "description": "MemGrowth is the change of the used memory in bytes per minute",
+                    "type": "number",
+                    "example": 1048576
+                },
+                "netThroughput": {
+                    "description": "NetThroughput is the network traffic in bytes per second",
+                    "type": "number",
+                    "example": 125000
+                }
+            }
+        },
+        "models.RuntimeInfo": {
+            "description": "Container detection, cgroup limits, and the usage of the container of the host and of its limits",
+            "type": "object",
+            "properties": {
+                "cgroupPath": {
+                    "type": "string",
+                    "example": "/"
+                },
+                "cgroupVersion": {
+                    "description": "CgroupVersion is 1 or 2, 0 when the cgroup cannot be read",
+                    "type": "integer",
+                    "example": 2
+                },
+                "container": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "cpu": {
+                    "description": "CPU and Memory are unset outside containers or when the cgroup cannot\nbe read",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.ContainerResource"
+                        }
+                    ]
+                },
+                "engine": {
+                    "description": "Engine is kubernetes, docker, podman, or the container environment\nvariable, e.g. lxc",
+                    "type": "string",
+                    "example": "kubernetes"
+                },
+                "memory": {
+                    "$ref": "#/definitions/models.ContainerResource"
+                }
+            }
+        },
+        "models.Sample": {
+            "description": "A collected snapshot of system statistics with its sequence number",
+            "type": "object",
+            "properties": {
+                "seq": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "stats": {
+                    "$ref": "#/definitions/models.SystemStats"
+                },
+                "timestamp": {
+                    "type": "string",
+                    "example": "2024-01-01T12:00:00Z"
+                }
+            }
+        },
+        "models.SystemStats": {
+            "description": "System resource usage statistics including CPU, memory, disk, network, and processes",
+            "type": "object",
+            "properties": {
+                "cpuUsage": {
+                    "type": "number",
+                    "example": 45.2
+                },
+                "diskUsage": {
+                    "type": "number",
+                    "example": 75
+                },
+                "diskUsed": {
+                    "type": "integer",
+                    "example": 107374182400
+                },
+                "errors": {
+                    "description": "Errors holds the error of each subsystem that failed to collect, by\ncollector name; the fields of those subsystems are left zero",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    },
+                    "example": {
+                        "disk": "permission denied"
+                    }
+                },
+                "extra": {
+                    "description": "Extra holds the values of collectors registered besides the built-in\nones, by collector name",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "filesystems": {
+                    "description": "Filesystems are the monitored filesystems; DiskUsage and DiskUsed are\nthose of the first",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Filesystem"
+                    }
+                },
+                "labels": {
+                    "description": "Labels are the labels configured on the host, e.g. env and role",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    },
+                    "example": {
+                        "env": "prod"
+                    }
+                },
+                "memUsage": {
+                    "type": "number",
+                    "example": 60.5
+                },
+                "memUsed": {
+                    "description": "MemUsed and DiskUsed are the used bytes of the memory and of the first\nmonitored filesystem, when reported by the collectors",
+                    "type": "integer",
+                    "example": 8589934592
+                },
+                "netTraffic": {
+                    "type": "integer",
+                    "example": 1048576
+                },
+                "processCount": {
+                    "description": "ProcessCount is the number of processes, which may be more than the\nprocesses listed when the list is capped",
+                    "type": "integer",
+                    "example": 312
+                },
+                "processes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ProcessInfo"
+                    }
+                },
+                "rates": {
+                    "description": "Rates are derived from the previous sample by the server; they are\nunset on the first sample",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Rates"
+                        }
+                    ]
+                },
+                "runtime": {
+                    "description": "Runtime tells whether the backend runs in a container, and the usage\nof the container relative to its limits and to the host; set with\ncpuUsage or memUsage",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.RuntimeInfo"
+                        }
+                    ]
+                },
+                "zombies": {
+                    "description": "Zombies is the number of zombie processes left out of Processes when\nprocesses.collapseZombies is set",
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "models.VersionInfo": {
+            "description": "Build and runtime information of the running binary",
+            "type": "object",
+            "properties": {
+                "buildDate": {
+                    "type": "string",
+                    "example": "2024-01-01T12:00:00Z"
+                },
+                "collectors": {
+                    "description": "Collectors lists the subsystems collected on every tick",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "cpu",
+                        "mem",
+                        "disk",
+                        "net",
+                        "processes"
+                    ]
+                },
+                "commit": {
+                    "type": "string",
+                    "example": "3b1f3e1"
+                },
+                "demo": {
+                    "description": "Demo is set when the server serves simulated stats",
+                    "type": "boolean",
+                    "example": false
+                },
+                "goVersion": {
+                    "type": "string",
+                    "example": "go1.22.5"
+                },
+                "platform": {
+                    "type": "string",
+                    "example": "linux/amd64"
+                },
+                "sinks": {
+                    "description": "Sinks lists the enabled push outputs",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "influxdb"
+                    ]
+                },
+                "version": {
+                    "type": "string",
+                    "example": "1.2.0"
+                }
+            }
+        },
+        "models.ZFSARC": {
+            "description": "Size and hit rate of the ZFS ARC",
+            "type": "object",
+            "properties": {
+                "hitRate": {
+                    "description": "HitRate is the percentage of the reads since boot served by the ARC",
+                    "type": "number",
+                    "example": 97.3
+                },
+                "hits": {
+                    "type": "integer",
+                    "example": 97300000
+                },
+                "misses": {
+                    "type": "integer",
+                    "example": 2700000
+                },
+                "size": {
+                    "description": "Size and TargetSize are in bytes",
+                    "type": "integer",
+                    "example": 8589934592
+                },
+                "targetSize": {
+                    "type": "integer",
+                    "example": 17179869184
+                }
+            }
+        },
+        "models.ZFSPool": {
+            "description": "Health of a ZFS pool and its last scan",
+            "type": "object",
+            "properties": {
+                "health": {
+                    "description": "Health is ONLINE, DEGRADED, FAULTED, OFFLINE, REMOVED, UNAVAIL, or\nSUSPENDED",
+                    "type": "string",
+                    "example": "ONLINE"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "tank"
+                },
+                "scan": {
+                    "description": "Scan is the scrub or resilver in progress or last finished, unset when\nnone ran or zpool is not installed",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.ZFSScan"
+                        }
+                    ]
+                }
+            }
+        },
+        "models.ZFSScan": {
+            "description": "Scrub or resilver of a ZFS pool",
+            "type": "object",
+            "properties": {
+                "errors": {
+                    "description": "Errors is the number of errors a finished scan found",
+                    "type": "integer",
+                    "example": 0
+                },
+                "function": {
+                    "description": "Function is scrub or resilver",
+                    "type": "string",
+                    "example": "scrub"
+                },
+                "progress": {
+                    "description": "Progress is the percentage done of a scan in progress",
+                    "type": "number",
+                    "example": 42.5
+                },
+                "state": {
+                    "description": "State is in progress, paused, finished, or canceled",
+                    "type": "string",
+                    "example": "in progress"
+                }
+            }
+        },
+        "models.ZFSStats": {
+            "description": "Health of the ZFS pools and ARC statistics",
+            "type": "object",
+            "properties": {
+                "arc": {
+                    "description": "ARC is unset when the ARC statistics cannot be read",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.ZFSARC"
+                        }
+                    ]
+                },
+                "degraded": {
+                    "description": "Degraded is the number of pools whose health is not ONLINE",
+                    "type": "integer",
+                    "example": 0
+                },
+                "pools": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ZFSPool"
+                    }
+                }
+            }
+        },
+        "server.Alert": {
+            "description": "An alert that fired, resolved, or is still firing",
+            "type": "object",
+            "properties": {
+                "fullAt": {
+                    "description": "FullAt is the projected time the disk fills up, for forecast rules",
+                    "type": "string",
+                    "example": "2024-01-03T02:15:00Z"
+                },
+                "group": {
+                    "type": "string",
+                    "example": "cpu"
+                },
+                "labels": {
+                    "description": "Labels are the labels configured on the host",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    },
+                    "example": {
+                        "env": "prod"
+                    }
+                },
+                "mean": {
+                    "description": "Mean, Stddev, and ZScore describe the baseline of anomaly rules",
+                    "type": "number",
+                    "example": 12.4
+                },
+                "message": {
+                    "type": "string",
+                    "example": "cpuUsage is 97.5, 27.4 standard deviations above its baseline of 12.4"
+                },
+                "metric": {
+                    "type": "string",
+                    "example": "cpuUsage"
+                },
+                "repeat": {
+                    "description": "Repeat is set when a firing alert is sent again after the repeat\ninterval of its rule",
+                    "type": "boolean",
+                    "example": false
+                },
+                "rule": {
+                    "type": "string",
+                    "example": "cpu-anomaly"
+                },
+                "since": {
+                    "description": "Since is when the condition started to hold, or stopped for resolved\nalerts",
+                    "type": "string",
+                    "example": "2024-01-01T12:00:00Z"
+                },
+                "state": {
+                    "description": "State is firing or resolved",
+                    "type": "string",
+                    "example": "firing"
+                },
+                "stddev": {
+                    "type": "number",
+                    "example": 3.1
+                },
+                "threshold": {
+                    "description": "Threshold is set for threshold rules",
+                    "type": "number",
+                    "example": 90
+                },
+                "timestamp": {
+                    "type": "string",
+                    "example": "2024-01-01T12:01:00Z"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "anomaly"
+                },
+                "value": {
+                    "type": "number",
+                    "example": 97.5
+                },
+                "zScore": {
+                    "type": "number",
+                    "example": 27.4
+                }
+            }
+        },
+        "server.AlertStatus": {
+            "description": "An alert rule with its current state",
+            "type": "object",
+            "properties": {
+                "baseline": {
+                    "description": "Baseline is how anomaly rules learn the usual values: ewma (the\ndefault), weighting values by their age with HalfLife, or window, the\nvalues of the last Window",
+                    "type": "string",
+                    "enum": [
+                        "ewma",
+                        "window"
+                    ],
+                    "example": "ewma"
+                },
+                "cooldown": {
+                    "type": "string",
+                    "example": "10m0s"
+                },
+                "direction": {
+                    "description": "Direction is the deviation that fires: above, below, or both (the\ndefault)",
+                    "type": "string",
+                    "enum": [
+                        "above",
+                        "below",
+                        "both"
+                    ],
+                    "example": "above"
+                },
+                "for": {
+                    "type": "string",
+                    "example": "1m0s"
+                },
+                "group": {
+                    "description": "Group names a set of rules alerting on the same problem, e.g. a\nwarning and a critical threshold. While a rule of the group fires, the\nothers fire and resolve without being sent.",
+                    "type": "string",
+                    "example": "cpu"
+                },
+                "halfLife": {
+                    "type": "string",
+                    "example": "1h0m0s"
+                },
+                "last": {
+                    "description": "Last is the last evaluation, unset before the first",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/server.Alert"
+                        }
+                    ]
+                },
+                "method": {
+                    "type": "string",
+                    "enum": [
+                        "linear",
+                        "holt"
+                    ],
+                    "example": "linear"
+                },
+                "metric": {
+                    "type": "string",
+                    "example": "cpuUsage"
+                },
+                "minDeviation": {
+                    "description": "MinDeviation is a floor of the standard deviation, in the unit of the\nmetric, so that nearly constant metrics do not fire on tiny changes",
+                    "type": "number",
+                    "example": 2
+                },
+                "minSamples": {
+                    "description": "MinSamples is the number of values learned before the rule may fire\n(default 30)",
+                    "type": "integer",
+                    "example": 30
+                },
+                "name": {
+                    "type": "string",
+                    "example": "cpu-anomaly"
+                },
+                "op": {
+                    "description": "Op and Value are the condition of threshold rules, e.g. \u003e 90",
+                    "type": "string",
+                    "enum": [
+                        "\u003e",
+                        "\u003e=",
+                        "\u003c",
+                        "\u003c="
+                    ],
+                    "example": "\u003e"
+                },
+                "repeat": {
+                    "type": "string",
+                    "example": "1h0m0s"
+                },
+                "resolve": {
+                    "description": "Resolve is the threshold a firing threshold rule must cross back to\nresolve, e.g. 80 for \u003e 90 (default Value), so that a metric hovering\naround Value does not flap",
+                    "type": "number",
+                    "example": 80
+                },
+                "resolveZScore": {
+                    "type": "number",
+                    "example": 2
+                },
+                "seasonal": {
+                    "description": "Seasonal learns a separate ewma baseline for every hour of the day\n(local time), so that e.g. a nightly backup is usual at 3am only",
+                    "type": "boolean",
+                    "example": true
+                },
+                "since": {
+                    "description": "Since is when the rule entered its state",
+                    "type": "string",
+                    "example": "2024-01-01T12:00:00Z"
+                },
+                "state": {
+                    "description": "State is ok, pending, or firing",
+                    "type": "string",
+                    "example": "ok"
+                },
+                "type": {
+                    "description": "Type is threshold (the default), anomaly, or forecast",
+                    "type": "string",
+                    "enum": [
+                        "threshold",
+                        "anomaly",
+                        "forecast"
+                    ],
+                    "example": "anomaly"
+                },
+                "value": {
+                    "type": "number",
+                    "example": 90
+                },
+                "window": {
+                    "type": "string",
+                    "example": "1h0m0s"
+                },
+                "within": {
+                    "type": "string",
+                    "example": "48h0m0s"
+                },
+                "zScore": {
+                    "description": "ZScore is the number of standard deviations from the mean at which\nanomaly rules fire (default 3), and ResolveZScore the one under which\nthey resolve (default ZScore)",
+                    "type": "number",
+                    "example": 3
+                }
+            }
+        },
+        "server.AuditEntry": {
+            "description": "An admin action with its principal and outcome",
+            "type": "object",
+            "properties": {
+                "action": {
+                    "description": "Action names the admin action, e.g. process.signal",
+                    "type": "string",
+                    "example": "process.signal"
+                },
+                "clientCN": {
+                    "description": "ClientCN is the common name of the client certificate, with mutual TLS",
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Error is the start of the response of an action that did not succeed",
+                    "type": "string"
+                },
+                "method": {
+                    "type": "string",
+                    "example": "POST"
+                },
+                "outcome": {
+                    "description": "Outcome is success, denied, or failure",
+                    "type": "string",
+                    "example": "success"
+                },
+                "path": {
+                    "type": "string",
+                    "example": "/api/processes/1234/signal"
+                },
+                "principal": {
+                    "description": "Principal names the client: admin for the admin token, the name of an\nauth token, or the basic authentication user. It is empty when the\nrequest carried no valid credentials.",
+                    "type": "string",
+                    "example": "ops"
+                },
+                "remoteIP": {
+                    "type": "string",
+                    "example": "10.0.0.12"
+                },
+                "request": {
+                    "description": "Request is the JSON body of the request",
+                    "type": "object"
+                },
+                "requestID": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string",
+                    "example": "admin"
+                },
+                "status": {
+                    "type": "integer",
+                    "example": 200
+                },
+                "timestamp": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.Comparison": {
+            "description": "Headline metrics averaged over the current span and over the same span one window ago",
+            "type": "object",
+            "properties": {
+                "current": {
+                    "description": "Current and Previous are the ends of the compared spans",
+                    "type": "string",
+                    "example": "2024-01-02T12:00:00Z"
+                },
+                "metrics": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/server.MetricComparison"
+                    }
+                },
+                "previous": {
+                    "type": "string",
+                    "example": "2024-01-01T12:00:00Z"
+                },
+                "span": {
+                    "type": "string",
+                    "example": "5m0s"
+                },
+                "window": {
+                    "type": "string",
+                    "example": "24h0m0s"
+                }
+            }
+        },
+        "server.Connection": {
+            "description": "A network socket owned by a process",
+            "type": "object",
+            "properties": {
+                "fd": {
+                    "type": "integer",
+                    "example": 12
+                },
+                "localAddr": {
+                    "type": "string",
+                    "example": "10.0.0.5:51234"
+                },
+                "protocol": {
+                    "type": "string",
+                    "example": "tcp"
+                },
+                "remoteAddr": {
+                    "type": "string",
+                    "example": "93.184.216.34:443"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "ESTABLISHED"
+                }
+            }
+        },
+        "server.DiskForecast": {
+            "description": "Projected fill of a filesystem from the trend of its usage",
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "string",
+                    "example": "2024-01-01T06:00:00Z"
+                },
+                "fullAt": {
+                    "description": "FullAt and HoursToFull are unset when the usage is not growing or would\ntake over a century to fill the filesystem",
+                    "type": "string",
+                    "example": "2024-01-03T02:15:00Z"
+                },
+                "hoursToFull": {
+                    "type": "number",
+                    "example": 46.2
+                },
+                "method": {
+                    "type": "string",
+                    "example": "linear"
+                },
+                "mountpoint": {
+                    "type": "string",
+                    "example": "/"
+                },
+                "samples": {
+                    "description": "Samples is the number of samples the trend was fitted on; the other\nfields are unset with fewer than two",
+                    "type": "integer",
+                    "example": 1800
+                },
+                "to": {
+                    "type": "string",
+                    "example": "2024-01-01T12:00:00Z"
+                },
+                "trend": {
+                    "description": "Trend is the change of the usage in percentage points per hour",
+                    "type": "number",
+                    "example": 0.4
+                },
+                "usage": {
+                    "description": "Usage is the fitted usage percentage at To",
+                    "type": "number",
+                    "example": 81.5
+                }
+            }
+        },
+        "server.FleetStats": {
+            "description": "Latest stats of every node with fleet-wide totals. Nodes that sent nothing within aggregator.nodeTimeout are listed as stale and left out of the totals.",
+            "type": "object",
+            "properties": {
+                "cpuUsage": {
+                    "description": "CPUUsage, MemUsage, and DiskUsage are averaged over the live nodes",
+                    "type": "number",
+                    "example": 45.2
+                },
+                "diskUsage": {
+                    "type": "number",
+                    "example": 75
+                },
+                "memUsage": {
+                    "type": "number",
+                    "example": 60.5
+                },
+                "netTraffic": {
+                    "description": "NetTraffic and ProcessCount are summed over the live nodes",
+                    "type": "integer",
+                    "example": 3145728
+                },
+                "nodes": {
+                    "description": "Nodes is the number of live nodes the totals cover",
+                    "type": "integer",
+                    "example": 3
+                },
+                "processCount": {
+                    "type": "integer",
+                    "example": 936
+                },
+                "stale": {
+                    "description": "Stale lists the nodes left out of the totals",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "stats": {
+                    "description": "Stats holds the latest stats of every node, by node name",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/models.SystemStats"
+                    }
+                }
+            }
+        },
+        "server.GrafanaAnnotation": {
+            "description": "Event shown on Grafana graphs",
+            "type": "object",
+            "properties": {
+                "text": {
+                    "type": "string",
+                    "example": "cpuUsage above 90"
+                },
+                "time": {
+                    "type": "integer",
+                    "example": 1704110400000
+                },
+                "title": {
+                    "type": "string",
+                    "example": "CPU high"
+                }
+            }
+        },
+        "server.GrafanaAnnotationRequest": {
+            "description": "Annotations request sent by the Grafana JSON datasource",
+            "type": "object",
+            "properties": {
+                "range": {
+                    "$ref": "#/definitions/server.GrafanaRange"
+                }
+            }
+        },
+        "server.GrafanaQueryRequest": {
+            "description": "Query request sent by the Grafana JSON datasource",
+            "type": "object",
+            "properties": {
+                "maxDataPoints": {
+                    "type": "integer",
+                    "example": 500
+                },
+                "range": {
+                    "$ref": "#/definitions/server.GrafanaRange"
+                },
+                "targets": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.GrafanaTarget"
+                    }
+                }
+            }
+        },
+        "server.GrafanaRange": {
+            "description": "Time range of a Grafana query",
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "string",
+                    "example": "2024-01-01T12:00:00Z"
+                },
+                "to": {
+                    "type": "string",
+                    "example": "2024-01-01T13:00:00Z"
+                }
+            }
+        },
+        "server.GrafanaSearchRequest": {
+            "description": "Metric search request sent by the Grafana JSON datasource",
+            "type": "object",
+            "properties": {
+                "target": {
+                    "type": "string",
+                    "example": "cpu"
+                }
+            }
+        },
+        "server.GrafanaTarget": {
+            "description": "Metric requested by a Grafana query",
+            "type": "object",
+            "properties": {
+                "target": {
+                    "type": "string",
+                    "example": "cpuUsage"
+                },
+                "type": {
+                    "description": "\"timeserie\" (default) or \"table\"",
+                    "type": "string",
+                    "example": "timeserie"
+                }
+            }
+        },
+        "server.GrafanaTimeSeries": {
+            "description": "Time series of one target as [value, unix milliseconds] pairs",
+            "type": "object",
+            "properties": {
+                "datapoints": {
+                    "type": "array",
+                    "items": {
+                        "type": "array",
+                        "items": {
+                            "type": "number"
+                        }
+                    }
+                },
+                "target": {
+                    "type": "string",
+                    "example": "cpuUsage"
+                }
+            }
+        },
+        "server.IONiceInfo": {
+            "description": "I/O scheduling class and level of a process (Linux only)",
+            "type": "object",
+            "properties": {
+                "class": {
+                    "type": "string",
+                    "example": "best-effort"
+                },
+                "level": {
+                    "type": "integer",
+                    "example": 4
+                }
+            }
+        },
+        "server.MetricComparison": {
+            "description": "A metric averaged over the current span and over the same span one window ago",
+            "type": "object",
+            "properties": {
+                "current": {
+                    "description": "Current and Previous are null when their span holds no samples",
+                    "type": "number",
+                    "example": 45.2
+                },
+                "delta": {
+                    "description": "Delta is Current minus Previous",
+                    "type": "number",
+                    "example": 15.1
+                },
+                "deltaPercent": {
+                    "description": "DeltaPercent is Delta relative to Previous, unset when Previous is 0",
+                    "type": "number",
+                    "example": 50.17
+                },
+                "previous": {
+                    "type": "number",
+                    "example": 30.1
+                }
+            }
+        },
+        "server.NodeRegistration": {
+            "description": "Registration of an agent with the aggregator",
+            "type": "object",
+            "properties": {
+                "hostname": {
+                    "type": "string",
+                    "example": "web-01"
+                },
+                "version": {
+                    "$ref": "#/definitions/models.VersionInfo"
+                }
+            }
+        },
+        "server.NodeSummary": {
+            "description": "A node known to the aggregator with its headline metrics. Health is healthy, degraded (some subsystems failed to collect), stale (nothing received within aggregator.nodeTimeout), or pending (registered but no sample yet). The metrics are omitted until a sample is received.",
+            "type": "object",
+            "properties": {
+                "cpuUsage": {
+                    "type": "number",
+                    "example": 45.2
+                },
+                "diskUsage": {
+                    "type": "number",
+                    "example": 75
+                },
+                "health": {
+                    "type": "string",
+                    "enum": [
+                        "healthy",
+                        "degraded",
+                        "stale",
+                        "pending"
+                    ],
+                    "example": "healthy"
+                },
+                "hostname": {
+                    "type": "string",
+                    "example": "web-01.example.com"
+                },
+                "labels": {
+                    "description": "Labels are the host labels of the latest sample",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    },
+                    "example": {
+                        "env": "prod"
+                    }
+                },
+                "lastSeen": {
+                    "type": "string",
+                    "example": "2024-01-01T12:00:00Z"
+                },
+                "local": {
+                    "description": "Local is set for the aggregator's own host",
+                    "type": "boolean",
+                    "example": false
+                },
+                "memUsage": {
+                    "type": "number",
+                    "example": 60.5
+                },
+                "name": {
+                    "type": "string",
+                    "example": "web-01"
+                },
+                "registered": {
+                    "type": "string",
+                    "example": "2024-01-01T11:00:00Z"
+                },
+                "sampleTime": {
+                    "description": "SampleTime is the timestamp of the latest sample",
+                    "type": "string",
+                    "example": "2024-01-01T12:00:00Z"
+                },
+                "version": {
+                    "type": "string",
+                    "example": "1.2.0"
+                }
+            }
+        },
+        "server.OpenFile": {
+            "description": "A file descriptor held open by a process",
+            "type": "object",
+            "properties": {
+                "fd": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "path": {
+                    "type": "string",
+                    "example": "/var/log/app.log"
+                }
+            }
+        },
+        "server.PriorityRequest": {
+            "description": "New nice value for a process, from -20 (highest priority) to 19 (lowest)",
+            "type": "object",
+            "properties": {
+                "nice": {
+                    "type": "integer",
+                    "example": 10
+                }
+            }
+        },
+        "server.PriorityResult": {
+            "description": "Outcome of changing the nice value of a process",
+            "type": "object",
+            "properties": {
+                "nice": {
+                    "type": "integer",
+                    "example": 10
+                },
+                "pid": {
+                    "type": "integer",
+                    "example": 1234
+                }
+            }
+        },
+        "server.ProcessConnections": {
+            "description": "Network connections owned by a single process",
+            "type": "object",
+            "properties": {
+                "connections": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.Connection"
+                    }
+                },
+                "count": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "pid": {
+                    "type": "integer",
+                    "example": 1234
+                }
+            }
+        },
+        "server.ProcessDetail": {
+            "description": "Detailed information about a single system process",
+            "type": "object",
+            "properties": {
+                "cmdline": {
+                    "type": "string",
+                    "example": "/usr/bin/chrome --type=renderer"
+                },
+                "cpuPercent": {
+                    "type": "number",
+                    "example": 5.5
+                },
+                "cwd": {
+                    "type": "string",
+                    "example": "/home/user"
+                },
+                "involuntaryCtxSwitches": {
+                    "type": "integer",
+                    "example": 320
+                },
+                "io": {
+                    "$ref": "#/definitions/server.ProcessIOStat"
+                },
+                "ionice": {
+                    "$ref": "#/definitions/server.IONiceInfo"
+                },
+                "memory": {
+                    "$ref": "#/definitions/server.ProcessMemory"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "chrome"
+                },
+                "nice": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "numThreads": {
+                    "type": "integer",
+                    "example": 24
+                },
+                "openFiles": {
+                    "type": "integer",
+                    "example": 128
+                },
+                "pid": {
+                    "type": "integer",
+                    "example": 1234
+                },
+                "ppid": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "startTime": {
+                    "type": "string",
+                    "example": "2024-01-01T12:00:00Z"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "sleep"
+                },
+                "username": {
+                    "type": "string",
+                    "example": "user"
+                },
+                "voluntaryCtxSwitches": {
+                    "description": "Voluntary and involuntary context switches since the process started",
+                    "type": "integer",
+                    "example": 15000
+                }
+            }
+        },
+        "server.ProcessFiles": {
+            "description": "Open files of a single process",
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.OpenFile"
+                    }
+                },
+                "pid": {
+                    "type": "integer",
+                    "example": 1234
+                }
+            }
+        },
+        "server.ProcessGroup": {
+            "description": "Summed resource usage of all processes sharing a user or executable name",
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer",
+                    "example": 14
+                },
+                "cpuPercent": {
+                    "type": "number",
+                    "example": 12.5
+                },
+                "key": {
+                    "type": "string",
+                    "example": "nginx"
+                },
+                "memoryUsage": {
+                    "description": "in MB",
+                    "type": "number",
+                    "example": 3276.8
+                }
+            }
+        },
+        "server.ProcessIOStat": {
+            "description": "I/O counters of a process",
+            "type": "object",
+            "properties": {
+                "readBytes": {
+                    "type": "integer",
+                    "example": 1048576
+                },
+                "readCount": {
+                    "type": "integer",
+                    "example": 1500
+                },
+                "writeBytes": {
+                    "type": "integer",
+                    "example": 524288
+                },
+                "writeCount": {
+                    "type": "integer",
+                    "example": 300
+                }
+            }
+        },
+        "server.ProcessList": {
+            "description": "A filtered, sorted, and paginated page of the process table",
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer",
+                    "example": 20
+                },
+                "offset": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "processes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ProcessInfo"
+                    }
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 312
+                },
+                "zombies": {
+                    "description": "Zombies is the number of zombie processes left out with\ncollapseZombies",
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "server.ProcessMemory": {
+            "description": "Memory breakdown of a process in MB",
+            "type": "object",
+            "properties": {
+                "rss": {
+                    "description": "in MB",
+                    "type": "number",
+                    "example": 256.5
+                },
+                "swap": {
+                    "description": "in MB",
+                    "type": "number",
+                    "example": 0
+                },
+                "vms": {
+                    "description": "in MB",
+                    "type": "number",
+                    "example": 1024
+                }
+            }
+        },
+        "server.ProcessNode": {
+            "description": "A process with its child processes nested beneath it",
+            "type": "object",
+            "properties": {
+                "children": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.ProcessNode"
+                    }
+                },
+                "cpuPercent": {
+                    "description": "since the previous sample; 100 is one core",
+                    "type": "number",
+                    "example": 5.5
+                },
+                "involuntaryCtxSwitches": {
+                    "type": "integer",
+                    "example": 320
+                },
+                "kernelThread": {
+                    "description": "KernelThread is set on the kernel threads of Linux, e.g. kworker/0:1",
+                    "type": "boolean"
+                },
+                "memoryUsage": {
+                    "description": "in MB",
+                    "type": "number",
+                    "example": 256.5
+                },
+                "name": {
+                    "type": "string",
+                    "example": "chrome"
+                },
+                "numFds": {
+                    "type": "integer",
+                    "example": 64
+                },
+                "numThreads": {
+                    "type": "integer",
+                    "example": 24
+                },
+                "pid": {
+                    "type": "integer",
+                    "example": 1234
+                },
+                "ppid": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "status": {
+                    "type": "string",
+                    "example": "sleep"
+                },
+                "username": {
+                    "type": "string",
+                    "example": "user"
+                },
+                "voluntaryCtxSwitches": {
+                    "description": "Voluntary and involuntary context switches since the process started",
+                    "type": "integer",
+                    "example": 15000
+                }
+            }
+        },
+        "server.ProcessSummary": {
+            "description": "Processes aggregated by user or executable name, ordered by memory usage",
+            "type": "object",
+            "properties": {
+                "groupBy": {
+                    "type": "string",
+                    "example": "name"
+                },
+                "groups": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.ProcessGroup"
+                    }
+                }
+            }
+        },
+        "server.QueryResult": {
+            "description": "Aggregate of a metric over the samples of a window of the history",
+            "type": "object",
+            "properties": {
+                "agg": {
+                    "type": "string",
+                    "example": "p95"
+                },
+                "from": {
+                    "description": "From and To are the timestamps of the oldest and newest samples\naggregated; From is later than the start of the window when the\nhistory does not reach that far back",
+                    "type": "string",
+                    "example": "2024-01-01T11:00:00Z"
+                },
+                "metric": {
+                    "type": "string",
+                    "example": "cpuUsage"
+                },
+                "samples": {
+                    "type": "integer",
+                    "example": 1800
+                },
+                "to": {
+                    "type": "string",
+                    "example": "2024-01-01T12:00:00Z"
+                },
+                "value": {
+                    "description": "Value is null when the window holds no samples",
+                    "type": "number",
+                    "example": 72.5
+                },
+                "window": {
+                    "description": "Window is the requested window, empty for the whole history",
+                    "type": "string",
+                    "example": "1h0m0s"
+                }
+            }
+        },
+        "server.RouteStats": {
+            "description": "Requests served by one route and method",
+            "type": "object",
+            "properties": {
+                "avgLatencyMs": {
+                    "type": "number",
+                    "example": 1.8
+                },
+                "codes": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "count": {
+                    "type": "integer",
+                    "example": 1200
+                },
+                "maxLatencyMs": {
+                    "type": "number",
+                    "example": 35.2
+                },
+                "method": {
+                    "type": "string",
+                    "example": "GET"
+                },
+                "route": {
+                    "type": "string",
+                    "example": "/api/stats"
+                }
+            }
+        },
+        "server.SelfStats": {
+            "description": "Operational metrics of the server itself",
+            "type": "object",
+            "properties": {
+                "avgCollectionMs": {
+                    "type": "number",
+                    "example": 40.1
+                },
+                "collectionErrors": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "collections": {
+                    "type": "integer",
+                    "example": 1800
+                },
+                "lastCollectionMs": {
+                    "type": "number",
+                    "example": 42.5
+                },
+                "maxCollectionMs": {
+                    "type": "number",
+                    "example": 120.3
+                },
+                "requests": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.RouteStats"
+                    }
+                },
+                "sinks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.SinkStats"
+                    }
+                },
+                "sseClients": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "uptimeSeconds": {
+                    "type": "number",
+                    "example": 3600
+                }
+            }
+        },
+        "server.SignalRequest": {
+            "description": "Signal to send to a process",
+            "type": "object",
+            "properties": {
+                "signal": {
+                    "type": "string",
+                    "example": "TERM"
+                }
+            }
+        },
+        "server.SignalResult": {
+            "description": "Outcome of sending a signal to a process",
+            "type": "object",
+            "properties": {
+                "pid": {
+                    "type": "integer",
+                    "example": 1234
+                },
+                "sent": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "signal": {
+                    "type": "string",
+                    "example": "TERM"
+                }
+            }
+        },
+        "server.SinkStats": {
+            "description": "Samples handed to one sink since the server started",
+            "type": "object",
+            "properties": {
+                "dropped": {
+                    "description": "Dropped samples were skipped because the sink was still busy",
+                    "type": "integer",
+                    "example": 0
+                },
+                "failed": {
+                    "description": "Failed samples were part of writes that failed",
+                    "type": "integer",
+                    "example": 2
+                },
+                "sink": {
+                    "type": "string",
+                    "example": "kafka"
+                },
+                "written": {
+                    "description": "Written samples were accepted by the sink's destination",
+                    "type": "integer",
+                    "example": 1800
+                }
+            }
+        },
+        "server.Snapshot": {
+            "description": "Data captured by a snapshot schedule: full stats or the socket table",
+            "type": "object",
+            "properties": {
+                "connections": {
+                    "description": "Connections is set by connections snapshots",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.SocketConnection"
+                    }
+                },
+                "schedule": {
+                    "type": "string",
+                    "example": "hourly-connections"
+                },
+                "stats": {
+                    "description": "Stats is set by stats snapshots, with every process",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.SystemStats"
+                        }
+                    ]
+                },
+                "timestamp": {
+                    "type": "string",
+                    "example": "2024-01-01T12:00:00Z"
+                }
+            }
+        },
+        "server.SnapshotScheduleStatus": {
+            "description": "A snapshot schedule with the times of its last and next snapshots",
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "keep": {
+                    "description": "Keep is the number of snapshots retained (0 means 24)",
+                    "type": "integer",
+                    "example": 24
+                },
+                "kind": {
+                    "description": "Kind is stats or connections",
+                    "type": "string",
+                    "enum": [
+                        "stats",
+                        "connections"
+                    ],
+                    "example": "connections"
+                },
+                "last": {
+                    "type": "string",
+                    "example": "2024-01-01T12:00:00Z"
+                },
+                "lastError": {
+                    "description": "LastError is the error of the last attempt, cleared by the next\nsuccessful one",
+                    "type": "string",
+                    "example": ""
+                },
+                "name": {
+                    "description": "Name identifies the schedule in /api/snapshots/{name}",
+                    "type": "string",
+                    "example": "hourly-connections"
+                },
+                "next": {
+                    "type": "string",
+                    "example": "2024-01-01T13:00:00Z"
+                },
+                "schedule": {
+                    "description": "Schedule is a five-field cron expression in local time, or a macro\nsuch as @hourly",
+                    "type": "string",
+                    "example": "0 * * * *"
+                }
+            }
+        },
+        "server.SocketConnection": {
+            "description": "A network socket and its owning process",
+            "type": "object",
+            "properties": {
+                "fd": {
+                    "type": "integer",
+                    "example": 12
+                },
+                "localAddr": {
+                    "type": "string",
+                    "example": "10.0.0.5:51234"
+                },
+                "pid": {
+                    "description": "PID is 0 when the owner is unknown, e.g. for sockets of other users\nwhen not running as root",
+                    "type": "integer",
+                    "example": 1234
+                },
+                "protocol": {
+                    "type": "string",
+                    "example": "tcp"
+                },
+                "remoteAddr": {
+                    "type": "string",
+                    "example": "93.184.216.34:443"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "ESTABLISHED"
+                }
+            }
+        },
+        "server.Watch": {
+            "description": "A registered watch with its most recent point",
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string",
+                    "example": "nginx"
+                },
+                "latest": {
+                    "$ref": "#/definitions/server.WatchPoint"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "^nginx"
+                },
+                "pid": {
+                    "type": "integer",
+                    "example": 0
+                }
+            }
+        },
+        "server.WatchHistory": {
+            "description": "Recorded time series of a watch, oldest first",
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string",
+                    "example": "nginx"
+                },
+                "points": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.WatchPoint"
+                    }
+                }
+            }
+        },
+        "server.WatchPoint": {
+            "description": "Combined usage of the processes matched by a watch at one point in time",
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer",
+                    "example": 4
+                },
+                "cpuPercent": {
+                    "type": "number",
+                    "example": 12.5
+                },
+                "memoryUsage": {
+                    "description": "in MB",
+                    "type": "number",
+                    "example": 512
+                },
+                "timestamp": {
+                    "type": "string",
+                    "example": "2024-01-01T12:00:00Z"
+                }
+            }
+        },
+        "server.WatchTarget": {
+            "description": "Processes tracked by a watch, selected by PID or name pattern",
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string",
+                    "example": "nginx"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "^nginx"
+                },
+                "pid": {
+                    "type": "integer",
+                    "example": 0
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "AdminToken": {
+            "description": "Token of the admin role (admin.token or an auth.tokens entry) sent as \"Bearer \u003ctoken\u003e\"",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        },
+        "AgentToken": {
+            "description": "Aggregator token sent by agents as \"Bearer \u003ctoken\u003e\"",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
@@ -130,7 +4042,7 @@ var SwaggerInfo = &swag.Spec{
 	BasePath:         "/api",
 	Schemes:          []string{},
 	Title:            "System Stats API",
-	Description:      "Information about a single system process",
+	Description:      "API for monitoring system resources and processes",
 	InfoInstanceName: "swagger",
 	SwaggerTemplate:  docTemplate,
 	LeftDelim:        "{{",
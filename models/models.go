@@ -0,0 +1,343 @@
+// Package models holds the payloads of the system stats API, shared by the
+// collectors, the server, and the client.
+package models
+
+import "time"
+
+// SystemStats represents system resource usage statistics
+// @Description System resource usage statistics including CPU, memory, disk, network, and processes
+type SystemStats struct {
+	CPUUsage   float64 `json:"cpuUsage" example:"45.2"`
+	MemUsage   float64 `json:"memUsage" example:"60.5"`
+	DiskUsage  float64 `json:"diskUsage" example:"75.0"`
+	NetTraffic int64   `json:"netTraffic" example:"1048576"`
+	// MemUsed and DiskUsed are the used bytes of the memory and of the first
+	// monitored filesystem, when reported by the collectors
+	MemUsed  uint64 `json:"memUsed,omitempty" example:"8589934592"`
+	DiskUsed uint64 `json:"diskUsed,omitempty" example:"107374182400"`
+	// Filesystems are the monitored filesystems; DiskUsage and DiskUsed are
+	// those of the first
+	Filesystems []Filesystem  `json:"filesystems,omitempty"`
+	Processes   []ProcessInfo `json:"processes"`
+	// ProcessCount is the number of processes, which may be more than the
+	// processes listed when the list is capped
+	ProcessCount int `json:"processCount,omitempty" example:"312"`
+	// Zombies is the number of zombie processes left out of Processes when
+	// processes.collapseZombies is set
+	Zombies int `json:"zombies,omitempty" example:"2"`
+	// Extra holds the values of collectors registered besides the built-in
+	// ones, by collector name
+	Extra map[string]interface{} `json:"extra,omitempty"`
+	// Errors holds the error of each subsystem that failed to collect, by
+	// collector name; the fields of those subsystems are left zero
+	Errors map[string]string `json:"errors,omitempty" example:"disk:permission denied"`
+	// Labels are the labels configured on the host, e.g. env and role
+	Labels map[string]string `json:"labels,omitempty" example:"env:prod"`
+	// Rates are derived from the previous sample by the server; they are
+	// unset on the first sample
+	Rates *Rates `json:"rates,omitempty"`
+	// Runtime tells whether the backend runs in a container, and the usage
+	// of the container relative to its limits and to the host; set with
+	// cpuUsage or memUsage
+	Runtime *RuntimeInfo `json:"runtime,omitempty"`
+}
+
+// Rates are metrics derived from the change since the previous sample. A rate
+// is 0 when its subsystem failed in either sample.
+// @Description Rates of change since the previous sample
+type Rates struct {
+	// MemGrowth is the change of the used memory in bytes per minute
+	MemGrowth float64 `json:"memGrowth" example:"1048576"`
+	// DiskFill is the change of the used disk space in bytes per minute
+	DiskFill float64 `json:"diskFill" example:"-52428800"`
+	// NetThroughput is the network traffic in bytes per second
+	NetThroughput float64 `json:"netThroughput" example:"125000"`
+}
+
+// RuntimeInfo describes the environment of the backend: whether it runs in
+// a container, the cgroup limits detected, and the usage of the container
+// both as a share of the host and of its limits. When collector.cgroup.
+// relative is set, CPUUsage, MemUsage, and MemUsed of SystemStats are those
+// of the container.
+// @Description Container detection, cgroup limits, and the usage of the container of the host and of its limits
+type RuntimeInfo struct {
+	Container bool `json:"container" example:"true"`
+	// Engine is kubernetes, docker, podman, or the container environment
+	// variable, e.g. lxc
+	Engine string `json:"engine,omitempty" example:"kubernetes"`
+	// CgroupVersion is 1 or 2, 0 when the cgroup cannot be read
+	CgroupVersion int    `json:"cgroupVersion,omitempty" example:"2"`
+	CgroupPath    string `json:"cgroupPath,omitempty" example:"/"`
+	// CPU and Memory are unset outside containers or when the cgroup cannot
+	// be read
+	CPU    *ContainerResource `json:"cpu,omitempty"`
+	Memory *ContainerResource `json:"memory,omitempty"`
+}
+
+// ContainerResource is the usage of CPU or memory by a container
+// @Description CPU or memory usage of a container, of the host and of its limit
+type ContainerResource struct {
+	// Limit is the CPU quota in cores or the memory limit in bytes, 0 when
+	// unlimited
+	Limit float64 `json:"limit" example:"0.5"`
+	// Used is the CPU cores or memory bytes used by the container. The
+	// inactive page cache is not counted as used memory.
+	Used float64 `json:"used" example:"0.48"`
+	// OfLimit is the percentage of Limit used; unset when unlimited
+	OfLimit *float64 `json:"ofLimit,omitempty" example:"96"`
+	// OfHost is the percentage of the host CPUs or memory used by the
+	// container
+	OfHost float64 `json:"ofHost" example:"2"`
+	// HostUsage is the usage percentage of the whole host
+	HostUsage float64 `json:"hostUsage" example:"35.5"`
+}
+
+// Filesystem is the usage of a monitored filesystem
+// @Description Usage of a monitored filesystem
+type Filesystem struct {
+	// Mountpoint is where the filesystem is mounted, or the configured path
+	// on it
+	Mountpoint  string  `json:"mountpoint" example:"/"`
+	Device      string  `json:"device,omitempty" example:"/dev/nvme0n1p2"`
+	Fstype      string  `json:"fstype,omitempty" example:"ext4"`
+	Total       uint64  `json:"total" example:"536870912000"`
+	Used        uint64  `json:"used" example:"402653184000"`
+	UsedPercent float64 `json:"usedPercent" example:"75.0"`
+	// Network is set on network and FUSE filesystems, e.g. NFS or CIFS
+	Network bool `json:"network,omitempty" example:"false"`
+	// Stale is set on a network filesystem whose usage could not be read in
+	// time, e.g. an unreachable NFS server; its usage is left zero
+	Stale bool `json:"stale,omitempty" example:"false"`
+}
+
+// ProcessInfo represents information about a single process
+// @Description Information about a single system process
+type ProcessInfo struct {
+	PID         int32   `json:"pid" example:"1234"`
+	PPID        int32   `json:"ppid" example:"1"`
+	Name        string  `json:"name" example:"chrome"`
+	Username    string  `json:"username,omitempty" example:"user"`
+	CPUPercent  float64 `json:"cpuPercent" example:"5.5"`    // since the previous sample; 100 is one core
+	MemoryUsage float32 `json:"memoryUsage" example:"256.5"` // in MB
+	NumFDs      int32   `json:"numFds" example:"64"`
+	NumThreads  int32   `json:"numThreads" example:"24"`
+	Status      string  `json:"status" example:"sleep"`
+	// Voluntary and involuntary context switches since the process started
+	VoluntaryCtxSwitches   int64 `json:"voluntaryCtxSwitches" example:"15000"`
+	InvoluntaryCtxSwitches int64 `json:"involuntaryCtxSwitches" example:"320"`
+	// KernelThread is set on the kernel threads of Linux, e.g. kworker/0:1
+	KernelThread bool `json:"kernelThread,omitempty"`
+}
+
+// Sample is a collected SystemStats snapshot with its sequence number
+// @Description A collected snapshot of system statistics with its sequence number
+type Sample struct {
+	Seq       uint64       `json:"seq" example:"42"`
+	Timestamp time.Time    `json:"timestamp" example:"2024-01-01T12:00:00Z"`
+	Stats     *SystemStats `json:"stats"`
+}
+
+// Event is the envelope wrapping every SSE payload
+// @Description Envelope of every SSE event. For "stats" events data is a SystemStats (trimmed to the requested topics) and seq equals the SSE id; "alert" events carry the alert that changed state; "error" events carry an ErrorData; the final "shutdown" event carries a ShutdownData.
+type Event struct {
+	Seq       uint64      `json:"seq,omitempty" example:"42"`
+	Timestamp time.Time   `json:"timestamp" example:"2024-01-01T12:00:00Z"`
+	Host      string      `json:"host" example:"web-01"`
+	Data      interface{} `json:"data"`
+}
+
+// ErrorData is the payload of an SSE error event
+// @Description Payload of an SSE "error" event
+type ErrorData struct {
+	Message string `json:"message" example:"error getting disk stats: permission denied"`
+}
+
+// ShutdownData is the payload of the SSE shutdown event
+// @Description Payload of the final SSE "shutdown" event, sent before the server closes the stream
+type ShutdownData struct {
+	Message string `json:"message" example:"server shutting down"`
+	// RetryMs is the advertised reconnection delay in milliseconds
+	RetryMs int64 `json:"retryMs" example:"3000"`
+}
+
+// VersionInfo describes the running build
+// @Description Build and runtime information of the running binary
+type VersionInfo struct {
+	Version   string `json:"version" example:"1.2.0"`
+	Commit    string `json:"commit,omitempty" example:"3b1f3e1"`
+	BuildDate string `json:"buildDate,omitempty" example:"2024-01-01T12:00:00Z"`
+	GoVersion string `json:"goVersion" example:"go1.22.5"`
+	Platform  string `json:"platform" example:"linux/amd64"`
+	// Collectors lists the subsystems collected on every tick
+	Collectors []string `json:"collectors" example:"cpu,mem,disk,net,processes"`
+	// Sinks lists the enabled push outputs
+	Sinks []string `json:"sinks" example:"influxdb"`
+	// Demo is set when the server serves simulated stats
+	Demo bool `json:"demo,omitempty" example:"false"`
+}
+
+// ZFSStats is the health of the ZFS pools and the ARC statistics
+// @Description Health of the ZFS pools and ARC statistics
+type ZFSStats struct {
+	Pools []ZFSPool `json:"pools"`
+	// Degraded is the number of pools whose health is not ONLINE
+	Degraded int `json:"degraded" example:"0"`
+	// ARC is unset when the ARC statistics cannot be read
+	ARC *ZFSARC `json:"arc,omitempty"`
+}
+
+// ZFSPool is the health of a ZFS pool and its last scan
+// @Description Health of a ZFS pool and its last scan
+type ZFSPool struct {
+	Name string `json:"name" example:"tank"`
+	// Health is ONLINE, DEGRADED, FAULTED, OFFLINE, REMOVED, UNAVAIL, or
+	// SUSPENDED
+	Health string `json:"health" example:"ONLINE"`
+	// Scan is the scrub or resilver in progress or last finished, unset when
+	// none ran or zpool is not installed
+	Scan *ZFSScan `json:"scan,omitempty"`
+}
+
+// ZFSScan is a scrub or resilver of a ZFS pool
+// @Description Scrub or resilver of a ZFS pool
+type ZFSScan struct {
+	// Function is scrub or resilver
+	Function string `json:"function" example:"scrub"`
+	// State is in progress, paused, finished, or canceled
+	State string `json:"state" example:"in progress"`
+	// Progress is the percentage done of a scan in progress
+	Progress float64 `json:"progress,omitempty" example:"42.5"`
+	// Errors is the number of errors a finished scan found
+	Errors int `json:"errors" example:"0"`
+}
+
+// ZFSARC is the size and efficiency of the ZFS adaptive replacement cache
+// @Description Size and hit rate of the ZFS ARC
+type ZFSARC struct {
+	// Size and TargetSize are in bytes
+	Size       uint64 `json:"size" example:"8589934592"`
+	TargetSize uint64 `json:"targetSize" example:"17179869184"`
+	Hits       uint64 `json:"hits" example:"97300000"`
+	Misses     uint64 `json:"misses" example:"2700000"`
+	// HitRate is the percentage of the reads since boot served by the ARC
+	HitRate float64 `json:"hitRate" example:"97.3"`
+}
+
+// MDRaidStats is the state of the Linux software RAID arrays
+// @Description State of the Linux software RAID (md) arrays
+type MDRaidStats struct {
+	Arrays []MDArray `json:"arrays"`
+	// Degraded is the number of arrays missing members or inactive
+	Degraded int `json:"degraded" example:"0"`
+}
+
+// MDArray is the state of a software RAID array from /proc/mdstat
+// @Description State of a software RAID array
+type MDArray struct {
+	Name string `json:"name" example:"md0"`
+	// State is active or inactive, followed by the read-only mode in
+	// parentheses if any, e.g. active (auto-read-only)
+	State string `json:"state" example:"active"`
+	// Level is e.g. raid1, raid5, or linear; inactive arrays have none
+	Level string `json:"level,omitempty" example:"raid1"`
+	// Disks is the number of members of the array and Active the number
+	// working
+	Disks  int `json:"disks" example:"2"`
+	Active int `json:"active" example:"2"`
+	// Members are the member devices; Failed and Spare those marked (F)
+	// and (S)
+	Members []string `json:"members" example:"sda1,sdb1"`
+	Failed  []string `json:"failed,omitempty"`
+	Spare   []string `json:"spare,omitempty"`
+	// Degraded is set when members are missing or the array is inactive
+	Degraded bool `json:"degraded" example:"false"`
+	// Sync is the resync, recovery, reshape, check, or repair in progress
+	Sync *MDSync `json:"sync,omitempty"`
+}
+
+// MDSync is a resync, recovery (rebuild), reshape, check, or repair of an
+// array
+// @Description Sync operation in progress on a software RAID array
+type MDSync struct {
+	Action string `json:"action" example:"recovery"`
+	// Progress is the percentage done, 0 while the action is delayed or
+	// pending
+	Progress float64 `json:"progress" example:"12.6"`
+	// Finish is the remaining time estimated by the kernel, e.g. 90.1min
+	Finish string `json:"finish,omitempty" example:"90.1min"`
+	// Pending is set while the action waits for another array, as
+	// resync=DELAYED or resync=PENDING
+	Pending bool `json:"pending,omitempty"`
+}
+
+// Pressure is the Pressure Stall Information of Linux: the share of time
+// tasks were stalled waiting for CPU, memory, or I/O
+// @Description Linux Pressure Stall Information of CPU, memory, and I/O
+type Pressure struct {
+	CPU    PressureResource `json:"cpu"`
+	Memory PressureResource `json:"memory"`
+	IO     PressureResource `json:"io"`
+}
+
+// PressureResource is the pressure of a resource. Some is the time at least
+// one task was stalled on it, Full the time all non-idle tasks were stalled
+// at once; CPU has no Full before Linux 5.13.
+// @Description Stall times of a resource
+type PressureResource struct {
+	Some PressureAverages  `json:"some"`
+	Full *PressureAverages `json:"full,omitempty"`
+}
+
+// PressureAverages are the percentages of time stalled over the last 10, 60,
+// and 300 seconds, and the total stall time
+// @Description Percentages of time stalled over 10s, 60s, and 300s
+type PressureAverages struct {
+	Avg10  float64 `json:"avg10" example:"2.68"`
+	Avg60  float64 `json:"avg60" example:"2.07"`
+	Avg300 float64 `json:"avg300" example:"2.02"`
+	// Total is the total stall time in microseconds
+	Total uint64 `json:"total" example:"143594988"`
+}
+
+// HugePages is the usage of the huge page pools of Linux
+// @Description Usage of the huge page pools
+type HugePages struct {
+	// Pools are the pools of each huge page size
+	Pools []HugePagePool `json:"pools"`
+	// Hugetlb is the memory taken by all the pools, in bytes
+	Hugetlb uint64 `json:"hugetlb" example:"8589934592"`
+	// AnonHugePages is the memory backed by transparent huge pages, in bytes
+	AnonHugePages uint64 `json:"anonHugePages" example:"0"`
+}
+
+// HugePagePool is the usage of the huge pages of one size
+// @Description Usage of the huge pages of one size
+type HugePagePool struct {
+	// Size is the size of a page in bytes
+	Size  uint64 `json:"size" example:"2097152"`
+	Total uint64 `json:"total" example:"4096"`
+	Free  uint64 `json:"free" example:"1024"`
+	// Reserved pages are promised to mappings but not yet faulted in; they
+	// are counted as free. Unset for the pools of a NUMA node.
+	Reserved uint64 `json:"reserved,omitempty" example:"0"`
+	// Surplus pages were allocated over Total by overcommit
+	Surplus uint64 `json:"surplus" example:"0"`
+}
+
+// NUMAStats is the memory usage of each NUMA node
+// @Description Memory usage of each NUMA node
+type NUMAStats struct {
+	Nodes []NUMANode `json:"nodes"`
+}
+
+// NUMANode is the memory usage of a NUMA node. Memory is in bytes.
+// @Description Memory usage of a NUMA node
+type NUMANode struct {
+	Node        int     `json:"node" example:"0"`
+	MemTotal    uint64  `json:"memTotal" example:"68719476736"`
+	MemFree     uint64  `json:"memFree" example:"8589934592"`
+	MemUsed     uint64  `json:"memUsed" example:"60129542144"`
+	UsedPercent float64 `json:"usedPercent" example:"87.5"`
+	// HugePages are the huge page pools allocated on the node
+	HugePages []HugePagePool `json:"hugePages,omitempty"`
+}
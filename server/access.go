@@ -0,0 +1,147 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// AccessConfig restricts the clients allowed to connect by IP address, for
+// deployments that cannot run authentication. Entries are CIDRs, e.g.
+// 10.0.0.0/8, or single addresses.
+type AccessConfig struct {
+	// Allow lists the clients allowed to connect; empty allows every client
+	// not denied
+	Allow []string `yaml:"allow"`
+	// Deny lists the clients refused, even when allowed
+	Deny []string `yaml:"deny"`
+	// TrustedProxies lists the reverse proxies whose ClientIPHeader is
+	// trusted to name the client
+	TrustedProxies []string `yaml:"trustedProxies"`
+	// ClientIPHeader is set by the trusted proxies to the client address,
+	// e.g. X-Forwarded-For or X-Real-IP. X-Forwarded-For is read from the
+	// right, skipping the trusted proxies.
+	ClientIPHeader string `yaml:"clientIPHeader"`
+}
+
+// ipAccess resolves the client address of requests and checks it against
+// the allowlist and denylist
+type ipAccess struct {
+	allow   []netip.Prefix
+	deny    []netip.Prefix
+	trusted []netip.Prefix
+	header  string
+}
+
+// newIPAccess parses the access config
+func newIPAccess(cfg AccessConfig) (*ipAccess, error) {
+	a := &ipAccess{header: http.CanonicalHeaderKey(cfg.ClientIPHeader)}
+	for _, list := range []struct {
+		name    string
+		entries []string
+		dst     *[]netip.Prefix
+	}{{"allow", cfg.Allow, &a.allow}, {"deny", cfg.Deny, &a.deny}, {"trustedProxies", cfg.TrustedProxies, &a.trusted}} {
+		for _, entry := range list.entries {
+			prefix, err := parsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid access.%s entry %q: must be a CIDR or an IP address", list.name, entry)
+			}
+			*list.dst = append(*list.dst, prefix)
+		}
+	}
+	if len(a.trusted) > 0 && a.header == "" {
+		return nil, fmt.Errorf("access.clientIPHeader is required with trustedProxies")
+	}
+	return a, nil
+}
+
+// parsePrefix parses a CIDR or a single address
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// contains reports whether addr is in one of the prefixes
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client of a request: the remote
+// address, or the address named by the client IP header when the request
+// comes from a trusted proxy. It is invalid when the address cannot be
+// parsed.
+func (a *ipAccess) clientIP(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	addr = addr.Unmap()
+	if !contains(a.trusted, addr) {
+		return addr
+	}
+
+	// Every proxy appends the address it received the request from, so the
+	// client is the rightmost address that is not a trusted proxy
+	values := r.Header.Values(a.header)
+	for i := len(values) - 1; i >= 0; i-- {
+		hops := strings.Split(values[i], ",")
+		for j := len(hops) - 1; j >= 0; j-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[j]))
+			if err != nil {
+				return netip.Addr{}
+			}
+			addr = hop.Unmap()
+			if !contains(a.trusted, addr) {
+				return addr
+			}
+		}
+	}
+	return addr
+}
+
+// allowed reports whether a client address may connect
+func (a *ipAccess) allowed(addr netip.Addr) bool {
+	if len(a.allow) == 0 && len(a.deny) == 0 {
+		return true
+	}
+	if !addr.IsValid() || contains(a.deny, addr) {
+		return false
+	}
+	return len(a.allow) == 0 || contains(a.allow, addr)
+}
+
+// accessHandler wraps an http.Handler and refuses the clients that are
+// denied or not allowed by the access config, before any other handler
+func (s *Server) accessHandler(next http.Handler) http.Handler {
+	if len(s.access.allow) == 0 && len(s.access.deny) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.access.allowed(s.access.clientIP(r)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
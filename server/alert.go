@@ -0,0 +1,732 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// Alert rule types
+const (
+	// alertThreshold fires when the metric crosses a fixed value
+	alertThreshold = "threshold"
+	// alertAnomaly fires when the metric deviates from a learned baseline
+	alertAnomaly = "anomaly"
+	// alertForecast fires when the disk is projected to fill up soon
+	alertForecast = "forecast"
+)
+
+// Baselines of anomaly rules
+const (
+	// baselineEWMA is an exponentially weighted mean and variance
+	baselineEWMA = "ewma"
+	// baselineWindow is the mean and variance of the values of a window
+	baselineWindow = "window"
+)
+
+// Alert states
+const (
+	alertOK       = "ok"
+	alertPending  = "pending"
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+// AlertRule configures an alert on a metric of the samples. The metric is
+// one of those of /api/query, or watch.<id>.<field> for the count,
+// cpuPercent, or memoryUsage of the processes of a configured watch.
+// @Description An alert rule: a threshold on a metric or a deviation from its learned baseline
+type AlertRule struct {
+	Name string `json:"name" yaml:"name" example:"cpu-anomaly"`
+	// Type is threshold (the default), anomaly, or forecast
+	Type   string `json:"type" yaml:"type" example:"anomaly" enums:"threshold,anomaly,forecast"`
+	Metric string `json:"metric" yaml:"metric" example:"cpuUsage"`
+	// For is how long the condition must hold before the alert fires. The
+	// durations are served as strings by AlertStatus.
+	For time.Duration `json:"-" yaml:"for"`
+
+	// Op and Value are the condition of threshold rules, e.g. > 90
+	Op    string  `json:"op,omitempty" yaml:"op" example:">" enums:">,>=,<,<="`
+	Value float64 `json:"value,omitempty" yaml:"value" example:"90"`
+	// Resolve is the threshold a firing threshold rule must cross back to
+	// resolve, e.g. 80 for > 90 (default Value), so that a metric hovering
+	// around Value does not flap
+	Resolve *float64 `json:"resolve,omitempty" yaml:"resolve" example:"80"`
+
+	// Baseline is how anomaly rules learn the usual values: ewma (the
+	// default), weighting values by their age with HalfLife, or window, the
+	// values of the last Window
+	Baseline string        `json:"baseline,omitempty" yaml:"baseline" example:"ewma" enums:"ewma,window"`
+	HalfLife time.Duration `json:"-" yaml:"halfLife"`
+	Window   time.Duration `json:"-" yaml:"window"`
+
+	// Within is the horizon of forecast rules, which fire when the disk is
+	// projected to be full within it. The trend is fitted with Method
+	// (linear or holt) on the samples of the last Window (default 6h). Their
+	// metric is diskUsage.
+	Within time.Duration `json:"-" yaml:"within"`
+	Method string        `json:"method,omitempty" yaml:"method" example:"linear" enums:"linear,holt"`
+
+	// ZScore is the number of standard deviations from the mean at which
+	// anomaly rules fire (default 3), and ResolveZScore the one under which
+	// they resolve (default ZScore)
+	ZScore        float64 `json:"zScore,omitempty" yaml:"zScore" example:"3"`
+	ResolveZScore float64 `json:"resolveZScore,omitempty" yaml:"resolveZScore" example:"2"`
+	// Direction is the deviation that fires: above, below, or both (the
+	// default)
+	Direction string `json:"direction,omitempty" yaml:"direction" example:"above" enums:"above,below,both"`
+	// MinSamples is the number of values learned before the rule may fire
+	// (default 30)
+	MinSamples int `json:"minSamples,omitempty" yaml:"minSamples" example:"30"`
+	// MinDeviation is a floor of the standard deviation, in the unit of the
+	// metric, so that nearly constant metrics do not fire on tiny changes
+	MinDeviation float64 `json:"minDeviation,omitempty" yaml:"minDeviation" example:"2"`
+	// Seasonal learns a separate ewma baseline for every hour of the day
+	// (local time), so that e.g. a nightly backup is usual at 3am only
+	Seasonal bool `json:"seasonal,omitempty" yaml:"seasonal" example:"true"`
+
+	// Cooldown is how long a resolved rule waits before it may fire again,
+	// staying pending meanwhile
+	Cooldown time.Duration `json:"-" yaml:"cooldown"`
+	// Repeat is the interval at which a firing alert is sent again (0 sends
+	// it once)
+	Repeat time.Duration `json:"-" yaml:"repeat"`
+	// Group names a set of rules alerting on the same problem, e.g. a
+	// warning and a critical threshold. While a rule of the group fires, the
+	// others fire and resolve without being sent.
+	Group string `json:"group,omitempty" yaml:"group" example:"cpu"`
+}
+
+// AlertsConfig configures the alert rules evaluated on every sample
+type AlertsConfig struct {
+	Rules []AlertRule `yaml:"rules"`
+	// HistorySize is the number of alert transitions kept for
+	// /api/alerts/history
+	HistorySize int `yaml:"historySize"`
+	// PagerDuty and Opsgenie page on-call with the alerts that are sent
+	PagerDuty PagerDutyConfig `yaml:"pagerduty"`
+	Opsgenie  OpsgenieConfig  `yaml:"opsgenie"`
+}
+
+// Alert represents an alert that changed state or is sent again. It is the
+// data of SSE alert events.
+// @Description An alert that fired, resolved, or is still firing
+type Alert struct {
+	Rule   string `json:"rule" example:"cpu-anomaly"`
+	Type   string `json:"type" example:"anomaly"`
+	Metric string `json:"metric" example:"cpuUsage"`
+	Group  string `json:"group,omitempty" example:"cpu"`
+	// State is firing or resolved
+	State string  `json:"state" example:"firing"`
+	Value float64 `json:"value" example:"97.5"`
+	// Threshold is set for threshold rules
+	Threshold *float64 `json:"threshold,omitempty" example:"90"`
+	// Mean, Stddev, and ZScore describe the baseline of anomaly rules
+	Mean   *float64 `json:"mean,omitempty" example:"12.4"`
+	Stddev *float64 `json:"stddev,omitempty" example:"3.1"`
+	ZScore *float64 `json:"zScore,omitempty" example:"27.4"`
+	// FullAt is the projected time the disk fills up, for forecast rules
+	FullAt *time.Time `json:"fullAt,omitempty" example:"2024-01-03T02:15:00Z"`
+	// Repeat is set when a firing alert is sent again after the repeat
+	// interval of its rule
+	Repeat bool `json:"repeat,omitempty" example:"false"`
+	// Since is when the condition started to hold, or stopped for resolved
+	// alerts
+	Since     time.Time `json:"since" example:"2024-01-01T12:00:00Z"`
+	Timestamp time.Time `json:"timestamp" example:"2024-01-01T12:01:00Z"`
+	Message   string    `json:"message" example:"cpuUsage is 97.5, 27.4 standard deviations above its baseline of 12.4"`
+	// Labels are the labels configured on the host
+	Labels map[string]string `json:"labels,omitempty" example:"env:prod"`
+}
+
+// AlertStatus represents a rule with its current state
+// @Description An alert rule with its current state
+type AlertStatus struct {
+	AlertRule
+	For      string `json:"for,omitempty" example:"1m0s"`
+	HalfLife string `json:"halfLife,omitempty" example:"1h0m0s"`
+	Window   string `json:"window,omitempty" example:"1h0m0s"`
+	Within   string `json:"within,omitempty" example:"48h0m0s"`
+	Cooldown string `json:"cooldown,omitempty" example:"10m0s"`
+	Repeat   string `json:"repeat,omitempty" example:"1h0m0s"`
+	// State is ok, pending, or firing
+	State string `json:"state" example:"ok"`
+	// Since is when the rule entered its state
+	Since *time.Time `json:"since,omitempty" example:"2024-01-01T12:00:00Z"`
+	// Last is the last evaluation, unset before the first
+	Last *Alert `json:"last,omitempty"`
+}
+
+// alertRuleState holds the baseline and state of a rule
+type alertRuleState struct {
+	rule   AlertRule
+	metric queryMetric
+	// baselines holds a single baseline, or one per hour for seasonal rules
+	baselines []*alertBaseline
+	state     string
+	since     time.Time
+	last      *Alert
+	// lastAt is the time of the previous value, which weights ewma updates
+	lastAt time.Time
+	// resolvedAt is when the rule last resolved, which starts its cooldown
+	resolvedAt time.Time
+	// notifiedAt is when the firing alert was last sent, or suppressed by
+	// its group
+	notifiedAt time.Time
+}
+
+// alertBaseline is the learned mean and variance of a metric
+type alertBaseline struct {
+	// window is set for window baselines
+	window bool
+	count  int
+	mean   float64
+	// variance is maintained by ewma baselines; window baselines keep sums
+	variance float64
+	times    []time.Time
+	values   []float64
+	sum      float64
+	sumSq    float64
+}
+
+// alertEngine evaluates the rules on every sample and publishes the alerts
+// that fire or resolve
+type alertEngine struct {
+	mu     sync.Mutex
+	rules  []*alertRuleState
+	labels map[string]string
+	// history holds the samples fitted by forecast rules
+	history *history
+	// transitions are the alerts that fired or resolved, oldest first
+	transitions *ring[Alert]
+	// notifiers page on-call with the alerts that are sent
+	notifiers []*notifierRunner
+	// publish delivers alert events, e.g. hub.Publish
+	publish func(eventType string, data interface{})
+}
+
+// newAlertEngine creates an engine for the configured rules
+func newAlertEngine(cfg AlertsConfig, labels map[string]string, history *history, watcher *watcher) (*alertEngine, error) {
+	if cfg.HistorySize < 1 {
+		return nil, fmt.Errorf("alerts.historySize must be at least 1")
+	}
+	e := &alertEngine{labels: labels, history: history, transitions: newRing[Alert](cfg.HistorySize)}
+	names := map[string]bool{}
+	for _, rule := range cfg.Rules {
+		if !watchIDPattern.MatchString(rule.Name) {
+			return nil, fmt.Errorf("invalid alerts.rules name %q", rule.Name)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate alerts.rules name %q", rule.Name)
+		}
+		names[rule.Name] = true
+		rule, err := normalizeAlertRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %q: %w", rule.Name, err)
+		}
+
+		metric, ok := queryMetrics[rule.Metric]
+		if !ok {
+			if metric, err = watcher.Metric(rule.Metric); err != nil {
+				return nil, fmt.Errorf("alert rule %q: %w", rule.Name, err)
+			}
+		}
+
+		state := &alertRuleState{rule: rule, metric: metric, state: alertOK}
+		baselines := 1
+		if rule.Seasonal {
+			baselines = 24
+		}
+		for i := 0; i < baselines; i++ {
+			state.baselines = append(state.baselines, &alertBaseline{window: rule.Baseline == baselineWindow})
+		}
+		e.rules = append(e.rules, state)
+	}
+	return e, nil
+}
+
+// normalizeAlertRule checks a rule and applies the defaults of its type
+func normalizeAlertRule(rule AlertRule) (AlertRule, error) {
+	if rule.Type == alertForecast && rule.Metric == "" {
+		rule.Metric = "diskUsage"
+	}
+	if _, ok := queryMetrics[rule.Metric]; !ok {
+		if _, _, ok := parseWatchMetric(rule.Metric); !ok {
+			return rule, fmt.Errorf("unknown metric %q", rule.Metric)
+		}
+	}
+	if rule.For < 0 || rule.Cooldown < 0 || rule.Repeat < 0 {
+		return rule, fmt.Errorf("for, cooldown, and repeat must not be negative")
+	}
+	if rule.Group != "" && !watchIDPattern.MatchString(rule.Group) {
+		return rule, fmt.Errorf("invalid group %q", rule.Group)
+	}
+	if rule.Type == "" {
+		rule.Type = alertThreshold
+	}
+
+	switch rule.Type {
+	case alertThreshold:
+		switch rule.Op {
+		case ">", ">=", "<", "<=":
+		default:
+			return rule, fmt.Errorf("invalid op %q (want >, >=, <, or <=)", rule.Op)
+		}
+		if r := rule.Resolve; r != nil {
+			above := rule.Op == ">" || rule.Op == ">="
+			if above && *r > rule.Value || !above && *r < rule.Value {
+				return rule, fmt.Errorf("resolve must be on the other side of value than the alerting values")
+			}
+		}
+	case alertAnomaly:
+		if rule.Baseline == "" {
+			rule.Baseline = baselineEWMA
+		}
+		switch rule.Baseline {
+		case baselineEWMA:
+			if rule.HalfLife == 0 {
+				rule.HalfLife = time.Hour
+			}
+			if rule.HalfLife < 0 {
+				return rule, fmt.Errorf("halfLife must be positive")
+			}
+		case baselineWindow:
+			if rule.Window == 0 {
+				rule.Window = time.Hour
+			}
+			if rule.Window < 0 {
+				return rule, fmt.Errorf("window must be positive")
+			}
+			if rule.Seasonal {
+				return rule, fmt.Errorf("seasonal requires the ewma baseline")
+			}
+		default:
+			return rule, fmt.Errorf("invalid baseline %q (want %s or %s)", rule.Baseline, baselineEWMA, baselineWindow)
+		}
+		if rule.ZScore == 0 {
+			rule.ZScore = 3
+		}
+		if rule.Direction == "" {
+			rule.Direction = "both"
+		}
+		if rule.Direction != "above" && rule.Direction != "below" && rule.Direction != "both" {
+			return rule, fmt.Errorf("invalid direction %q (want above, below, or both)", rule.Direction)
+		}
+		if rule.MinSamples == 0 {
+			rule.MinSamples = 30
+		}
+		if rule.ResolveZScore == 0 {
+			rule.ResolveZScore = rule.ZScore
+		}
+		if rule.ZScore < 0 || rule.MinSamples < 2 || rule.MinDeviation < 0 {
+			return rule, fmt.Errorf("zScore and minDeviation must not be negative and minSamples must be at least 2")
+		}
+		if rule.ResolveZScore < 0 || rule.ResolveZScore > rule.ZScore {
+			return rule, fmt.Errorf("resolveZScore must be between 0 and zScore")
+		}
+	case alertForecast:
+		if rule.Metric != "diskUsage" {
+			return rule, fmt.Errorf("forecast rules only support the diskUsage metric")
+		}
+		if rule.Within <= 0 {
+			return rule, fmt.Errorf("within must be positive")
+		}
+		if rule.Window == 0 {
+			rule.Window = 6 * time.Hour
+		}
+		if rule.Window < 0 {
+			return rule, fmt.Errorf("window must be positive")
+		}
+		method, err := parseForecastMethod(rule.Method)
+		if err != nil {
+			return rule, err
+		}
+		rule.Method = method
+	default:
+		return rule, fmt.Errorf("invalid type %q (want %s, %s, or %s)", rule.Type, alertThreshold, alertAnomaly, alertForecast)
+	}
+	return rule, nil
+}
+
+// observe evaluates every rule on a sample. Rules whose subsystem failed to
+// collect keep their state. Every transition is logged and recorded, but
+// only those not suppressed by the group of the rule are sent, along with
+// the repeats of firing alerts.
+func (e *alertEngine) observe(sample models.Sample) {
+	var changed, send []Alert
+	e.mu.Lock()
+	for _, rs := range e.rules {
+		if _, failed := sample.Stats.Errors[rs.metric.topic]; failed {
+			continue
+		}
+		if rs.metric.rate && sample.Stats.Rates == nil {
+			continue
+		}
+		now := sample.Timestamp
+		alert, ok := e.evaluate(rs, rs.metric.value(sample.Stats), now)
+		switch {
+		case ok:
+			e.transitions.Push(alert)
+			changed = append(changed, alert)
+			rs.notifiedAt = now
+			if !e.groupFiring(rs) {
+				send = append(send, alert)
+			}
+		case rs.state == alertFiring && rs.rule.Repeat > 0 && now.Sub(rs.notifiedAt) >= rs.rule.Repeat && e.groupLeader(rs):
+			rs.notifiedAt = now
+			alert.Repeat = true
+			send = append(send, alert)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, alert := range changed {
+		if alert.State == alertFiring {
+			slog.Warn("Alert firing", "rule", alert.Rule, "value", alert.Value, "message", alert.Message)
+		} else {
+			slog.Info("Alert resolved", "rule", alert.Rule, "value", alert.Value)
+		}
+	}
+	for _, alert := range send {
+		if e.publish != nil {
+			e.publish(eventAlert, alert)
+		}
+		for _, runner := range e.notifiers {
+			runner.Enqueue(alert)
+		}
+	}
+}
+
+// groupFiring reports whether another rule of the group of rs is firing
+func (e *alertEngine) groupFiring(rs *alertRuleState) bool {
+	if rs.rule.Group == "" {
+		return false
+	}
+	for _, other := range e.rules {
+		if other != rs && other.rule.Group == rs.rule.Group && other.state == alertFiring {
+			return true
+		}
+	}
+	return false
+}
+
+// groupLeader reports whether rs is the first firing rule of its group,
+// which is the one repeating the alert of the group
+func (e *alertEngine) groupLeader(rs *alertRuleState) bool {
+	if rs.rule.Group == "" {
+		return true
+	}
+	for _, other := range e.rules {
+		if other.rule.Group == rs.rule.Group && other.state == alertFiring {
+			return other == rs
+		}
+	}
+	return false
+}
+
+// evaluate updates the state of a rule with a value and returns the alert
+// when it fired or resolved
+func (e *alertEngine) evaluate(rs *alertRuleState, value float64, now time.Time) (Alert, bool) {
+	alert := Alert{
+		Rule:      rs.rule.Name,
+		Type:      rs.rule.Type,
+		Metric:    rs.rule.Metric,
+		Group:     rs.rule.Group,
+		Value:     value,
+		Timestamp: now,
+		Labels:    e.labels,
+	}
+
+	var active bool
+	switch rs.rule.Type {
+	case alertThreshold:
+		threshold := rs.rule.Value
+		if rs.state == alertFiring && rs.rule.Resolve != nil {
+			threshold = *rs.rule.Resolve
+		}
+		active = compareThreshold(value, rs.rule.Op, threshold)
+		alert.Threshold = &threshold
+		alert.Message = fmt.Sprintf("%s is %s (%s %s)", rs.rule.Metric, formatAlertValue(value), rs.rule.Op, formatAlertValue(threshold))
+	case alertAnomaly:
+		active = e.evaluateAnomaly(rs, &alert, value, now)
+	case alertForecast:
+		active = e.evaluateForecast(rs, &alert, now)
+	}
+
+	defer func() { rs.last = &alert }()
+	switch {
+	case active && rs.state == alertOK:
+		rs.state = alertPending
+		rs.since = now
+	case !active && rs.state == alertPending:
+		rs.state = alertOK
+		rs.since = now
+	case !active && rs.state == alertFiring:
+		rs.state = alertOK
+		rs.since = now
+		rs.resolvedAt = now
+		alert.State = alertResolved
+		alert.Since = now
+		return alert, true
+	}
+	alert.State = rs.state
+	alert.Since = rs.since
+	if rs.state == alertPending && now.Sub(rs.since) >= rs.rule.For && now.Sub(rs.resolvedAt) >= rs.rule.Cooldown {
+		rs.state = alertFiring
+		alert.State = alertFiring
+		return alert, true
+	}
+	return alert, false
+}
+
+// evaluateAnomaly scores a value against the baseline of a rule, then
+// learns it. It reports whether the value is anomalous.
+func (e *alertEngine) evaluateAnomaly(rs *alertRuleState, alert *Alert, value float64, now time.Time) bool {
+	baseline := rs.baselines[0]
+	if rs.rule.Seasonal {
+		baseline = rs.baselines[now.Local().Hour()]
+	}
+	elapsed := now.Sub(rs.lastAt)
+	if rs.lastAt.IsZero() {
+		elapsed = 0
+	}
+	rs.lastAt = now
+
+	mean, stddev := baseline.stats()
+	learned := baseline.count >= rs.rule.MinSamples
+	switch rs.rule.Baseline {
+	case baselineEWMA:
+		baseline.addEWMA(value, elapsed, rs.rule.HalfLife)
+	case baselineWindow:
+		baseline.addWindow(value, now, rs.rule.Window)
+	}
+	if !learned {
+		alert.Message = fmt.Sprintf("%s is %s, learning its baseline", rs.rule.Metric, formatAlertValue(value))
+		return false
+	}
+
+	deviation := max(stddev, rs.rule.MinDeviation)
+	z := 0.0
+	if deviation > 0 {
+		z = (value - mean) / deviation
+	}
+	alert.Mean = &mean
+	alert.Stddev = &stddev
+	alert.ZScore = &z
+
+	direction := "above"
+	if z < 0 {
+		direction = "below"
+	}
+	alert.Message = fmt.Sprintf("%s is %s, %s standard deviations %s its baseline of %s",
+		rs.rule.Metric, formatAlertValue(value), formatAlertValue(math.Abs(z)), direction, formatAlertValue(mean))
+
+	limit := rs.rule.ZScore
+	if rs.state == alertFiring {
+		limit = rs.rule.ResolveZScore
+	}
+	switch rs.rule.Direction {
+	case "above":
+		return z >= limit
+	case "below":
+		return z <= -limit
+	}
+	return math.Abs(z) >= limit
+}
+
+// evaluateForecast projects the disk fill from the recent samples and
+// reports whether it is full within the horizon of the rule
+func (e *alertEngine) evaluateForecast(rs *alertRuleState, alert *Alert, now time.Time) bool {
+	forecast := forecastDisk(e.history.Range(now.Add(-rs.rule.Window), time.Time{}), rs.rule.Method, "")
+	if forecast.FullAt == nil {
+		alert.Message = fmt.Sprintf("disk %s is %s%% used and not filling up", forecast.Mountpoint, formatAlertValue(alert.Value))
+		return false
+	}
+	alert.FullAt = forecast.FullAt
+	alert.Message = fmt.Sprintf("disk %s is %s%% used and projected to be full in %sh",
+		forecast.Mountpoint, formatAlertValue(alert.Value), formatAlertValue(*forecast.HoursToFull))
+	return forecast.FullAt.Sub(now) <= rs.rule.Within
+}
+
+// stats returns the mean and standard deviation of the baseline
+func (b *alertBaseline) stats() (mean, stddev float64) {
+	if b.window {
+		if len(b.values) == 0 {
+			return 0, 0
+		}
+		n := float64(len(b.values))
+		mean = b.sum / n
+		return mean, math.Sqrt(max(b.sumSq/n-mean*mean, 0))
+	}
+	return b.mean, math.Sqrt(b.variance)
+}
+
+// addEWMA learns a value, weighting it by the time elapsed since the
+// previous one so that the weight of values halves every halfLife
+func (b *alertBaseline) addEWMA(value float64, elapsed, halfLife time.Duration) {
+	b.count++
+	if b.count == 1 {
+		b.mean = value
+		return
+	}
+	alpha := 1 - math.Exp(-math.Ln2*elapsed.Seconds()/halfLife.Seconds())
+	// Until enough values were seen, weight them equally so that the first
+	// one does not dominate
+	alpha = max(alpha, 1/float64(b.count))
+	diff := value - b.mean
+	b.mean += alpha * diff
+	b.variance = (1 - alpha) * (b.variance + alpha*diff*diff)
+}
+
+// addWindow learns a value and forgets those older than window
+func (b *alertBaseline) addWindow(value float64, now time.Time, window time.Duration) {
+	b.times = append(b.times, now)
+	b.values = append(b.values, value)
+	b.sum += value
+	b.sumSq += value * value
+	expired := 0
+	for expired < len(b.times) && now.Sub(b.times[expired]) > window {
+		b.sum -= b.values[expired]
+		b.sumSq -= b.values[expired] * b.values[expired]
+		expired++
+	}
+	if expired > 0 {
+		b.times = append(b.times[:0], b.times[expired:]...)
+		b.values = append(b.values[:0], b.values[expired:]...)
+	}
+	b.count = len(b.values)
+}
+
+// compareThreshold reports whether value satisfies op threshold
+func compareThreshold(value float64, op string, threshold float64) bool {
+	switch op {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	}
+	return false
+}
+
+// formatAlertValue formats a value with at most two decimals
+func formatAlertValue(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// List returns the rules with their current state
+func (e *alertEngine) List() []AlertStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	statuses := make([]AlertStatus, 0, len(e.rules))
+	for _, rs := range e.rules {
+		status := AlertStatus{AlertRule: rs.rule, State: rs.state, Last: rs.last}
+		if rs.rule.For > 0 {
+			status.For = rs.rule.For.String()
+		}
+		if rs.rule.HalfLife > 0 {
+			status.HalfLife = rs.rule.HalfLife.String()
+		}
+		if rs.rule.Window > 0 {
+			status.Window = rs.rule.Window.String()
+		}
+		if rs.rule.Within > 0 {
+			status.Within = rs.rule.Within.String()
+		}
+		if rs.rule.Cooldown > 0 {
+			status.Cooldown = rs.rule.Cooldown.String()
+		}
+		if rs.rule.Repeat > 0 {
+			status.Repeat = rs.rule.Repeat.String()
+		}
+		if !rs.since.IsZero() {
+			since := rs.since
+			status.Since = &since
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// History returns the alert transitions between from and to (zero times are
+// unbounded), oldest first
+func (e *alertEngine) History(from, to time.Time) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	alerts := []Alert{}
+	for _, alert := range e.transitions.Slice() {
+		if !from.IsZero() && alert.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && alert.Timestamp.After(to) {
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// Expire drops the alert transitions older than before and returns the
+// number dropped
+func (e *alertEngine) Expire(before time.Time) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.transitions.DropWhile(func(alert Alert) bool {
+		return alert.Timestamp.Before(before)
+	})
+}
+
+// alertsHandler godoc
+// @Summary List alert rules
+// @Description Returns the configured alert rules with their state (ok, pending, or firing) and their last evaluation. Alerts that fire or resolve are also sent as SSE alert events.
+// @Tags alerts
+// @Produce json
+// @Success 200 {array} AlertStatus
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /alerts [get]
+func (s *Server) alertsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.alerts.List()); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
+
+// alertHistoryHandler godoc
+// @Summary Get alert history
+// @Description Returns the alerts that fired or resolved, oldest first, optionally limited to a time range. The last alerts.historySize transitions are kept in memory, for at most retention.alerts.
+// @Tags alerts
+// @Produce json
+// @Param from query string false "Only include alerts that changed state at or after this RFC 3339 timestamp"
+// @Param to query string false "Only include alerts that changed state at or before this RFC 3339 timestamp"
+// @Success 200 {array} Alert
+// @Failure 400 {string} string "Bad Request"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /alerts/history [get]
+func (s *Server) alertHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := parseTimeRange(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSONArray(w, r, s.alerts.History(from, to))
+}
@@ -0,0 +1,433 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// testAlertEngine returns an engine evaluating rules
+func testAlertEngine(t *testing.T, rules ...AlertRule) *alertEngine {
+	t.Helper()
+	e, err := newAlertEngine(AlertsConfig{Rules: rules, HistorySize: 100}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// evaluateSeries evaluates the first rule of e on values taken every
+// interval from start, and returns the state of the rule after each
+func evaluateSeries(e *alertEngine, start time.Time, interval time.Duration, values []float64) []string {
+	rs := e.rules[0]
+	states := make([]string, len(values))
+	for i, value := range values {
+		e.evaluate(rs, value, start.Add(time.Duration(i)*interval))
+		states[i] = rs.state
+	}
+	return states
+}
+
+// alternating returns n values alternating between a and b
+func alternating(n int, a, b float64) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = a
+		if i%2 == 1 {
+			values[i] = b
+		}
+	}
+	return values
+}
+
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestAddEWMA(t *testing.T) {
+	var b alertBaseline
+	b.addEWMA(10, 0, time.Hour)
+	if mean, stddev := b.stats(); mean != 10 || stddev != 0 || b.count != 1 {
+		t.Fatalf("after one value: mean %v, stddev %v, count %d", mean, stddev, b.count)
+	}
+	// While few values were seen they weigh the same, so the baseline is
+	// their mean and population variance
+	b.addEWMA(20, time.Second, time.Hour)
+	b.addEWMA(30, time.Second, time.Hour)
+	if mean, stddev := b.stats(); !closeTo(mean, 20) || !closeTo(stddev*stddev, 200.0/3) {
+		t.Errorf("after 10, 20, 30: mean %v, variance %v, want 20 and 66.67", mean, stddev*stddev)
+	}
+
+	// Once many were seen, a value after one half-life weighs half
+	b = alertBaseline{count: 1000}
+	b.addEWMA(10, time.Hour, time.Hour)
+	if mean, stddev := b.stats(); !closeTo(mean, 5) || !closeTo(stddev*stddev, 25) {
+		t.Errorf("after a half-life: mean %v, variance %v, want 5 and 25", mean, stddev*stddev)
+	}
+	// and a value after two half-lives three quarters
+	b = alertBaseline{count: 1000}
+	b.addEWMA(10, 2*time.Hour, time.Hour)
+	if mean, _ := b.stats(); !closeTo(mean, 7.5) {
+		t.Errorf("after two half-lives: mean %v, want 7.5", mean)
+	}
+	// while a value right after the previous one barely counts
+	b = alertBaseline{count: 1000}
+	b.addEWMA(10, 0, time.Hour)
+	if mean, _ := b.stats(); !closeTo(mean, 10.0/1001) {
+		t.Errorf("without elapsed time: mean %v, want %v", mean, 10.0/1001)
+	}
+}
+
+func TestAddWindow(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := alertBaseline{window: true}
+	if mean, stddev := b.stats(); mean != 0 || stddev != 0 {
+		t.Errorf("empty window: mean %v, stddev %v", mean, stddev)
+	}
+
+	tests := []struct {
+		at         time.Duration
+		value      float64
+		wantCount  int
+		wantMean   float64
+		wantStddev float64
+	}{
+		{0, 10, 1, 10, 0},
+		{30 * time.Second, 20, 2, 15, 5},
+		{60 * time.Second, 30, 3, 20, math.Sqrt(200.0 / 3)},
+		// 0s is more than a minute old, 30s exactly a minute
+		{90 * time.Second, 40, 3, 30, math.Sqrt(200.0 / 3)},
+		{10 * time.Minute, 5, 1, 5, 0},
+	}
+	for _, tt := range tests {
+		b.addWindow(tt.value, start.Add(tt.at), time.Minute)
+		mean, stddev := b.stats()
+		if b.count != tt.wantCount || !closeTo(mean, tt.wantMean) || !closeTo(stddev, tt.wantStddev) {
+			t.Errorf("at %v: count %d, mean %v, stddev %v, want %d, %v, %v", tt.at, b.count, mean, stddev, tt.wantCount, tt.wantMean, tt.wantStddev)
+		}
+	}
+}
+
+func TestEvaluateAnomaly(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	// 30 values of 10 and 12 learn a mean of 11 and a deviation of 1
+	learn := alternating(30, 10, 12)
+	series := func(values ...float64) []float64 {
+		return append(append([]float64{}, learn...), values...)
+	}
+
+	tests := []struct {
+		name   string
+		rule   AlertRule
+		values []float64
+		// want are the states after the learned values
+		want []string
+	}{
+		{
+			name:   "fires and resolves",
+			rule:   AlertRule{MinSamples: 30},
+			values: series(11, 15, 30, 12, 11),
+			want:   []string{alertOK, alertFiring, alertFiring, alertOK, alertOK},
+		},
+		{
+			name:   "below",
+			rule:   AlertRule{MinSamples: 30},
+			values: series(7),
+			want:   []string{alertFiring},
+		},
+		{
+			name:   "only above",
+			rule:   AlertRule{MinSamples: 30, Direction: "above"},
+			values: series(0, 30),
+			want:   []string{alertOK, alertFiring},
+		},
+		{
+			name:   "only below",
+			rule:   AlertRule{MinSamples: 30, Direction: "below"},
+			values: series(30, 0),
+			want:   []string{alertOK, alertFiring},
+		},
+		{
+			name:   "resolve z-score",
+			rule:   AlertRule{MinSamples: 30, ZScore: 4, ResolveZScore: 2},
+			values: series(14, 16, 15, 13, 12),
+			want:   []string{alertOK, alertFiring, alertFiring, alertOK, alertOK},
+		},
+		{
+			name:   "held for a while",
+			rule:   AlertRule{MinSamples: 30, For: 20 * time.Second},
+			values: series(20, 20, 20, 11),
+			want:   []string{alertPending, alertPending, alertFiring, alertOK},
+		},
+		{
+			name:   "learning",
+			rule:   AlertRule{MinSamples: 40},
+			values: series(100),
+			want:   []string{alertOK},
+		},
+		{
+			name:   "minimum deviation",
+			rule:   AlertRule{MinSamples: 30, MinDeviation: 5},
+			values: series(20, 30),
+			want:   []string{alertOK, alertFiring},
+		},
+		{
+			name:   "window",
+			rule:   AlertRule{MinSamples: 30, Baseline: baselineWindow, Window: 10 * time.Minute},
+			values: series(20),
+			want:   []string{alertFiring},
+		},
+		{
+			name:   "window too short to learn",
+			rule:   AlertRule{MinSamples: 30, Baseline: baselineWindow, Window: time.Minute},
+			values: series(20),
+			want:   []string{alertOK},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Name, tt.rule.Type, tt.rule.Metric = "cpu", alertAnomaly, "cpuUsage"
+			e := testAlertEngine(t, tt.rule)
+			states := evaluateSeries(e, start, 10*time.Second, tt.values)
+			for i, state := range states[:len(learn)] {
+				if state != alertOK {
+					t.Fatalf("state after learned value %d is %s", i, state)
+				}
+			}
+			if got := states[len(learn):]; strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got states %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateAnomalyConstant(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	values := append(alternating(30, 50, 50), 50.5)
+	for _, tt := range []struct {
+		minDeviation float64
+		want         string
+	}{
+		// Without a floor, a metric that never changed has no deviation to
+		// score against and never fires
+		{0, alertOK},
+		{0.1, alertFiring},
+		{1, alertOK},
+	} {
+		e := testAlertEngine(t, AlertRule{Name: "cpu", Type: alertAnomaly, Metric: "cpuUsage", MinSamples: 30, MinDeviation: tt.minDeviation})
+		states := evaluateSeries(e, start, 10*time.Second, values)
+		last := e.rules[0].last
+		if got := states[len(states)-1]; got != tt.want {
+			t.Errorf("with minDeviation %v: state %s, want %s (%s)", tt.minDeviation, got, tt.want, last.Message)
+		}
+		if last.Stddev == nil || *last.Stddev != 0 || *last.Mean != 50 {
+			t.Errorf("with minDeviation %v: baseline %v ± %v, want 50 ± 0", tt.minDeviation, last.Mean, last.Stddev)
+		}
+	}
+}
+
+func TestEvaluateAnomalySeasonal(t *testing.T) {
+	// Every night at 3am a backup takes the CPU to 90%; the rest of the
+	// time it is around 10%
+	e := testAlertEngine(t, AlertRule{Name: "cpu", Type: alertAnomaly, Metric: "cpuUsage", MinSamples: 10, Seasonal: true, HalfLife: 24 * time.Hour})
+	rs := e.rules[0]
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+	for d := range 10 {
+		for hour := range 24 {
+			value := 10.0 + float64(d%2)
+			if hour == 3 {
+				value = 90 + float64(d%2)
+			}
+			e.evaluate(rs, value, day.AddDate(0, 0, d).Add(time.Duration(hour)*time.Hour))
+		}
+	}
+	for hour, baseline := range rs.baselines {
+		if baseline.count != 10 {
+			t.Fatalf("baseline of %d:00 learned %d values, want 10", hour, baseline.count)
+		}
+	}
+	if mean, _ := rs.baselines[3].stats(); math.Abs(mean-90.5) > 0.5 {
+		t.Errorf("baseline of 3:00 has mean %v, want about 90.5", mean)
+	}
+
+	next := day.AddDate(0, 0, 10)
+	if alert, _ := e.evaluate(rs, 90, next.Add(3*time.Hour)); rs.state != alertOK {
+		t.Errorf("backup at 3:00 is %s: %s", rs.state, alert.Message)
+	}
+	if alert, _ := e.evaluate(rs, 90, next.Add(4*time.Hour)); rs.state != alertFiring {
+		t.Errorf("backup at 4:00 is %s: %s", rs.state, alert.Message)
+	}
+}
+
+func TestEvaluateThreshold(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	resolve := 80.0
+
+	tests := []struct {
+		name   string
+		rule   AlertRule
+		values []float64
+		want   []string
+	}{
+		{
+			name:   "flapping",
+			rule:   AlertRule{},
+			values: []float64{95, 85, 95, 90, 91},
+			want:   []string{alertFiring, alertOK, alertFiring, alertOK, alertFiring},
+		},
+		{
+			name:   "held for a while",
+			rule:   AlertRule{For: 20 * time.Second},
+			values: []float64{95, 85, 95, 95, 95, 85},
+			want:   []string{alertPending, alertOK, alertPending, alertPending, alertFiring, alertOK},
+		},
+		{
+			name:   "resolve threshold",
+			rule:   AlertRule{Resolve: &resolve},
+			values: []float64{95, 85, 91, 80, 85, 95},
+			want:   []string{alertFiring, alertFiring, alertFiring, alertOK, alertOK, alertFiring},
+		},
+		{
+			name:   "held for a while with resolve threshold",
+			rule:   AlertRule{For: 20 * time.Second, Resolve: &resolve},
+			values: []float64{95, 95, 95, 85, 75, 95, 85, 95},
+			want:   []string{alertPending, alertPending, alertFiring, alertFiring, alertOK, alertPending, alertOK, alertPending},
+		},
+		{
+			name:   "cooldown",
+			rule:   AlertRule{Cooldown: time.Minute},
+			values: []float64{95, 70, 95, 95, 85, 95, 95, 95, 95},
+			// resolved at 10s, so it may fire again from 70s
+			want: []string{alertFiring, alertOK, alertPending, alertPending, alertOK, alertPending, alertPending, alertFiring, alertFiring},
+		},
+		{
+			name:   "cooldown with for",
+			rule:   AlertRule{For: 40 * time.Second, Cooldown: 30 * time.Second},
+			values: []float64{95, 95, 95, 95, 95, 70, 95, 95, 95, 95, 95},
+			want:   []string{alertPending, alertPending, alertPending, alertPending, alertFiring, alertOK, alertPending, alertPending, alertPending, alertPending, alertFiring},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Name, tt.rule.Metric, tt.rule.Op, tt.rule.Value = "cpu", "cpuUsage", ">", 90
+			e := testAlertEngine(t, tt.rule)
+			if got := evaluateSeries(e, start, 10*time.Second, tt.values); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got states %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateThresholdAlerts(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	resolve := 80.0
+	e := testAlertEngine(t, AlertRule{Name: "cpu", Metric: "cpuUsage", Op: ">", Value: 90, Resolve: &resolve, For: 10 * time.Second})
+	rs := e.rules[0]
+
+	tests := []struct {
+		value         float64
+		wantSent      bool
+		wantState     string
+		wantSince     time.Duration
+		wantThreshold float64
+	}{
+		{95, false, alertPending, 0, 90},
+		{95, true, alertFiring, 0, 90},
+		{85, false, alertFiring, 0, 80},
+		{75, true, alertResolved, 30 * time.Second, 80},
+		{85, false, alertOK, 30 * time.Second, 90},
+	}
+	for i, tt := range tests {
+		now := start.Add(time.Duration(i) * 10 * time.Second)
+		alert, sent := e.evaluate(rs, tt.value, now)
+		if sent != tt.wantSent || alert.State != tt.wantState || !alert.Since.Equal(start.Add(tt.wantSince)) || *alert.Threshold != tt.wantThreshold {
+			t.Errorf("value %d of %v: got %s since %v with threshold %v (sent %t), want %s since %v with threshold %v (sent %t)",
+				i, tt.value, alert.State, alert.Since, *alert.Threshold, sent, tt.wantState, start.Add(tt.wantSince), tt.wantThreshold, tt.wantSent)
+		}
+	}
+}
+
+func TestObserve(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	// cpu-warn and cpu-crit alert on the same problem, so only the first
+	// transition of the group is sent and only the first firing rule repeats
+	e := testAlertEngine(t,
+		AlertRule{Name: "cpu-warn", Metric: "cpuUsage", Op: ">", Value: 80, Group: "cpu", Repeat: 30 * time.Second},
+		AlertRule{Name: "cpu-crit", Metric: "cpuUsage", Op: ">", Value: 95, Group: "cpu", Repeat: 30 * time.Second},
+		AlertRule{Name: "mem", Metric: "memUsage", Op: ">", Value: 90, Repeat: 20 * time.Second},
+	)
+	var sent []string
+	e.publish = func(eventType string, data interface{}) {
+		alert := data.(Alert)
+		if eventType != eventAlert {
+			t.Errorf("published %s event", eventType)
+		}
+		event := fmt.Sprintf("%ds %s %s", int(alert.Timestamp.Sub(start).Seconds()), alert.Rule, alert.State)
+		if alert.Repeat {
+			event += " repeat"
+		}
+		sent = append(sent, event)
+	}
+
+	samples := []struct {
+		cpu, mem float64
+		// failed is the subsystem that failed to collect
+		failed string
+	}{
+		{90, 95, ""},
+		{99, 95, ""},
+		{99, 50, ""},
+		{99, 95, ""},
+		{99, 95, collector.TopicMem},
+		{99, 95, ""},
+		{99, 95, ""},
+		{50, 95, ""},
+	}
+	for i, s := range samples {
+		stats := &models.SystemStats{CPUUsage: s.cpu, MemUsage: s.mem}
+		if s.failed != "" {
+			stats.Errors = map[string]string{s.failed: "permission denied"}
+		}
+		e.observe(models.Sample{Timestamp: start.Add(time.Duration(i) * 10 * time.Second), Stats: stats})
+	}
+
+	want := []string{
+		"0s cpu-warn firing",
+		"0s mem firing",
+		// cpu-crit fires at 10s while cpu-warn is firing
+		"20s mem resolved",
+		"30s cpu-warn firing repeat",
+		"30s mem firing",
+		// mem keeps its state while it fails to collect at 40s
+		"50s mem firing repeat",
+		"60s cpu-warn firing repeat",
+		// cpu-warn resolves while cpu-crit still fires
+		"70s cpu-crit resolved",
+		"70s mem firing repeat",
+	}
+	if strings.Join(sent, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sent\n%s\nwant\n%s", strings.Join(sent, "\n"), strings.Join(want, "\n"))
+	}
+
+	var transitions []string
+	for _, alert := range e.History(time.Time{}, time.Time{}) {
+		transitions = append(transitions, fmt.Sprintf("%ds %s %s", int(alert.Timestamp.Sub(start).Seconds()), alert.Rule, alert.State))
+	}
+	wantTransitions := []string{
+		"0s cpu-warn firing",
+		"0s mem firing",
+		"10s cpu-crit firing",
+		"20s mem resolved",
+		"30s mem firing",
+		"70s cpu-warn resolved",
+		"70s cpu-crit resolved",
+	}
+	if strings.Join(transitions, "\n") != strings.Join(wantTransitions, "\n") {
+		t.Errorf("recorded\n%s\nwant\n%s", strings.Join(transitions, "\n"), strings.Join(wantTransitions, "\n"))
+	}
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"net/http"
+
+	httpSwagger "github.com/swaggo/http-swagger"
+	"github.com/thatbeautifuldream/system-stats-backend/docs"
+)
+
+// setupDocsRoutes serves the OpenAPI spec generated from the swag
+// annotations, and Swagger UI to explore it, under /docs/. The spec is also
+// served converted to OpenAPI 3 at /api/openapi.json.
+func (s *Server) setupDocsRoutes() {
+	// Let "Try it out" call the host serving the docs rather than the
+	// localhost:3000 of the annotations
+	docs.SwaggerInfo.Host = ""
+
+	s.router.Handle("/docs/", httpSwagger.Handler(
+		httpSwagger.URL("/docs/doc.json"),
+		httpSwagger.DeepLinking(true),
+		httpSwagger.DocExpansion("none"),
+		httpSwagger.DomID("swagger-ui"),
+	))
+	// Former location of the docs
+	s.router.Handle("/swagger/", http.RedirectHandler("/docs/", http.StatusMovedPermanently))
+
+	s.router.HandleFunc(apiPrefix+"/openapi.json", s.corsMiddleware(s.rateLimitMiddleware(s.openAPIHandler)))
+}
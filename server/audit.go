@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Outcomes of audited actions
+const (
+	auditSuccess = "success"
+	// auditDenied is the outcome of requests refused for their credentials
+	// or by the config, e.g. with signals disabled
+	auditDenied  = "denied"
+	auditFailure = "failure"
+)
+
+// maxAuditRequest is the size of the largest request body kept in an audit
+// entry; larger or non-JSON bodies are left out
+const maxAuditRequest = 4096
+
+// AuditConfig configures the audit log of the admin actions
+type AuditConfig struct {
+	// Size is the number of entries kept for /api/audit
+	Size int `yaml:"size"`
+}
+
+// AuditEntry records an admin action, whether it succeeded or not
+// @Description An admin action with its principal and outcome
+type AuditEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Action names the admin action, e.g. process.signal
+	Action string `json:"action" example:"process.signal"`
+	Method string `json:"method" example:"POST"`
+	Path   string `json:"path" example:"/api/processes/1234/signal"`
+	// Principal names the client: admin for the admin token, the name of an
+	// auth token, or the basic authentication user. It is empty when the
+	// request carried no valid credentials.
+	Principal string `json:"principal,omitempty" example:"ops"`
+	Role      string `json:"role,omitempty" example:"admin"`
+	// ClientCN is the common name of the client certificate, with mutual TLS
+	ClientCN  string `json:"clientCN,omitempty"`
+	RemoteIP  string `json:"remoteIP" example:"10.0.0.12"`
+	RequestID string `json:"requestID,omitempty"`
+	// Request is the JSON body of the request
+	Request json.RawMessage `json:"request,omitempty" swaggertype:"object"`
+	// Outcome is success, denied, or failure
+	Outcome string `json:"outcome" example:"success"`
+	Status  int    `json:"status" example:"200"`
+	// Error is the start of the response of an action that did not succeed
+	Error string `json:"error,omitempty"`
+}
+
+// auditLog keeps the last audit entries
+type auditLog struct {
+	mu      sync.Mutex
+	entries *ring[AuditEntry]
+}
+
+// newAuditLog creates an audit log of the config
+func newAuditLog(cfg AuditConfig) (*auditLog, error) {
+	if cfg.Size < 1 {
+		return nil, fmt.Errorf("audit.size must be at least 1")
+	}
+	return &auditLog{entries: newRing[AuditEntry](cfg.Size)}, nil
+}
+
+// Record adds an entry
+func (a *auditLog) Record(entry AuditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries.Push(entry)
+}
+
+// Entries returns the entries between from and to (zero times are
+// unbounded) of an action, or of every action when it is empty, oldest first
+func (a *auditLog) Entries(from, to time.Time, action string) []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entries := []AuditEntry{}
+	for _, entry := range a.entries.Slice() {
+		if !from.IsZero() && entry.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && entry.Timestamp.After(to) {
+			continue
+		}
+		if action != "" && entry.Action != action {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Expire drops the entries older than before and returns the number dropped
+func (a *auditLog) Expire(before time.Time) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.entries.DropWhile(func(entry AuditEntry) bool {
+		return entry.Timestamp.Before(before)
+	})
+}
+
+// auditRecorder records the status of a response and the start of its body
+// when the action did not succeed
+type auditRecorder struct {
+	statusRecorder
+	body []byte
+}
+
+func (r *auditRecorder) Write(b []byte) (int, error) {
+	n, err := r.statusRecorder.Write(b)
+	if r.code >= 300 && len(r.body) < 200 {
+		r.body = append(r.body, b[:min(n, 200-len(r.body))]...)
+	}
+	return n, err
+}
+
+// auditMiddleware wraps an admin endpoint and records every request in the
+// audit log and the structured log. It goes outside adminMiddleware, so that
+// the requests refused for their credentials are recorded too.
+func (s *Server) auditMiddleware(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		role, principal := s.credentials(r)
+		entry := AuditEntry{
+			Timestamp: time.Now().UTC(),
+			Action:    action,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Principal: principal,
+			Role:      role,
+			ClientCN:  clientCertCN(r),
+			RequestID: w.Header().Get(requestIDHeader),
+		}
+		if addr := s.access.clientIP(r); addr.IsValid() {
+			entry.RemoteIP = addr.String()
+		}
+
+		// Keep a small JSON body, then hand the whole body to the handler
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxAuditRequest+1))
+		if err == nil && len(body) <= maxAuditRequest && json.Valid(body) {
+			var compact bytes.Buffer
+			if json.Compact(&compact, body) == nil {
+				entry.Request = compact.Bytes()
+			}
+		}
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+
+		rec := &auditRecorder{statusRecorder: statusRecorder{ResponseWriter: w}}
+		next(rec, r)
+
+		entry.Status = rec.code
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		level := slog.LevelWarn
+		switch {
+		case entry.Status < 300:
+			entry.Outcome = auditSuccess
+			level = slog.LevelInfo
+		case entry.Status == http.StatusUnauthorized || entry.Status == http.StatusForbidden:
+			entry.Outcome = auditDenied
+		default:
+			entry.Outcome = auditFailure
+		}
+		if entry.Outcome != auditSuccess {
+			entry.Error = string(bytes.TrimSpace(bytes.ToValidUTF8(rec.body, nil)))
+		}
+		s.audit.Record(entry)
+
+		slog.Log(r.Context(), level, "Audit",
+			"action", entry.Action, "principal", entry.Principal, "role", entry.Role,
+			"clientCN", entry.ClientCN, "remoteIP", entry.RemoteIP, "request", string(entry.Request),
+			"outcome", entry.Outcome, "status", entry.Status, "error", entry.Error)
+	}
+}
+
+// readCloser reads from a Reader and closes a Closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// auditHandler godoc
+// @Summary Get audit log
+// @Description Returns the admin actions (signals, priority changes, watch changes) with their principal and outcome, oldest first, optionally limited to a time range or an action. Requests refused for their credentials are recorded too. The last audit.size entries are kept in memory, for at most retention.audit. Requires the admin token.
+// @Tags audit
+// @Produce json
+// @Security AdminToken
+// @Param from query string false "Only include actions at or after this RFC 3339 timestamp"
+// @Param to query string false "Only include actions at or before this RFC 3339 timestamp"
+// @Param action query string false "Only include this action, e.g. process.signal"
+// @Success 200 {array} AuditEntry
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /audit [get]
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := parseTimeRange(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSONArray(w, r, s.audit.Entries(from, to, r.URL.Query().Get("action")))
+}
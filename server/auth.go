@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Roles of API clients. Admins may do everything viewers may, and also use
+// the endpoints that change the host, e.g. signalling processes.
+const (
+	roleViewer = "viewer"
+	roleAdmin  = "admin"
+	// roleAgent is the role of the agents pushing to the aggregator with
+	// its token
+	roleAgent = "agent"
+)
+
+// APIToken is the bearer token of an API client with its role
+type APIToken struct {
+	// Name identifies the client in logs
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	// Role is viewer or admin
+	Role string `yaml:"role"`
+}
+
+// AuthConfig assigns roles to API clients. The admin token has the admin
+// role, and the basic authentication user the role of basicAuth.
+type AuthConfig struct {
+	Tokens []APIToken `yaml:"tokens"`
+	// RequireViewer refuses the requests without valid credentials on
+	// every route; otherwise only the admin endpoints require credentials
+	RequireViewer bool `yaml:"requireViewer"`
+}
+
+// validate checks the tokens
+func (c AuthConfig) validate() error {
+	seen := map[string]bool{}
+	for _, t := range c.Tokens {
+		if !watchIDPattern.MatchString(t.Name) {
+			return fmt.Errorf("invalid auth.tokens name %q", t.Name)
+		}
+		if t.Token == "" || seen[t.Token] {
+			return fmt.Errorf("auth.tokens %s requires a token used by no other client", t.Name)
+		}
+		if t.Role != roleViewer && t.Role != roleAdmin {
+			return fmt.Errorf("invalid auth.tokens %s role %q (want %s or %s)", t.Name, t.Role, roleViewer, roleAdmin)
+		}
+		seen[t.Token] = true
+	}
+	return nil
+}
+
+// tokenMatches reports in constant time whether token is want, which is
+// unset when empty
+func tokenMatches(token, want string) bool {
+	return want != "" && subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
+
+// credentialsKey is the context key of the credentials of a request
+type credentialsKey struct{}
+
+// requestCredentials are the role and the name of the client of a request,
+// empty when it sent no valid credentials
+type requestCredentials struct {
+	role, name string
+}
+
+// credentialsHandler wraps an http.Handler and verifies the credentials of
+// every request once, for the middleware and handlers that check them.
+// Clients that failed too many basic authentications are refused before
+// bcrypt runs again.
+func (s *Server) credentialsHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, name, wait := s.verifyCredentials(r)
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too many failed authentications", http.StatusTooManyRequests)
+			return
+		}
+		ctx := context.WithValue(r.Context(), credentialsKey{}, requestCredentials{role: role, name: name})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// credentials returns the role and the name of the client of a request as
+// verified by credentialsHandler, or empty strings when it sent none that
+// are valid. Requests served without credentialsHandler are verified here.
+func (s *Server) credentials(r *http.Request) (role, name string) {
+	if c, ok := r.Context().Value(credentialsKey{}).(requestCredentials); ok {
+		return c.role, c.name
+	}
+	role, name, _ = s.verifyCredentials(r)
+	return role, name
+}
+
+// verifyCredentials checks the bearer token or basic credentials of a
+// request. When the basic password cannot be checked because the client
+// failed too many times, it returns how long until it may try again.
+func (s *Server) verifyCredentials(r *http.Request) (role, name string, wait time.Duration) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if tokenMatches(token, s.config.Admin.Token) {
+			return roleAdmin, "admin", 0
+		}
+		if s.config.Aggregator.Enabled && tokenMatches(token, s.config.Aggregator.Token) {
+			return roleAgent, "agent", 0
+		}
+		for _, t := range s.config.Auth.Tokens {
+			if tokenMatches(token, t.Token) {
+				return t.Role, t.Name, 0
+			}
+		}
+		return "", "", 0
+	}
+	if s.basicAuth != nil {
+		ok, wait := s.basicAuth.authorized(r, s.ipKey(r), time.Now())
+		if ok {
+			return s.config.BasicAuth.Role, s.config.BasicAuth.Username, 0
+		}
+		return "", "", wait
+	}
+	return "", "", 0
+}
+
+// adminMiddleware wraps an http.HandlerFunc and requires the credentials of
+// the admin role
+func (s *Server) adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch role, _ := s.credentials(r); role {
+		case roleAdmin:
+			next(w, r)
+		case "":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		default:
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		}
+	}
+}
+
+// Checks of basic passwords against the bcrypt hash are limited per client
+// address, so that guessing passwords cannot pin the CPUs
+const (
+	basicAuthCheckRate  = 0.2
+	basicAuthCheckBurst = 10
+)
+
+// basicAuth checks the credentials of HTTP Basic authentication. Checking a
+// bcrypt hash takes tens of milliseconds, so the digest of the last password
+// that matched is remembered, and the other checks are rate limited per
+// client address: in practice, only the failed ones.
+type basicAuth struct {
+	cfg    BasicAuthConfig
+	hash   *bcryptHash
+	checks *rateLimiter
+
+	mu       sync.Mutex
+	verified [sha256.Size]byte
+}
+
+// newBasicAuth creates the basic authentication of the config
+func newBasicAuth(cfg BasicAuthConfig) (*basicAuth, error) {
+	if cfg.Username == "" || cfg.PasswordHash == "" || cfg.Realm == "" {
+		return nil, fmt.Errorf("basicAuth.username, passwordHash, and realm are required")
+	}
+	if strings.ContainsAny(cfg.Realm, `"\`) {
+		return nil, fmt.Errorf("basicAuth.realm must not contain quotes or backslashes")
+	}
+	if cfg.Role != roleViewer && cfg.Role != roleAdmin {
+		return nil, fmt.Errorf("invalid basicAuth.role %q (want %s or %s)", cfg.Role, roleViewer, roleAdmin)
+	}
+	hash, err := parseBcrypt(cfg.PasswordHash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid basicAuth.passwordHash: %w", err)
+	}
+	return &basicAuth{cfg: cfg, hash: hash, checks: newRateLimiter(basicAuthCheckRate, basicAuthCheckBurst)}, nil
+}
+
+// authorized reports whether a request of the client identified by key
+// carries the basic credentials of the user. When the client has no check
+// left, the password is not checked and it returns how long until the next.
+func (a *basicAuth) authorized(r *http.Request, key string, now time.Time) (bool, time.Duration) {
+	username, password, ok := r.BasicAuth()
+	if !ok || subtle.ConstantTimeCompare([]byte(username), []byte(a.cfg.Username)) != 1 {
+		return false, 0
+	}
+	digest := sha256.Sum256([]byte(password))
+	a.mu.Lock()
+	known := subtle.ConstantTimeCompare(digest[:], a.verified[:]) == 1
+	a.mu.Unlock()
+	if known {
+		return true, 0
+	}
+	if ok, wait := a.checks.Allow(key, now); !ok {
+		return false, wait
+	}
+	if !a.hash.matches([]byte(password)) {
+		return false, 0
+	}
+	a.mu.Lock()
+	a.verified = digest
+	a.mu.Unlock()
+	return true, 0
+}
+
+// authHandler wraps an http.Handler and requires valid credentials on every
+// route when basic authentication or auth.requireViewer is enabled. Bearer
+// tokens are accepted alongside basic credentials, so that agents and
+// clients with a token need not also send a password.
+func (s *Server) authHandler(next http.Handler) http.Handler {
+	if s.basicAuth == nil && !s.config.Auth.RequireViewer {
+		return next
+	}
+	challenge := `Bearer realm="system-stats"`
+	if s.basicAuth != nil {
+		challenge = fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, s.basicAuth.cfg.Realm)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// CORS preflight requests never carry credentials
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if role, _ := s.credentials(r); role == "" {
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
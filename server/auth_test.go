@@ -0,0 +1,113 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testBasicAuthServer returns a server requiring the basic credentials of
+// user with password secret
+func testBasicAuthServer(t *testing.T) *Server {
+	t.Helper()
+	hash, err := hashPassword("secret", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := defaultConfig()
+	cfg.BasicAuth = BasicAuthConfig{Enabled: true, Username: "user", PasswordHash: hash, Realm: "system-stats", Role: roleViewer}
+	s := &Server{config: cfg}
+	if s.basicAuth, err = newBasicAuth(cfg.BasicAuth); err != nil {
+		t.Fatal(err)
+	}
+	if s.access, err = newIPAccess(cfg.Access); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestBasicAuthThrottled(t *testing.T) {
+	s := testBasicAuthServer(t)
+	handler := s.credentialsHandler(s.authHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	request := func(addr, password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/stats", nil)
+		r.RemoteAddr = addr + ":1234"
+		r.SetBasicAuth("user", password)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request("10.0.0.1", "secret"); w.Code != http.StatusOK {
+		t.Fatalf("right password: status %d, want 200", w.Code)
+	}
+	// The right password took the first check
+	for i := range basicAuthCheckBurst - 1 {
+		if w := request("10.0.0.1", "wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d: status %d, want 401", i, w.Code)
+		}
+	}
+	w := request("10.0.0.1", "wrong")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("wrong password over the limit: status %d, Retry-After %q, want 429 and a delay", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := request("10.0.0.1", "secret"); w.Code != http.StatusOK {
+		t.Errorf("verified password over the limit: status %d, want 200", w.Code)
+	}
+	if w := request("10.0.0.2", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("other client: status %d, want 401", w.Code)
+	}
+}
+
+func TestCredentialsVerifiedOnce(t *testing.T) {
+	s := testBasicAuthServer(t)
+	var role string
+	handler := s.credentialsHandler(s.securityHandler(s.authHandler(s.rateLimitMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		role, _ = s.credentials(r)
+	}))))
+	for _, password := range []string{"wrong", "secret"} {
+		r := httptest.NewRequest(http.MethodPost, "/stats", strings.NewReader("{}"))
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.SetBasicAuth("user", password)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	// The wrong and the first right password each took one check
+	if tokens := s.basicAuth.checks.buckets["ip:10.0.0.1"].tokens; int(tokens) != basicAuthCheckBurst-2 {
+		t.Errorf("%v checks left, want %d", tokens, basicAuthCheckBurst-2)
+	}
+	if role != roleViewer {
+		t.Errorf("role = %q, want %q", role, roleViewer)
+	}
+}
+
+func TestVerifyCredentials(t *testing.T) {
+	s := testBasicAuthServer(t)
+	s.config.Admin.Token = "admin-token"
+	s.config.Auth.Tokens = []APIToken{{Name: "grafana", Token: "viewer-token", Role: roleViewer}}
+	tests := []struct {
+		name     string
+		header   string
+		wantRole string
+		wantName string
+	}{
+		{"admin", "Bearer admin-token", roleAdmin, "admin"},
+		{"token", "Bearer viewer-token", roleViewer, "grafana"},
+		{"unknown token", "Bearer other", "", ""},
+		{"basic", "Basic dXNlcjpzZWNyZXQ=", roleViewer, "user"},
+		{"wrong user", "Basic b3RoZXI6c2VjcmV0", "", ""},
+		{"none", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/stats", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			role, name, wait := s.verifyCredentials(r)
+			if role != tt.wantRole || name != tt.wantName || wait != 0 {
+				t.Errorf("verifyCredentials() = %q, %q, %v, want %q, %q, 0", role, name, wait, tt.wantRole, tt.wantName)
+			}
+		})
+	}
+}
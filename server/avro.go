@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// avroSampleSchema is the Avro schema of a sample, in Parsing Canonical Form
+// so that its fingerprint can be computed directly. Processes and the values
+// of extra collectors are left out; timestamp is in milliseconds.
+const avroSampleSchema = `{"name":"systemstats.Sample","type":"record","fields":[` +
+	`{"name":"host","type":"string"},` +
+	`{"name":"seq","type":"long"},` +
+	`{"name":"timestamp","type":"long"},` +
+	`{"name":"cpuUsage","type":"double"},` +
+	`{"name":"memUsage","type":"double"},` +
+	`{"name":"diskUsage","type":"double"},` +
+	`{"name":"netTraffic","type":"long"},` +
+	`{"name":"processCount","type":"long"},` +
+	`{"name":"labels","type":{"type":"map","values":"string"}},` +
+	`{"name":"errors","type":{"type":"map","values":"string"}}]}`
+
+// avroSampleFingerprint is the CRC-64-AVRO fingerprint of avroSampleSchema,
+// used by the single-object encoding
+var avroSampleFingerprint = avroFingerprint(avroSampleSchema)
+
+// appendAvroSample appends the binary Avro encoding of a sample of host
+func appendAvroSample(b []byte, host string, sample models.Sample) []byte {
+	stats := sample.Stats
+	processCount := stats.ProcessCount
+	if processCount == 0 {
+		processCount = len(stats.Processes)
+	}
+	b = appendAvroString(b, host)
+	b = binary.AppendVarint(b, int64(sample.Seq))
+	b = binary.AppendVarint(b, sample.Timestamp.UnixMilli())
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(stats.CPUUsage))
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(stats.MemUsage))
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(stats.DiskUsage))
+	b = binary.AppendVarint(b, stats.NetTraffic)
+	b = binary.AppendVarint(b, int64(processCount))
+	b = appendAvroMap(b, stats.Labels)
+	return appendAvroMap(b, stats.Errors)
+}
+
+// appendAvroSingleObject appends a sample in the Avro single-object
+// encoding: a marker, the schema fingerprint, and the binary encoding
+func appendAvroSingleObject(b []byte, host string, sample models.Sample) []byte {
+	b = append(b, 0xc3, 0x01)
+	b = binary.LittleEndian.AppendUint64(b, avroSampleFingerprint)
+	return appendAvroSample(b, host, sample)
+}
+
+// Avro longs, and the lengths and counts below, are zigzag varints like
+// those of encoding/binary
+
+func appendAvroString(b []byte, s string) []byte {
+	b = binary.AppendVarint(b, int64(len(s)))
+	return append(b, s...)
+}
+
+// appendAvroMap writes m as a single block followed by the end marker
+func appendAvroMap(b []byte, m map[string]string) []byte {
+	if len(m) > 0 {
+		b = binary.AppendVarint(b, int64(len(m)))
+		for _, key := range labelNames(m) {
+			b = appendAvroString(b, key)
+			b = appendAvroString(b, m[key])
+		}
+	}
+	return append(b, 0)
+}
+
+// avroFingerprint computes the CRC-64-AVRO (Rabin) fingerprint of a schema
+// in Parsing Canonical Form
+func avroFingerprint(schema string) uint64 {
+	const empty = 0xc15d213aa4d7a795
+	var table [256]uint64
+	for i := range table {
+		fp := uint64(i)
+		for j := 0; j < 8; j++ {
+			fp = fp>>1 ^ empty&-(fp&1)
+		}
+		table[i] = fp
+	}
+
+	fp := uint64(empty)
+	for i := 0; i < len(schema); i++ {
+		fp = fp>>8 ^ table[byte(fp)^schema[i]]
+	}
+	return fp
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+func TestAvroFingerprint(t *testing.T) {
+	tests := []struct {
+		schema string
+		want   uint64
+	}{
+		{`"int"`, 0x7275d51a3f395c8f},
+		{avroSampleSchema, 0x8b55ea3c9859a8b6},
+	}
+	for _, tt := range tests {
+		if got := avroFingerprint(tt.schema); got != tt.want {
+			t.Errorf("avroFingerprint(%s) = %#x, want %#x", tt.schema, got, tt.want)
+		}
+	}
+}
+
+func TestAppendAvroSingleObject(t *testing.T) {
+	stats := models.SystemStats{
+		CPUUsage:     12.5,
+		MemUsage:     50.25,
+		DiskUsage:    75,
+		NetTraffic:   1048576,
+		ProcessCount: 312,
+		Labels:       map[string]string{"env": "prod", "role": "web"},
+		Errors:       map[string]string{"disk": "permission denied"},
+	}
+	bare := models.SystemStats{Processes: make([]models.ProcessInfo, 3)}
+
+	// Both decode with a reference implementation of the schema
+	tests := []struct {
+		name  string
+		stats models.SystemStats
+		want  string
+	}{
+		{"full", stats, "c301" + "b6a859983cea558b" + // marker, fingerprint
+			"0c" + "7765622d3031" + // host
+			"0e" + // seq
+			"80f8b4c0e663" + // timestamp
+			"0000000000002940" + "0000000000204940" + "0000000000c05240" + // cpuUsage, memUsage, diskUsage
+			"80808001" + // netTraffic
+			"f004" + // processCount
+			"04" + "06656e76" + "0870726f64" + "08726f6c65" + "06776562" + "00" + // labels
+			"02" + "086469736b" + "227065726d697373696f6e2064656e696564" + "00"}, // errors
+		{"empty", bare, "c301" + "b6a859983cea558b" +
+			"0c" + "7765622d3031" +
+			"0e" +
+			"80f8b4c0e663" +
+			"0000000000000000" + "0000000000000000" + "0000000000000000" +
+			"00" +
+			"06" + // processCount from the processes listed
+			"00" + "00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sample := models.Sample{Seq: 7, Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Stats: &tt.stats}
+			if got := hex.EncodeToString(appendAvroSingleObject(nil, "web-01", sample)); got != tt.want {
+				t.Errorf("appendAvroSingleObject() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptHash is a bcrypt hash, e.g.
+// $2b$10$<22 characters of salt><31 characters of checksum>
+type bcryptHash struct {
+	hash []byte
+}
+
+// parseBcrypt checks a bcrypt hash of version 2, 2a, 2b, or 2y
+func parseBcrypt(hash string) (*bcryptHash, error) {
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return nil, err
+	}
+	return &bcryptHash{hash: []byte(hash)}, nil
+}
+
+// matches reports whether password hashes to h
+func (h *bcryptHash) matches(password []byte) bool {
+	return bcrypt.CompareHashAndPassword(h.hash, password) == nil
+}
+
+// hashPassword returns the bcrypt hash of password with a random salt
+func hashPassword(password string, cost int) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	return string(hash), err
+}
+
+// RunHashPasswordCommand reads a password from the first line of the
+// standard input, prints its bcrypt hash for basicAuth.passwordHash, and
+// exits
+func RunHashPasswordCommand() {
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		fmt.Fprintln(os.Stderr, "no password on the standard input")
+		os.Exit(1)
+	}
+	hash, err := hashPassword(password, bcrypt.DefaultCost)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error hashing the password:", err)
+		os.Exit(1)
+	}
+	fmt.Println(hash)
+	os.Exit(0)
+}
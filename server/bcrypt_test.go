@@ -0,0 +1,59 @@
+package server
+
+import "testing"
+
+func TestBcryptMatches(t *testing.T) {
+	// known answers from the OpenBSD and Openwall test vectors
+	tests := []struct {
+		hash     string
+		password string
+		want     bool
+	}{
+		{"$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", "U*U", true},
+		{"$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", "U*V", false},
+		{"$2a$05$CCCCCCCCCCCCCCCCCCCCC.VGOzA784oUp/Z0DY336zx7pLYAy0lwK", "U*U*", true},
+		{"$2a$05$XXXXXXXXXXXXXXXXXXXXXOAcXxm9kjPGEMsLznoKqmqw7tc8WCx4a", "U*U*U", true},
+		{"$2a$06$DCq7YPn5Rq63x1Lad4cll.TV4S6ytwfsfvkgY8jIucDrjc8deX1s.", "", true},
+		{"$2a$06$DCq7YPn5Rq63x1Lad4cll.TV4S6ytwfsfvkgY8jIucDrjc8deX1s.", "a", false},
+	}
+	for _, tt := range tests {
+		h, err := parseBcrypt(tt.hash)
+		if err != nil {
+			t.Fatalf("parseBcrypt(%q): %v", tt.hash, err)
+		}
+		if got := h.matches([]byte(tt.password)); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.hash, tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestParseBcryptInvalid(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"password",
+		"$2a$05$short",
+		"$1$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW",
+		"$2a$99$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW",
+	} {
+		if _, err := parseBcrypt(hash); err == nil {
+			t.Errorf("parseBcrypt(%q) succeeded, want an error", hash)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := hashPassword("secret", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := parseBcrypt(hash)
+	if err != nil {
+		t.Fatalf("parseBcrypt(%q): %v", hash, err)
+	}
+	if !h.matches([]byte("secret")) {
+		t.Errorf("%q does not match its password", hash)
+	}
+	if h.matches([]byte("Secret")) {
+		t.Errorf("%q matches a different password", hash)
+	}
+}
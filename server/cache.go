@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// statsCache shares the on-demand collections of /api/stats, so that many
+// pollers do not each run a process scan. Requests for the same subsystems
+// arriving while a collection is running wait for it, and its result is
+// served to later requests for ttl. Failed collections are not cached.
+type statsCache struct {
+	ttl     time.Duration
+	stats   StatsProvider
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+// cacheEntry is one collection of a set of subsystems
+type cacheEntry struct {
+	// done is closed when the collection finishes
+	done  chan struct{}
+	stats *models.SystemStats
+	err   error
+	at    time.Time
+}
+
+func newStatsCache(ttl time.Duration, stats StatsProvider) *statsCache {
+	return &statsCache{ttl: ttl, stats: stats, entries: map[string]*cacheEntry{}}
+}
+
+// Get returns the stats of topics, collecting them unless a collection
+// younger than the TTL exists. fresh skips the cached result, but still
+// joins a collection that is already running. The returned stats are shared
+// and must not be modified.
+func (c *statsCache) Get(ctx context.Context, topics collector.TopicSet, fresh bool) (*models.SystemStats, error) {
+	key := topicsKey(topics)
+
+	c.mu.Lock()
+	entry := c.entries[key]
+	if entry == nil || !entry.running() && (fresh || entry.err != nil || time.Since(entry.at) >= c.ttl) {
+		entry = &cacheEntry{done: make(chan struct{})}
+		c.entries[key] = entry
+		// Detached from the request, so that one client going away does
+		// not fail the collection the others are waiting for
+		go c.collect(entry, topics)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-entry.done:
+		return entry.stats, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *statsCache) collect(entry *cacheEntry, topics collector.TopicSet) {
+	entry.stats, entry.err = c.stats.Collect(context.Background(), topics)
+	entry.at = time.Now()
+	close(entry.done)
+}
+
+// running reports whether the collection of the entry has not finished
+func (e *cacheEntry) running() bool {
+	select {
+	case <-e.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// topicsKey identifies a set of subsystems
+func topicsKey(topics collector.TopicSet) string {
+	names := make([]string, 0, len(topics))
+	for topic := range topics {
+		names = append(names, topic)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// Nagios plugin states, used as CLI exit codes
+const (
+	checkOK       = 0
+	checkWarning  = 1
+	checkCritical = 2
+	checkUnknown  = 3
+)
+
+var checkStateNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// checkStatusCodes maps plugin states to HTTP status codes. check_http
+// reports 4xx as WARNING and 5xx as CRITICAL by default.
+var checkStatusCodes = []int{
+	http.StatusOK,
+	http.StatusPreconditionFailed,
+	http.StatusServiceUnavailable,
+	http.StatusInternalServerError,
+}
+
+// checkMetric describes a metric that can be checked against thresholds
+type checkMetric struct {
+	topic string
+	unit  string
+	// max is the upper bound reported in the performance data, if any
+	max   string
+	value func(*models.SystemStats) float64
+}
+
+var checkMetrics = map[string]checkMetric{
+	"cpu":       {collector.TopicCPU, "%", "100", func(s *models.SystemStats) float64 { return s.CPUUsage }},
+	"mem":       {collector.TopicMem, "%", "100", func(s *models.SystemStats) float64 { return s.MemUsage }},
+	"disk":      {collector.TopicDisk, "%", "100", func(s *models.SystemStats) float64 { return s.DiskUsage }},
+	"processes": {collector.TopicProcesses, "", "", func(s *models.SystemStats) float64 { return float64(max(s.ProcessCount, len(s.Processes))) }},
+}
+
+// checkQuery is a metric with optional warning and critical thresholds. The
+// state is raised when the value is at or above a threshold.
+type checkQuery struct {
+	Metric string
+	Warn   *float64
+	Crit   *float64
+}
+
+// parseCheckQuery parses the metric, warn, and crit query parameters
+func parseCheckQuery(values url.Values) (checkQuery, error) {
+	query := checkQuery{Metric: values.Get("metric")}
+	if _, ok := checkMetrics[query.Metric]; !ok {
+		names := make([]string, 0, len(checkMetrics))
+		for name := range checkMetrics {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return query, fmt.Errorf("invalid metric %q: must be one of %s", query.Metric, strings.Join(names, ", "))
+	}
+
+	for _, param := range []struct {
+		name string
+		dst  **float64
+	}{{"warn", &query.Warn}, {"crit", &query.Crit}} {
+		v := values.Get(param.name)
+		if v == "" {
+			continue
+		}
+		threshold, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return query, fmt.Errorf("invalid %s %q: must be a number", param.name, v)
+		}
+		*param.dst = &threshold
+	}
+	return query, nil
+}
+
+// evaluate returns the plugin state and output line for stats, e.g.
+// "CPU OK - cpu is 12.50% | cpu=12.5%;80;95;0;100"
+func (q checkQuery) evaluate(stats *models.SystemStats) (int, string) {
+	metric := checkMetrics[q.Metric]
+	if err, ok := stats.Errors[metric.topic]; ok {
+		return checkUnknown, fmt.Sprintf("%s UNKNOWN - %s", strings.ToUpper(q.Metric), err)
+	}
+	value := metric.value(stats)
+
+	state := checkOK
+	if q.Crit != nil && value >= *q.Crit {
+		state = checkCritical
+	} else if q.Warn != nil && value >= *q.Warn {
+		state = checkWarning
+	}
+
+	threshold := func(t *float64) string {
+		if t == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*t, 'f', -1, 64)
+	}
+	lower := ""
+	if metric.max != "" {
+		lower = "0"
+	}
+	perfdata := fmt.Sprintf("%s=%s%s;%s;%s;%s;%s", q.Metric, strconv.FormatFloat(value, 'f', -1, 64), metric.unit,
+		threshold(q.Warn), threshold(q.Crit), lower, metric.max)
+
+	display := strconv.FormatFloat(value, 'f', -1, 64)
+	if metric.unit == "%" {
+		display = strconv.FormatFloat(value, 'f', 2, 64)
+	}
+	return state, fmt.Sprintf("%s %s - %s is %s%s | %s",
+		strings.ToUpper(q.Metric), checkStateNames[state], q.Metric, display, metric.unit, perfdata)
+}
+
+// runCheck collects the metric of a check from the command line. CPU usage
+// is measured over a short interval, as a single reading has no baseline.
+func runCheck(stats StatsProvider, query checkQuery) (int, string) {
+	topics := collector.TopicSet{checkMetrics[query.Metric].topic: true}
+	if query.Metric == "cpu" {
+		if _, err := stats.Collect(context.Background(), topics); err != nil {
+			return checkUnknown, fmt.Sprintf("%s UNKNOWN - %v", strings.ToUpper(query.Metric), err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	sample, err := stats.Collect(context.Background(), topics)
+	if err != nil {
+		return checkUnknown, fmt.Sprintf("%s UNKNOWN - %v", strings.ToUpper(query.Metric), err)
+	}
+	return query.evaluate(sample)
+}
+
+// RunCheckCommand runs a check from the command line flags with the
+// collector settings of the config file at configPath, prints the plugin
+// output line, and exits with the plugin state
+func RunCheckCommand(configPath, metric, warn, crit string) {
+	query, err := parseCheckQuery(url.Values{"metric": {metric}, "warn": {warn}, "crit": {crit}})
+	if err == nil {
+		var cfg *Config
+		if cfg, err = LoadConfig(configPath); err == nil {
+			err = applyCollectorConfig(cfg)
+		}
+	}
+	if err != nil {
+		fmt.Println("UNKNOWN - " + err.Error())
+		os.Exit(checkUnknown)
+	}
+
+	state, line := runCheck(collectorProvider{}, query)
+	fmt.Println(line)
+	os.Exit(state)
+}
+
+// checkHandler godoc
+// @Summary Nagios-style check
+// @Description Checks a metric of the latest sample against warning and critical thresholds and returns a Nagios plugin output line. The status code reflects the state: 200 OK, 412 WARNING, 503 CRITICAL, 500 UNKNOWN.
+// @Tags stats
+// @Produce plain
+// @Param metric query string true "Metric to check" Enums(cpu, mem, disk, processes)
+// @Param warn query number false "Warning threshold, reached when the value is at or above it"
+// @Param crit query number false "Critical threshold, reached when the value is at or above it"
+// @Success 200 {string} string "CPU OK - cpu is 12.50% | cpu=12.5%;80;95;0;100"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 412 {string} string "WARNING"
+// @Failure 429 {string} string "Too Many Requests"
+// @Failure 500 {string} string "UNKNOWN"
+// @Failure 503 {string} string "CRITICAL"
+// @Router /check [get]
+func (s *Server) checkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := parseCheckQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, "UNKNOWN - "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var state int
+	var line string
+	if sample, ok := s.history.Latest(); ok {
+		state, line = query.evaluate(sample.Stats)
+	} else {
+		state, line = runCheck(s.stats, query)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(checkStatusCodes[state])
+	fmt.Fprintln(w, line)
+}
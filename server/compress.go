@@ -0,0 +1,139 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// compressibleTypes are the content types worth compressing
+var compressibleTypes = []string{
+	"application/json",
+	"text/event-stream",
+	"text/plain",
+	"text/csv",
+	"text/html",
+	"text/css",
+	"application/javascript",
+	"text/javascript",
+	mediaMsgpack,
+	mediaProtobuf,
+}
+
+// gzipResponseWriter compresses the response body when the handler writes a
+// compressible content type. Compression is decided when the header is written.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	pool        *sync.Pool
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+
+	h := g.Header()
+	if code != http.StatusNoContent && code != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && isCompressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		g.gz = g.pool.Get().(*gzip.Writer)
+		g.gz.Reset(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(code)
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.gz != nil {
+		return g.gz.Write(b)
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+// Flush pushes buffered compressed data to the client so streams such as SSE
+// are not held back by the compressor
+func (g *gzipResponseWriter) Flush() {
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// close finishes the gzip stream and returns the writer to the pool
+func (g *gzipResponseWriter) close() {
+	if g.gz == nil {
+		return
+	}
+	g.gz.Close()
+	g.gz.Reset(io.Discard)
+	g.pool.Put(g.gz)
+	g.gz = nil
+}
+
+// isCompressible reports whether contentType is one of compressibleTypes
+func isCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	for _, t := range compressibleTypes {
+		if strings.EqualFold(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip reports whether the client accepts a gzip-encoded response
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		// "gzip;q=0" explicitly refuses gzip
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// compressHandler wraps an http.Handler and gzips compressible responses for
+// clients that accept it
+func (s *Server) compressHandler(next http.Handler) http.Handler {
+	cfg := s.config.Compression
+	if !cfg.Enabled {
+		return next
+	}
+
+	pool := &sync.Pool{New: func() interface{} {
+		// The level is validated when the config is loaded
+		gz, _ := gzip.NewWriterLevel(io.Discard, cfg.Level)
+		return gz
+	}}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, pool: pool}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
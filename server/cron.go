@@ -0,0 +1,206 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression (minute, hour, day of
+// month, month, day of week) evaluated in local time. Each field is a bit
+// set of the values it matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar are set when the day fields start with *, in which
+	// case a day must match both fields; otherwise matching either is enough
+	domStar, dowStar bool
+}
+
+// cronField describes the range and value names of a cron field
+type cronField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var cronFields = [5]cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is accepted for Sunday as well as 0
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// cronMacros are the predefined schedules accepted in place of the fields
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCron parses a cron expression. Fields are *, values, ranges (a-b),
+// steps (*/n, a-b/n, a/n), or comma-separated lists of those; months and
+// days of the week may also be given by their three-letter English names.
+func parseCron(expr string) (*cronSchedule, error) {
+	spec := strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields (minute hour day-of-month month day-of-week)", expr)
+	}
+
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+		}
+		sets[i] = set
+	}
+	// Fold Sunday as 7 into 0
+	if sets[4]&(1<<7) != 0 {
+		sets[4] = sets[4]&^(1<<7) | 1
+	}
+
+	return &cronSchedule{
+		minute:  sets[0],
+		hour:    sets[1],
+		dom:     sets[2],
+		month:   sets[3],
+		dow:     sets[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseCronField parses one field into the bit set of the values it matches
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(field, ",") {
+		expr, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepText, spec.name)
+			}
+		}
+
+		var lo, hi int
+		switch {
+		case expr == "*":
+			lo, hi = spec.min, spec.max
+		case strings.Contains(expr, "-"):
+			loText, hiText, _ := strings.Cut(expr, "-")
+			var err error
+			if lo, err = cronValue(loText, spec); err != nil {
+				return 0, err
+			}
+			if hi, err = cronValue(hiText, spec); err != nil {
+				return 0, err
+			}
+			// Ranges may end on Sunday as 0, e.g. mon-sun
+			if spec.max == 7 && hi == 0 {
+				hi = 7
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %q in %s field", expr, spec.name)
+			}
+		default:
+			var err error
+			if lo, err = cronValue(expr, spec); err != nil {
+				return 0, err
+			}
+			hi = lo
+			// a/n steps from a to the end of the range
+			if hasStep {
+				hi = spec.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// cronValue parses a number or name within the range of a field
+func cronValue(text string, spec cronField) (int, error) {
+	for i, name := range spec.names {
+		if strings.EqualFold(text, name) {
+			return i + spec.min, nil
+		}
+	}
+	v, err := strconv.Atoi(text)
+	if err != nil || v < spec.min || v > spec.max {
+		return 0, fmt.Errorf("invalid value %q in %s field (want %d-%d)", text, spec.name, spec.min, spec.max)
+	}
+	return v, nil
+}
+
+// Next returns the first time after t matching the schedule, or the zero
+// time when none does within five years (e.g. for February 30). Like cron,
+// times skipped when DST starts never match, and when DST ends schedules
+// with fixed hours match only the first of the repeated times while those
+// with an hour of * match both.
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	from := wallClock(t)
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = cronAdvance(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+		case !c.dayMatches(t):
+			t = cronAdvance(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = cronAdvance(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc))
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		case c.hour != cronAllHours && !wallClock(t).After(from):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// cronAdvance returns next, the start of a later hour than t. time.Date
+// resolves a time skipped when DST starts to one before the gap, possibly t
+// itself, so next then moves forward past the gap.
+func cronAdvance(t, next time.Time) time.Time {
+	for !next.After(t) {
+		next = next.Add(time.Hour)
+	}
+	return next
+}
+
+// cronAllHours is the hour field of *
+const cronAllHours = 1<<24 - 1
+
+// wallClock returns the date and time of day of t, ignoring its offset
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// dayMatches reports whether the day of t matches the day fields
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
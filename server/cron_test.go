@@ -0,0 +1,114 @@
+package server
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// cronBits returns the bit set of values
+func cronBits(values ...int) uint64 {
+	var set uint64
+	for _, v := range values {
+		set |= 1 << v
+	}
+	return set
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    *cronSchedule
+		wantErr bool
+	}{
+		{"*/15 * * * *", &cronSchedule{minute: cronBits(0, 15, 30, 45), hour: cronAllHours, dom: cronBits(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31), month: cronBits(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12), dow: cronBits(0, 1, 2, 3, 4, 5, 6), domStar: true, dowStar: true}, false},
+		{"0 9 1,15 * mon-sun", &cronSchedule{minute: 1, hour: cronBits(9), dom: cronBits(1, 15), month: cronBits(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12), dow: cronBits(0, 1, 2, 3, 4, 5, 6)}, false},
+		{"0 0 * * 7", &cronSchedule{minute: 1, hour: 1, dom: cronBits(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31), month: cronBits(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12), dow: cronBits(0), domStar: true}, false},
+		{"5/20 8-18/5 * jan,JUL Sat", &cronSchedule{minute: cronBits(5, 25, 45), hour: cronBits(8, 13, 18), dom: cronBits(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31), month: cronBits(1, 7), dow: cronBits(6), domStar: true}, false},
+		{"@Weekly", &cronSchedule{minute: 1, hour: 1, dom: cronBits(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31), month: cronBits(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12), dow: cronBits(0), domStar: true}, false},
+		{"* * * *", nil, true},
+		{"* * * * * *", nil, true},
+		{"60 * * * *", nil, true},
+		{"* 24 * * *", nil, true},
+		{"* * 0 * *", nil, true},
+		{"* * * 13 *", nil, true},
+		{"* * * * 8", nil, true},
+		{"*/0 * * * *", nil, true},
+		{"30-10 * * * *", nil, true},
+		{"* * * foo *", nil, true},
+		{"@every 5m", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := parseCron(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCron() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && *got != *tt.want {
+				t.Errorf("parseCron() = %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Santiago starts DST at midnight: 2024-09-08 begins at 01:00
+	santiago, err := time.LoadLocation("America/Santiago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+	// Times around the DST changes of New York: 02:00 EST becomes 03:00 EDT
+	// on 2024-03-10, and 02:00 EDT becomes 01:00 EST on 2024-11-03
+	est := time.FixedZone("EST", -5*3600)
+	edt := time.FixedZone("EDT", -4*3600)
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"every 15 minutes", "*/15 * * * *", utc(2024, 5, 1, 10, 7), utc(2024, 5, 1, 10, 15)},
+		{"on a match", "*/15 * * * *", utc(2024, 5, 1, 10, 15), utc(2024, 5, 1, 10, 30)},
+		{"within a minute", "*/15 * * * *", utc(2024, 5, 1, 10, 14).Add(59 * time.Second), utc(2024, 5, 1, 10, 15)},
+		{"next hour", "*/15 * * * *", utc(2024, 5, 1, 10, 50), utc(2024, 5, 1, 11, 0)},
+		{"next year", "0 0 1 1 *", utc(2024, 12, 31, 23, 59), utc(2025, 1, 1, 0, 0)},
+		{"mon-sun", "0 9 * * mon-sun", utc(2024, 5, 4, 9, 0), utc(2024, 5, 5, 9, 0)},
+		{"7 as Sunday", "0 0 * * 7", utc(2024, 5, 1, 0, 0), utc(2024, 5, 5, 0, 0)},
+		{"0 as Sunday", "0 0 * * 0", utc(2024, 5, 1, 0, 0), utc(2024, 5, 5, 0, 0)},
+		{"weekdays", "30 8 * * mon-fri", utc(2024, 5, 3, 9, 0), utc(2024, 5, 6, 8, 30)},
+		{"day of month or week", "0 0 13 * fri", utc(2024, 5, 1, 0, 0), utc(2024, 5, 3, 0, 0)},
+		{"day of month and every weekday", "0 0 13 * *", utc(2024, 5, 1, 0, 0), utc(2024, 5, 13, 0, 0)},
+		{"31st", "0 0 31 * *", utc(2024, 4, 1, 0, 0), utc(2024, 5, 31, 0, 0)},
+		{"leap day", "0 0 29 2 *", utc(2024, 3, 1, 0, 0), utc(2028, 2, 29, 0, 0)},
+		{"never", "0 0 30 2 *", utc(2024, 1, 1, 0, 0), time.Time{}},
+		{"skipped by DST start", "30 2 * * *", time.Date(2024, 3, 10, 0, 0, 0, 0, newYork), time.Date(2024, 3, 11, 2, 30, 0, 0, newYork)},
+		{"hourly across DST start", "30 * * * *", time.Date(2024, 3, 10, 1, 30, 0, 0, newYork), time.Date(2024, 3, 10, 3, 30, 0, 0, newYork)},
+		{"first of repeated times", "30 1 * * *", time.Date(2024, 11, 3, 0, 0, 0, 0, edt), time.Date(2024, 11, 3, 1, 30, 0, 0, edt)},
+		{"repeated time once", "30 1 * * *", time.Date(2024, 11, 3, 1, 30, 0, 0, edt), time.Date(2024, 11, 4, 1, 30, 0, 0, est)},
+		{"day starting after DST start", "0 * 8 9 *", time.Date(2024, 9, 7, 12, 0, 0, 0, santiago), time.Date(2024, 9, 8, 1, 0, 0, 0, santiago)},
+		{"hourly across DST end", "30 * * * *", time.Date(2024, 11, 3, 1, 30, 0, 0, edt), time.Date(2024, 11, 3, 1, 30, 0, 0, est)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from := tt.from
+			if from.Location() == edt || from.Location() == est {
+				from = from.In(newYork)
+			}
+			if got := schedule.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", from, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// RuntimeStats reports the Go runtime state of the server itself
+type RuntimeStats struct {
+	Goroutines   int     `json:"goroutines"`
+	HeapAlloc    uint64  `json:"heapAlloc"`
+	HeapSys      uint64  `json:"heapSys"`
+	HeapObjects  uint64  `json:"heapObjects"`
+	TotalAlloc   uint64  `json:"totalAlloc"`
+	Sys          uint64  `json:"sys"`
+	NumGC        uint32  `json:"numGc"`
+	PauseTotalMs float64 `json:"pauseTotalMs"`
+	LastGC       string  `json:"lastGc,omitempty"`
+	GOMAXPROCS   int     `json:"gomaxprocs"`
+}
+
+// setupDebugRoutes registers net/http/pprof and the runtime stats under
+// /debug, behind the admin token
+func (s *Server) setupDebugRoutes() {
+	s.router.HandleFunc("/debug/pprof/", s.adminMiddleware(pprof.Index))
+	s.router.HandleFunc("/debug/pprof/cmdline", s.adminMiddleware(pprof.Cmdline))
+	s.router.HandleFunc("/debug/pprof/profile", s.adminMiddleware(extendWriteDeadline(pprof.Profile)))
+	s.router.HandleFunc("/debug/pprof/symbol", s.adminMiddleware(pprof.Symbol))
+	s.router.HandleFunc("/debug/pprof/trace", s.adminMiddleware(extendWriteDeadline(pprof.Trace)))
+	s.router.HandleFunc("/debug/runtime", s.adminMiddleware(s.runtimeStatsHandler))
+}
+
+// extendWriteDeadline lets profiles run longer than the server write
+// timeout: the deadline is moved to the requested duration plus a margin
+func extendWriteDeadline(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seconds, err := strconv.ParseFloat(r.URL.Query().Get("seconds"), 64)
+		if err != nil || seconds <= 0 {
+			seconds = 30
+		}
+		deadline := time.Now().Add(time.Duration(seconds*float64(time.Second)) + 10*time.Second)
+		if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil {
+			slog.WarnContext(r.Context(), "Error extending write deadline", "error", err)
+		}
+
+		next(w, r)
+	}
+}
+
+// runtimeStatsHandler returns the goroutine count, heap, and GC statistics
+func (s *Server) runtimeStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	stats := RuntimeStats{
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    m.HeapAlloc,
+		HeapSys:      m.HeapSys,
+		HeapObjects:  m.HeapObjects,
+		TotalAlloc:   m.TotalAlloc,
+		Sys:          m.Sys,
+		NumGC:        m.NumGC,
+		PauseTotalMs: float64(m.PauseTotalNs) / float64(time.Millisecond),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+	}
+	if m.LastGC > 0 {
+		stats.LastGC = time.Unix(0, int64(m.LastGC)).UTC().Format(time.RFC3339Nano)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
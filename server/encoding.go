@@ -0,0 +1,305 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// Response formats of the stats endpoints
+const (
+	mediaJSON     = "application/json"
+	mediaMsgpack  = "application/msgpack"
+	mediaProtobuf = "application/x-protobuf"
+	mediaCSV      = "text/csv"
+)
+
+// formatNames maps the values of the format query parameter to response formats
+var formatNames = map[string]string{
+	"json":     mediaJSON,
+	"msgpack":  mediaMsgpack,
+	"protobuf": mediaProtobuf,
+	"csv":      mediaCSV,
+}
+
+// mediaAliases maps accepted media types to the format served for them
+var mediaAliases = map[string]string{
+	"application/json":        mediaJSON,
+	"application/*":           mediaJSON,
+	"*/*":                     mediaJSON,
+	"application/msgpack":     mediaMsgpack,
+	"application/x-msgpack":   mediaMsgpack,
+	"application/vnd.msgpack": mediaMsgpack,
+	"application/x-protobuf":  mediaProtobuf,
+	"application/protobuf":    mediaProtobuf,
+	"text/csv":                mediaCSV,
+}
+
+// negotiateFormat picks the response format from the format query parameter
+// or else the supported type with the highest quality in the Accept header,
+// falling back to JSON when nothing supported is listed
+func negotiateFormat(r *http.Request) (string, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		format, ok := formatNames[name]
+		if !ok {
+			return "", fmt.Errorf("invalid format %q: must be one of json, msgpack, protobuf, csv", name)
+		}
+		return format, nil
+	}
+
+	format, best, specific := mediaJSON, 0.0, false
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		served, ok := mediaAliases[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		// At equal quality an explicit type beats a wildcard, then the first listed wins
+		explicit := !strings.Contains(mediaType, "*")
+		if q > best || (q == best && explicit && !specific) {
+			format, best, specific = served, q, explicit
+		}
+	}
+	return format, nil
+}
+
+// addVary adds header to the Vary header of the response unless it is
+// already listed
+func addVary(w http.ResponseWriter, header string) {
+	if !slices.Contains(w.Header().Values("Vary"), header) {
+		w.Header().Add("Vary", header)
+	}
+}
+
+// writeStats writes stats in the negotiated format, limited to the topics in
+// the set. Protobuf leaves the excluded fields unset.
+func writeStats(w http.ResponseWriter, r *http.Request, stats *models.SystemStats, topics collector.TopicSet) {
+	addVary(w, "Accept")
+	format, err := negotiateFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch format {
+	case mediaCSV:
+		writeCSV(w, r, statsCSVHeader(topics), [][]string{statsCSVRecord(stats, topics)})
+	case mediaProtobuf:
+		masked := *stats
+		topics.Mask(&masked)
+		writeBody(w, r, mediaProtobuf, marshalStatsProto(&masked), nil)
+	case mediaMsgpack:
+		body, err := marshalMsgpack(topics.Filter(stats))
+		writeBody(w, r, mediaMsgpack, body, err)
+	default:
+		writeJSON(w, r, topics.Filter(stats))
+	}
+}
+
+// writeSamples writes history samples in the negotiated format
+func writeSamples(w http.ResponseWriter, r *http.Request, samples []models.Sample) {
+	addVary(w, "Accept")
+	format, err := negotiateFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch format {
+	case mediaCSV:
+		header := append([]string{"seq", "timestamp"}, statsCSVHeader(collector.AllTopicSet())...)
+		records := make([][]string, len(samples))
+		for i, sample := range samples {
+			records[i] = append([]string{
+				strconv.FormatUint(sample.Seq, 10),
+				sample.Timestamp.Format(time.RFC3339Nano),
+			}, statsCSVRecord(sample.Stats, collector.AllTopicSet())...)
+		}
+		writeCSV(w, r, header, records)
+	case mediaProtobuf:
+		writeBody(w, r, mediaProtobuf, marshalSamplesProto(samples), nil)
+	case mediaMsgpack:
+		body, err := marshalMsgpack(samples)
+		writeBody(w, r, mediaMsgpack, body, err)
+	default:
+		writeJSONArray(w, r, samples)
+	}
+}
+
+// statsCSVHeader returns the CSV columns of the topics in the set. The
+// processes topic becomes a process count, as a list does not fit in a cell.
+func statsCSVHeader(topics collector.TopicSet) []string {
+	header := []string{}
+	for _, topic := range collector.Topics() {
+		if !topics[topic] {
+			continue
+		}
+		if topic == collector.TopicProcesses {
+			header = append(header, "processCount")
+		} else {
+			header = append(header, collector.FieldName(topic))
+		}
+	}
+	return header
+}
+
+// statsCSVRecord returns the CSV cells of stats matching statsCSVHeader.
+// The cells of subsystems that failed to collect are empty.
+func statsCSVRecord(stats *models.SystemStats, topics collector.TopicSet) []string {
+	values := map[string]string{
+		collector.TopicCPU:       strconv.FormatFloat(stats.CPUUsage, 'f', -1, 64),
+		collector.TopicMem:       strconv.FormatFloat(stats.MemUsage, 'f', -1, 64),
+		collector.TopicDisk:      strconv.FormatFloat(stats.DiskUsage, 'f', -1, 64),
+		collector.TopicNet:       strconv.FormatInt(stats.NetTraffic, 10),
+		collector.TopicProcesses: strconv.Itoa(max(stats.ProcessCount, len(stats.Processes))),
+	}
+
+	record := []string{}
+	for _, topic := range collector.Topics() {
+		if !topics[topic] {
+			continue
+		}
+		value, ok := values[topic]
+		if _, failed := stats.Errors[topic]; failed {
+			value = ""
+		} else if !ok {
+			// Values of other collectors are written as JSON
+			if b, err := json.Marshal(stats.Extra[topic]); err == nil {
+				value = string(b)
+			}
+		}
+		record = append(record, value)
+	}
+	return record
+}
+
+// writeCSV writes a CSV response with a header row
+func writeCSV(w http.ResponseWriter, r *http.Request, header []string, records [][]string) {
+	w.Header().Set("Content-Type", mediaCSV+"; charset=utf-8")
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	cw.WriteAll(records)
+	if err := cw.Error(); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	w.Header().Set("Content-Type", mediaJSON)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
+
+// writeJSONArray writes items as a JSON array response. The elements are
+// encoded one at a time, so that long lists start arriving at once and are
+// never held encoded in memory as a whole.
+func writeJSONArray[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	w.Header().Set("Content-Type", mediaJSON)
+	err := encodeJSONArray(w, items)
+	if err == nil {
+		_, err = io.WriteString(w, "\n")
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
+
+// jsonField is a field of an object written by writeJSONObject
+type jsonField struct {
+	Name  string
+	Value interface{}
+}
+
+// writeJSONObject writes a JSON object response made of fields followed by
+// the field name holding items, which are encoded one at a time like
+// writeJSONArray does
+func writeJSONObject[T any](w http.ResponseWriter, r *http.Request, fields []jsonField, name string, items []T) {
+	w.Header().Set("Content-Type", mediaJSON)
+	err := encodeJSONObject(w, fields, name, items)
+	if err == nil {
+		_, err = io.WriteString(w, "\n")
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
+
+func encodeJSONObject[T any](w io.Writer, fields []jsonField, name string, items []T) error {
+	head := []byte{'{'}
+	for _, field := range fields {
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return err
+		}
+		head = strconv.AppendQuote(head, field.Name)
+		head = append(head, ':')
+		head = append(head, value...)
+		head = append(head, ',')
+	}
+	head = strconv.AppendQuote(head, name)
+	head = append(head, ':')
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+	if err := encodeJSONArray(w, items); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "}")
+	return err
+}
+
+// encodeJSONArray writes items as a JSON array, encoding one element at a
+// time. A nil slice is written as an empty array.
+func encodeJSONArray[T any](w io.Writer, items []T) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i, item := range items {
+		b, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b = append([]byte{','}, b...)
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+// writeBody writes an already encoded response body
+func writeBody(w http.ResponseWriter, r *http.Request, contentType string, body []byte, err error) {
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+}
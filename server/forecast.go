@@ -0,0 +1,201 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// Forecast methods
+const (
+	// forecastLinear fits a least-squares line through the samples
+	forecastLinear = "linear"
+	// forecastHolt is Holt's double exponential smoothing, which follows
+	// recent changes of the trend more closely
+	forecastHolt = "holt"
+)
+
+// Smoothing factors of the Holt forecast, per sample
+const (
+	holtAlpha = 0.3
+	holtBeta  = 0.1
+)
+
+// forecastMaxHours bounds the projected time to full: beyond a century the
+// trend is noise of an idle disk, and the time would overflow a Duration
+const forecastMaxHours = 100 * 365 * 24
+
+// DiskForecast represents the projected fill of a filesystem
+// @Description Projected fill of a filesystem from the trend of its usage
+type DiskForecast struct {
+	Mountpoint string `json:"mountpoint" example:"/"`
+	Method     string `json:"method" example:"linear"`
+	// Samples is the number of samples the trend was fitted on; the other
+	// fields are unset with fewer than two
+	Samples int        `json:"samples" example:"1800"`
+	From    *time.Time `json:"from,omitempty" example:"2024-01-01T06:00:00Z"`
+	To      *time.Time `json:"to,omitempty" example:"2024-01-01T12:00:00Z"`
+	// Usage is the fitted usage percentage at To
+	Usage *float64 `json:"usage,omitempty" example:"81.5"`
+	// Trend is the change of the usage in percentage points per hour
+	Trend *float64 `json:"trend,omitempty" example:"0.4"`
+	// FullAt and HoursToFull are unset when the usage is not growing or would
+	// take over a century to fill the filesystem
+	FullAt      *time.Time `json:"fullAt,omitempty" example:"2024-01-03T02:15:00Z"`
+	HoursToFull *float64   `json:"hoursToFull,omitempty" example:"46.2"`
+}
+
+// forecastDisks projects when each filesystem of the last sample fills up,
+// the one of diskUsage first
+func forecastDisks(samples []models.Sample, method string) []DiskForecast {
+	if len(samples) == 0 || len(samples[len(samples)-1].Stats.Filesystems) == 0 {
+		return []DiskForecast{forecastDisk(samples, method, "")}
+	}
+	var forecasts []DiskForecast
+	for _, fs := range samples[len(samples)-1].Stats.Filesystems {
+		forecasts = append(forecasts, forecastDisk(samples, method, fs.Mountpoint))
+	}
+	return forecasts
+}
+
+// forecastDisk projects when the filesystem mounted at mountpoint fills up
+// from the trend of its usage in samples, or the filesystem of diskUsage
+// when mountpoint is empty. Samples whose disk collection failed, that lack
+// the filesystem, or in which it is stale are left out.
+func forecastDisk(samples []models.Sample, method, mountpoint string) DiskForecast {
+	forecast := DiskForecast{Mountpoint: mountpoint, Method: method}
+	if mountpoint == "" {
+		// Samples from before the filesystems were reported only have the
+		// root filesystem
+		forecast.Mountpoint = "/"
+		if n := len(samples); n > 0 && len(samples[n-1].Stats.Filesystems) > 0 {
+			forecast.Mountpoint = samples[n-1].Stats.Filesystems[0].Mountpoint
+		}
+	}
+
+	var times []time.Time
+	var usages []float64
+	for _, sample := range samples {
+		if _, failed := sample.Stats.Errors[collector.TopicDisk]; failed {
+			continue
+		}
+		usage := sample.Stats.DiskUsage
+		if mountpoint == "" && len(sample.Stats.Filesystems) > 0 && sample.Stats.Filesystems[0].Stale {
+			continue
+		}
+		if mountpoint != "" {
+			i := slices.IndexFunc(sample.Stats.Filesystems, func(fs models.Filesystem) bool { return fs.Mountpoint == mountpoint })
+			if i < 0 || sample.Stats.Filesystems[i].Stale {
+				continue
+			}
+			usage = sample.Stats.Filesystems[i].UsedPercent
+		}
+		times = append(times, sample.Timestamp)
+		usages = append(usages, usage)
+	}
+	forecast.Samples = len(usages)
+	if len(usages) < 2 {
+		return forecast
+	}
+	from, to := times[0], times[len(times)-1]
+	forecast.From, forecast.To = &from, &to
+	hours := to.Sub(from).Hours()
+	if hours <= 0 {
+		return forecast
+	}
+
+	var usage, trend float64
+	switch method {
+	case forecastHolt:
+		usage, trend = usages[0], usages[1]-usages[0]
+		for _, u := range usages[1:] {
+			previous := usage
+			usage = holtAlpha*u + (1-holtAlpha)*(usage+trend)
+			trend = holtBeta*(usage-previous) + (1-holtBeta)*trend
+		}
+		// Convert the trend per sample to one per hour
+		trend *= float64(len(usages)-1) / hours
+	default:
+		// Least squares on hours since the first sample
+		var sumX, sumY, sumXY, sumXX float64
+		for i, u := range usages {
+			x := times[i].Sub(from).Hours()
+			sumX += x
+			sumY += u
+			sumXY += x * u
+			sumXX += x * x
+		}
+		n := float64(len(usages))
+		denominator := n*sumXX - sumX*sumX
+		if denominator == 0 {
+			return forecast
+		}
+		trend = (n*sumXY - sumX*sumY) / denominator
+		usage = (sumY-trend*sumX)/n + trend*hours
+	}
+	forecast.Usage, forecast.Trend = &usage, &trend
+
+	if trend > 0 {
+		if hoursToFull := max(100-usage, 0) / trend; hoursToFull <= forecastMaxHours {
+			fullAt := to.Add(time.Duration(hoursToFull * float64(time.Hour)))
+			forecast.HoursToFull, forecast.FullAt = &hoursToFull, &fullAt
+		}
+	}
+	return forecast
+}
+
+// parseForecastMethod parses the method query parameter
+func parseForecastMethod(v string) (string, error) {
+	switch v {
+	case "":
+		return forecastLinear, nil
+	case forecastLinear, forecastHolt:
+		return v, nil
+	}
+	return "", fmt.Errorf("invalid method %q: must be %s or %s", v, forecastLinear, forecastHolt)
+}
+
+// diskForecastHandler godoc
+// @Summary Forecast disk fill
+// @Description Fits a trend on the disk usage of the samples of the in-memory history taken within the window and projects when each monitored filesystem fills up, the one of diskUsage first. The linear method fits a least-squares line; holt (double exponential smoothing) follows recent changes of the trend more closely.
+// @Tags stats
+// @Produce json
+// @Param window query string false "Only fit the samples taken within this duration before now, e.g. 6h (default the whole history)"
+// @Param method query string false "Trend model" Enums(linear, holt)
+// @Success 200 {array} DiskForecast
+// @Failure 400 {string} string "Bad Request"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /forecast/disk [get]
+func (s *Server) diskForecastHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	method, err := parseForecastMethod(r.URL.Query().Get("method"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var from time.Time
+	if v := r.URL.Query().Get("window"); v != "" {
+		window, err := time.ParseDuration(v)
+		if err != nil || window <= 0 {
+			http.Error(w, fmt.Sprintf("invalid window %q: must be a positive duration such as 6h", v), http.StatusBadRequest)
+			return
+		}
+		from = time.Now().Add(-window)
+	}
+
+	forecasts := forecastDisks(s.history.Range(from, time.Time{}), method)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(forecasts); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// diskSamples returns a sample per hour with the disk usages
+func diskSamples(usages ...float64) []models.Sample {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := make([]models.Sample, len(usages))
+	for i, usage := range usages {
+		samples[i] = models.Sample{
+			Seq:       uint64(i + 1),
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+			Stats:     &models.SystemStats{DiskUsage: usage},
+		}
+	}
+	return samples
+}
+
+// series returns n usages starting at start and changing by step
+func series(n int, start, step float64) []float64 {
+	usages := make([]float64, n)
+	for i := range usages {
+		usages[i] = start + float64(i)*step
+	}
+	return usages
+}
+
+func TestForecastDisk(t *testing.T) {
+	tests := []struct {
+		name        string
+		usages      []float64
+		wantTrend   float64
+		wantHours   float64
+		wantFull    bool
+		wantSamples int
+	}{
+		{"flat", series(11, 50, 0), 0, 0, false, 11},
+		{"growing", series(11, 50, 1), 1, 40, true, 11},
+		{"shrinking", series(11, 60, -1), -1, 0, false, 11},
+		{"tiny trend", series(11, 50, 1e-8), 1e-8, 0, false, 11},
+		{"full", series(11, 90, 1), 1, 0, true, 11},
+		{"one sample", []float64{50}, 0, 0, false, 1},
+	}
+	for _, method := range []string{forecastLinear, forecastHolt} {
+		for _, tt := range tests {
+			t.Run(method+" "+tt.name, func(t *testing.T) {
+				forecast := forecastDisk(diskSamples(tt.usages...), method, "")
+				if forecast.Samples != tt.wantSamples {
+					t.Fatalf("Samples = %d, want %d", forecast.Samples, tt.wantSamples)
+				}
+				if tt.wantSamples < 2 {
+					if forecast.Trend != nil || forecast.FullAt != nil {
+						t.Errorf("forecast of %d samples has a trend", tt.wantSamples)
+					}
+					return
+				}
+				if forecast.Trend == nil || math.Abs(*forecast.Trend-tt.wantTrend) > 1e-9 {
+					t.Errorf("Trend = %v, want %v", forecast.Trend, tt.wantTrend)
+				}
+				if (forecast.FullAt != nil) != tt.wantFull || (forecast.HoursToFull != nil) != tt.wantFull {
+					t.Fatalf("FullAt = %v, HoursToFull = %v, want set %v", forecast.FullAt, forecast.HoursToFull, tt.wantFull)
+				}
+				if !tt.wantFull {
+					return
+				}
+				if math.Abs(*forecast.HoursToFull-tt.wantHours) > 1e-6 {
+					t.Errorf("HoursToFull = %v, want %v", *forecast.HoursToFull, tt.wantHours)
+				}
+				if got := forecast.FullAt.Sub(*forecast.To).Hours(); math.Abs(got-tt.wantHours) > 1e-6 {
+					t.Errorf("FullAt is %vh after To, want %vh", got, tt.wantHours)
+				}
+			})
+		}
+	}
+}
+
+func TestForecastDiskSkipsFailedSamples(t *testing.T) {
+	samples := diskSamples(50, 0, 52)
+	samples[1].Stats.Errors = map[string]string{collector.TopicDisk: "error"}
+	forecast := forecastDisk(samples, forecastLinear, "")
+	if forecast.Samples != 2 || forecast.Trend == nil || math.Abs(*forecast.Trend-1) > 1e-9 {
+		t.Errorf("forecast = %d samples, trend %v, want 2 samples, trend 1", forecast.Samples, forecast.Trend)
+	}
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// grafanaMetrics are the series exposed to Grafana, keyed by target name
+var grafanaMetrics = map[string]func(*models.SystemStats) float64{
+	"cpuUsage":     func(s *models.SystemStats) float64 { return s.CPUUsage },
+	"memUsage":     func(s *models.SystemStats) float64 { return s.MemUsage },
+	"diskUsage":    func(s *models.SystemStats) float64 { return s.DiskUsage },
+	"netTraffic":   func(s *models.SystemStats) float64 { return float64(s.NetTraffic) },
+	"processCount": func(s *models.SystemStats) float64 { return float64(max(s.ProcessCount, len(s.Processes))) },
+}
+
+// GrafanaSearchRequest is the body of a search request
+// @Description Metric search request sent by the Grafana JSON datasource
+type GrafanaSearchRequest struct {
+	Target string `json:"target" example:"cpu"`
+}
+
+// GrafanaRange is the time range of a query
+// @Description Time range of a Grafana query
+type GrafanaRange struct {
+	From time.Time `json:"from" example:"2024-01-01T12:00:00Z"`
+	To   time.Time `json:"to" example:"2024-01-01T13:00:00Z"`
+}
+
+// GrafanaTarget is a metric requested by a query
+// @Description Metric requested by a Grafana query
+type GrafanaTarget struct {
+	Target string `json:"target" example:"cpuUsage"`
+	// "timeserie" (default) or "table"
+	Type string `json:"type,omitempty" example:"timeserie"`
+}
+
+// GrafanaQueryRequest is the body of a query request
+// @Description Query request sent by the Grafana JSON datasource
+type GrafanaQueryRequest struct {
+	Range         GrafanaRange    `json:"range"`
+	Targets       []GrafanaTarget `json:"targets"`
+	MaxDataPoints int             `json:"maxDataPoints" example:"500"`
+}
+
+// GrafanaTimeSeries is a time series response
+// @Description Time series of one target as [value, unix milliseconds] pairs
+type GrafanaTimeSeries struct {
+	Target     string       `json:"target" example:"cpuUsage"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// GrafanaColumn describes a table column
+// @Description Column of a Grafana table response
+type GrafanaColumn struct {
+	Text string `json:"text" example:"Time"`
+	Type string `json:"type" example:"time"`
+}
+
+// GrafanaTable is a table response
+// @Description Table of one target with time and value columns
+type GrafanaTable struct {
+	Type    string          `json:"type" example:"table"`
+	Columns []GrafanaColumn `json:"columns"`
+	Rows    [][]float64     `json:"rows"`
+}
+
+// GrafanaAnnotationRequest is the body of an annotations request
+// @Description Annotations request sent by the Grafana JSON datasource
+type GrafanaAnnotationRequest struct {
+	Range GrafanaRange `json:"range"`
+}
+
+// GrafanaAnnotation is an event shown on Grafana graphs
+// @Description Event shown on Grafana graphs
+type GrafanaAnnotation struct {
+	Title string `json:"title" example:"CPU high"`
+	Text  string `json:"text" example:"cpuUsage above 90"`
+	Time  int64  `json:"time" example:"1704110400000"`
+}
+
+// thinSamples keeps at most max evenly spaced samples (0 keeps all)
+func thinSamples(samples []models.Sample, max int) []models.Sample {
+	if max <= 0 || len(samples) <= max {
+		return samples
+	}
+	thinned := make([]models.Sample, max)
+	for i := range thinned {
+		thinned[i] = samples[i*len(samples)/max]
+	}
+	return thinned
+}
+
+// grafanaTestHandler godoc
+// @Summary Grafana datasource test
+// @Description Answers the connection test of the Grafana JSON datasource. Point the datasource at /api/grafana.
+// @Tags grafana
+// @Success 200
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /grafana/ [get]
+func (s *Server) grafanaTestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// grafanaSearchHandler godoc
+// @Summary Search Grafana metrics
+// @Description Returns the metric names containing the search target, for the query editor of the Grafana JSON datasource
+// @Tags grafana
+// @Accept json
+// @Produce json
+// @Param request body GrafanaSearchRequest false "Search request"
+// @Success 200 {array} string
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /grafana/search [post]
+func (s *Server) grafanaSearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The body is optional, an empty search lists every metric
+	var req GrafanaSearchRequest
+	json.NewDecoder(r.Body).Decode(&req)
+
+	names := []string{}
+	for name := range grafanaMetrics {
+		if strings.Contains(strings.ToLower(name), strings.ToLower(req.Target)) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(names); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
+
+// grafanaQueryHandler godoc
+// @Summary Query Grafana metrics
+// @Description Returns the history samples in the requested range as Grafana time series or tables, thinned to maxDataPoints
+// @Tags grafana
+// @Accept json
+// @Produce json
+// @Param request body GrafanaQueryRequest true "Query request"
+// @Success 200 {array} GrafanaTimeSeries
+// @Failure 400 {string} string "Bad Request"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /grafana/query [post]
+func (s *Server) grafanaQueryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req GrafanaQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	samples := thinSamples(s.history.Range(req.Range.From, req.Range.To), req.MaxDataPoints)
+
+	results := []interface{}{}
+	for _, target := range req.Targets {
+		value, ok := grafanaMetrics[target.Target]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown target %q", target.Target), http.StatusBadRequest)
+			return
+		}
+
+		if target.Type == "table" {
+			table := GrafanaTable{
+				Type:    "table",
+				Columns: []GrafanaColumn{{Text: "Time", Type: "time"}, {Text: target.Target, Type: "number"}},
+				Rows:    make([][]float64, len(samples)),
+			}
+			for i, sample := range samples {
+				table.Rows[i] = []float64{float64(sample.Timestamp.UnixMilli()), value(sample.Stats)}
+			}
+			results = append(results, table)
+			continue
+		}
+
+		series := GrafanaTimeSeries{Target: target.Target, Datapoints: make([][2]float64, len(samples))}
+		for i, sample := range samples {
+			series.Datapoints[i] = [2]float64{value(sample.Stats), float64(sample.Timestamp.UnixMilli())}
+		}
+		results = append(results, series)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
+
+// grafanaAnnotationsHandler godoc
+// @Summary Grafana annotations
+// @Description Returns the alerts that fired or resolved in the requested range as events to show on Grafana graphs
+// @Tags grafana
+// @Accept json
+// @Produce json
+// @Param request body GrafanaAnnotationRequest true "Annotations request"
+// @Success 200 {array} GrafanaAnnotation
+// @Failure 400 {string} string "Bad Request"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /grafana/annotations [post]
+func (s *Server) grafanaAnnotationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req GrafanaAnnotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	annotations := []GrafanaAnnotation{}
+	for _, alert := range s.alerts.History(req.Range.From, req.Range.To) {
+		annotations = append(annotations, GrafanaAnnotation{
+			Title: fmt.Sprintf("%s %s", alert.Rule, alert.State),
+			Text:  alert.Message,
+			Time:  alert.Timestamp.UnixMilli(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(annotations); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
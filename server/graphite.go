@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// graphiteSink pushes samples to a Graphite carbon endpoint using the
+// plaintext protocol over a persistent TCP connection
+type graphiteSink struct {
+	cfg GraphiteConfig
+	// tags are the host labels as Graphite 1.1 tags, e.g. ";env=prod"
+	tags string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// newGraphiteSink creates a Graphite sink. The {host} placeholder of the path
+// template is replaced once, with dots in the hostname turned into underscores.
+// The host labels are sent as tags.
+func newGraphiteSink(cfg GraphiteConfig, hostname string, labels map[string]string) *graphiteSink {
+	host := strings.NewReplacer(".", "_", " ", "_").Replace(hostname)
+	cfg.Template = strings.ReplaceAll(cfg.Template, "{host}", host)
+	var tags strings.Builder
+	for _, name := range labelNames(labels) {
+		tags.WriteString(";" + name + "=" + labels[name])
+	}
+	return &graphiteSink{cfg: cfg, tags: tags.String()}
+}
+
+func (s *graphiteSink) Name() string {
+	return "graphite"
+}
+
+// Write sends one line per metric and sample, e.g. "system.web1.cpu.usage 12.5 1700000000".
+// The connection is re-established on the next write after an error.
+func (s *graphiteSink) Write(ctx context.Context, samples []models.Sample) error {
+	var buf bytes.Buffer
+	for _, sample := range samples {
+		s.appendLines(&buf, sample)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		dialer := net.Dialer{Timeout: s.cfg.Timeout}
+		conn, err := dialer.DialContext(ctx, "tcp", s.cfg.Address)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(s.cfg.Timeout))
+	if _, err := s.conn.Write(buf.Bytes()); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *graphiteSink) appendLines(b *bytes.Buffer, sample models.Sample) {
+	stats := sample.Stats
+	timestamp := " " + strconv.FormatInt(sample.Timestamp.Unix(), 10) + "\n"
+	metrics := []struct {
+		name  string
+		value string
+	}{
+		{"cpu.usage", strconv.FormatFloat(stats.CPUUsage, 'f', -1, 64)},
+		{"mem.usage", strconv.FormatFloat(stats.MemUsage, 'f', -1, 64)},
+		{"disk.usage", strconv.FormatFloat(stats.DiskUsage, 'f', -1, 64)},
+		{"net.traffic", strconv.FormatInt(stats.NetTraffic, 10)},
+		{"processes.count", strconv.Itoa(len(stats.Processes))},
+	}
+	for _, metric := range metrics {
+		b.WriteString(strings.ReplaceAll(s.cfg.Template, "{metric}", metric.name))
+		b.WriteString(s.tags)
+		b.WriteByte(' ')
+		b.WriteString(metric.value)
+		b.WriteString(timestamp)
+	}
+}
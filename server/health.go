@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// staleSampleIntervals is how many collector intervals may pass without a
+// new sample before the service reports itself as not ready
+const staleSampleIntervals = 3
+
+// HealthStatus is the response of the liveness probe
+type HealthStatus struct {
+	Status        string  `json:"status"`
+	UptimeSeconds float64 `json:"uptimeSeconds"`
+}
+
+// ReadinessStatus is the response of the readiness probe
+type ReadinessStatus struct {
+	Status           string     `json:"status"`
+	LastSample       *time.Time `json:"lastSample,omitempty"`
+	SampleAgeSeconds float64    `json:"sampleAgeSeconds,omitempty"`
+	MaxAgeSeconds    float64    `json:"maxAgeSeconds"`
+	Error            string     `json:"error,omitempty"`
+}
+
+// healthzHandler reports that the process is up and serving requests
+func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeProbe(w, r, http.StatusOK, HealthStatus{
+		Status:        "ok",
+		UptimeSeconds: time.Since(s.started).Seconds(),
+	})
+}
+
+// readyzHandler reports whether the collectors are working: the latest
+// collection succeeded and the latest sample is recent. It answers 503
+// otherwise, including before the first sample is collected.
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	maxAge := staleSampleIntervals * s.config.Collector.Interval
+	status := ReadinessStatus{Status: "ok", MaxAgeSeconds: maxAge.Seconds()}
+
+	sample, ok := s.history.Latest()
+	if ok {
+		age := time.Since(sample.Timestamp)
+		status.LastSample = &sample.Timestamp
+		status.SampleAgeSeconds = age.Seconds()
+		if age > maxAge {
+			status.Status = "unavailable"
+			status.Error = "latest sample is stale"
+		}
+	} else {
+		status.Status = "unavailable"
+		status.Error = "no sample collected yet"
+	}
+	if err := s.hub.LastError(); err != nil {
+		status.Status = "unavailable"
+		status.Error = err.Error()
+	}
+
+	code := http.StatusOK
+	if status.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	writeProbe(w, r, code, status)
+}
+
+// writeProbe writes a probe response that must never be cached
+func writeProbe(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// history keeps the most recent samples in memory. Sequence numbers increase
+// monotonically and are used as SSE event IDs.
+type history struct {
+	mu      sync.RWMutex
+	seq     uint64
+	samples *ring[models.Sample]
+	// processLimit is the embedded limit of the process lists served from
+	// the history; 0 keeps every process
+	processLimit int
+}
+
+// newHistory creates a history holding at most size samples, with the
+// processes that can be served with an embedded limit of processLimit
+func newHistory(size, processLimit int) *history {
+	return &history{samples: newRing[models.Sample](size), processLimit: processLimit}
+}
+
+// Append records stats as the next sample. The stats must not be modified
+// afterwards. The returned sample has every process, for the sinks, watches,
+// and alerts, while the history only keeps those it can serve.
+func (h *history) Append(stats *models.SystemStats) models.Sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	sample := models.Sample{Seq: h.seq, Timestamp: time.Now().UTC(), Stats: stats}
+	stored := sample
+	stored.Stats = heaviestProcesses(stats, h.processLimit)
+	h.samples.Push(stored)
+	return sample
+}
+
+// heaviestProcesses returns stats with only the heaviest limit processes by
+// CPU and by memory, the lists topProcs picks from, keeping the process
+// count. Stored stats are shared, so the given ones are copied.
+func heaviestProcesses(stats *models.SystemStats, limit int) *models.SystemStats {
+	if limit == 0 || len(stats.Processes) <= limit {
+		return stats
+	}
+	trimmed := *stats
+	trimmed.ProcessCount = max(stats.ProcessCount, len(stats.Processes))
+	trimmed.Processes = topProcesses(stats.Processes, topProcsQuery{N: limit, SortBy: "cpu"})
+	for _, proc := range topProcesses(stats.Processes, topProcsQuery{N: limit, SortBy: "mem"}) {
+		if !slices.ContainsFunc(trimmed.Processes, func(p models.ProcessInfo) bool { return p.PID == proc.PID }) {
+			trimmed.Processes = append(trimmed.Processes, proc)
+		}
+	}
+	return &trimmed
+}
+
+// Latest returns the most recent sample, if any
+func (h *history) Latest() (models.Sample, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.samples.Last()
+}
+
+// Range returns the retained samples taken between from and to (zero times are unbounded), oldest first
+func (h *history) Range(from, to time.Time) []models.Sample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	samples := []models.Sample{}
+	for _, sample := range h.samples.Slice() {
+		if !from.IsZero() && sample.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && sample.Timestamp.After(to) {
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// Since returns the retained samples with a sequence number greater than seq, oldest first
+func (h *history) Since(seq uint64) []models.Sample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	samples := []models.Sample{}
+	for _, sample := range h.samples.Slice() {
+		if sample.Seq > seq {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// Expire drops the samples taken before statsBefore and removes the process
+// lists of those taken before processesBefore (zero times disable either).
+// It returns the number of samples dropped and stripped.
+func (h *history) Expire(statsBefore, processesBefore time.Time) (dropped, stripped int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !statsBefore.IsZero() {
+		dropped = h.samples.DropWhile(func(sample models.Sample) bool {
+			return sample.Timestamp.Before(statsBefore)
+		})
+	}
+	if !processesBefore.IsZero() {
+		h.samples.Update(func(sample models.Sample) models.Sample {
+			if sample.Timestamp.Before(processesBefore) && len(sample.Stats.Processes) > 0 {
+				sample.Stats = withoutProcesses(sample.Stats)
+				stripped++
+			}
+			return sample
+		})
+	}
+	return dropped, stripped
+}
+
+// parseTimeRange parses the from and to query parameters as RFC 3339 timestamps
+func parseTimeRange(values url.Values) (from, to time.Time, err error) {
+	if v := values.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, fmt.Errorf("invalid from %q: must be an RFC 3339 timestamp", v)
+		}
+	}
+	if v := values.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, fmt.Errorf("invalid to %q: must be an RFC 3339 timestamp", v)
+		}
+	}
+	return from, to, nil
+}
+
+// historyHandler godoc
+// @Summary Get recent samples
+// @Description Returns the samples retained in the in-memory history buffer, optionally limited to a time range. Processes are trimmed with topProcs. The format is negotiated with the Accept header or the format parameter (JSON, MessagePack, Protobuf, or CSV). CSV reports a process count rather than the process list.
+// @Tags stats
+// @Produce json,application/msgpack,application/x-protobuf,text/csv
+// @Param from query string false "Only include samples taken at or after this RFC 3339 timestamp"
+// @Param to query string false "Only include samples taken at or before this RFC 3339 timestamp"
+// @Param topProcs query int false "Only include the N heaviest processes per sample (0 for all, up to processes.embeddedLimit)"
+// @Param sortBy query string false "Key used to pick the heaviest processes" Enums(cpu, mem)
+// @Param format query string false "Response format, overriding the Accept header" Enums(json, msgpack, protobuf, csv)
+// @Success 200 {array} models.Sample
+// @Failure 400 {string} string "Bad Request"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /history [get]
+func (s *Server) historyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := parseTimeRange(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	top, err := parseTopProcsQuery(r.URL.Query(), s.config.Processes.EmbeddedLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	samples := s.history.Range(from, to)
+	for i, sample := range samples {
+		stats := *sample.Stats
+		trimProcesses(&stats, top)
+		samples[i].Stats = &stats
+	}
+
+	writeSamples(w, r, samples)
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// seqs returns the sequence numbers of samples
+func seqs(samples []models.Sample) []uint64 {
+	ids := []uint64{}
+	for _, sample := range samples {
+		ids = append(ids, sample.Seq)
+	}
+	return ids
+}
+
+// testHistory returns a history of size 3 to which 5 samples were appended,
+// one millisecond apart
+func testHistory(t *testing.T) (*history, []models.Sample) {
+	t.Helper()
+	h := newHistory(3, 0)
+	var appended []models.Sample
+	for i := range 5 {
+		appended = append(appended, h.Append(&models.SystemStats{CPUUsage: float64(i)}))
+		time.Sleep(time.Millisecond)
+	}
+	return h, appended
+}
+
+func TestHistorySince(t *testing.T) {
+	h, _ := testHistory(t)
+	tests := []struct {
+		seq  uint64
+		want []uint64
+	}{
+		{0, []uint64{3, 4, 5}},
+		{3, []uint64{4, 5}},
+		{5, []uint64{}},
+		{9, []uint64{}},
+	}
+	for _, tt := range tests {
+		if got := seqs(h.Since(tt.seq)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Since(%d) = %v, want %v", tt.seq, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryRange(t *testing.T) {
+	h, appended := testHistory(t)
+	at := func(seq int) time.Time { return appended[seq-1].Timestamp }
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []uint64
+	}{
+		{"unbounded", time.Time{}, time.Time{}, []uint64{3, 4, 5}},
+		{"from inclusive", at(4), time.Time{}, []uint64{4, 5}},
+		{"to inclusive", time.Time{}, at(4), []uint64{3, 4}},
+		{"both", at(4), at(4), []uint64{4}},
+		{"expired", time.Time{}, at(2), []uint64{}},
+		{"future", at(5).Add(time.Hour), time.Time{}, []uint64{}},
+	}
+	for _, tt := range tests {
+		if got := seqs(h.Range(tt.from, tt.to)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Range() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryAppendTrimsProcesses(t *testing.T) {
+	procs := []models.ProcessInfo{
+		{PID: 1, CPUPercent: 50, MemoryUsage: 10},
+		{PID: 2, CPUPercent: 40, MemoryUsage: 20},
+		{PID: 3, CPUPercent: 1, MemoryUsage: 900},
+		{PID: 4, CPUPercent: 2, MemoryUsage: 30},
+		{PID: 5, CPUPercent: 0, MemoryUsage: 1},
+	}
+	tests := []struct {
+		name      string
+		limit     int
+		wantPIDs  []int32
+		wantCount int
+	}{
+		{"no limit", 0, []int32{1, 2, 3, 4, 5}, 0},
+		{"under the limit", 5, []int32{1, 2, 3, 4, 5}, 0},
+		{"heaviest by CPU and memory", 2, []int32{1, 2, 3, 4}, 5},
+		{"same by both", 1, []int32{1, 3}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistory(10, tt.limit)
+			sample := h.Append(&models.SystemStats{Processes: procs})
+			if len(sample.Stats.Processes) != len(procs) {
+				t.Errorf("appended sample has %d processes, want all %d", len(sample.Stats.Processes), len(procs))
+			}
+			stored, _ := h.Latest()
+			var pids []int32
+			for _, proc := range stored.Stats.Processes {
+				pids = append(pids, proc.PID)
+			}
+			if !reflect.DeepEqual(pids, tt.wantPIDs) || stored.Stats.ProcessCount != tt.wantCount {
+				t.Errorf("stored PIDs %v, count %d, want %v, %d", pids, stored.Stats.ProcessCount, tt.wantPIDs, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestHistoryExpire(t *testing.T) {
+	h := newHistory(10, 0)
+	var appended []models.Sample
+	for i := range 3 {
+		appended = append(appended, h.Append(&models.SystemStats{Processes: []models.ProcessInfo{{PID: int32(i + 1)}, {PID: 100}}}))
+		time.Sleep(time.Millisecond)
+	}
+	dropped, stripped := h.Expire(appended[1].Timestamp, appended[2].Timestamp)
+	if dropped != 1 || stripped != 1 {
+		t.Errorf("Expire() = %d dropped, %d stripped, want 1, 1", dropped, stripped)
+	}
+	samples := h.Since(0)
+	if got := seqs(samples); !reflect.DeepEqual(got, []uint64{2, 3}) {
+		t.Fatalf("retained %v, want [2 3]", got)
+	}
+	if len(samples[0].Stats.Processes) != 0 || samples[0].Stats.ProcessCount != 2 {
+		t.Errorf("stripped sample has %d processes, count %d, want 0, 2", len(samples[0].Stats.Processes), samples[0].Stats.ProcessCount)
+	}
+	if len(samples[1].Stats.Processes) != 2 {
+		t.Errorf("recent sample has %d processes, want 2", len(samples[1].Stats.Processes))
+	}
+	if len(appended[1].Stats.Processes) != 2 {
+		t.Error("Expire() modified the shared stats")
+	}
+}
+
+func TestSSEReplay(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.SSE.Heartbeat = 0
+	cfg.SSE.Retry = 0
+	h, _ := testHistory(t)
+	s := &Server{config: cfg, history: h, hostname: "web-01"}
+	s.hub = newHub(cfg.Collector, cfg.SSE, nil, h, nil, nil)
+
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		want   []string
+	}{
+		{"no last event", "", "", nil},
+		{"header", "3", "", []string{"id: 4", "id: 5"}},
+		{"query", "", "?lastEventId=4", []string{"id: 5"}},
+		{"expired", "1", "", []string{"id: 3", "id: 4", "id: 5"}},
+		{"up to date", "5", "", nil},
+		{"invalid", "abc", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The stream ends once the replay is written
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			r := httptest.NewRequest(http.MethodGet, "/api/events"+tt.query, nil).WithContext(ctx)
+			if tt.header != "" {
+				r.Header.Set("Last-Event-ID", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.sseHandler(w, r)
+
+			var ids []string
+			for _, line := range strings.Split(w.Body.String(), "\n") {
+				if strings.HasPrefix(line, "id: ") {
+					ids = append(ids, line)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("replayed %q, want %q", ids, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// configureHTTP2 sets up HTTP/2 on server: over TLS through ALPN, and in
+// cleartext (h2c) when enabled, for deployments behind a trusted proxy that
+// speaks HTTP/2 to its backends. Many SSE streams of one client then share a
+// single connection instead of each holding its own.
+func (s *Server) configureHTTP2(server *http.Server) error {
+	cfg := s.config.HTTP2
+	if !cfg.Enabled {
+		// A non-nil empty map keeps net/http from enabling HTTP/2 itself
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		return nil
+	}
+
+	h2s := &http2.Server{
+		MaxConcurrentStreams: cfg.MaxConcurrentStreams,
+		IdleTimeout:          server.IdleTimeout,
+	}
+	if err := http2.ConfigureServer(server, h2s); err != nil {
+		return err
+	}
+	if cfg.H2C {
+		// h2c wraps the whole chain so that the connection preface is not
+		// logged or counted as a request of its own
+		server.Handler = h2c.NewHandler(server.Handler, h2s)
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// hubEvent is a collection result or published event fanned out to subscribers
+type hubEvent struct {
+	Type      string
+	Timestamp time.Time
+	Sample    models.Sample
+	Err       error
+	Data      interface{}
+}
+
+// Policies for subscribers whose buffer is full when an event is broadcast
+const (
+	overflowDropOldest = "drop-oldest"
+	overflowDropNewest = "drop-newest"
+	overflowDisconnect = "disconnect"
+)
+
+// errTooManyClients is returned when the subscriber limit is reached
+var errTooManyClients = errors.New("too many SSE clients")
+
+// errShuttingDown is returned to subscribers arriving during shutdown
+var errShuttingDown = errors.New("server shutting down")
+
+// subscriber receives hub events at its own interval
+type subscriber struct {
+	ch       chan hubEvent
+	interval time.Duration
+	last     time.Time
+	// kicked is closed when the subscriber is disconnected for falling behind
+	kicked  chan struct{}
+	dropped atomic.Uint64
+}
+
+// hub collects stats once per tick on behalf of every SSE client, records
+// them in the history, and fans them out to the subscribers. Sends never
+// block: a subscriber that cannot keep up is handled by the overflow policy.
+type hub struct {
+	mu          sync.Mutex
+	interval    time.Duration
+	granularity time.Duration
+	maxClients  int
+	buffer      int
+	overflow    string
+	stats       StatsProvider
+	history     *history
+	// alerts evaluates the alert rules on every sample, if set
+	alerts *alertEngine
+	// watcher records the watched processes of every sample, if set
+	watcher     *watcher
+	subscribers map[*subscriber]struct{}
+	sinks       []*sinkRunner
+	lastCollect time.Time
+	lastErr     error
+	// failing holds the collectors that failed in the last collection, so
+	// that failures and recoveries are logged once
+	failing   map[string]bool
+	telemetry *telemetry
+	tracer    *tracer
+	// closing is closed when the server starts shutting down
+	closing chan struct{}
+}
+
+// newHub creates a hub collecting every collector interval. Faster
+// subscribers speed collection up, down to the minimum SSE interval.
+func newHub(collector CollectorConfig, sse SSEConfig, stats StatsProvider, history *history, telemetry *telemetry, tracer *tracer) *hub {
+	granularity := sse.MinInterval
+	if granularity > collector.Interval {
+		granularity = collector.Interval
+	}
+	return &hub{
+		interval:    collector.Interval,
+		granularity: granularity,
+		maxClients:  sse.MaxClients,
+		buffer:      sse.ClientBuffer,
+		overflow:    sse.Overflow,
+		stats:       stats,
+		history:     history,
+		subscribers: map[*subscriber]struct{}{},
+		telemetry:   telemetry,
+		tracer:      tracer,
+		closing:     make(chan struct{}),
+	}
+}
+
+// Subscribe registers a subscriber that wants an event every interval
+func (h *hub) Subscribe(interval time.Duration) (*subscriber, error) {
+	sub := &subscriber{
+		ch:       make(chan hubEvent, h.buffer),
+		interval: interval,
+		kicked:   make(chan struct{}),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	select {
+	case <-h.closing:
+		return nil, errShuttingDown
+	default:
+	}
+	if h.maxClients > 0 && len(h.subscribers) >= h.maxClients {
+		return nil, errTooManyClients
+	}
+	h.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+// AddSink registers a sink receiving every collected sample. A sink that is
+// still busy with earlier samples when its queue fills up misses samples.
+func (h *hub) AddSink(runner *sinkRunner) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sinks = append(h.sinks, runner)
+}
+
+// Shutdown tells subscribers to end their streams and refuses new ones
+func (h *hub) Shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	select {
+	case <-h.closing:
+	default:
+		close(h.closing)
+	}
+}
+
+// Closing returns a channel that is closed when the hub shuts down
+func (h *hub) Closing() <-chan struct{} {
+	return h.closing
+}
+
+// Unsubscribe removes a subscriber
+func (h *hub) Unsubscribe(sub *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, sub)
+}
+
+// send delivers an event to a subscriber without blocking, applying the
+// overflow policy when its buffer is full
+func (h *hub) send(sub *subscriber, event hubEvent) {
+	select {
+	case sub.ch <- event:
+		return
+	default:
+	}
+
+	sub.dropped.Add(1)
+	switch h.overflow {
+	case overflowDropOldest:
+		// Make room by discarding the oldest buffered event. The client may
+		// drain the buffer concurrently, so neither step is allowed to block.
+		select {
+		case <-sub.ch:
+		default:
+		}
+		select {
+		case sub.ch <- event:
+		default:
+		}
+	case overflowDisconnect:
+		delete(h.subscribers, sub)
+		close(sub.kicked)
+	}
+}
+
+// due reports whether a collection is needed: either the hub interval has
+// elapsed or a subscriber wants a sample sooner
+func (h *hub) due(now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// Allow half a tick of slack so intervals that are a multiple of the
+	// granularity are not pushed back by timer jitter
+	slack := h.granularity / 2
+	if now.Sub(h.lastCollect) >= h.interval-slack {
+		return true
+	}
+	for sub := range h.subscribers {
+		if now.Sub(sub.last) >= sub.interval-slack && now.Sub(h.lastCollect) >= sub.interval-slack {
+			return true
+		}
+	}
+	return false
+}
+
+// collect takes one sample and delivers it to every subscriber that is due
+func (h *hub) collect(now time.Time) error {
+	ctx, span := h.tracer.startRoot(context.Background(), "collect stats", otlpSpanKindInternal, "")
+	start := time.Now()
+	stats, err := h.stats.Collect(ctx, collector.AllTopicSet())
+	h.telemetry.observeCollection(time.Since(start), err)
+	span.End(err)
+
+	event := hubEvent{Type: eventStats, Timestamp: now.UTC()}
+	if err != nil {
+		event.Type = eventError
+		event.Err = err
+	} else {
+		if prev, ok := h.history.Latest(); ok {
+			stats.Rates = deriveRates(prev.Stats, prev.Timestamp, stats, time.Now().UTC())
+		}
+		event.Sample = h.history.Append(stats)
+		event.Timestamp = event.Sample.Timestamp
+	}
+	h.logFailures(stats)
+	if err == nil && h.watcher != nil {
+		h.watcher.observe(event.Sample)
+	}
+	if err == nil && h.alerts != nil {
+		h.alerts.observe(event.Sample)
+	}
+
+	slack := h.granularity / 2
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastCollect = now
+	h.lastErr = err
+	if err == nil {
+		for _, runner := range h.sinks {
+			select {
+			case runner.ch <- event.Sample:
+			default:
+				runner.dropped.Add(1)
+				slog.Warn("Dropping sample: sink queue full", "seq", event.Sample.Seq, "sink", runner.sink.Name())
+			}
+		}
+	}
+	for sub := range h.subscribers {
+		if now.Sub(sub.last) >= sub.interval-slack {
+			sub.last = now
+			h.send(sub, event)
+		}
+	}
+	return err
+}
+
+// logFailures logs the collectors that started failing or recovered since
+// the previous collection. stats is nil when every collector failed.
+func (h *hub) logFailures(stats *models.SystemStats) {
+	if stats == nil {
+		return
+	}
+	for name, err := range stats.Errors {
+		if !h.failing[name] {
+			slog.Warn("Collector failed, reporting partial stats", "collector", name, "error", err)
+		}
+	}
+	for name := range h.failing {
+		if _, ok := stats.Errors[name]; !ok {
+			slog.Info("Collector recovered", "collector", name)
+		}
+	}
+	h.failing = map[string]bool{}
+	for name := range stats.Errors {
+		h.failing[name] = true
+	}
+}
+
+// Clients returns the number of connected subscribers
+func (h *hub) Clients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// LastError returns the error of the most recent collection, if it failed
+func (h *hub) LastError() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastErr
+}
+
+// Publish delivers a non-stats event (e.g. an alert) to every subscriber
+// immediately, regardless of their interval, and to the sinks forwarding events
+func (h *hub) Publish(eventType string, data interface{}) {
+	event := hubEvent{Type: eventType, Timestamp: time.Now().UTC(), Data: data}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		h.send(sub, event)
+	}
+	for _, runner := range h.sinks {
+		if runner.events == nil {
+			continue
+		}
+		select {
+		case runner.events <- event:
+		default:
+			slog.Warn("Dropping event: sink queue full", "type", eventType, "sink", runner.sink.Name())
+		}
+	}
+}
+
+// run collects on schedule until ctx is cancelled
+func (h *hub) run(ctx context.Context) {
+	ticker := time.NewTicker(h.granularity)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if !h.due(now) {
+				continue
+			}
+			if err := h.collect(now); err != nil {
+				slog.Error("Error collecting stats", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// influxSink writes samples to InfluxDB in line protocol. It uses the v2
+// write API when a bucket is configured and the v1 API otherwise.
+type influxSink struct {
+	cfg      InfluxDBConfig
+	client   *http.Client
+	writeURL string
+	tags     string
+}
+
+// newInfluxSink creates an InfluxDB sink tagging points with the hostname
+// and the host labels
+func newInfluxSink(cfg InfluxDBConfig, hostname string, labels map[string]string) (*influxSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sinks.influxdb.url: %w", err)
+	}
+
+	query := url.Values{"precision": {"ns"}}
+	if cfg.Bucket != "" {
+		u = u.JoinPath("api/v2/write")
+		query.Set("bucket", cfg.Bucket)
+		query.Set("org", cfg.Org)
+	} else {
+		u = u.JoinPath("write")
+		query.Set("db", cfg.Database)
+		if cfg.RetentionPolicy != "" {
+			query.Set("rp", cfg.RetentionPolicy)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	// Tags sorted by key, as InfluxDB stores them
+	tags := map[string]string{"host": hostname}
+	for name, value := range labels {
+		tags[name] = value
+	}
+	var tagSet strings.Builder
+	for _, name := range labelNames(tags) {
+		tagSet.WriteString("," + escapeInfluxTag(name) + "=" + escapeInfluxTag(tags[name]))
+	}
+
+	return &influxSink{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		writeURL: u.String(),
+		tags:     tagSet.String(),
+	}, nil
+}
+
+func (s *influxSink) Name() string {
+	return "influxdb"
+}
+
+// Write posts the samples as one line protocol batch
+func (s *influxSink) Write(ctx context.Context, samples []models.Sample) error {
+	var body bytes.Buffer
+	for _, sample := range samples {
+		s.appendLine(&body, sample)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.writeURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.cfg.Token)
+	} else if s.cfg.Username != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+	return postSinkRequest(s.client, req)
+}
+
+// appendLine writes a sample as a line of the configured measurement, e.g.
+// system,host=web1 cpu_usage=12.5,mem_usage=40.1,disk_usage=71,net_traffic=1024i,process_count=210i 1700000000000000000
+func (s *influxSink) appendLine(b *bytes.Buffer, sample models.Sample) {
+	stats := sample.Stats
+	b.WriteString(escapeInfluxMeasurement(s.cfg.Measurement))
+	b.WriteString(s.tags)
+	b.WriteString(" cpu_usage=")
+	b.WriteString(strconv.FormatFloat(stats.CPUUsage, 'f', -1, 64))
+	b.WriteString(",mem_usage=")
+	b.WriteString(strconv.FormatFloat(stats.MemUsage, 'f', -1, 64))
+	b.WriteString(",disk_usage=")
+	b.WriteString(strconv.FormatFloat(stats.DiskUsage, 'f', -1, 64))
+	b.WriteString(",net_traffic=")
+	b.WriteString(strconv.FormatInt(stats.NetTraffic, 10))
+	b.WriteString("i,process_count=")
+	b.WriteString(strconv.Itoa(len(stats.Processes)))
+	b.WriteString("i ")
+	b.WriteString(strconv.FormatInt(sample.Timestamp.UnixNano(), 10))
+	b.WriteByte('\n')
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+)
+
+func escapeInfluxMeasurement(s string) string {
+	return influxMeasurementEscaper.Replace(s)
+}
+
+func escapeInfluxTag(s string) string {
+	return influxTagEscaper.Replace(s)
+}
@@ -0,0 +1,30 @@
+package server
+
+import "syscall"
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	ioprioDataMask   = 0xff
+)
+
+// ioprioClasses maps the kernel I/O scheduling classes to their names
+var ioprioClasses = map[int]string{
+	0: "none",
+	1: "realtime",
+	2: "best-effort",
+	3: "idle",
+}
+
+// getIONice returns the I/O scheduling class and level of a process
+func getIONice(pid int32) (*IONiceInfo, error) {
+	prio, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_GET, ioprioWhoProcess, uintptr(pid), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	return &IONiceInfo{
+		Class: ioprioClasses[int(prio)>>ioprioClassShift],
+		Level: int(prio) & ioprioDataMask,
+	}, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"fmt"
+)
+
+// getIONice is not supported on this platform
+func getIONice(pid int32) (*IONiceInfo, error) {
+	return nil, fmt.Errorf("reading I/O priority: %w", errors.ErrUnsupported)
+}
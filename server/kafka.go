@@ -0,0 +1,496 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// Kafka API keys and the versions spoken, the oldest ones Kafka 4 accepts
+const (
+	kafkaProduce         = 0
+	kafkaProduceVersion  = 3
+	kafkaMetadata        = 3
+	kafkaMetadataVersion = 4
+)
+
+// kafkaErrors names the error codes a producer commonly runs into
+var kafkaErrors = map[int16]string{
+	2:  "corrupt message",
+	3:  "unknown topic or partition",
+	5:  "leader not available",
+	6:  "not leader for partition",
+	7:  "request timed out",
+	10: "message too large",
+	19: "not enough replicas",
+	20: "not enough replicas after append",
+	29: "topic authorization failed",
+	31: "cluster authorization failed",
+	87: "invalid record",
+}
+
+// kafkaError is an error code returned by a broker
+type kafkaError int16
+
+func (e kafkaError) Error() string {
+	if name, ok := kafkaErrors[int16(e)]; ok {
+		return "kafka: " + name
+	}
+	return fmt.Sprintf("kafka: error code %d", int16(e))
+}
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaSink produces every sample to a Kafka topic, keyed by hostname so
+// that the samples of a host stay in order on one partition. Samples are
+// encoded as JSON or Avro and sent in record batches of at most batchSize.
+// After an error the connections and the cluster metadata are dropped and
+// fetched again on the next write.
+type kafkaSink struct {
+	cfg      KafkaConfig
+	hostname string
+	key      []byte
+	client   *http.Client
+
+	mu            sync.Mutex
+	correlationID int32
+	brokers       map[int32]string
+	conns         map[int32]net.Conn
+	// leaders holds the leader of every partition of the topic, by partition
+	leaders  []int32
+	schemaID int32
+}
+
+// newKafkaSink creates a Kafka sink
+func newKafkaSink(cfg KafkaConfig, hostname string) *kafkaSink {
+	return &kafkaSink{
+		cfg:      cfg,
+		hostname: hostname,
+		key:      []byte(hostname),
+		client:   &http.Client{Timeout: cfg.Timeout},
+		conns:    map[int32]net.Conn{},
+	}
+}
+
+func (s *kafkaSink) Name() string {
+	return "kafka"
+}
+
+// Write produces the samples to the partition of this host
+func (s *kafkaSink) Write(ctx context.Context, samples []models.Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cfg.Format == "avro" && s.cfg.SchemaRegistry != "" && s.schemaID == 0 {
+		if err := s.registerSchema(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := s.write(ctx, samples)
+	if err != nil {
+		s.reset()
+	}
+	return err
+}
+
+func (s *kafkaSink) write(ctx context.Context, samples []models.Sample) error {
+	if s.leaders == nil {
+		if err := s.refreshMetadata(ctx); err != nil {
+			return err
+		}
+	}
+	partition := kafkaPartition(s.key, len(s.leaders))
+	conn, err := s.conn(ctx, s.leaders[partition])
+	if err != nil {
+		return err
+	}
+
+	for len(samples) > 0 {
+		n := min(len(samples), s.cfg.BatchSize)
+		values := make([][]byte, n)
+		for i, sample := range samples[:n] {
+			if values[i], err = s.encode(sample); err != nil {
+				return err
+			}
+		}
+		if err := s.produce(conn, int32(partition), samples[:n], values); err != nil {
+			return err
+		}
+		samples = samples[n:]
+	}
+	return nil
+}
+
+// encode encodes a sample in the configured format: JSON, or Avro framed
+// for the schema registry or in the single-object encoding
+func (s *kafkaSink) encode(sample models.Sample) ([]byte, error) {
+	if s.cfg.Format != "avro" {
+		stats := *sample.Stats
+		if s.cfg.Processes > 0 {
+			trimProcesses(&stats, topProcsQuery{N: s.cfg.Processes, SortBy: "cpu"})
+		} else {
+			stats.ProcessCount = len(stats.Processes)
+			stats.Processes = []models.ProcessInfo{}
+		}
+		return json.Marshal(models.Sample{Seq: sample.Seq, Timestamp: sample.Timestamp, Stats: &stats})
+	}
+	if s.schemaID != 0 {
+		b := binary.BigEndian.AppendUint32([]byte{0}, uint32(s.schemaID))
+		return appendAvroSample(b, s.hostname, sample), nil
+	}
+	return appendAvroSingleObject(nil, s.hostname, sample), nil
+}
+
+// produce sends one record batch and checks the acknowledgement
+func (s *kafkaSink) produce(conn net.Conn, partition int32, samples []models.Sample, values [][]byte) error {
+	batch := s.recordBatch(samples, values)
+
+	var req []byte
+	req = binary.BigEndian.AppendUint16(req, 0xffff) // no transactional id
+	req = binary.BigEndian.AppendUint16(req, uint16(s.cfg.Acks))
+	req = binary.BigEndian.AppendUint32(req, uint32(s.cfg.Timeout.Milliseconds()))
+	req = binary.BigEndian.AppendUint32(req, 1)
+	req = appendKafkaString(req, s.cfg.Topic)
+	req = binary.BigEndian.AppendUint32(req, 1)
+	req = binary.BigEndian.AppendUint32(req, uint32(partition))
+	req = binary.BigEndian.AppendUint32(req, uint32(len(batch)))
+	req = append(req, batch...)
+
+	if s.cfg.Acks == 0 {
+		// The broker does not answer unacknowledged produce requests
+		return s.send(conn, kafkaProduce, kafkaProduceVersion, req)
+	}
+	resp, err := s.roundTrip(conn, kafkaProduce, kafkaProduceVersion, req)
+	if err != nil {
+		return err
+	}
+
+	r := kafkaReader{b: resp}
+	for topics := r.int32(); topics > 0 && r.err == nil; topics-- {
+		r.string()
+		for partitions := r.int32(); partitions > 0 && r.err == nil; partitions-- {
+			r.int32()
+			code := r.int16()
+			r.int64()
+			r.int64()
+			if r.err == nil && code != 0 {
+				return kafkaError(code)
+			}
+		}
+	}
+	return r.err
+}
+
+// recordBatch encodes the values as a v2 record batch
+func (s *kafkaSink) recordBatch(samples []models.Sample, values [][]byte) []byte {
+	first := samples[0].Timestamp.UnixMilli()
+	last := samples[len(samples)-1].Timestamp.UnixMilli()
+
+	var records []byte
+	for i, value := range values {
+		var record []byte
+		record = append(record, 0) // attributes
+		record = binary.AppendVarint(record, samples[i].Timestamp.UnixMilli()-first)
+		record = binary.AppendVarint(record, int64(i))
+		record = binary.AppendVarint(record, int64(len(s.key)))
+		record = append(record, s.key...)
+		record = binary.AppendVarint(record, int64(len(value)))
+		record = append(record, value...)
+		record = binary.AppendVarint(record, 0) // headers
+		records = binary.AppendVarint(records, int64(len(record)))
+		records = append(records, record...)
+	}
+
+	// The CRC covers everything from the attributes on
+	var body []byte
+	body = binary.BigEndian.AppendUint16(body, 0) // attributes: no compression
+	body = binary.BigEndian.AppendUint32(body, uint32(len(values)-1))
+	body = binary.BigEndian.AppendUint64(body, uint64(first))
+	body = binary.BigEndian.AppendUint64(body, uint64(max(first, last)))
+	body = binary.BigEndian.AppendUint64(body, 0xffffffffffffffff) // no producer id
+	body = binary.BigEndian.AppendUint16(body, 0xffff)
+	body = binary.BigEndian.AppendUint32(body, 0xffffffff)
+	body = binary.BigEndian.AppendUint32(body, uint32(len(values)))
+	body = append(body, records...)
+
+	var batch []byte
+	batch = binary.BigEndian.AppendUint64(batch, 0)                   // base offset
+	batch = binary.BigEndian.AppendUint32(batch, uint32(len(body)+9)) // length after this field
+	batch = binary.BigEndian.AppendUint32(batch, 0xffffffff)          // partition leader epoch
+	batch = append(batch, 2)                                          // magic
+	batch = binary.BigEndian.AppendUint32(batch, crc32.Checksum(body, crc32c))
+	return append(batch, body...)
+}
+
+// refreshMetadata asks the bootstrap brokers for the brokers and the
+// partition leaders of the topic
+func (s *kafkaSink) refreshMetadata(ctx context.Context) error {
+	var req []byte
+	req = binary.BigEndian.AppendUint32(req, 1)
+	req = appendKafkaString(req, s.cfg.Topic)
+	req = append(req, 0) // do not create the topic
+
+	var errs []error
+	for _, address := range s.cfg.Brokers {
+		dialer := net.Dialer{Timeout: s.cfg.Timeout}
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resp, err := s.roundTrip(conn, kafkaMetadata, kafkaMetadataVersion, req)
+		conn.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", address, err))
+			continue
+		}
+		return s.parseMetadata(resp)
+	}
+	return fmt.Errorf("error fetching kafka metadata: %w", errors.Join(errs...))
+}
+
+func (s *kafkaSink) parseMetadata(resp []byte) error {
+	r := kafkaReader{b: resp}
+	r.int32() // throttle time
+	brokers := map[int32]string{}
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		id := r.int32()
+		host := r.string()
+		port := r.int32()
+		r.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	r.string() // cluster id
+	r.int32()  // controller id
+
+	var leaders []int32
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		if code := r.int16(); code != 0 {
+			return fmt.Errorf("topic %s: %w", s.cfg.Topic, kafkaError(code))
+		}
+		r.string()
+		r.bool()
+		partitions := r.int32()
+		if partitions < 0 || partitions > 1<<16 {
+			return errors.New("malformed kafka metadata")
+		}
+		leaders = make([]int32, partitions)
+		for ; partitions > 0 && r.err == nil; partitions-- {
+			r.int16()
+			index := r.int32()
+			leader := r.int32()
+			for replicas := r.int32(); replicas > 0 && r.err == nil; replicas-- {
+				r.int32()
+			}
+			for isr := r.int32(); isr > 0 && r.err == nil; isr-- {
+				r.int32()
+			}
+			if index < 0 || int(index) >= len(leaders) {
+				return errors.New("malformed kafka metadata")
+			}
+			leaders[index] = leader
+		}
+	}
+	if r.err != nil {
+		return fmt.Errorf("malformed kafka metadata: %w", r.err)
+	}
+	if len(leaders) == 0 {
+		return fmt.Errorf("topic %s has no partitions", s.cfg.Topic)
+	}
+	s.brokers = brokers
+	s.leaders = leaders
+	return nil
+}
+
+// conn returns the connection to a broker, dialing it if needed
+func (s *kafkaSink) conn(ctx context.Context, id int32) (net.Conn, error) {
+	if conn, ok := s.conns[id]; ok {
+		return conn, nil
+	}
+	address, ok := s.brokers[id]
+	if !ok {
+		return nil, kafkaError(5)
+	}
+	dialer := net.Dialer{Timeout: s.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	s.conns[id] = conn
+	return conn, nil
+}
+
+// reset drops the connections and the metadata
+func (s *kafkaSink) reset() {
+	for id, conn := range s.conns {
+		conn.Close()
+		delete(s.conns, id)
+	}
+	s.leaders = nil
+}
+
+// send writes a request with the v1 request header
+func (s *kafkaSink) send(conn net.Conn, apiKey, version int16, body []byte) error {
+	s.correlationID++
+	var header []byte
+	header = binary.BigEndian.AppendUint16(header, uint16(apiKey))
+	header = binary.BigEndian.AppendUint16(header, uint16(version))
+	header = binary.BigEndian.AppendUint32(header, uint32(s.correlationID))
+	header = appendKafkaString(header, "system-stats-backend")
+
+	req := binary.BigEndian.AppendUint32(nil, uint32(len(header)+len(body)))
+	req = append(req, header...)
+	req = append(req, body...)
+	conn.SetWriteDeadline(time.Now().Add(s.cfg.Timeout))
+	_, err := conn.Write(req)
+	return err
+}
+
+// roundTrip sends a request and returns the body of its response
+func (s *kafkaSink) roundTrip(conn net.Conn, apiKey, version int16, body []byte) ([]byte, error) {
+	if err := s.send(conn, apiKey, version, body); err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(s.cfg.Timeout))
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > 16<<20 {
+		return nil, fmt.Errorf("malformed kafka response of %d bytes", n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	if id := int32(binary.BigEndian.Uint32(resp)); id != s.correlationID {
+		return nil, fmt.Errorf("kafka response %d does not match request %d", id, s.correlationID)
+	}
+	return resp[4:], nil
+}
+
+// registerSchema registers the Avro schema under the <topic>-value subject
+// of the schema registry and keeps its id
+func (s *kafkaSink) registerSchema(ctx context.Context) error {
+	u, err := url.Parse(s.cfg.SchemaRegistry)
+	if err != nil {
+		return fmt.Errorf("invalid sinks.kafka.schemaRegistry: %w", err)
+	}
+	body, err := json.Marshal(map[string]string{"schema": avroSampleSchema})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.JoinPath("subjects", s.cfg.Topic+"-value", "versions").String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error registering Avro schema: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("error registering Avro schema: %s returned %s: %s", req.URL.Redacted(), resp.Status, msg)
+	}
+	var registered struct {
+		ID int32 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&registered); err != nil {
+		return fmt.Errorf("error registering Avro schema: %w", err)
+	}
+	s.schemaID = registered.ID
+	return nil
+}
+
+// kafkaPartition picks the partition of a key like the default partitioner
+// of the Java client, so that other producers keyed by hostname agree
+func kafkaPartition(key []byte, partitions int) int {
+	return int(murmur2(key)&0x7fffffff) % partitions
+}
+
+// murmur2 is the hash of the Java client's default partitioner
+func murmur2(data []byte) int32 {
+	const (
+		seed = 0x9747b28c
+		m    = 0x5bd1e995
+		r    = 24
+	)
+	h := uint32(seed) ^ uint32(len(data))
+	n := len(data) / 4 * 4
+	for i := 0; i < n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	switch len(data) % 4 {
+	case 3:
+		h ^= uint32(data[n+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[n+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[n])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+func appendKafkaString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// kafkaReader decodes the fixed-width fields of a response, recording the
+// first read past the end
+type kafkaReader struct {
+	b   []byte
+	err error
+}
+
+func (r *kafkaReader) next(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = io.ErrUnexpectedEOF
+		return make([]byte, n)
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *kafkaReader) bool() bool   { return r.next(1)[0] != 0 }
+func (r *kafkaReader) int16() int16 { return int16(binary.BigEndian.Uint16(r.next(2))) }
+func (r *kafkaReader) int32() int32 { return int32(binary.BigEndian.Uint32(r.next(4))) }
+func (r *kafkaReader) int64() int64 { return int64(binary.BigEndian.Uint64(r.next(8))) }
+
+// string reads a nullable string, returning "" for null
+func (r *kafkaReader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.next(int(n)))
+}
@@ -0,0 +1,471 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// kafkaRecord is a record decoded from a batch sent by the sink
+type kafkaRecord struct {
+	key, value string
+}
+
+// testKafkaBroker serves requests on a local listener, answering each with
+// the body returned by handle, or not at all when it returns nil
+func testKafkaBroker(t *testing.T, handle func(apiKey, version int16, body []byte) []byte) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					var size [4]byte
+					if _, err := io.ReadFull(r, size[:]); err != nil {
+						return
+					}
+					req := make([]byte, binary.BigEndian.Uint32(size[:]))
+					if _, err := io.ReadFull(r, req); err != nil {
+						return
+					}
+					kr := kafkaReader{b: req}
+					apiKey, version, correlationID := kr.int16(), kr.int16(), kr.int32()
+					kr.string() // client id
+					resp := handle(apiKey, version, kr.b)
+					if resp == nil {
+						continue
+					}
+					frame := binary.BigEndian.AppendUint32(nil, uint32(4+len(resp)))
+					frame = binary.BigEndian.AppendUint32(frame, uint32(correlationID))
+					if _, err := conn.Write(append(frame, resp...)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// kafkaMetadataResponse is a v4 metadata response listing broker 1 at
+// address as the leader of every partition of topic
+func kafkaMetadataResponse(address, topic string, partitions int, code int16) []byte {
+	host, port, _ := net.SplitHostPort(address)
+	portNum, _ := strconv.Atoi(port)
+	var b []byte
+	b = binary.BigEndian.AppendUint32(b, 0) // throttle time
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = appendKafkaString(b, host)
+	b = binary.BigEndian.AppendUint32(b, uint32(portNum))
+	b = binary.BigEndian.AppendUint16(b, 0xffff) // rack
+	b = binary.BigEndian.AppendUint16(b, 0xffff) // cluster id
+	b = binary.BigEndian.AppendUint32(b, 1)      // controller id
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = binary.BigEndian.AppendUint16(b, uint16(code))
+	b = appendKafkaString(b, topic)
+	b = append(b, 0) // internal
+	b = binary.BigEndian.AppendUint32(b, uint32(partitions))
+	for i := range partitions {
+		b = binary.BigEndian.AppendUint16(b, 0)
+		b = binary.BigEndian.AppendUint32(b, uint32(i))
+		b = binary.BigEndian.AppendUint32(b, 1) // leader
+		b = binary.BigEndian.AppendUint32(b, 1) // replicas
+		b = binary.BigEndian.AppendUint32(b, 1)
+		b = binary.BigEndian.AppendUint32(b, 1) // in-sync replicas
+		b = binary.BigEndian.AppendUint32(b, 1)
+	}
+	return b
+}
+
+// kafkaProduceResponse is a v3 produce response for one partition
+func kafkaProduceResponse(topic string, partition int32, code int16) []byte {
+	var b []byte
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = appendKafkaString(b, topic)
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = binary.BigEndian.AppendUint32(b, uint32(partition))
+	b = binary.BigEndian.AppendUint16(b, uint16(code))
+	b = binary.BigEndian.AppendUint64(b, 42)                 // base offset
+	b = binary.BigEndian.AppendUint64(b, 0xffffffffffffffff) // log append time
+	return binary.BigEndian.AppendUint32(b, 0)               // throttle time
+}
+
+// decodeProduceRequest checks a v3 produce request for one partition and
+// decodes the records of its batch
+func decodeProduceRequest(body []byte) (topic string, partition int32, records []kafkaRecord, err error) {
+	r := kafkaReader{b: body}
+	r.string() // transactional id
+	r.int16()  // acks
+	r.int32()  // timeout
+	if n := r.int32(); n != 1 {
+		return "", 0, nil, errors.New("want one topic")
+	}
+	topic = r.string()
+	if n := r.int32(); n != 1 {
+		return "", 0, nil, errors.New("want one partition")
+	}
+	partition = r.int32()
+	batch := r.next(int(r.int32()))
+	if r.err != nil {
+		return "", 0, nil, r.err
+	}
+	records, err = decodeRecordBatch(batch)
+	return topic, partition, records, err
+}
+
+// decodeRecordBatch checks the length, magic, and CRC-32C of a v2 record
+// batch and decodes its records
+func decodeRecordBatch(batch []byte) ([]kafkaRecord, error) {
+	if len(batch) < 61 || int(binary.BigEndian.Uint32(batch[8:]))+12 != len(batch) {
+		return nil, errors.New("batch length does not match")
+	}
+	if batch[16] != 2 {
+		return nil, errors.New("magic is not 2")
+	}
+	if crc := binary.BigEndian.Uint32(batch[17:]); crc != crc32.Checksum(batch[21:], crc32c) {
+		return nil, errors.New("CRC-32C does not match")
+	}
+	count := int(binary.BigEndian.Uint32(batch[57:]))
+	rest := batch[61:]
+	varint := func() int64 {
+		v, n := binary.Varint(rest)
+		if n <= 0 {
+			rest = nil
+			return 0
+		}
+		rest = rest[n:]
+		return v
+	}
+	bytesField := func() string {
+		n := varint()
+		if n < 0 || int(n) > len(rest) {
+			rest = nil
+			return ""
+		}
+		v := string(rest[:n])
+		rest = rest[n:]
+		return v
+	}
+	var records []kafkaRecord
+	for i := 0; i < count; i++ {
+		varint() // length
+		rest = rest[1:]
+		varint() // timestamp delta
+		if delta := varint(); delta != int64(i) {
+			return nil, errors.New("offset deltas out of order")
+		}
+		key := bytesField()
+		value := bytesField()
+		if varint() != 0 || rest == nil {
+			return nil, errors.New("malformed record")
+		}
+		records = append(records, kafkaRecord{key, value})
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing bytes after the records")
+	}
+	return records, nil
+}
+
+func kafkaSamples(n int) []models.Sample {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	samples := make([]models.Sample, n)
+	for i := range samples {
+		samples[i] = models.Sample{
+			Seq:       uint64(i + 1),
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Stats: &models.SystemStats{
+				CPUUsage:  12.5,
+				MemUsage:  50,
+				Processes: []models.ProcessInfo{{PID: 1, Name: "init"}},
+				Labels:    map[string]string{"env": "prod"},
+			},
+		}
+	}
+	return samples
+}
+
+func TestKafkaWrite(t *testing.T) {
+	var batches [][]kafkaRecord
+	var address string
+	address = testKafkaBroker(t, func(apiKey, version int16, body []byte) []byte {
+		switch {
+		case apiKey == kafkaMetadata && version == kafkaMetadataVersion:
+			return kafkaMetadataResponse(address, "stats", 3, 0)
+		case apiKey == kafkaProduce && version == kafkaProduceVersion:
+			topic, partition, records, err := decodeProduceRequest(body)
+			if err != nil {
+				t.Errorf("produce request: %v", err)
+			}
+			batches = append(batches, records)
+			return kafkaProduceResponse(topic, partition, 0)
+		}
+		t.Errorf("unexpected request %d v%d", apiKey, version)
+		return []byte{}
+	})
+
+	s := newKafkaSink(KafkaConfig{Brokers: []string{address}, Topic: "stats", Format: "json", Acks: -1, BatchSize: 2, Timeout: 5 * time.Second}, "web-01")
+	defer s.reset()
+	if err := s.Write(context.Background(), kafkaSamples(3)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Fatalf("got batches %v, want batches of 2 and 1 records", batches)
+	}
+	var seq uint64
+	for _, batch := range batches {
+		for _, record := range batch {
+			seq++
+			var sample models.Sample
+			if err := json.Unmarshal([]byte(record.value), &sample); err != nil {
+				t.Fatalf("record %d: %v", seq, err)
+			}
+			if record.key != "web-01" || sample.Seq != seq || len(sample.Stats.Processes) != 0 || sample.Stats.ProcessCount != 1 {
+				t.Errorf("record %d = key %q, seq %d, %d processes of %d", seq, record.key, sample.Seq, len(sample.Stats.Processes), sample.Stats.ProcessCount)
+			}
+		}
+	}
+}
+
+func TestKafkaWriteError(t *testing.T) {
+	var address string
+	address = testKafkaBroker(t, func(apiKey, version int16, body []byte) []byte {
+		if apiKey == kafkaMetadata {
+			return kafkaMetadataResponse(address, "stats", 1, 0)
+		}
+		return kafkaProduceResponse("stats", 0, 6)
+	})
+
+	s := newKafkaSink(KafkaConfig{Brokers: []string{address}, Topic: "stats", Acks: 1, BatchSize: 10, Timeout: 5 * time.Second}, "web-01")
+	defer s.reset()
+	err := s.Write(context.Background(), kafkaSamples(1))
+	if !errors.Is(err, kafkaError(6)) {
+		t.Fatalf("Write() error = %v, want %v", err, kafkaError(6))
+	}
+	if s.leaders != nil || len(s.conns) != 0 {
+		t.Errorf("metadata and connections kept after an error: %v, %d connections", s.leaders, len(s.conns))
+	}
+}
+
+func TestKafkaWriteUnacknowledged(t *testing.T) {
+	produced := make(chan []kafkaRecord, 1)
+	var address string
+	address = testKafkaBroker(t, func(apiKey, version int16, body []byte) []byte {
+		if apiKey == kafkaMetadata {
+			return kafkaMetadataResponse(address, "stats", 1, 0)
+		}
+		_, _, records, err := decodeProduceRequest(body)
+		if err != nil {
+			t.Errorf("produce request: %v", err)
+		}
+		produced <- records
+		return nil
+	})
+
+	s := newKafkaSink(KafkaConfig{Brokers: []string{address}, Topic: "stats", Acks: 0, BatchSize: 10, Timeout: 5 * time.Second}, "web-01")
+	defer s.reset()
+	if err := s.Write(context.Background(), kafkaSamples(1)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	select {
+	case records := <-produced:
+		if len(records) != 1 {
+			t.Errorf("got %d records, want 1", len(records))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no produce request received")
+	}
+}
+
+func TestKafkaMetadata(t *testing.T) {
+	valid := kafkaMetadataResponse("kafka-1:9092", "stats", 2, 0)
+	// A partition claiming 2^31-1 replicas followed by nothing
+	hugeReplicas := kafkaMetadataResponse("kafka-1:9092", "stats", 1, 0)
+	hugeReplicas = binary.BigEndian.AppendUint32(hugeReplicas[:len(hugeReplicas)-16], 0x7fffffff)
+
+	tests := []struct {
+		name        string
+		resp        []byte
+		wantLeaders []int32
+		wantErr     error
+	}{
+		{"valid", valid, []int32{1, 1}, nil},
+		{"topic error", kafkaMetadataResponse("kafka-1:9092", "stats", 0, 3), nil, kafkaError(3)},
+		{"no partitions", kafkaMetadataResponse("kafka-1:9092", "stats", 0, 0), nil, nil},
+		{"truncated", valid[:len(valid)-3], nil, io.ErrUnexpectedEOF},
+		{"huge replica count", hugeReplicas, nil, io.ErrUnexpectedEOF},
+		{"negative partitions", kafkaMetadataResponse("kafka-1:9092", "stats", -1, 0), nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newKafkaSink(KafkaConfig{Topic: "stats"}, "web-01")
+			err := s.parseMetadata(tt.resp)
+			if tt.wantLeaders == nil {
+				if err == nil {
+					t.Fatal("parseMetadata() succeeded, want an error")
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("parseMetadata() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMetadata() error = %v", err)
+			}
+			if len(s.leaders) != len(tt.wantLeaders) || s.brokers[1] != "kafka-1:9092" {
+				t.Errorf("got leaders %v, brokers %v", s.leaders, s.brokers)
+			}
+		})
+	}
+}
+
+func TestKafkaProduceMalformed(t *testing.T) {
+	// Claims 2^31-1 topics, then ends
+	address := testKafkaBroker(t, func(apiKey, version int16, body []byte) []byte {
+		return []byte{0x7f, 0xff, 0xff, 0xff}
+	})
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s := newKafkaSink(KafkaConfig{Topic: "stats", Acks: 1, Timeout: 5 * time.Second}, "web-01")
+	samples := kafkaSamples(1)
+	value, _ := s.encode(samples[0])
+	if err := s.produce(conn, 0, samples, [][]byte{value}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("produce() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestRecordBatch(t *testing.T) {
+	s := newKafkaSink(KafkaConfig{}, "web-01")
+	samples := kafkaSamples(2)
+	batch := s.recordBatch(samples, [][]byte{[]byte("a"), []byte("bc")})
+
+	// Decodes with a reference client as the same two records
+	const want = "0000000000000000" + // base offset
+		"0000004f" + // length
+		"ffffffff" + // partition leader epoch
+		"02" + // magic
+		"619d8f17" + // CRC-32C
+		"0000" + // attributes
+		"00000001" + // last offset delta
+		"0000018f34069e00" + // first timestamp
+		"0000018f3406a1e8" + // max timestamp
+		"ffffffffffffffff" + "ffff" + "ffffffff" + // producer id, epoch, base sequence
+		"00000002" + // records
+		"1a" + "00" + "00" + "00" + "0c" + "7765622d3031" + "02" + "61" + "00" +
+		"1e" + "00" + "d00f" + "02" + "0c" + "7765622d3031" + "04" + "6263" + "00"
+	if got := hex.EncodeToString(batch); got != want {
+		t.Errorf("recordBatch() =\n%s\nwant\n%s", got, want)
+	}
+	records, err := decodeRecordBatch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0] != (kafkaRecord{"web-01", "a"}) || records[1] != (kafkaRecord{"web-01", "bc"}) {
+		t.Errorf("got records %v", records)
+	}
+}
+
+func TestCRC32C(t *testing.T) {
+	// Check value of CRC-32C from RFC 3720 and the CRC catalogue
+	if got := crc32.Checksum([]byte("123456789"), crc32c); got != 0xe3069283 {
+		t.Errorf("CRC-32C(123456789) = %#x, want 0xe3069283", got)
+	}
+	if got := crc32.Checksum(make([]byte, 32), crc32c); got != 0x8a9136aa {
+		t.Errorf("CRC-32C(32 zero bytes) = %#x, want 0x8a9136aa", got)
+	}
+}
+
+func TestMurmur2(t *testing.T) {
+	// Vectors of the Java client's Utils.murmur2
+	tests := []struct {
+		key  string
+		want int32
+	}{
+		{"21", -973932308},
+		{"foobar", -790332482},
+		{"a-little-bit-long-string", -985981536},
+		{"a-little-bit-longer-string", -1486304829},
+		{"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", -58897971},
+		{"abc", 479470107},
+	}
+	for _, tt := range tests {
+		if got := murmur2([]byte(tt.key)); got != tt.want {
+			t.Errorf("murmur2(%q) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestKafkaPartition(t *testing.T) {
+	// The Java client's default partitioner maps murmur2 to positive values
+	// before taking the modulus
+	if got := kafkaPartition([]byte("foobar"), 7); got != int(-790332482&0x7fffffff)%7 {
+		t.Errorf("kafkaPartition(foobar, 7) = %d", got)
+	}
+	for _, key := range []string{"", "a", "web-01", "db-primary"} {
+		if got := kafkaPartition([]byte(key), 3); got < 0 || got >= 3 {
+			t.Errorf("kafkaPartition(%q, 3) = %d, out of range", key, got)
+		}
+	}
+}
+
+func TestKafkaRegisterSchema(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Schema string `json:"schema"`
+		}
+		if r.Method != http.MethodPost || r.URL.Path != "/subjects/stats-value/versions" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Schema != avroSampleSchema {
+			http.Error(w, "invalid schema", http.StatusUnprocessableEntity)
+			return
+		}
+		w.Write([]byte(`{"id":21}`))
+	}))
+	defer registry.Close()
+
+	s := newKafkaSink(KafkaConfig{Topic: "stats", Format: "avro", SchemaRegistry: registry.URL, Timeout: 5 * time.Second}, "web-01")
+	if err := s.registerSchema(context.Background()); err != nil {
+		t.Fatalf("registerSchema() error = %v", err)
+	}
+	sample := kafkaSamples(1)[0]
+	value, err := s.encode(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The wire format of the registry: magic byte 0 and the schema id
+	want := append([]byte{0, 0, 0, 0, 21}, appendAvroSample(nil, "web-01", sample)...)
+	if string(value) != string(want) {
+		t.Errorf("encode() = %x, want %x", value, want)
+	}
+}
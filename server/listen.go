@@ -0,0 +1,212 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// unixScheme prefixes the listen addresses of unix domain sockets
+const unixScheme = "unix://"
+
+// ListenerConfig is one address the server listens on
+type ListenerConfig struct {
+	// Address is a TCP host:port or a unix socket URL (unix:///path)
+	Address string `yaml:"address"`
+	// TLS serves HTTPS on the listener when a certificate is set
+	TLS TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig holds the PEM certificate and key of an HTTPS listener, and the
+// CA verifying client certificates for mutual TLS
+type TLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// ClientCAFile holds the PEM certificates of the CAs that client
+	// certificates must be signed by. Clients without a valid certificate
+	// are refused during the handshake.
+	ClientCAFile string `yaml:"clientCAFile"`
+	// ClientAuth is require (the default with a ClientCAFile), or optional
+	// to verify the certificates of only the clients that present one
+	ClientAuth string `yaml:"clientAuth"`
+	// ClientCNs restricts the accepted client certificates to these common
+	// names (default all signed by the CAs)
+	ClientCNs []string `yaml:"clientCNs"`
+}
+
+// UnmarshalYAML accepts a plain address string as well as a mapping
+func (c *ListenerConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*c = ListenerConfig{Address: node.Value}
+		return nil
+	}
+	type plain ListenerConfig
+	return node.Decode((*plain)(c))
+}
+
+// listenConfigs is a list of listeners, which may also be written as a
+// single address in the config file
+type listenConfigs []ListenerConfig
+
+func (l *listenConfigs) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = listenConfigs{{Address: node.Value}}
+		return nil
+	}
+	var listeners []ListenerConfig
+	if err := node.Decode(&listeners); err != nil {
+		return err
+	}
+	*l = listeners
+	return nil
+}
+
+// validate checks that the address is a unix socket URL or a TCP host:port
+// and that TLS has both a certificate and a key, or neither
+func (c ListenerConfig) validate() error {
+	if path, ok := strings.CutPrefix(c.Address, unixScheme); ok {
+		if path == "" {
+			return fmt.Errorf("listen address %q has no socket path", c.Address)
+		}
+	} else if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return fmt.Errorf("listen address %q must be host:port or %s/path: %w", c.Address, unixScheme, err)
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("listener %s requires both tls.certFile and tls.keyFile", c.Address)
+	}
+	if c.TLS.CertFile == "" && (c.TLS.ClientCAFile != "" || c.TLS.ClientAuth != "" || len(c.TLS.ClientCNs) > 0) {
+		return fmt.Errorf("listener %s requires tls.certFile and tls.keyFile for client certificates", c.Address)
+	}
+	if c.TLS.ClientCAFile == "" && (c.TLS.ClientAuth != "" || len(c.TLS.ClientCNs) > 0) {
+		return fmt.Errorf("listener %s requires tls.clientCAFile with tls.clientAuth and tls.clientCNs", c.Address)
+	}
+	if c.TLS.ClientAuth != "" && c.TLS.ClientAuth != "require" && c.TLS.ClientAuth != "optional" {
+		return fmt.Errorf("listener %s has invalid tls.clientAuth %q (want require or optional)", c.Address, c.TLS.ClientAuth)
+	}
+	return nil
+}
+
+// tlsListener is a listener serving HTTPS
+type tlsListener struct {
+	net.Listener
+}
+
+// listen opens a listener on a unix socket URL (e.g. unix:///run/sysstats.sock)
+// or a TCP host:port, wrapped in TLS when a certificate is configured. TLS
+// listeners offer HTTP/2 through ALPN when http2 is set. A socket file left
+// behind by an unclean exit is removed first; the socket file is removed
+// again when the listener closes.
+func listen(cfg ListenerConfig, http2 bool) (net.Listener, error) {
+	var tlsConfig *tls.Config
+	if cfg.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading TLS certificate of %s: %w", cfg.Address, err)
+		}
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+			NextProtos:   []string{"http/1.1"},
+		}
+		if http2 {
+			tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+		}
+		if cfg.TLS.ClientCAFile != "" {
+			if err := verifyClientCerts(tlsConfig, cfg.TLS); err != nil {
+				return nil, fmt.Errorf("error loading TLS client CAs of %s: %w", cfg.Address, err)
+			}
+		}
+	}
+
+	l, err := listenAddr(cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		return tlsListener{tls.NewListener(l, tlsConfig)}, nil
+	}
+	return l, nil
+}
+
+// verifyClientCerts makes a TLS config require client certificates signed by
+// the client CAs and, when ClientCNs is set, with one of those common names
+func verifyClientCerts(tlsConfig *tls.Config, cfg TLSConfig) error {
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return err
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no PEM certificates found in %s", cfg.ClientCAFile)
+	}
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	if cfg.ClientAuth == "optional" {
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	if len(cfg.ClientCNs) > 0 {
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return nil
+			}
+			if cn := cs.PeerCertificates[0].Subject.CommonName; !slices.Contains(cfg.ClientCNs, cn) {
+				return fmt.Errorf("client certificate common name %q is not allowed", cn)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// clientCertCN returns the common name of the verified client certificate
+// of a request, or "" without one
+func clientCertCN(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
+
+func listenAddr(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixScheme)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("error listening on %s: file exists and is not a socket", addr)
+		}
+		// Only remove the socket if no other process is serving on it
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("error listening on %s: socket is in use", addr)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("error removing stale socket %s: %w", path, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error listening on %s: %w", addr, err)
+	}
+	return net.Listen("unix", path)
+}
+
+// listenURL returns the URL at which a listener is reachable, for logs
+func listenURL(l net.Listener) string {
+	scheme := "http://"
+	if _, ok := l.(tlsListener); ok {
+		scheme = "https://"
+	}
+	if l.Addr().Network() == "unix" {
+		return unixScheme + l.Addr().String()
+	}
+	return scheme + l.Addr().String()
+}
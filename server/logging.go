@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// logAttrsKey is the context key of the request attributes added to log records
+type logAttrsKey struct{}
+
+// contextHandler adds the request attributes stored in the context to every
+// record logged with the *Context variants of the slog functions
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(logAttrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// withLogAttrs returns a copy of ctx whose log records carry attrs
+func withLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return context.WithValue(ctx, logAttrsKey{}, append(existing[:len(existing):len(existing)], attrs...))
+}
+
+// SetupLogger installs the default slog logger with the configured level and
+// format. The standard log package is redirected to it as well.
+func SetupLogger(cfg LogConfig) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return fmt.Errorf("invalid config: log.level %q must be debug, info, warn, or error", cfg.Level)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid config: log.format %q must be text or json", cfg.Format)
+	}
+
+	slog.SetDefault(slog.New(contextHandler{handler}))
+	return nil
+}
+
+// requestIDHeader carries the ID of a request, taken from the client or a
+// proxy when present and generated otherwise
+const requestIDHeader = "X-Request-ID"
+
+// newRequestID returns a random 16 byte hex request ID
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID reports whether a client supplied request ID is safe to
+// echo and log: at most 128 printable ASCII characters
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// accessLogHandler assigns each request an ID, returned in the X-Request-ID
+// header and attached with the method, path, and remote address to the log
+// records of its handlers. When access logging is enabled, every finished
+// request is logged with its status, size, and latency.
+func (s *Server) accessLogHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		attrs := []slog.Attr{
+			slog.String("requestId", id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("remote", r.RemoteAddr),
+		}
+		if cn := clientCertCN(r); cn != "" {
+			attrs = append(attrs, slog.String("clientCN", cn))
+		}
+		ctx := withLogAttrs(r.Context(), attrs...)
+		r = r.WithContext(ctx)
+
+		if !s.config.Log.AccessLog {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+		slog.InfoContext(ctx, "Request",
+			"status", rec.code,
+			"bytes", rec.bytes,
+			"latencyMs", float64(time.Since(start).Microseconds())/1000,
+			"userAgent", r.UserAgent(),
+		)
+	})
+}
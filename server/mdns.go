@@ -0,0 +1,451 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+const (
+	// mdnsService is the DNS-SD service type instances are announced as
+	mdnsService = "_system-stats._tcp.local."
+	// mdnsTTL is the lifetime of the announced records in seconds
+	mdnsTTL = 120
+	// mdnsCacheFlush marks the records only this host answers for
+	mdnsCacheFlush = 1 << 15
+)
+
+// mdnsGroup is the IPv4 multicast address of mDNS
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// listenMDNS joins the mDNS multicast group. Multicast loopback, which Go
+// disables, is enabled so that instances on the same host see each other.
+func listenMDNS() (*net.UDPConn, error) {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return nil, fmt.Errorf("error joining the mDNS group: %w", err)
+	}
+	if err := ipv4.NewPacketConn(conn).SetMulticastLoopback(true); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error enabling mDNS multicast loopback: %w", err)
+	}
+	return conn, nil
+}
+
+// announcedEndpoint returns the port and TLS setting announced over mDNS:
+// the configured port, or else that of the first TCP listener
+func announcedEndpoint(cfg *Config) (int, bool, error) {
+	if len(cfg.Listen) == 0 {
+		port := cfg.MDNS.Port
+		if port == 0 {
+			var err error
+			if port, err = strconv.Atoi(cfg.Port); err != nil {
+				return 0, false, fmt.Errorf("invalid config: mdns.port is required with the port %q", cfg.Port)
+			}
+		}
+		return port, false, nil
+	}
+	for _, listener := range cfg.Listen {
+		if strings.HasPrefix(listener.Address, unixScheme) {
+			continue
+		}
+		port := cfg.MDNS.Port
+		if port == 0 {
+			_, p, _ := net.SplitHostPort(listener.Address)
+			var err error
+			if port, err = strconv.Atoi(p); err != nil || port == 0 {
+				return 0, false, fmt.Errorf("invalid config: mdns.port is required with the listener %s", listener.Address)
+			}
+		}
+		return port, listener.TLS.CertFile != "", nil
+	}
+	return 0, false, fmt.Errorf("invalid config: mdns.announce requires a TCP listener")
+}
+
+// mdnsResponder announces this instance as a _system-stats._tcp service
+// and answers the queries for it, e.g. those of an aggregator browsing for
+// agents
+type mdnsResponder struct {
+	instance dnsmessage.Name
+	host     dnsmessage.Name
+	port     uint16
+	txt      []string
+}
+
+// newMDNSResponder creates the responder of the instance name served on
+// port. The TXT record tells browsers the scheme and path of the API.
+func newMDNSResponder(name, hostname string, port int, tls bool) (*mdnsResponder, error) {
+	instance, err := dnsmessage.NewName(name + "." + mdnsService)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mDNS instance name %q: %w", name, err)
+	}
+	host, err := dnsmessage.NewName(strings.Split(hostname, ".")[0] + ".local.")
+	if err != nil {
+		return nil, fmt.Errorf("invalid mDNS host name %q: %w", hostname, err)
+	}
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+	return &mdnsResponder{
+		instance: instance,
+		host:     host,
+		port:     uint16(port),
+		txt:      []string{"scheme=" + scheme, "path=" + apiPrefix, "version=" + version},
+	}, nil
+}
+
+// run announces the instance, answers queries until ctx is cancelled, and
+// then withdraws the announcement
+func (r *mdnsResponder) run(ctx context.Context) {
+	conn, err := listenMDNS()
+	if err != nil {
+		slog.Error("Error starting mDNS announcements", "error", err)
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		r.send(conn, 0)
+		conn.Close()
+	}()
+
+	slog.Info("Announcing over mDNS", "instance", r.instance.String(), "port", r.port)
+	r.send(conn, mdnsTTL)
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				slog.Error("Error reading mDNS query", "error", err)
+			}
+			return
+		}
+		if r.asked(buf[:n]) {
+			r.send(conn, mdnsTTL)
+		}
+	}
+}
+
+// asked reports whether a packet is a query for the service or the instance
+func (r *mdnsResponder) asked(packet []byte) bool {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(packet); err != nil || msg.Header.Response {
+		return false
+	}
+	for _, q := range msg.Questions {
+		switch {
+		case strings.EqualFold(q.Name.String(), mdnsService) && (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL):
+			return true
+		case strings.EqualFold(q.Name.String(), r.instance.String()):
+			return true
+		}
+	}
+	return false
+}
+
+// send multicasts the records of the instance with a TTL in seconds; a TTL
+// of 0 tells the other hosts to forget them
+func (r *mdnsResponder) send(conn *net.UDPConn, ttl uint32) {
+	packet, err := r.packet(ttl, localIPv4s())
+	if err == nil {
+		_, err = conn.WriteToUDP(packet, mdnsGroup)
+	}
+	if err != nil {
+		slog.Error("Error sending mDNS announcement", "error", err)
+	}
+}
+
+// packet builds the response announcing the instance at the addresses ips
+func (r *mdnsResponder) packet(ttl uint32, ips []net.IP) ([]byte, error) {
+	service := dnsmessage.MustNewName(mdnsService)
+	unique := dnsmessage.ClassINET | mdnsCacheFlush
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: service, Class: dnsmessage.ClassINET, TTL: ttl},
+			Body:   &dnsmessage.PTRResource{PTR: r.instance},
+		}},
+		Additionals: []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: r.instance, Class: unique, TTL: ttl},
+			Body:   &dnsmessage.SRVResource{Target: r.host, Port: r.port},
+		}, {
+			Header: dnsmessage.ResourceHeader{Name: r.instance, Class: unique, TTL: ttl},
+			Body:   &dnsmessage.TXTResource{TXT: r.txt},
+		}},
+	}
+	for _, ip := range ips {
+		msg.Additionals = append(msg.Additionals, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: r.host, Class: unique, TTL: ttl},
+			Body:   &dnsmessage.AResource{A: [4]byte(ip)},
+		})
+	}
+	return msg.Pack()
+}
+
+// localIPv4s returns the non-loopback IPv4 addresses of the host
+func localIPv4s() []net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+			if ip := ipNet.IP.To4(); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips
+}
+
+// mdnsBrowser periodically queries the network for _system-stats._tcp
+// instances and reports the API URL of each one answering
+type mdnsBrowser struct {
+	interval time.Duration
+	found    func(name string, apiURL *url.URL)
+}
+
+// run browses until ctx is cancelled
+func (b *mdnsBrowser) run(ctx context.Context) {
+	conn, err := listenMDNS()
+	if err != nil {
+		slog.Error("Error starting mDNS discovery", "error", err)
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	go func() {
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+		for {
+			b.query(conn)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				slog.Error("Error reading mDNS response", "error", err)
+			}
+			return
+		}
+		b.handle(buf[:n], src.IP)
+	}
+}
+
+// query multicasts a PTR query for the service
+func (b *mdnsBrowser) query(conn *net.UDPConn) {
+	packet, err := mdnsQuery()
+	if err == nil {
+		_, err = conn.WriteToUDP(packet, mdnsGroup)
+	}
+	if err != nil {
+		slog.Error("Error sending mDNS query", "error", err)
+	}
+}
+
+// mdnsQuery builds the PTR query for the service
+func mdnsQuery() ([]byte, error) {
+	msg := dnsmessage.Message{
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(mdnsService),
+			Type:  dnsmessage.TypePTR,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	return msg.Pack()
+}
+
+// mdnsInstance is what a response tells about one instance
+type mdnsInstance struct {
+	target string
+	port   uint16
+	txt    map[string]string
+	ttl    uint32
+}
+
+// handle reports the instances announced in a response. The address is
+// taken from the first A record of the SRV target, or else the sender.
+func (b *mdnsBrowser) handle(packet []byte, src net.IP) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(packet); err != nil || !msg.Header.Response {
+		return
+	}
+
+	instances := map[string]*mdnsInstance{}
+	addrs := map[string]net.IP{}
+	for _, rr := range append(msg.Answers, msg.Additionals...) {
+		name := rr.Header.Name.String()
+		switch body := rr.Body.(type) {
+		case *dnsmessage.SRVResource:
+			if strings.HasSuffix(strings.ToLower(name), mdnsService) {
+				instance := instanceOf(instances, name)
+				instance.target, instance.port, instance.ttl = body.Target.String(), body.Port, rr.Header.TTL
+			}
+		case *dnsmessage.TXTResource:
+			if strings.HasSuffix(strings.ToLower(name), mdnsService) {
+				instance := instanceOf(instances, name)
+				for _, kv := range body.TXT {
+					k, v, _ := strings.Cut(kv, "=")
+					instance.txt[k] = v
+				}
+			}
+		case *dnsmessage.AResource:
+			if _, ok := addrs[strings.ToLower(name)]; !ok {
+				addrs[strings.ToLower(name)] = net.IP(body.A[:])
+			}
+		}
+	}
+
+	for name, instance := range instances {
+		// A TTL of 0 withdraws the instance; it goes stale once unreachable
+		if instance.port == 0 || instance.ttl == 0 {
+			continue
+		}
+		ip, ok := addrs[strings.ToLower(instance.target)]
+		if !ok {
+			ip = src
+		}
+		scheme := instance.txt["scheme"]
+		if scheme != "https" {
+			scheme = "http"
+		}
+		path := instance.txt["path"]
+		if path == "" {
+			path = apiPrefix
+		}
+		apiURL := &url.URL{Scheme: scheme, Host: net.JoinHostPort(ip.String(), strconv.Itoa(int(instance.port))), Path: path}
+		b.found(strings.TrimSuffix(name[:len(name)-len(mdnsService)], "."), apiURL)
+	}
+}
+
+func instanceOf(instances map[string]*mdnsInstance, name string) *mdnsInstance {
+	instance, ok := instances[name]
+	if !ok {
+		instance = &mdnsInstance{txt: map[string]string{}}
+		instances[name] = instance
+	}
+	return instance
+}
+
+// discovery polls the stats of the agents found over mDNS into the node
+// registry, for agents that do not push their samples themselves
+type discovery struct {
+	registry *nodeRegistry
+	interval time.Duration
+	client   *http.Client
+	// self is the name this instance announces itself as, which is skipped
+	self string
+
+	mu   sync.Mutex
+	urls map[string]*url.URL
+}
+
+func newDiscovery(registry *nodeRegistry, interval time.Duration, self string) *discovery {
+	return &discovery{
+		registry: registry,
+		interval: interval,
+		client:   &http.Client{Timeout: interval},
+		self:     self,
+		urls:     map[string]*url.URL{},
+	}
+}
+
+// found starts polling a newly discovered agent, or updates the URL of a
+// known one
+func (d *discovery) found(ctx context.Context, name string, apiURL *url.URL) {
+	if name == d.self {
+		return
+	}
+	if _, err := parseNodeName(name); err != nil {
+		slog.Warn("Ignoring mDNS instance", "instance", name, "error", err)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.urls[name]; !ok {
+		slog.Info("Discovered agent over mDNS", "node", name, "url", apiURL.String())
+		go d.poll(ctx, name)
+	}
+	d.urls[name] = apiURL
+}
+
+// poll fetches the stats of a discovered agent every interval. Agents that
+// registered to push their samples are left alone.
+func (d *discovery) poll(ctx context.Context, name string) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		if !d.registry.Pushed(name) {
+			if err := d.fetch(ctx, name); err != nil && ctx.Err() == nil {
+				slog.Debug("Error polling discovered agent", "node", name, "error", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetch records the current stats of a discovered agent
+func (d *discovery) fetch(ctx context.Context, name string) error {
+	d.mu.Lock()
+	apiURL := d.urls[name]
+	d.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL.JoinPath("stats").String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", mediaJSON)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", req.URL.Redacted(), resp.Status)
+	}
+	var stats models.SystemStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return fmt.Errorf("error decoding stats: %w", err)
+	}
+
+	sample := []models.Sample{{Timestamp: time.Now().UTC(), Stats: &stats}}
+	err = d.registry.Append(name, sample)
+	if errors.Is(err, errUnknownNode) {
+		if err := d.registry.RegisterDiscovered(name, NodeRegistration{Hostname: apiURL.Hostname()}); err != nil {
+			return err
+		}
+		err = d.registry.Append(name, sample)
+	}
+	return err
+}
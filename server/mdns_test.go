@@ -0,0 +1,224 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsPointer is a compressed name pointing at offset
+func dnsPointer(offset int) []byte {
+	return []byte{0xc0 | byte(offset>>8), byte(offset)}
+}
+
+// dnsLabels encodes labels, ending with the root unless rest points to the
+// remaining labels
+func dnsLabels(rest []byte, labels ...string) []byte {
+	var b []byte
+	for _, label := range labels {
+		b = append(append(b, byte(len(label))), label...)
+	}
+	if rest == nil {
+		return append(b, 0)
+	}
+	return append(b, rest...)
+}
+
+// appendDNSRecord appends a resource record and returns the offset of its
+// data
+func appendDNSRecord(b *[]byte, name []byte, typ, class uint16, ttl uint32, data []byte) int {
+	*b = append(*b, name...)
+	*b = binary.BigEndian.AppendUint16(*b, typ)
+	*b = binary.BigEndian.AppendUint16(*b, class)
+	*b = binary.BigEndian.AppendUint32(*b, ttl)
+	*b = binary.BigEndian.AppendUint16(*b, uint16(len(data)))
+	offset := len(*b)
+	*b = append(*b, data...)
+	return offset
+}
+
+// mdnsAnnouncement is a response announcing instance web-01 on port 8080
+// with its names compressed the way responders do, e.g.
+//
+//	_system-stats._tcp.local. PTR web-01.<ptr>
+//	web-01.<ptr> SRV 0 0 8080 web-01.<ptr to local.>
+//	web-01.<ptr> TXT scheme=https path=/v2
+//	web-01.<ptr to local.> A 192.168.1.10
+func mdnsAnnouncement(ttl uint32, withA bool) []byte {
+	b := []byte{0, 0, 0x84, 0x00, 0, 0, 0, 1, 0, 0, 0, 2}
+	if withA {
+		b[11] = 3
+	}
+	const service = 12
+	local := service + 1 + len("_system-stats") + 1 + len("_tcp")
+	instance := appendDNSRecord(&b, dnsLabels(nil, "_system-stats", "_tcp", "local"), 12, 1, ttl, dnsLabels(dnsPointer(service), "web-01"))
+
+	srv := binary.BigEndian.AppendUint16([]byte{0, 0, 0, 0}, 8080)
+	target := appendDNSRecord(&b, dnsPointer(instance), 33, 0x8001, ttl, append(srv, dnsLabels(dnsPointer(local), "web-01")...)) + len(srv)
+	appendDNSRecord(&b, dnsPointer(instance), 16, 0x8001, ttl, []byte("\x0cscheme=https\x08path=/v2"))
+	if withA {
+		appendDNSRecord(&b, dnsPointer(target), 1, 0x8001, ttl, []byte{192, 168, 1, 10})
+	}
+	return b
+}
+
+// mdnsFound returns the instances found by a browser in a packet from src
+func mdnsFound(packet []byte, src net.IP) map[string]string {
+	found := map[string]string{}
+	b := &mdnsBrowser{found: func(name string, apiURL *url.URL) {
+		found[name] = apiURL.String()
+	}}
+	b.handle(packet, src)
+	return found
+}
+
+func TestMDNSBrowserHandle(t *testing.T) {
+	src := net.IPv4(10, 0, 0, 7)
+	announcement := mdnsAnnouncement(120, true)
+	query, err := mdnsQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a pointer to itself
+	loop := append(mdnsAnnouncement(120, true)[:12:12], dnsPointer(12)...)
+
+	tests := []struct {
+		name   string
+		packet []byte
+		want   map[string]string
+	}{
+		{"announcement", announcement, map[string]string{"web-01": "https://192.168.1.10:8080/v2"}},
+		{"without address", mdnsAnnouncement(120, false), map[string]string{"web-01": "https://10.0.0.7:8080/v2"}},
+		{"withdrawn", mdnsAnnouncement(0, true), map[string]string{}},
+		{"query", query, map[string]string{}},
+		{"truncated", announcement[:len(announcement)-3], map[string]string{}},
+		{"pointer loop", loop, map[string]string{}},
+		{"misplaced pointer", append(append([]byte{}, announcement[:12]...), append(dnsPointer(40), announcement[12:]...)...), map[string]string{}},
+		{"empty", nil, map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mdnsFound(tt.packet, src)
+			if len(got) != len(tt.want) {
+				t.Fatalf("found %v, want %v", got, tt.want)
+			}
+			for name, apiURL := range tt.want {
+				if got[name] != apiURL {
+					t.Errorf("found %s at %s, want %s", name, got[name], apiURL)
+				}
+			}
+		})
+	}
+}
+
+func TestMDNSResponderPacket(t *testing.T) {
+	r, err := newMDNSResponder("web-01", "web-01.example.com", 8443, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ips := []net.IP{net.IPv4(192, 168, 1, 10).To4(), net.IPv4(10, 0, 0, 7).To4()}
+	packet, err := r.packet(120, ips)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(packet); err != nil {
+		t.Fatal(err)
+	}
+	if !msg.Header.Response || !msg.Header.Authoritative {
+		t.Errorf("got header %+v", msg.Header)
+	}
+	var records []string
+	for _, rr := range append(msg.Answers, msg.Additionals...) {
+		record := fmt.Sprintf("%s %d %d", rr.Header.Name, rr.Header.Class, rr.Header.TTL)
+		switch body := rr.Body.(type) {
+		case *dnsmessage.PTRResource:
+			record += " PTR " + body.PTR.String()
+		case *dnsmessage.SRVResource:
+			record += fmt.Sprintf(" SRV %d %s", body.Port, body.Target)
+		case *dnsmessage.TXTResource:
+			record += " TXT " + strings.Join(body.TXT, " ")
+		case *dnsmessage.AResource:
+			record += " A " + net.IP(body.A[:]).String()
+		}
+		records = append(records, record)
+	}
+	want := []string{
+		"_system-stats._tcp.local. 1 120 PTR web-01._system-stats._tcp.local.",
+		"web-01._system-stats._tcp.local. 32769 120 SRV 8443 web-01.local.",
+		"web-01._system-stats._tcp.local. 32769 120 TXT scheme=https path=/api version=" + version,
+		"web-01.local. 32769 120 A 192.168.1.10",
+		"web-01.local. 32769 120 A 10.0.0.7",
+	}
+	if strings.Join(records, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got records\n%s\nwant\n%s", strings.Join(records, "\n"), strings.Join(want, "\n"))
+	}
+	// Repeated names are compressed
+	if n := bytes.Count(packet, []byte("_system-stats")); n != 1 {
+		t.Errorf("_system-stats appears %d times, want once", n)
+	}
+
+	// The first address is the one used
+	if got := mdnsFound(packet, nil); got["web-01"] != "https://192.168.1.10:8443/api" {
+		t.Errorf("browser found %v", got)
+	}
+	withdrawal, err := r.packet(0, ips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mdnsFound(withdrawal, nil); len(got) != 0 {
+		t.Errorf("browser found %v in the withdrawal", got)
+	}
+}
+
+func TestMDNSResponderAsked(t *testing.T) {
+	r, err := newMDNSResponder("web-01", "web-01", 8080, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	question := func(name string, typ dnsmessage.Type) []byte {
+		msg := dnsmessage.Message{Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET}}}
+		packet, err := msg.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return packet
+	}
+	query, err := mdnsQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	announcement, err := r.packet(120, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		packet []byte
+		want   bool
+	}{
+		{"browser query", query, true},
+		{"any", question("_system-stats._tcp.local.", dnsmessage.TypeALL), true},
+		{"case", question("_SYSTEM-STATS._tcp.local.", dnsmessage.TypePTR), true},
+		{"instance", question("web-01._system-stats._tcp.local.", dnsmessage.TypeSRV), true},
+		{"service SRV", question("_system-stats._tcp.local.", dnsmessage.TypeSRV), false},
+		{"other service", question("_http._tcp.local.", dnsmessage.TypePTR), false},
+		{"other instance", question("web-02._system-stats._tcp.local.", dnsmessage.TypeTXT), false},
+		{"response", announcement, false},
+		{"truncated", query[:len(query)-2], false},
+		{"malformed", []byte{0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0x3f}, false},
+	}
+	for _, tt := range tests {
+		if got := r.asked(tt.packet); got != tt.want {
+			t.Errorf("%s: asked() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// mdraidStats returns the software RAID statistics of a sample, or nil when
+// it has none
+func mdraidStats(stats *models.SystemStats) *models.MDRaidStats {
+	mdraid, ok := stats.Extra[collector.TopicMDRaid].(models.MDRaidStats)
+	if !ok {
+		return nil
+	}
+	return &mdraid
+}
+
+// mdraidHandler godoc
+// @Summary Get software RAID status
+// @Description Returns the Linux software RAID (md) arrays of /proc/mdstat from the last sample: their state, members with the failed and spare ones, and the resync, recovery, reshape, check, or repair in progress. Arrays missing members or inactive are counted in degraded, which alert rules watch as the mdraidDegradedArrays metric. Only available on Linux hosts with the md driver loaded.
+// @Tags stats
+// @Produce json
+// @Success 200 {object} models.MDRaidStats
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /mdraid [get]
+func (s *Server) mdraidHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !slices.Contains(collector.Topics(), collector.TopicMDRaid) {
+		http.Error(w, "Software RAID is not available on this host", http.StatusNotFound)
+		return
+	}
+
+	sample, ok := s.history.Latest()
+	stats := sample.Stats
+	if !ok {
+		cached, err := s.cache.Get(r.Context(), collector.TopicSet{collector.TopicMDRaid: true}, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stats = cached
+	}
+	if err, failed := stats.Errors[collector.TopicMDRaid]; failed {
+		http.Error(w, err, http.StatusInternalServerError)
+		return
+	}
+	mdraid := mdraidStats(stats)
+	if mdraid == nil {
+		http.Error(w, "Software RAID is not available on this host", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, r, mdraid)
+}
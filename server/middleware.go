@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// originAllowed reports whether origin matches one of the explicitly allowed
+// origins. Entries may contain a single "*" wildcard, e.g.
+// "https://*.example.com"; a bare "*" entry is not an explicit origin and
+// never matches.
+func originAllowed(origin string, allowed []string) bool {
+	for _, pattern := range allowed {
+		if pattern == "*" {
+			continue
+		}
+		if pattern == origin {
+			return true
+		}
+		if prefix, suffix, ok := strings.Cut(pattern, "*"); ok &&
+			len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or ""
+// if it may not call the API. Only explicitly allowed origins are echoed; a
+// "*" entry lets any other origin read the API without credentials.
+func allowOrigin(origin string, allowed []string) string {
+	switch {
+	case originAllowed(origin, allowed):
+		return origin
+	case slices.Contains(allowed, "*"):
+		return "*"
+	}
+	return ""
+}
+
+// corsMiddleware wraps an http.HandlerFunc and adds CORS headers according to the config
+func (s *Server) corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return s.cors(s.config.CORS.AllowedMethods, next)
+}
+
+// corsReadOnlyMiddleware is corsMiddleware for routes which also serve admin
+// methods, e.g. POST /watch: only reads and their preflights get CORS
+// headers, so browsers refuse to send cross-origin admin requests.
+func (s *Server) corsReadOnlyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	var methods []string
+	for _, method := range s.config.CORS.AllowedMethods {
+		switch strings.ToUpper(method) {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			methods = append(methods, method)
+		}
+	}
+	return s.cors(methods, next)
+}
+
+// cors adds the CORS headers to the requests from allowed origins using one
+// of methods
+func (s *Server) cors(methods []string, next http.HandlerFunc) http.HandlerFunc {
+	cfg := s.config.CORS
+	allowMethods := strings.Join(methods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	methodAllowed := func(method string) bool {
+		return slices.ContainsFunc(methods, func(m string) bool { return strings.EqualFold(m, method) })
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		method := r.Method
+		if preflight {
+			method = r.Header.Get("Access-Control-Request-Method")
+		}
+
+		if origin != "" && methodAllowed(method) {
+			if allowed := allowOrigin(origin, cfg.AllowedOrigins); allowed != "" {
+				w.Header().Set("Access-Control-Allow-Origin", allowed)
+				// Credentials are only ever shared with an echoed origin
+				if cfg.AllowCredentials && allowed != "*" {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+				w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+				w.Header().Set("Access-Control-Expose-Headers", requestIDHeader)
+			}
+		}
+
+		// Handle preflight requests
+		if preflight {
+			if cfg.MaxAge > 0 && w.Header().Get("Access-Control-Allow-Origin") != "" {
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{"https://app.example.com", []string{"https://app.example.com"}, true},
+		{"https://app.example.com", []string{"https://*.example.com"}, true},
+		{"https://example.com", []string{"https://*.example.com"}, false},
+		{"https://evil.com", []string{"https://*.example.com"}, false},
+		{"https://evil.com", []string{"*"}, false},
+		{"https://evil.com", nil, false},
+	}
+	for _, tt := range tests {
+		if got := originAllowed(tt.origin, tt.allowed); got != tt.want {
+			t.Errorf("originAllowed(%q, %q) = %v, want %v", tt.origin, tt.allowed, got, tt.want)
+		}
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		credentials bool
+		readOnly    bool
+		method      string
+		preflight   string
+		origin      string
+		wantOrigin  string
+		wantCreds   bool
+		wantCalled  bool
+	}{
+		{name: "wildcard", origins: []string{"*"}, method: "GET", origin: "https://a.com", wantOrigin: "*", wantCalled: true},
+		{name: "no origin", origins: []string{"*"}, method: "GET", wantCalled: true},
+		{name: "listed with credentials", origins: []string{"https://a.com"}, credentials: true, method: "GET", origin: "https://a.com", wantOrigin: "https://a.com", wantCreds: true, wantCalled: true},
+		{name: "unlisted with credentials", origins: []string{"https://a.com"}, credentials: true, method: "GET", origin: "https://b.com", wantCalled: true},
+		{name: "wildcard does not echo", origins: []string{"*", "https://a.com"}, method: "GET", origin: "https://b.com", wantOrigin: "*", wantCalled: true},
+		{name: "preflight", origins: []string{"https://a.com"}, method: "OPTIONS", preflight: "POST", origin: "https://a.com", wantOrigin: "https://a.com"},
+		{name: "read only get", origins: []string{"*"}, readOnly: true, method: "GET", origin: "https://a.com", wantOrigin: "*", wantCalled: true},
+		{name: "read only post", origins: []string{"*"}, readOnly: true, method: "POST", origin: "https://a.com", wantCalled: true},
+		{name: "read only preflight post", origins: []string{"*"}, readOnly: true, method: "OPTIONS", preflight: "POST", origin: "https://a.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.CORS.AllowedOrigins = tt.origins
+			cfg.CORS.AllowCredentials = tt.credentials
+			s := &Server{config: cfg}
+
+			called := false
+			next := func(w http.ResponseWriter, r *http.Request) { called = true }
+			handler := s.corsMiddleware(next)
+			if tt.readOnly {
+				handler = s.corsReadOnlyMiddleware(next)
+			}
+
+			r := httptest.NewRequest(tt.method, "/api/stats", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight != "" {
+				r.Header.Set("Access-Control-Request-Method", tt.preflight)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCreds {
+				t.Errorf("Access-Control-Allow-Credentials = %v, want %v", got, tt.wantCreds)
+			}
+			if !strings.Contains(w.Header().Get("Vary"), "Origin") {
+				t.Errorf("Vary = %q, want Origin", w.Header().Get("Vary"))
+			}
+			if called != tt.wantCalled {
+				t.Errorf("next called = %v, want %v", called, tt.wantCalled)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRejectsCredentialedWildcard(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	cfg := defaultConfig()
+	if cfg.CORS.AllowCredentials {
+		t.Fatal("credentials are allowed by default")
+	}
+	if _, err := LoadConfig(""); err != nil {
+		t.Fatalf("LoadConfig() = %v", err)
+	}
+
+	path := t.TempDir() + "/config.yaml"
+	if err := os.WriteFile(path, []byte("cors:\n  allowCredentials: true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "cors.allowCredentials") {
+		t.Errorf("LoadConfig() = %v, want a cors.allowCredentials error", err)
+	}
+}
@@ -0,0 +1,306 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// MQTT 3.1.1 control packet types, in the high nibble of the first byte
+const (
+	mqttConnect = 1
+	mqttConnack = 2
+	mqttPublish = 3
+	mqttPuback  = 4
+	mqttPubrec  = 5
+	mqttPubrel  = 6
+	mqttPubcomp = 7
+)
+
+// mqttConnackErrors are the reasons a broker refuses a connection
+var mqttConnackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// mqttSink publishes every sample as JSON to an MQTT broker over a
+// persistent connection, e.g. for Home Assistant or Node-RED. It speaks
+// MQTT 3.1.1 and only publishes, so it connects with a keep alive of 0 and
+// the connection is re-established on the next write after an error.
+type mqttSink struct {
+	cfg       MQTTConfig
+	address   string
+	tlsConfig *tls.Config
+	topic     string
+	clientID  string
+
+	mu       sync.Mutex
+	conn     net.Conn
+	reader   *bufio.Reader
+	packetID uint16
+}
+
+// newMQTTSink creates an MQTT sink. The {host} placeholder of the topic
+// template is replaced once.
+func newMQTTSink(cfg MQTTConfig, hostname string) (*mqttSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sinks.mqtt.url: %w", err)
+	}
+
+	s := &mqttSink{
+		cfg:      cfg,
+		address:  u.Host,
+		topic:    strings.ReplaceAll(cfg.Topic, "{host}", hostname),
+		clientID: cfg.ClientID,
+	}
+	if s.clientID == "" {
+		s.clientID = "system-stats-backend-" + hostname
+	}
+	if strings.ContainsAny(s.topic, "+#") {
+		return nil, fmt.Errorf("invalid sinks.mqtt.topic %q: must not contain wildcards", s.topic)
+	}
+
+	switch u.Scheme {
+	case "mqtt", "tcp":
+		if u.Port() == "" {
+			s.address = net.JoinHostPort(u.Hostname(), "1883")
+		}
+	case "mqtts", "ssl", "tls":
+		if u.Port() == "" {
+			s.address = net.JoinHostPort(u.Hostname(), "8883")
+		}
+		if s.tlsConfig, err = clientTLSConfig(cfg.TLS, u.Hostname(), "sinks.mqtt.tls"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid sinks.mqtt.url: unsupported scheme %q (want mqtt or mqtts)", u.Scheme)
+	}
+	return s, nil
+}
+
+func (s *mqttSink) Name() string {
+	return "mqtt"
+}
+
+// Write publishes the samples in order, as {"seq":..,"timestamp":..,"stats":{..}}.
+// With QoS 1 and 2 every message is acknowledged before the next one is sent.
+func (s *mqttSink) Write(ctx context.Context, samples []models.Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	for _, sample := range samples {
+		payload, err := json.Marshal(s.message(sample))
+		if err != nil {
+			return err
+		}
+		if err := s.publish(payload); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// message trims the processes of a sample to the configured number
+func (s *mqttSink) message(sample models.Sample) models.Sample {
+	stats := *sample.Stats
+	if s.cfg.Processes > 0 {
+		trimProcesses(&stats, topProcsQuery{N: s.cfg.Processes, SortBy: "cpu"})
+	} else {
+		stats.ProcessCount = len(stats.Processes)
+		stats.Processes = []models.ProcessInfo{}
+	}
+	return models.Sample{Seq: sample.Seq, Timestamp: sample.Timestamp, Stats: &stats}
+}
+
+// connect dials the broker and waits for it to accept the session
+func (s *mqttSink) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: s.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return err
+	}
+	if s.tlsConfig != nil {
+		tlsConn := tls.Client(conn, s.tlsConfig)
+		tlsConn.SetDeadline(time.Now().Add(s.cfg.Timeout))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return err
+		}
+		conn = tlsConn
+	}
+
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+	if err := s.handshake(); err != nil {
+		conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// handshake sends the connect packet and checks the broker's answer
+func (s *mqttSink) handshake() error {
+	var flags byte = 0x02 // clean session
+	payload := appendMQTTString(nil, s.clientID)
+	if s.cfg.Username != "" {
+		flags |= 0x80
+		payload = appendMQTTString(payload, s.cfg.Username)
+	}
+	if s.cfg.Password != "" {
+		flags |= 0x40
+		payload = appendMQTTString(payload, s.cfg.Password)
+	}
+	body := appendMQTTString(nil, "MQTT")
+	body = append(body, 4, flags, 0, 0) // protocol level 4, keep alive 0
+	body = append(body, payload...)
+	if err := s.send(mqttConnect<<4, body); err != nil {
+		return err
+	}
+
+	kind, body, err := s.receive()
+	if err != nil {
+		return err
+	}
+	if kind != mqttConnack || len(body) != 2 {
+		return fmt.Errorf("unexpected MQTT packet %d instead of CONNACK", kind)
+	}
+	if code := body[1]; code != 0 {
+		if reason, ok := mqttConnackErrors[code]; ok {
+			return fmt.Errorf("MQTT broker refused the connection: %s", reason)
+		}
+		return fmt.Errorf("MQTT broker refused the connection: code %d", code)
+	}
+	return nil
+}
+
+// publish sends one message and completes the acknowledgement flow of its QoS
+func (s *mqttSink) publish(payload []byte) error {
+	header := byte(mqttPublish<<4 | s.cfg.QoS<<1)
+	if s.cfg.Retain {
+		header |= 0x01
+	}
+	body := appendMQTTString(nil, s.topic)
+	var id uint16
+	if s.cfg.QoS > 0 {
+		s.packetID++
+		if s.packetID == 0 {
+			s.packetID = 1
+		}
+		id = s.packetID
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, payload...)
+	if err := s.send(header, body); err != nil {
+		return err
+	}
+
+	switch s.cfg.QoS {
+	case 1:
+		return s.expectAck(mqttPuback, id)
+	case 2:
+		if err := s.expectAck(mqttPubrec, id); err != nil {
+			return err
+		}
+		if err := s.send(mqttPubrel<<4|0x02, binary.BigEndian.AppendUint16(nil, id)); err != nil {
+			return err
+		}
+		return s.expectAck(mqttPubcomp, id)
+	}
+	return nil
+}
+
+// expectAck waits for the acknowledgement of kind for packet id
+func (s *mqttSink) expectAck(kind byte, id uint16) error {
+	got, body, err := s.receive()
+	if err != nil {
+		return err
+	}
+	if got != kind || len(body) != 2 || binary.BigEndian.Uint16(body) != id {
+		return fmt.Errorf("unexpected MQTT packet %d instead of the acknowledgement of message %d", got, id)
+	}
+	return nil
+}
+
+// send writes a control packet
+func (s *mqttSink) send(header byte, body []byte) error {
+	packet := append([]byte{header}, appendMQTTLength(nil, len(body))...)
+	packet = append(packet, body...)
+	s.conn.SetWriteDeadline(time.Now().Add(s.cfg.Timeout))
+	_, err := s.conn.Write(packet)
+	return err
+}
+
+// receive reads a control packet, returning its type and body
+func (s *mqttSink) receive() (byte, []byte, error) {
+	s.conn.SetReadDeadline(time.Now().Add(s.cfg.Timeout))
+	header, err := s.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := s.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("malformed MQTT packet length")
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
+
+// appendMQTTString appends a length-prefixed UTF-8 string
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// appendMQTTLength appends the variable-length remaining length of a packet
+func appendMQTTLength(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// mqttPacket is a control packet received by mqttScript
+type mqttPacket struct {
+	header byte
+	body   []byte
+}
+
+// mqttScript is the broker end of a connection to an mqttSink
+type mqttScript struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// receive reads a control packet, or returns false when the sink closed
+// the connection
+func (s *mqttScript) receive() (mqttPacket, bool) {
+	header, err := s.r.ReadByte()
+	if err != nil {
+		return mqttPacket{}, false
+	}
+	length, multiplier := 0, 1
+	for {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			s.t.Errorf("reading the packet length: %v", err)
+			return mqttPacket{}, false
+		}
+		length += int(b&0x7f) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.r, body); err != nil {
+		s.t.Errorf("reading the packet body: %v", err)
+		return mqttPacket{}, false
+	}
+	return mqttPacket{header, body}, true
+}
+
+func (s *mqttScript) send(header byte, body ...byte) {
+	s.conn.Write(append(appendMQTTLength([]byte{header}, len(body)), body...))
+}
+
+// ack sends an acknowledgement of kind for packet id
+func (s *mqttScript) ack(kind byte, id uint16) {
+	s.send(kind<<4, byte(id>>8), byte(id))
+}
+
+// testMQTTSink returns a sink connected to script over a pipe, and a
+// function closing the connection and waiting for script to return
+func testMQTTSink(t *testing.T, cfg MQTTConfig, script func(s *mqttScript)) (*mqttSink, func()) {
+	t.Helper()
+	cfg.URL, cfg.Topic, cfg.Timeout = "mqtt://localhost", "stats/{host}", 5*time.Second
+	sink, err := newMQTTSink(cfg, "web-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := net.Pipe()
+	sink.conn, sink.reader = client, bufio.NewReader(client)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer server.Close()
+		script(&mqttScript{t: t, conn: server, r: bufio.NewReader(server)})
+	}()
+	closeConn := func() {
+		client.Close()
+		<-done
+	}
+	t.Cleanup(closeConn)
+	return sink, closeConn
+}
+
+func TestMQTTHandshake(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         MQTTConfig
+		connack     []byte
+		wantConnect []byte
+		wantErr     string
+	}{
+		{
+			name:    "accepted",
+			connack: []byte{0x20, 0x02, 0x00, 0x00},
+			wantConnect: []byte{
+				0x10, 0x27,
+				0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0x02, 0x00, 0x00,
+				0x00, 0x1b, 's', 'y', 's', 't', 'e', 'm', '-', 's', 't', 'a', 't', 's', '-', 'b', 'a', 'c', 'k', 'e', 'n', 'd', '-', 'w', 'e', 'b', '-', '0', '1',
+			},
+		},
+		{
+			name:    "credentials",
+			cfg:     MQTTConfig{ClientID: "probe", Username: "user", Password: "pass"},
+			connack: []byte{0x20, 0x02, 0x01, 0x00},
+			wantConnect: []byte{
+				0x10, 0x1d,
+				0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0xc2, 0x00, 0x00,
+				0x00, 0x05, 'p', 'r', 'o', 'b', 'e',
+				0x00, 0x04, 'u', 's', 'e', 'r',
+				0x00, 0x04, 'p', 'a', 's', 's',
+			},
+		},
+		{
+			name:    "bad credentials",
+			connack: []byte{0x20, 0x02, 0x00, 0x04},
+			wantErr: "MQTT broker refused the connection: bad user name or password",
+		},
+		{
+			name:    "unknown refusal",
+			connack: []byte{0x20, 0x02, 0x00, 0x80},
+			wantErr: "MQTT broker refused the connection: code 128",
+		},
+		{
+			name:    "not a CONNACK",
+			connack: []byte{0x40, 0x02, 0x00, 0x00},
+			wantErr: "unexpected MQTT packet 4 instead of CONNACK",
+		},
+		{
+			name:    "malformed length",
+			connack: []byte{0x20, 0x80, 0x80, 0x80, 0x80, 0x01},
+			wantErr: "malformed MQTT packet length",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var connect mqttPacket
+			sink, _ := testMQTTSink(t, tt.cfg, func(s *mqttScript) {
+				connect, _ = s.receive()
+				s.conn.Write(tt.connack)
+			})
+			err := sink.handshake()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("handshake() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handshake() error = %v", err)
+			}
+			got := append(appendMQTTLength([]byte{connect.header}, len(connect.body)), connect.body...)
+			if !bytes.Equal(got, tt.wantConnect) {
+				t.Errorf("sent CONNECT % x, want % x", got, tt.wantConnect)
+			}
+		})
+	}
+}
+
+func TestMQTTPublish(t *testing.T) {
+	samples := []models.Sample{
+		{Seq: 1, Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Stats: &models.SystemStats{CPUUsage: 12.5, Processes: make([]models.ProcessInfo, 3)}},
+		{Seq: 2, Timestamp: time.Date(2024, 5, 1, 12, 0, 1, 0, time.UTC), Stats: &models.SystemStats{CPUUsage: 25}},
+	}
+	tests := []struct {
+		name   string
+		qos    byte
+		retain bool
+		// broker answers the publish of message id, or returns false to stop
+		broker     func(s *mqttScript, id uint16) bool
+		wantHeader byte
+		wantErr    string
+	}{
+		{
+			name:       "QoS 0",
+			broker:     func(*mqttScript, uint16) bool { return true },
+			wantHeader: 0x30,
+		},
+		{
+			name:       "QoS 0 retained",
+			retain:     true,
+			broker:     func(*mqttScript, uint16) bool { return true },
+			wantHeader: 0x31,
+		},
+		{
+			name: "QoS 1",
+			qos:  1,
+			broker: func(s *mqttScript, id uint16) bool {
+				s.ack(mqttPuback, id)
+				return true
+			},
+			wantHeader: 0x32,
+		},
+		{
+			name: "QoS 2",
+			qos:  2,
+			broker: func(s *mqttScript, id uint16) bool {
+				s.ack(mqttPubrec, id)
+				pubrel, _ := s.receive()
+				if pubrel.header != 0x62 || !bytes.Equal(pubrel.body, binary.BigEndian.AppendUint16(nil, id)) {
+					s.t.Errorf("got %x % x, want PUBREL of message %d", pubrel.header, pubrel.body, id)
+				}
+				s.ack(mqttPubcomp, id)
+				return true
+			},
+			wantHeader: 0x34,
+		},
+		{
+			name: "QoS 1 acknowledging another message",
+			qos:  1,
+			broker: func(s *mqttScript, id uint16) bool {
+				s.ack(mqttPuback, id+1)
+				return false
+			},
+			wantHeader: 0x32,
+			wantErr:    "unexpected MQTT packet 4 instead of the acknowledgement of message 1",
+		},
+		{
+			name: "QoS 2 without PUBREC",
+			qos:  2,
+			broker: func(s *mqttScript, id uint16) bool {
+				s.ack(mqttPubcomp, id)
+				return false
+			},
+			wantHeader: 0x34,
+			wantErr:    "unexpected MQTT packet 7 instead of the acknowledgement of message 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var published []mqttPacket
+			sink, closeConn := testMQTTSink(t, MQTTConfig{QoS: tt.qos, Retain: tt.retain}, func(s *mqttScript) {
+				for id := uint16(1); ; id++ {
+					packet, ok := s.receive()
+					if !ok {
+						return
+					}
+					published = append(published, packet)
+					if !tt.broker(s, id) {
+						return
+					}
+				}
+			})
+			err := sink.Write(context.Background(), samples)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Write() error = %v, want %q", err, tt.wantErr)
+				}
+				if sink.conn != nil {
+					t.Error("connection kept after an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			closeConn()
+
+			if len(published) != len(samples) {
+				t.Fatalf("published %d messages, want %d", len(published), len(samples))
+			}
+			for i, packet := range published {
+				if packet.header != tt.wantHeader {
+					t.Errorf("message %d has header %#x, want %#x", i+1, packet.header, tt.wantHeader)
+				}
+				body := packet.body
+				topic := string(body[2 : 2+binary.BigEndian.Uint16(body)])
+				body = body[2+len(topic):]
+				if tt.qos > 0 {
+					if id := binary.BigEndian.Uint16(body); id != uint16(i+1) {
+						t.Errorf("message %d has packet id %d", i+1, id)
+					}
+					body = body[2:]
+				}
+				var sample models.Sample
+				if err := json.Unmarshal(body, &sample); err != nil {
+					t.Fatal(err)
+				}
+				if topic != "stats/web-01" || sample.Seq != samples[i].Seq || sample.Stats.CPUUsage != samples[i].Stats.CPUUsage || len(sample.Stats.Processes) != 0 || sample.Stats.ProcessCount != len(samples[i].Stats.Processes) {
+					t.Errorf("message %d published %s to %s", i+1, body, topic)
+				}
+			}
+		})
+	}
+}
+
+func TestAppendMQTTLength(t *testing.T) {
+	tests := []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+		{268435455, []byte{0xff, 0xff, 0xff, 0x7f}},
+	}
+	for _, tt := range tests {
+		if got := appendMQTTLength(nil, tt.n); !bytes.Equal(got, tt.want) {
+			t.Errorf("appendMQTTLength(%d) = % x, want % x", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestNewMQTTSink(t *testing.T) {
+	tests := []struct {
+		url, topic  string
+		wantAddress string
+		wantErr     string
+	}{
+		{"mqtt://broker", "stats/{host}", "broker:1883", ""},
+		{"tcp://broker:1884", "stats/{host}", "broker:1884", ""},
+		{"mqtts://broker", "stats/{host}", "broker:8883", ""},
+		{"http://broker", "stats/{host}", "", "unsupported scheme"},
+		{"mqtt://broker", "stats/+/cpu", "", "must not contain wildcards"},
+	}
+	for _, tt := range tests {
+		s, err := newMQTTSink(MQTTConfig{URL: tt.url, Topic: tt.topic}, "web-01")
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newMQTTSink(%s, %s) error = %v, want %q", tt.url, tt.topic, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || s.address != tt.wantAddress {
+			t.Errorf("newMQTTSink(%s) = %v, %v, want address %s", tt.url, s, err, tt.wantAddress)
+		}
+	}
+}
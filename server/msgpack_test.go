@@ -0,0 +1,152 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+func TestMarshalMsgpackGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want []byte
+	}{
+		{"nil", nil, []byte{0xc0}},
+		{"false", false, []byte{0xc2}},
+		{"true", true, []byte{0xc3}},
+		{"positive fixint", 127, []byte{0x7f}},
+		{"uint8", 128, []byte{0xcc, 0x80}},
+		{"uint16", 256, []byte{0xcd, 0x01, 0x00}},
+		{"uint32", 1 << 16, []byte{0xce, 0x00, 0x01, 0x00, 0x00}},
+		{"uint64", uint64(1 << 32), []byte{0xcf, 0, 0, 0, 1, 0, 0, 0, 0}},
+		{"negative fixint", -32, []byte{0xe0}},
+		{"int8", -33, []byte{0xd0, 0xdf}},
+		{"int16", -129, []byte{0xd1, 0xff, 0x7f}},
+		{"int32", -32769, []byte{0xd2, 0xff, 0xff, 0x7f, 0xff}},
+		{"int64", int64(math.MinInt64), []byte{0xd3, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+		{"float32", float32(1.5), []byte{0xca, 0x3f, 0xc0, 0x00, 0x00}},
+		{"float64", 1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{"fixstr", "abc", []byte{0xa3, 'a', 'b', 'c'}},
+		{"str8", strings.Repeat("a", 32), append([]byte{0xd9, 32}, strings.Repeat("a", 32)...)},
+		{"str16", strings.Repeat("a", 256), append([]byte{0xda, 0x01, 0x00}, strings.Repeat("a", 256)...)},
+		{"nil slice", []int(nil), []byte{0xc0}},
+		{"empty slice", []int{}, []byte{0x90}},
+		{"fixarray", []int{1, 2}, []byte{0x92, 0x01, 0x02}},
+		{"array16", make([]bool, 16), append([]byte{0xdc, 0x00, 0x10}, bytes.Repeat([]byte{0xc2}, 16)...)},
+		{"sorted map", map[string]int{"b": 2, "a": 1}, []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x02}},
+		{"nil map", map[string]int(nil), []byte{0xc0}},
+		{"time", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), append([]byte{0xb4}, "2024-05-01T12:00:00Z"...)},
+		{"struct", models.Rates{MemGrowth: 1}, []byte{
+			0x83,
+			0xa9, 'm', 'e', 'm', 'G', 'r', 'o', 'w', 't', 'h', 0xcb, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0,
+			0xa8, 'd', 'i', 's', 'k', 'F', 'i', 'l', 'l', 0xcb, 0, 0, 0, 0, 0, 0, 0, 0,
+			0xad, 'n', 'e', 't', 'T', 'h', 'r', 'o', 'u', 'g', 'h', 'p', 'u', 't', 0xcb, 0, 0, 0, 0, 0, 0, 0, 0,
+		}},
+		{"omitempty", models.Filesystem{Mountpoint: "/"}, []byte{
+			0x84,
+			0xaa, 'm', 'o', 'u', 'n', 't', 'p', 'o', 'i', 'n', 't', 0xa1, '/',
+			0xa5, 't', 'o', 't', 'a', 'l', 0x00,
+			0xa4, 'u', 's', 'e', 'd', 0x00,
+			0xab, 'u', 's', 'e', 'd', 'P', 'e', 'r', 'c', 'e', 'n', 't', 0xcb, 0, 0, 0, 0, 0, 0, 0, 0,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := marshalMsgpack(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("marshalMsgpack(%v) = % x, want % x", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalMsgpackUnsupported(t *testing.T) {
+	for _, v := range []interface{}{map[int]string{1: "a"}, make(chan int), func() {}} {
+		if _, err := marshalMsgpack(v); err == nil {
+			t.Errorf("marshalMsgpack(%T) succeeded", v)
+		}
+	}
+}
+
+// msgpackNumbers converts the integers and floats in a value decoded from
+// MessagePack to float64, like encoding/json decodes them
+func msgpackNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = msgpackNumbers(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = msgpackNumbers(value)
+		}
+	default:
+		if rv := reflect.ValueOf(v); rv.CanInt() {
+			return float64(rv.Int())
+		} else if rv.CanUint() {
+			return float64(rv.Uint())
+		} else if rv.CanFloat() {
+			return rv.Float()
+		}
+	}
+	return v
+}
+
+func TestMarshalMsgpackMatchesJSON(t *testing.T) {
+	samples := []models.Sample{
+		{Seq: 1, Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Stats: encodingStats()},
+		{Seq: 2, Timestamp: time.Date(2024, 5, 1, 12, 0, 1, 500, time.FixedZone("CEST", 2*3600)), Stats: &models.SystemStats{}},
+		{Seq: 3},
+	}
+	// the process list needs a 16 bit array header and a name a str8
+	many := encodingStats()
+	many.Processes = make([]models.ProcessInfo, 300)
+	many.Processes[0].Name = strings.Repeat("x", 100)
+
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"stats", encodingStats()},
+		{"many processes", many},
+		{"samples", samples},
+		{"no samples", []models.Sample{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := marshalMsgpack(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got interface{}
+			if err := msgpack.Unmarshal(b, &got); err != nil {
+				t.Fatalf("decoding: %v", err)
+			}
+
+			data, err := json.Marshal(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want interface{}
+			if err := json.Unmarshal(data, &want); err != nil {
+				t.Fatal(err)
+			}
+			if got := msgpackNumbers(got); !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				t.Errorf("got\n%s\nwant\n%s", gotJSON, data)
+			}
+		})
+	}
+}
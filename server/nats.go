@@ -0,0 +1,350 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// natsSink publishes samples and events to NATS subjects over a persistent
+// connection. With JetStream every message waits for the stream storing its
+// subject to acknowledge it. Each write ends with a PING round trip, which
+// answers the server's own pings and surfaces errors such as permission
+// violations. The connection is re-established on the next write after an
+// error.
+type natsSink struct {
+	cfg          NATSConfig
+	address      string
+	tlsConfig    *tls.Config
+	hostname     string
+	subject      string
+	eventSubject string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	// inbox is the prefix of the reply subjects of JetStream acknowledgements
+	inbox string
+	acks  uint64
+}
+
+// natsPubAck is the acknowledgement of a JetStream publish
+type natsPubAck struct {
+	Stream string `json:"stream"`
+	Seq    uint64 `json:"seq"`
+	Error  *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// newNATSSink creates a NATS sink. The {host} placeholder of the subjects is
+// replaced once.
+func newNATSSink(cfg NATSConfig, hostname string) (*natsSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sinks.nats.url: %w", err)
+	}
+
+	host := strings.NewReplacer(".", "_", " ", "_").Replace(hostname)
+	s := &natsSink{
+		cfg:          cfg,
+		address:      u.Host,
+		hostname:     hostname,
+		subject:      strings.ReplaceAll(cfg.Subject, "{host}", host),
+		eventSubject: strings.ReplaceAll(cfg.EventSubject, "{host}", host),
+	}
+	if strings.ContainsAny(s.subject+s.eventSubject, " \t*>") {
+		return nil, fmt.Errorf("invalid sinks.nats subjects %q and %q: must not contain whitespace or wildcards", s.subject, s.eventSubject)
+	}
+	if u.Port() == "" {
+		s.address = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	switch u.Scheme {
+	case "nats":
+	case "tls":
+		if s.tlsConfig, err = clientTLSConfig(cfg.TLS, u.Hostname(), "sinks.nats.tls"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid sinks.nats.url: unsupported scheme %q (want nats or tls)", u.Scheme)
+	}
+	return s, nil
+}
+
+func (s *natsSink) Name() string {
+	return "nats"
+}
+
+// Write publishes the samples in order, as {"seq":..,"timestamp":..,"stats":{..}}
+func (s *natsSink) Write(ctx context.Context, samples []models.Sample) error {
+	messages := make([][]byte, len(samples))
+	for i, sample := range samples {
+		stats := *sample.Stats
+		if s.cfg.Processes > 0 {
+			trimProcesses(&stats, topProcsQuery{N: s.cfg.Processes, SortBy: "cpu"})
+		} else {
+			stats.ProcessCount = len(stats.Processes)
+			stats.Processes = []models.ProcessInfo{}
+		}
+		payload, err := json.Marshal(models.Sample{Seq: sample.Seq, Timestamp: sample.Timestamp, Stats: &stats})
+		if err != nil {
+			return err
+		}
+		messages[i] = payload
+	}
+	return s.publish(ctx, s.subject, messages)
+}
+
+// WriteEvent publishes an event in the SSE envelope to the event subject,
+// where {type} is the event type
+func (s *natsSink) WriteEvent(ctx context.Context, event hubEvent) error {
+	payload, err := json.Marshal(models.Event{Timestamp: event.Timestamp, Host: s.hostname, Data: event.Data})
+	if err != nil {
+		return err
+	}
+	return s.publish(ctx, strings.ReplaceAll(s.eventSubject, "{type}", event.Type), [][]byte{payload})
+}
+
+// publish sends messages to subject, connecting first if needed
+func (s *natsSink) publish(ctx context.Context, subject string, messages [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := s.send(subject, messages)
+	if err == nil {
+		err = s.ping()
+	}
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// send publishes the messages, waiting for the JetStream acknowledgement of
+// each one when enabled
+func (s *natsSink) send(subject string, messages [][]byte) error {
+	for _, payload := range messages {
+		var b strings.Builder
+		if s.cfg.JetStream {
+			s.acks++
+			reply := s.inbox + "." + strconv.FormatUint(s.acks, 10)
+			fmt.Fprintf(&b, "PUB %s %s %d\r\n%s\r\n", subject, reply, len(payload), payload)
+		} else {
+			fmt.Fprintf(&b, "PUB %s %d\r\n%s\r\n", subject, len(payload), payload)
+		}
+		if err := s.write(b.String()); err != nil {
+			return err
+		}
+		if s.cfg.JetStream {
+			if err := s.pubAck(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// connect dials the server, upgrades to TLS after its INFO when configured,
+// and authenticates
+func (s *natsSink) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: s.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+
+	err = s.handshake(ctx)
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+func (s *natsSink) handshake(ctx context.Context) error {
+	line, err := s.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected NATS greeting %q", line)
+	}
+	if s.tlsConfig != nil {
+		tlsConn := tls.Client(s.conn, s.tlsConfig)
+		tlsConn.SetDeadline(time.Now().Add(s.cfg.Timeout))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return err
+		}
+		s.conn = tlsConn
+		s.reader = bufio.NewReader(tlsConn)
+	}
+
+	options := map[string]interface{}{
+		"verbose":       false,
+		"pedantic":      false,
+		"name":          "system-stats-backend",
+		"lang":          "go",
+		"version":       BuildVersionInfo().Version,
+		"protocol":      1,
+		"headers":       true,
+		"no_responders": true,
+	}
+	if s.cfg.Token != "" {
+		options["auth_token"] = s.cfg.Token
+	}
+	if s.cfg.Username != "" {
+		options["user"] = s.cfg.Username
+		options["pass"] = s.cfg.Password
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	if err := s.write("CONNECT " + string(connect) + "\r\n"); err != nil {
+		return err
+	}
+	if err := s.ping(); err != nil {
+		return err
+	}
+
+	if s.cfg.JetStream {
+		var id [8]byte
+		rand.Read(id[:])
+		s.inbox = "_INBOX." + hex.EncodeToString(id[:])
+		if err := s.write("SUB " + s.inbox + ".* 1\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ping sends a PING and reads until the PONG, answering the server's pings
+func (s *natsSink) ping() error {
+	if err := s.write("PING\r\n"); err != nil {
+		return err
+	}
+	for {
+		line, err := s.readControl()
+		if err != nil {
+			return err
+		}
+		if line == "PONG" {
+			return nil
+		}
+	}
+}
+
+// pubAck reads the JetStream acknowledgement of the last message
+func (s *natsSink) pubAck() error {
+	for {
+		line, err := s.readControl()
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 4 && fields[0] == "MSG":
+			n, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return fmt.Errorf("malformed NATS message %q", line)
+			}
+			payload, err := s.readPayload(n)
+			if err != nil {
+				return err
+			}
+			var ack natsPubAck
+			if err := json.Unmarshal(payload, &ack); err != nil {
+				return fmt.Errorf("malformed JetStream acknowledgement: %w", err)
+			}
+			if ack.Error != nil {
+				return fmt.Errorf("JetStream rejected the message: %s (%d)", ack.Error.Description, ack.Error.Code)
+			}
+			return nil
+		case len(fields) >= 5 && fields[0] == "HMSG":
+			// Only sent without a payload, when no stream stores the subject
+			n, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return fmt.Errorf("malformed NATS message %q", line)
+			}
+			headers, err := s.readPayload(n)
+			if err != nil {
+				return err
+			}
+			if strings.Contains(string(headers), " 503") {
+				return errors.New("no JetStream stream stores the subject")
+			}
+			return fmt.Errorf("unexpected JetStream answer %q", strings.TrimSpace(string(headers)))
+		}
+	}
+}
+
+// readControl reads the next protocol line, answering pings, skipping +OK,
+// and turning -ERR into an error
+func (s *natsSink) readControl() (string, error) {
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case line == "PING":
+			if err := s.write("PONG\r\n"); err != nil {
+				return "", err
+			}
+		case line == "+OK", strings.HasPrefix(line, "INFO "):
+		case strings.HasPrefix(line, "-ERR"):
+			return "", fmt.Errorf("NATS server error: %s", strings.Trim(strings.TrimPrefix(line, "-ERR"), " '"))
+		default:
+			return line, nil
+		}
+	}
+}
+
+func (s *natsSink) readLine() (string, error) {
+	s.conn.SetReadDeadline(time.Now().Add(s.cfg.Timeout))
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readPayload reads a message payload of n bytes and its trailing CRLF
+func (s *natsSink) readPayload(n int) ([]byte, error) {
+	s.conn.SetReadDeadline(time.Now().Add(s.cfg.Timeout))
+	payload := make([]byte, n+2)
+	if _, err := io.ReadFull(s.reader, payload); err != nil {
+		return nil, err
+	}
+	return payload[:n], nil
+}
+
+func (s *natsSink) write(data string) error {
+	s.conn.SetWriteDeadline(time.Now().Add(s.cfg.Timeout))
+	_, err := io.WriteString(s.conn, data)
+	return err
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// natsScript is the server end of a connection to a natsSink
+type natsScript struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// expect reads a protocol line and checks that it starts with prefix
+func (s *natsScript) expect(prefix string) string {
+	s.t.Helper()
+	line, err := s.r.ReadString('\n')
+	if err != nil {
+		s.t.Errorf("reading %q: %v", prefix, err)
+		return ""
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if !strings.HasPrefix(line, prefix) {
+		s.t.Errorf("got %q, want %q", line, prefix)
+	}
+	return line
+}
+
+// payload reads the payload announced by the last field of line
+func (s *natsScript) payload(line string) string {
+	s.t.Helper()
+	fields := strings.Fields(line)
+	n, _ := strconv.Atoi(fields[len(fields)-1])
+	payload := make([]byte, n+2)
+	if _, err := io.ReadFull(s.r, payload); err != nil {
+		s.t.Errorf("reading the payload of %q: %v", line, err)
+	}
+	return string(payload[:n])
+}
+
+func (s *natsScript) send(lines ...string) {
+	for _, line := range lines {
+		io.WriteString(s.conn, line+"\r\n")
+	}
+}
+
+// handshake greets the sink and checks its CONNECT options
+func (s *natsScript) handshake(want map[string]interface{}) {
+	s.t.Helper()
+	s.send(`INFO {"server_id":"test","version":"2.10.0","headers":true,"max_payload":1048576}`)
+	line := s.expect("CONNECT ")
+	var options map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &options); err != nil {
+		s.t.Errorf("malformed %q: %v", line, err)
+	}
+	for key, value := range want {
+		if options[key] != value {
+			s.t.Errorf("CONNECT option %s = %v, want %v", key, options[key], value)
+		}
+	}
+	s.expect("PING")
+	s.send("PONG")
+}
+
+// subscribe reads the subscription of a JetStream sink to its inbox and
+// returns the inbox
+func (s *natsScript) subscribe() string {
+	s.t.Helper()
+	line := s.expect("SUB _INBOX.")
+	if !strings.HasSuffix(line, ".* 1") {
+		s.t.Errorf("got %q, want a subscription to every reply of the inbox", line)
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(line, "SUB "), ".* 1")
+}
+
+// testNATSSink returns a sink connected to script over a pipe
+func testNATSSink(t *testing.T, cfg NATSConfig, script func(s *natsScript)) *natsSink {
+	t.Helper()
+	cfg.URL, cfg.Subject, cfg.EventSubject, cfg.Timeout = "nats://localhost", "stats.{host}", "events.{host}.{type}", 5*time.Second
+	sink, err := newNATSSink(cfg, "web-01.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := net.Pipe()
+	sink.conn, sink.reader = client, bufio.NewReader(client)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer server.Close()
+		script(&natsScript{t: t, conn: server, r: bufio.NewReader(server)})
+	}()
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+	})
+	return sink
+}
+
+func TestNATSWrite(t *testing.T) {
+	samples := []models.Sample{{
+		Seq:       7,
+		Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Stats:     &models.SystemStats{CPUUsage: 12.5, Processes: []models.ProcessInfo{{PID: 1, Name: "init", CPUPercent: 0.1}, {PID: 2, Name: "chrome", CPUPercent: 50}}},
+	}}
+	var payloads []string
+	sink := testNATSSink(t, NATSConfig{Token: "secret", Processes: 1}, func(s *natsScript) {
+		s.handshake(map[string]interface{}{"auth_token": "secret", "verbose": false, "headers": true, "no_responders": true, "protocol": 1.0})
+		payloads = append(payloads, s.payload(s.expect("PUB stats.web-01_example_com ")))
+		s.expect("PING")
+		// The sink answers pings and skips +OK and INFO while waiting for
+		// its PONG
+		s.send("+OK", "PING")
+		s.expect("PONG")
+		s.send(`INFO {"server_id":"test"}`, "PONG")
+
+		payloads = append(payloads, s.payload(s.expect("PUB events.web-01_example_com.alert ")))
+		s.expect("PING")
+		s.send("PONG")
+	})
+
+	ctx := context.Background()
+	if err := sink.handshake(ctx); err != nil {
+		t.Fatalf("handshake() error = %v", err)
+	}
+	if err := sink.Write(ctx, samples); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := sink.WriteEvent(ctx, hubEvent{Type: eventAlert, Timestamp: samples[0].Timestamp, Data: Alert{Rule: "cpu"}}); err != nil {
+		t.Fatalf("WriteEvent() error = %v", err)
+	}
+	sink.conn.Close()
+
+	var sample models.Sample
+	if err := json.Unmarshal([]byte(payloads[0]), &sample); err != nil {
+		t.Fatal(err)
+	}
+	if sample.Seq != 7 || sample.Stats.CPUUsage != 12.5 || len(sample.Stats.Processes) != 1 || sample.Stats.Processes[0].Name != "chrome" {
+		t.Errorf("published sample %s", payloads[0])
+	}
+	var event models.Event
+	if err := json.Unmarshal([]byte(payloads[1]), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Host != "web-01.example.com" || !strings.Contains(payloads[1], `"rule":"cpu"`) {
+		t.Errorf("published event %s", payloads[1])
+	}
+}
+
+func TestNATSJetStream(t *testing.T) {
+	ack := func(inbox string, n int, payload string) []string {
+		return []string{fmt.Sprintf("MSG %s.%d 1 %d", inbox, n, len(payload)), payload}
+	}
+	tests := []struct {
+		name string
+		// reply answers the publish of the second message
+		reply   func(inbox string) []string
+		wantErr string
+	}{
+		{
+			name:  "acknowledged",
+			reply: func(inbox string) []string { return ack(inbox, 2, `{"stream":"STATS","seq":2}`) },
+		},
+		{
+			name: "rejected",
+			reply: func(inbox string) []string {
+				return ack(inbox, 2, `{"error":{"code":503,"err_code":10077,"description":"maximum messages exceeded"}}`)
+			},
+			wantErr: "JetStream rejected the message: maximum messages exceeded (503)",
+		},
+		{
+			name: "no stream",
+			reply: func(inbox string) []string {
+				return []string{fmt.Sprintf("HMSG %s.2 1 16 16", inbox), "NATS/1.0 503\r\n\r\n"}
+			},
+			wantErr: "no JetStream stream stores the subject",
+		},
+		{
+			name: "permission violation",
+			reply: func(string) []string {
+				return []string{`-ERR 'Permissions Violation for Publish to "stats.web-01_example_com"'`}
+			},
+			wantErr: `NATS server error: Permissions Violation for Publish to "stats.web-01_example_com"`,
+		},
+		{
+			name:    "malformed acknowledgement",
+			reply:   func(inbox string) []string { return ack(inbox, 2, "nope") },
+			wantErr: "malformed JetStream acknowledgement",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := testNATSSink(t, NATSConfig{JetStream: true}, func(s *natsScript) {
+				s.handshake(nil)
+				inbox := s.subscribe()
+				for n := 1; n <= 2; n++ {
+					line := s.expect(fmt.Sprintf("PUB stats.web-01_example_com %s.%d ", inbox, n))
+					s.payload(line)
+					if n == 1 {
+						s.send(ack(inbox, n, `{"stream":"STATS","seq":1}`)...)
+					} else {
+						s.send(tt.reply(inbox)...)
+					}
+				}
+				if tt.wantErr == "" {
+					s.expect("PING")
+					s.send("PONG")
+				}
+			})
+
+			ctx := context.Background()
+			if err := sink.handshake(ctx); err != nil {
+				t.Fatalf("handshake() error = %v", err)
+			}
+			samples := []models.Sample{{Seq: 1, Stats: &models.SystemStats{}}, {Seq: 2, Stats: &models.SystemStats{}}}
+			err := sink.Write(ctx, samples)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Write() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Write() error = %v, want %q", err, tt.wantErr)
+			}
+			// The next write connects again
+			if sink.conn != nil {
+				t.Error("connection kept after an error")
+			}
+		})
+	}
+}
+
+func TestNATSHandshakeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  func(s *natsScript)
+		wantErr string
+	}{
+		{
+			name:    "not NATS",
+			script:  func(s *natsScript) { s.send("HTTP/1.1 400 Bad Request") },
+			wantErr: `unexpected NATS greeting "HTTP/1.1 400 Bad Request"`,
+		},
+		{
+			name: "authorization violation",
+			script: func(s *natsScript) {
+				s.send(`INFO {"auth_required":true}`)
+				s.expect("CONNECT ")
+				s.expect("PING")
+				s.send("-ERR 'Authorization Violation'")
+			},
+			wantErr: "NATS server error: Authorization Violation",
+		},
+		{
+			name: "closed",
+			script: func(s *natsScript) {
+				s.send(`INFO {}`)
+				s.expect("CONNECT ")
+				s.expect("PING")
+			},
+			wantErr: "EOF",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := testNATSSink(t, NATSConfig{Username: "user", Password: "pass"}, tt.script)
+			if err := sink.handshake(context.Background()); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("handshake() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
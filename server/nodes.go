@@ -0,0 +1,508 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// maxNodeBody bounds the request bodies sent by agents
+const maxNodeBody = 4 << 20
+
+// nodeNamePattern matches the names nodes may register under
+var nodeNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,62}$`)
+
+var (
+	errUnknownNode  = errors.New("unknown node")
+	errTooManyNodes = errors.New("too many nodes")
+)
+
+// NodeRegistration is sent by an agent before it pushes samples
+// @Description Registration of an agent with the aggregator
+type NodeRegistration struct {
+	Hostname string             `json:"hostname" example:"web-01"`
+	Version  models.VersionInfo `json:"version"`
+}
+
+// FleetStats is the merged view of the latest samples of every node
+// @Description Latest stats of every node with fleet-wide totals. Nodes that sent nothing within aggregator.nodeTimeout are listed as stale and left out of the totals.
+type FleetStats struct {
+	// Nodes is the number of live nodes the totals cover
+	Nodes int `json:"nodes" example:"3"`
+	// CPUUsage, MemUsage, and DiskUsage are averaged over the live nodes
+	CPUUsage  float64 `json:"cpuUsage" example:"45.2"`
+	MemUsage  float64 `json:"memUsage" example:"60.5"`
+	DiskUsage float64 `json:"diskUsage" example:"75.0"`
+	// NetTraffic and ProcessCount are summed over the live nodes
+	NetTraffic   int64 `json:"netTraffic" example:"3145728"`
+	ProcessCount int   `json:"processCount" example:"936"`
+	// Stats holds the latest stats of every node, by node name
+	Stats map[string]*models.SystemStats `json:"stats"`
+	// Stale lists the nodes left out of the totals
+	Stale []string `json:"stale"`
+}
+
+// Health of a node in the fleet overview
+const (
+	nodeHealthy  = "healthy"
+	nodeDegraded = "degraded"
+	nodeStale    = "stale"
+	nodePending  = "pending"
+)
+
+// NodeSummary is the overview of one node of the fleet
+// @Description A node known to the aggregator with its headline metrics. Health is healthy, degraded (some subsystems failed to collect), stale (nothing received within aggregator.nodeTimeout), or pending (registered but no sample yet). The metrics are omitted until a sample is received.
+type NodeSummary struct {
+	Name     string `json:"name" example:"web-01"`
+	Hostname string `json:"hostname" example:"web-01.example.com"`
+	Version  string `json:"version" example:"1.2.0"`
+	// Local is set for the aggregator's own host
+	Local      bool      `json:"local" example:"false"`
+	Health     string    `json:"health" example:"healthy" enums:"healthy,degraded,stale,pending"`
+	Registered time.Time `json:"registered" example:"2024-01-01T11:00:00Z"`
+	LastSeen   time.Time `json:"lastSeen" example:"2024-01-01T12:00:00Z"`
+	// SampleTime is the timestamp of the latest sample
+	SampleTime *time.Time `json:"sampleTime,omitempty" example:"2024-01-01T12:00:00Z"`
+	CPUUsage   *float64   `json:"cpuUsage,omitempty" example:"45.2"`
+	MemUsage   *float64   `json:"memUsage,omitempty" example:"60.5"`
+	DiskUsage  *float64   `json:"diskUsage,omitempty" example:"75.0"`
+	// Labels are the host labels of the latest sample
+	Labels map[string]string `json:"labels,omitempty" example:"env:prod"`
+}
+
+// node is a host known to the aggregator
+type node struct {
+	name         string
+	registration NodeRegistration
+	registered   time.Time
+	lastSeen     time.Time
+	// latest is the newest sample received, nil until the first one
+	latest *models.Sample
+	// local is set for the aggregator's own host
+	local bool
+	// discovered is set for the agents found over mDNS, whose stats the
+	// aggregator polls
+	discovered bool
+}
+
+// nodeRegistry holds the nodes registered by agents and their latest samples
+type nodeRegistry struct {
+	mu       sync.Mutex
+	timeout  time.Duration
+	maxNodes int
+	nodes    map[string]*node
+}
+
+func newNodeRegistry(cfg AggregatorConfig) *nodeRegistry {
+	return &nodeRegistry{timeout: cfg.NodeTimeout, maxNodes: cfg.MaxNodes, nodes: map[string]*node{}}
+}
+
+// Register adds a node pushing its samples or renews its registration.
+// When the registry is full, stale nodes are evicted to make room.
+func (r *nodeRegistry) Register(name string, registration NodeRegistration) error {
+	return r.register(name, registration, false)
+}
+
+// RegisterDiscovered adds an agent found over mDNS, whose stats are polled
+func (r *nodeRegistry) RegisterDiscovered(name string, registration NodeRegistration) error {
+	return r.register(name, registration, true)
+}
+
+func (r *nodeRegistry) register(name string, registration NodeRegistration, discovered bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if n, ok := r.nodes[name]; ok {
+		n.registration = registration
+		n.registered = now
+		n.lastSeen = now
+		n.discovered = discovered
+		return nil
+	}
+	if len(r.nodes) >= r.maxNodes {
+		for other, n := range r.nodes {
+			if now.Sub(n.lastSeen) > r.timeout {
+				delete(r.nodes, other)
+			}
+		}
+		if len(r.nodes) >= r.maxNodes {
+			return errTooManyNodes
+		}
+	}
+	r.nodes[name] = &node{name: name, registration: registration, registered: now, lastSeen: now, discovered: discovered}
+	return nil
+}
+
+// Pushed reports whether a node registered to push its samples
+func (r *nodeRegistry) Pushed(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, ok := r.nodes[name]
+	return ok && !n.discovered
+}
+
+// Append records the samples pushed by a registered node, keeping the newest
+func (r *nodeRegistry) Append(name string, samples []models.Sample) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n, ok := r.nodes[name]
+	if !ok {
+		return errUnknownNode
+	}
+	n.lastSeen = time.Now()
+	for _, sample := range samples {
+		if sample.Stats == nil {
+			continue
+		}
+		// Sequence numbers restart with the agent, timestamps do not
+		if n.latest == nil || !sample.Timestamp.Before(n.latest.Timestamp) {
+			n.latest = &sample
+		}
+	}
+	return nil
+}
+
+// Nodes returns copies of the registered nodes sorted by name
+func (r *nodeRegistry) Nodes() []node {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nodes := make([]node, 0, len(r.nodes))
+	for _, n := range r.nodes {
+		nodes = append(nodes, *n)
+	}
+	slices.SortFunc(nodes, func(a, b node) int { return strings.Compare(a.name, b.name) })
+	return nodes
+}
+
+// stale reports whether a node sent nothing within the timeout
+func (r *nodeRegistry) stale(n node, now time.Time) bool {
+	return now.Sub(n.lastSeen) > r.timeout
+}
+
+// summary returns the overview of a node
+func (r *nodeRegistry) summary(n node, now time.Time) NodeSummary {
+	summary := NodeSummary{
+		Name:       n.name,
+		Hostname:   n.registration.Hostname,
+		Version:    n.registration.Version.Version,
+		Local:      n.local,
+		Health:     nodeHealthy,
+		Registered: n.registered,
+		LastSeen:   n.lastSeen,
+	}
+	switch {
+	case n.latest == nil:
+		summary.Health = nodePending
+	case !n.local && r.stale(n, now):
+		summary.Health = nodeStale
+	case len(n.latest.Stats.Errors) > 0:
+		summary.Health = nodeDegraded
+	}
+	if n.latest != nil {
+		stats := n.latest.Stats
+		summary.SampleTime = &n.latest.Timestamp
+		summary.CPUUsage = &stats.CPUUsage
+		summary.MemUsage = &stats.MemUsage
+		summary.DiskUsage = &stats.DiskUsage
+		summary.Labels = stats.Labels
+	}
+	return summary
+}
+
+// nodes returns the registered nodes and the aggregator's own host, which
+// is listed under its hostname unless an agent registered that name
+func (s *Server) nodes() []node {
+	nodes := s.nodeRegistry.Nodes()
+	if slices.ContainsFunc(nodes, func(n node) bool { return n.name == s.hostname }) {
+		return nodes
+	}
+
+	local := node{name: s.hostname, registered: s.started, local: true}
+	local.registration = NodeRegistration{Hostname: s.hostname, Version: BuildVersionInfo()}
+	if sample, ok := s.history.Latest(); ok {
+		local.latest = &sample
+		local.lastSeen = sample.Timestamp
+	}
+	i, _ := slices.BinarySearchFunc(nodes, local.name, func(n node, name string) int { return strings.Compare(n.name, name) })
+	return slices.Insert(nodes, i, local)
+}
+
+// agentMiddleware requires the aggregator token sent by agents
+func (s *Server) agentMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Aggregator.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="aggregator"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// parseNodeName validates the node path parameter
+func parseNodeName(value string) (string, error) {
+	if !nodeNamePattern.MatchString(value) {
+		return "", fmt.Errorf("invalid node %q: must be 1-63 letters, digits, dots, dashes, or underscores", value)
+	}
+	return value, nil
+}
+
+// nodeRegisterHandler godoc
+// @Summary Register an agent
+// @Description Registers the node an agent pushes samples for, or renews its registration. Only served in aggregator mode; requires the aggregator token.
+// @Tags nodes
+// @Accept json
+// @Security AgentToken
+// @Param node path string true "Node name"
+// @Param request body NodeRegistration true "Registration"
+// @Success 204
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 503 {string} string "Too many nodes"
+// @Router /nodes/{node} [post]
+func (s *Server) nodeRegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, err := parseNodeName(r.PathValue("node"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var registration NodeRegistration
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxNodeBody)).Decode(&registration); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.nodeRegistry.Register(name, registration); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	slog.InfoContext(r.Context(), "Node registered", "node", name, "version", registration.Version.Version)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// nodeSamplesHandler godoc
+// @Summary Push samples of a node
+// @Description Records samples collected by an agent, oldest first. The node must be registered first; 404 tells the agent to register again, e.g. after the aggregator restarted. Only served in aggregator mode; requires the aggregator token.
+// @Tags nodes
+// @Accept json
+// @Security AgentToken
+// @Param node path string true "Node name"
+// @Param request body []models.Sample true "Samples"
+// @Success 204
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Unknown node"
+// @Router /nodes/{node}/samples [post]
+func (s *Server) nodeSamplesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, err := parseNodeName(r.PathValue("node"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var samples []models.Sample
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxNodeBody)).Decode(&samples); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.nodeRegistry.Append(name, samples); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// nodesHandler godoc
+// @Summary List the nodes of the fleet
+// @Description Lists every node known to the aggregator, including itself, sorted by name, with its last-seen time, health, labels, and CPU, memory, and disk usage, e.g. for a fleet heatmap. Only served in aggregator mode.
+// @Tags nodes
+// @Produce json
+// @Param health query string false "Only list nodes with this health" Enums(healthy, degraded, stale, pending)
+// @Param label query []string false "Only list nodes with this label, as name=value; repeat to require several" collectionFormat(multi)
+// @Success 200 {array} NodeSummary
+// @Failure 400 {string} string "Bad Request"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /nodes [get]
+func (s *Server) nodesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	health := r.URL.Query().Get("health")
+	switch health {
+	case "", nodeHealthy, nodeDegraded, nodeStale, nodePending:
+	default:
+		http.Error(w, fmt.Sprintf("invalid health %q: must be one of %s, %s, %s, %s", health, nodeHealthy, nodeDegraded, nodeStale, nodePending), http.StatusBadRequest)
+		return
+	}
+	labels := map[string]string{}
+	for _, label := range r.URL.Query()["label"] {
+		name, value, ok := strings.Cut(label, "=")
+		if !ok || name == "" {
+			http.Error(w, fmt.Sprintf("invalid label %q: must be name=value", label), http.StatusBadRequest)
+			return
+		}
+		labels[name] = value
+	}
+
+	now := time.Now()
+	summaries := []NodeSummary{}
+	for _, n := range s.nodes() {
+		summary := s.nodeRegistry.summary(n, now)
+		if health != "" && summary.Health != health {
+			continue
+		}
+		if !hasLabels(summary.Labels, labels) {
+			continue
+		}
+		summaries = append(summaries, summary)
+	}
+	writeJSONArray(w, r, summaries)
+}
+
+// nodeStatsHandler godoc
+// @Summary Get the statistics of a node
+// @Description Returns the latest sample pushed by a node, or collected by the aggregator itself for its own hostname. Only served in aggregator mode.
+// @Tags nodes
+// @Produce json,application/msgpack,application/x-protobuf,text/csv
+// @Param node path string true "Node name"
+// @Param topProcs query int false "Only include the N heaviest processes (0 for all, up to processes.embeddedLimit)"
+// @Param sortBy query string false "Key used to pick the heaviest processes" Enums(cpu, mem)
+// @Param format query string false "Response format, overriding the Accept header" Enums(json, msgpack, protobuf, csv)
+// @Param fields query string false "Comma-separated fields to include (cpuUsage, memUsage, diskUsage, netTraffic, processes); defaults to all"
+// @Success 200 {object} models.SystemStats
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Unknown node"
+// @Failure 503 {string} string "No sample received yet"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /nodes/{node}/stats [get]
+func (s *Server) nodeStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	top, err := parseTopProcsQuery(r.URL.Query(), s.config.Processes.EmbeddedLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	topics, err := collector.ParseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	nodes := s.nodes()
+	i := slices.IndexFunc(nodes, func(n node) bool { return n.name == r.PathValue("node") })
+	if i < 0 {
+		http.Error(w, errUnknownNode.Error(), http.StatusNotFound)
+		return
+	}
+	if nodes[i].latest == nil {
+		http.Error(w, "no sample received yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Copy before trimming, the latest sample is shared
+	stats := *nodes[i].latest.Stats
+	trimProcesses(&stats, top)
+	w.Header().Set("Last-Modified", nodes[i].latest.Timestamp.UTC().Format(http.TimeFormat))
+	writeStats(w, r, &stats, topics)
+}
+
+// fleetHandler godoc
+// @Summary Get the statistics of the fleet
+// @Description Returns the latest stats of every node, including the aggregator itself, with the average CPU, memory, and disk usage and the total network traffic and process count of the live nodes. Only served in aggregator mode.
+// @Tags nodes
+// @Produce json
+// @Param topProcs query int false "Only include the N heaviest processes per node (0 for all, up to processes.embeddedLimit)"
+// @Param sortBy query string false "Key used to pick the heaviest processes" Enums(cpu, mem)
+// @Success 200 {object} FleetStats
+// @Failure 400 {string} string "Bad Request"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /fleet [get]
+func (s *Server) fleetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	top, err := parseTopProcsQuery(r.URL.Query(), s.config.Processes.EmbeddedLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	fleet := FleetStats{Stats: map[string]*models.SystemStats{}, Stale: []string{}}
+	for _, n := range s.nodes() {
+		if n.latest == nil {
+			continue
+		}
+		stats := *n.latest.Stats
+		trimProcesses(&stats, top)
+		fleet.Stats[n.name] = &stats
+
+		if !n.local && s.nodeRegistry.stale(n, now) {
+			fleet.Stale = append(fleet.Stale, n.name)
+			continue
+		}
+		fleet.Nodes++
+		fleet.CPUUsage += stats.CPUUsage
+		fleet.MemUsage += stats.MemUsage
+		fleet.DiskUsage += stats.DiskUsage
+		fleet.NetTraffic += stats.NetTraffic
+		fleet.ProcessCount += stats.ProcessCount
+	}
+	if fleet.Nodes > 0 {
+		fleet.CPUUsage /= float64(fleet.Nodes)
+		fleet.MemUsage /= float64(fleet.Nodes)
+		fleet.DiskUsage /= float64(fleet.Nodes)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(fleet); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
+
+// hasLabels reports whether labels contains every label of want
+func hasLabels(labels, want map[string]string) bool {
+	for name, value := range want {
+		if v, ok := labels[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
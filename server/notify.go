@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+	"unicode/utf8"
+)
+
+// notifyBuffer is the number of alerts queued for a notifier that is busy
+// sending
+const notifyBuffer = 64
+
+// notifyAttempts bounds the attempts to send an alert. Failures other than
+// client errors are retried after a delay doubling from notifyBackoff.
+const (
+	notifyAttempts = 3
+	notifyBackoff  = time.Second
+)
+
+// notifier sends alerts to an incident management service paging on-call
+type notifier interface {
+	// Name identifies the notifier in logs
+	Name() string
+	// Notify sends an alert that fired, resolved, or is sent again. A
+	// resolved alert closes the incident opened by the firing one.
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// notifierRunner feeds the alerts sent by the alert engine to a notifier
+type notifierRunner struct {
+	notifier notifier
+	ch       chan Alert
+}
+
+// newNotifiers creates the notifiers enabled in the config
+func newNotifiers(cfg AlertsConfig, hostname string) ([]*notifierRunner, error) {
+	var notifiers []notifier
+	if cfg.PagerDuty.Enabled {
+		n, err := newPagerDutyNotifier(cfg.PagerDuty, hostname)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	if cfg.Opsgenie.Enabled {
+		n, err := newOpsgenieNotifier(cfg.Opsgenie, hostname)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+
+	runners := make([]*notifierRunner, len(notifiers))
+	for i, n := range notifiers {
+		runners[i] = &notifierRunner{notifier: n, ch: make(chan Alert, notifyBuffer)}
+	}
+	return runners, nil
+}
+
+// Enqueue queues an alert, dropping it when the queue is full
+func (r *notifierRunner) Enqueue(alert Alert) {
+	select {
+	case r.ch <- alert:
+	default:
+		slog.Warn("Dropping alert: notifier queue full", "notifier", r.notifier.Name(), "rule", alert.Rule)
+	}
+}
+
+// run sends the queued alerts until ctx is cancelled
+func (r *notifierRunner) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case alert := <-r.ch:
+			if err := r.send(ctx, alert); err != nil && ctx.Err() == nil {
+				slog.Error("Error sending alert", "notifier", r.notifier.Name(), "rule", alert.Rule, "state", alert.State, "error", err)
+			}
+		}
+	}
+}
+
+// send notifies an alert, retrying server errors, rate limiting, and
+// network errors
+func (r *notifierRunner) send(ctx context.Context, alert Alert) error {
+	backoff := notifyBackoff
+	for attempt := 1; ; attempt++ {
+		err := r.notifier.Notify(ctx, alert)
+		var statusErr *sinkStatusError
+		clientErr := errors.As(err, &statusErr) && statusErr.StatusCode < 500 && statusErr.StatusCode != http.StatusTooManyRequests
+		if err == nil || clientErr || attempt == notifyAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// alertKey identifies the incident of an alert on a host: the group of its
+// rule, whose rules alert on the same problem, or the rule itself
+func alertKey(hostname string, alert Alert) string {
+	if alert.Group != "" {
+		return hostname + "/" + alert.Group
+	}
+	return hostname + "/" + alert.Rule
+}
+
+// truncate shortens s to at most n bytes without splitting a character, for
+// fields with a length limit
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
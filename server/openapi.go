@@ -0,0 +1,235 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/thatbeautifuldream/system-stats-backend/docs"
+)
+
+// openAPIVersion is the OpenAPI version of the converted document
+const openAPIVersion = "3.0.3"
+
+// swaggerSchemaKeys are the parameter fields that OpenAPI 3 moves into the
+// parameter's schema
+var swaggerSchemaKeys = []string{
+	"type", "format", "items", "enum", "default", "minimum", "maximum",
+	"minLength", "maxLength", "pattern", "collectionFormat",
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  []byte
+	openAPIErr  error
+)
+
+// openAPISpec returns the OpenAPI 3 document, converted once from the
+// Swagger 2 document generated from the annotations
+func openAPISpec() ([]byte, error) {
+	openAPIOnce.Do(func() {
+		doc, err := convertSwagger2([]byte(docs.SwaggerInfo.ReadDoc()))
+		if err != nil {
+			openAPIErr = fmt.Errorf("error converting the spec to OpenAPI 3: %w", err)
+			return
+		}
+		openAPIDoc, openAPIErr = json.MarshalIndent(doc, "", "  ")
+	})
+	return openAPIDoc, openAPIErr
+}
+
+// convertSwagger2 converts a Swagger 2.0 document to OpenAPI 3.0. Body
+// parameters become request bodies, response schemas get a media type per
+// produced content type, and error responses, which the handlers write with
+// http.Error, are documented as text/plain.
+func convertSwagger2(swagger []byte) (map[string]interface{}, error) {
+	swagger = bytes.ReplaceAll(swagger, []byte(`"#/definitions/`), []byte(`"#/components/schemas/`))
+
+	var in map[string]interface{}
+	if err := json.Unmarshal(swagger, &in); err != nil {
+		return nil, err
+	}
+
+	basePath, _ := in["basePath"].(string)
+	if basePath == "" {
+		basePath = "/"
+	}
+	out := map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info":    in["info"],
+		"servers": []interface{}{map[string]interface{}{"url": basePath}},
+	}
+
+	components := map[string]interface{}{}
+	if definitions, ok := in["definitions"]; ok {
+		components["schemas"] = definitions
+	}
+	if schemes, ok := in["securityDefinitions"]; ok {
+		components["securitySchemes"] = schemes
+	}
+	out["components"] = components
+
+	globalProduces := stringList(in["produces"], "application/json")
+	globalConsumes := stringList(in["consumes"], "application/json")
+
+	paths := map[string]interface{}{}
+	inPaths, _ := in["paths"].(map[string]interface{})
+	for path, item := range inPaths {
+		ops, _ := item.(map[string]interface{})
+		outOps := map[string]interface{}{}
+		for method, op := range ops {
+			outOps[method] = convertOperation(op.(map[string]interface{}), globalProduces, globalConsumes)
+		}
+		paths[path] = outOps
+	}
+	out["paths"] = paths
+	return out, nil
+}
+
+// convertOperation converts one Swagger 2 operation
+func convertOperation(op map[string]interface{}, globalProduces, globalConsumes []string) map[string]interface{} {
+	produces := stringList(op["produces"], globalProduces...)
+	consumes := stringList(op["consumes"], globalConsumes...)
+
+	out := map[string]interface{}{}
+	for key, value := range op {
+		switch key {
+		case "produces", "consumes", "parameters", "responses":
+		default:
+			out[key] = value
+		}
+	}
+
+	var params []interface{}
+	inParams, _ := op["parameters"].([]interface{})
+	for _, p := range inParams {
+		param := p.(map[string]interface{})
+		if param["in"] == "body" {
+			content := map[string]interface{}{}
+			for _, mediaType := range consumes {
+				content[mediaType] = map[string]interface{}{"schema": param["schema"]}
+			}
+			body := map[string]interface{}{"content": content}
+			copyKeys(body, param, "description", "required")
+			out["requestBody"] = body
+			continue
+		}
+
+		schema := map[string]interface{}{}
+		outParam := map[string]interface{}{}
+		for key, value := range param {
+			if slices.Contains(swaggerSchemaKeys, key) {
+				if key != "collectionFormat" {
+					schema[key] = value
+				}
+				continue
+			}
+			outParam[key] = value
+		}
+		if param["collectionFormat"] == "multi" {
+			outParam["explode"] = true
+		}
+		outParam["schema"] = schema
+		params = append(params, outParam)
+	}
+	if params != nil {
+		out["parameters"] = params
+	}
+
+	responses := map[string]interface{}{}
+	inResponses, _ := op["responses"].(map[string]interface{})
+	for code, r := range inResponses {
+		resp := r.(map[string]interface{})
+		outResp := map[string]interface{}{}
+		copyKeys(outResp, resp, "description")
+		if _, ok := outResp["description"]; !ok {
+			outResp["description"] = http.StatusText(atoi(code))
+		}
+		if headers, ok := resp["headers"].(map[string]interface{}); ok {
+			outHeaders := map[string]interface{}{}
+			for name, h := range headers {
+				header := h.(map[string]interface{})
+				outHeader := map[string]interface{}{}
+				copyKeys(outHeader, header, "description")
+				schema := map[string]interface{}{}
+				copyKeys(schema, header, swaggerSchemaKeys...)
+				outHeader["schema"] = schema
+				outHeaders[name] = outHeader
+			}
+			outResp["headers"] = outHeaders
+		}
+		if schema, ok := resp["schema"]; ok {
+			mediaTypes := produces
+			if atoi(code) >= 400 {
+				mediaTypes = []string{"text/plain"}
+			}
+			content := map[string]interface{}{}
+			for _, mediaType := range mediaTypes {
+				content[mediaType] = map[string]interface{}{"schema": schema}
+			}
+			outResp["content"] = content
+		}
+		responses[code] = outResp
+	}
+	out["responses"] = responses
+	return out
+}
+
+// stringList converts a JSON string array, returning fallback when it is empty
+func stringList(v interface{}, fallback ...string) []string {
+	items, _ := v.([]interface{})
+	if len(items) == 0 {
+		return fallback
+	}
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+func copyKeys(dst, src map[string]interface{}, keys ...string) {
+	for _, key := range keys {
+		if value, ok := src[key]; ok {
+			dst[key] = value
+		}
+	}
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// openAPIHandler godoc
+// @Summary Get the OpenAPI 3 spec
+// @Description Returns the OpenAPI 3.0 document of the API, for client code generators. It is converted from the Swagger 2.0 document served at /docs/doc.json; error responses are documented as text/plain.
+// @Tags system
+// @Produce json
+// @Success 200 {object} object
+// @Failure 429 {string} string "Too Many Requests"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /openapi.json [get]
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	spec, err := openAPISpec()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error generating OpenAPI spec", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeBody(w, r, mediaJSON, spec, nil)
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// OpsgenieConfig configures paging through the Opsgenie Alert API
+type OpsgenieConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// APIKey is the key of an API integration
+	APIKey string `yaml:"apiKey"`
+	// URL is the API base URL, https://api.eu.opsgenie.com for the EU
+	// instance
+	URL string `yaml:"url"`
+	// Priority of the alerts, P1 (critical) to P5 (informational)
+	Priority string `yaml:"priority"`
+	// Tags are added to every alert
+	Tags    []string      `yaml:"tags"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// opsgenieNotifier creates an Opsgenie alert when an alert fires and closes
+// it when the alert resolves. Repeats are deduplicated by Opsgenie into the
+// open alert, whose count they increase.
+type opsgenieNotifier struct {
+	cfg      OpsgenieConfig
+	client   *http.Client
+	alertURL *url.URL
+	hostname string
+}
+
+// opsgenieAlert is the body of a create alert request
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description"`
+	Source      string            `json:"source"`
+	Entity      string            `json:"entity"`
+	Priority    string            `json:"priority"`
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details"`
+}
+
+// opsgenieClose is the body of a close alert request
+type opsgenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note"`
+}
+
+// newOpsgenieNotifier creates an Opsgenie notifier reporting alerts on hostname
+func newOpsgenieNotifier(cfg OpsgenieConfig, hostname string) (*opsgenieNotifier, error) {
+	if cfg.APIKey == "" || cfg.URL == "" || cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("alerts.opsgenie.apiKey, url, and timeout are required")
+	}
+	switch cfg.Priority {
+	case "P1", "P2", "P3", "P4", "P5":
+	default:
+		return nil, fmt.Errorf("invalid alerts.opsgenie.priority %q (want P1 to P5)", cfg.Priority)
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid alerts.opsgenie.url: %w", err)
+	}
+	return &opsgenieNotifier{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		alertURL: u.JoinPath("v2", "alerts"),
+		hostname: hostname,
+	}, nil
+}
+
+func (n *opsgenieNotifier) Name() string {
+	return "opsgenie"
+}
+
+// Notify creates an alert for a firing alert and closes it for a resolved
+// one, both identified by an alias naming the rule or its group
+func (n *opsgenieNotifier) Notify(ctx context.Context, alert Alert) error {
+	alias := truncate(alertKey(n.hostname, alert), 512)
+	target := *n.alertURL
+	var payload interface{}
+	if alert.State == alertResolved {
+		// The alias contains a slash, which must stay escaped in the path
+		target.Path += "/" + alias + "/close"
+		target.RawPath = n.alertURL.EscapedPath() + "/" + url.PathEscape(alias) + "/close"
+		target.RawQuery = url.Values{"identifierType": {"alias"}}.Encode()
+		payload = opsgenieClose{Source: n.hostname, Note: truncate(alert.Message, 25000)}
+	} else {
+		details := map[string]string{
+			"rule":   alert.Rule,
+			"type":   alert.Type,
+			"metric": alert.Metric,
+			"value":  formatAlertValue(alert.Value),
+		}
+		for name, value := range alert.Labels {
+			details[name] = value
+		}
+		payload = opsgenieAlert{
+			Message:     truncate(fmt.Sprintf("%s: %s", n.hostname, alert.Message), 130),
+			Alias:       alias,
+			Description: truncate(alert.Message, 15000),
+			Source:      "system-stats-backend",
+			Entity:      n.hostname,
+			Priority:    n.cfg.Priority,
+			Tags:        n.cfg.Tags,
+			Details:     details,
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+n.cfg.APIKey)
+	return postSinkRequest(n.client, req)
+}
@@ -0,0 +1,429 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// otlpScope names the instrumentation scope of the exported metrics
+const otlpScope = "github.com/thatbeautifuldream/system-stats-backend"
+
+// OTLP transports, as named by OTEL_EXPORTER_OTLP_PROTOCOL
+const (
+	otlpProtocolGRPC     = "grpc"
+	otlpProtocolProtobuf = "http/protobuf"
+	otlpProtocolJSON     = "http/json"
+)
+
+func validOTLPProtocol(protocol string) bool {
+	return protocol == otlpProtocolGRPC || protocol == otlpProtocolProtobuf || protocol == otlpProtocolJSON
+}
+
+// OTLP/JSON message types, following the protobuf JSON mapping of
+// opentelemetry.proto.collector.metrics.v1.ExportMetricsServiceRequest. The
+// grpc and http/protobuf transports encode them with appendProto.
+type (
+	otlpMetricsRequest struct {
+		ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+	}
+	otlpResourceMetrics struct {
+		Resource     otlpResource       `json:"resource"`
+		ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeMetrics struct {
+		Scope   otlpInstrumentationScope `json:"scope"`
+		Metrics []otlpMetric             `json:"metrics"`
+	}
+	otlpInstrumentationScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+	otlpMetric struct {
+		Name        string     `json:"name"`
+		Description string     `json:"description,omitempty"`
+		Unit        string     `json:"unit,omitempty"`
+		Gauge       *otlpGauge `json:"gauge,omitempty"`
+		Sum         *otlpSum   `json:"sum,omitempty"`
+	}
+	otlpGauge struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	}
+	otlpSum struct {
+		DataPoints             []otlpDataPoint `json:"dataPoints"`
+		AggregationTemporality int             `json:"aggregationTemporality"`
+		IsMonotonic            bool            `json:"isMonotonic"`
+	}
+	otlpDataPoint struct {
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+		TimeUnixNano      string         `json:"timeUnixNano"`
+		AsDouble          *float64       `json:"asDouble,omitempty"`
+		AsInt             string         `json:"asInt,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue string `json:"stringValue,omitempty"`
+		// IntValue is an int64 encoded as a decimal string
+		IntValue string `json:"intValue,omitempty"`
+	}
+)
+
+// otlpTemporalityCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE
+const otlpTemporalityCumulative = 2
+
+// otlpSink exports samples as OTLP metrics
+type otlpSink struct {
+	cfg      OTLPConfig
+	exporter *otlpExporter
+	resource otlpResource
+	start    time.Time
+}
+
+// newOTLPSink creates an OTLP sink whose resource carries the hostname, the
+// host labels, and the configured resource attributes
+func newOTLPSink(cfg OTLPConfig, hostname string, labels map[string]string) (*otlpSink, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sinks.otlp.endpoint: %w", err)
+	}
+
+	attrs := map[string]string{
+		"host.name":    hostname,
+		"service.name": "system-stats-backend",
+	}
+	for name, value := range labels {
+		attrs[name] = value
+	}
+	for key, value := range cfg.ResourceAttributes {
+		attrs[key] = value
+	}
+
+	return &otlpSink{
+		cfg:      cfg,
+		exporter: newOTLPExporter(u, cfg.Protocol, "v1/metrics", otlpMetricsMethod, cfg.Headers, cfg.Timeout),
+		resource: otlpResource{Attributes: otlpAttributes(attrs)},
+		start:    time.Now(),
+	}, nil
+}
+
+func (s *otlpSink) Name() string {
+	return "otlp"
+}
+
+// Write exports the samples in one request, one data point per sample
+func (s *otlpSink) Write(ctx context.Context, samples []models.Sample) error {
+	return s.exporter.export(ctx, s.request(samples))
+}
+
+// request maps samples to the system.* metrics of the OpenTelemetry semantic
+// conventions. Utilizations are ratios between 0 and 1.
+func (s *otlpSink) request(samples []models.Sample) otlpMetricsRequest {
+	start := otlpTime(s.start)
+	gauge := func(name, unit, description string, value func(*models.SystemStats) float64) otlpMetric {
+		points := make([]otlpDataPoint, len(samples))
+		for i, sample := range samples {
+			v := value(sample.Stats)
+			points[i] = otlpDataPoint{TimeUnixNano: otlpTime(sample.Timestamp), AsDouble: &v}
+		}
+		return otlpMetric{Name: name, Unit: unit, Description: description, Gauge: &otlpGauge{DataPoints: points}}
+	}
+
+	network := make([]otlpDataPoint, len(samples))
+	processes := make([]otlpDataPoint, len(samples))
+	var filesystems []otlpDataPoint
+	for i, sample := range samples {
+		// Samples from before the filesystems were reported only have the
+		// root filesystem
+		fss := sample.Stats.Filesystems
+		if len(fss) == 0 {
+			fss = []models.Filesystem{{Mountpoint: "/", UsedPercent: sample.Stats.DiskUsage}}
+		}
+		for _, fs := range fss {
+			if fs.Stale {
+				continue
+			}
+			v := fs.UsedPercent / 100
+			filesystems = append(filesystems, otlpDataPoint{
+				Attributes:   []otlpKeyValue{{Key: "system.filesystem.mountpoint", Value: otlpValue{StringValue: fs.Mountpoint}}},
+				TimeUnixNano: otlpTime(sample.Timestamp),
+				AsDouble:     &v,
+			})
+		}
+		network[i] = otlpDataPoint{
+			StartTimeUnixNano: start,
+			TimeUnixNano:      otlpTime(sample.Timestamp),
+			AsInt:             strconv.FormatInt(sample.Stats.NetTraffic, 10),
+		}
+		processes[i] = otlpDataPoint{
+			TimeUnixNano: otlpTime(sample.Timestamp),
+			AsInt:        strconv.Itoa(len(sample.Stats.Processes)),
+		}
+	}
+
+	metrics := []otlpMetric{
+		gauge("system.cpu.utilization", "1", "CPU utilization of the host",
+			func(stats *models.SystemStats) float64 { return stats.CPUUsage / 100 }),
+		gauge("system.memory.utilization", "1", "Memory utilization of the host",
+			func(stats *models.SystemStats) float64 { return stats.MemUsage / 100 }),
+		{
+			Name:        "system.filesystem.utilization",
+			Unit:        "1",
+			Description: "Filesystem utilization of the monitored mountpoints",
+			Gauge:       &otlpGauge{DataPoints: filesystems},
+		},
+		{
+			Name:        "system.network.io",
+			Unit:        "By",
+			Description: "Bytes sent and received on all interfaces",
+			Sum:         &otlpSum{DataPoints: network, AggregationTemporality: otlpTemporalityCumulative, IsMonotonic: true},
+		},
+		{
+			Name:        "system.process.count",
+			Unit:        "{process}",
+			Description: "Number of processes on the host",
+			Gauge:       &otlpGauge{DataPoints: processes},
+		},
+	}
+
+	return otlpMetricsRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: s.resource,
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope:   otlpInstrumentationScope{Name: otlpScope},
+			Metrics: metrics,
+		}},
+	}}}
+}
+
+// appendProto encodes the request as an ExportMetricsServiceRequest
+func (r otlpMetricsRequest) appendProto(b []byte) []byte {
+	for _, rm := range r.ResourceMetrics {
+		msg := appendProtoMessage(nil, 1, rm.Resource.appendProto(nil))
+		for _, sm := range rm.ScopeMetrics {
+			scope := appendProtoMessage(nil, 1, sm.Scope.appendProto(nil))
+			for _, metric := range sm.Metrics {
+				scope = appendProtoMessage(scope, 2, metric.appendProto(nil))
+			}
+			msg = appendProtoMessage(msg, 2, scope)
+		}
+		b = appendProtoMessage(b, 1, msg)
+	}
+	return b
+}
+
+func (r otlpResource) appendProto(b []byte) []byte {
+	return appendOTLPAttributesProto(b, 1, r.Attributes)
+}
+
+func (s otlpInstrumentationScope) appendProto(b []byte) []byte {
+	b = appendProtoString(b, 1, s.Name)
+	return appendProtoString(b, 2, s.Version)
+}
+
+func (m otlpMetric) appendProto(b []byte) []byte {
+	b = appendProtoString(b, 1, m.Name)
+	b = appendProtoString(b, 2, m.Description)
+	b = appendProtoString(b, 3, m.Unit)
+	if m.Gauge != nil {
+		var gauge []byte
+		for _, point := range m.Gauge.DataPoints {
+			gauge = appendProtoMessage(gauge, 1, point.appendProto(nil))
+		}
+		b = appendProtoMessage(b, 5, gauge)
+	}
+	if m.Sum != nil {
+		var sum []byte
+		for _, point := range m.Sum.DataPoints {
+			sum = appendProtoMessage(sum, 1, point.appendProto(nil))
+		}
+		sum = appendProtoInt(sum, 2, int64(m.Sum.AggregationTemporality))
+		b = appendProtoMessage(b, 7, appendProtoBool(sum, 3, m.Sum.IsMonotonic))
+	}
+	return b
+}
+
+// appendProto encodes a NumberDataPoint. The value is a oneof, so it is
+// written even when 0.
+func (p otlpDataPoint) appendProto(b []byte) []byte {
+	b = appendProtoFixed64(b, 2, otlpNanos(p.StartTimeUnixNano))
+	b = appendProtoFixed64(b, 3, otlpNanos(p.TimeUnixNano))
+	switch {
+	case p.AsDouble != nil:
+		b = binary.LittleEndian.AppendUint64(appendProtoTag(b, 4, wireFixed64), math.Float64bits(*p.AsDouble))
+	case p.AsInt != "":
+		v, _ := strconv.ParseInt(p.AsInt, 10, 64)
+		b = binary.LittleEndian.AppendUint64(appendProtoTag(b, 6, wireFixed64), uint64(v))
+	}
+	return appendOTLPAttributesProto(b, 7, p.Attributes)
+}
+
+// appendOTLPAttributesProto encodes attributes as a repeated KeyValue field
+func appendOTLPAttributesProto(b []byte, field int, attrs []otlpKeyValue) []byte {
+	for _, kv := range attrs {
+		var value []byte
+		if kv.Value.IntValue != "" {
+			v, _ := strconv.ParseInt(kv.Value.IntValue, 10, 64)
+			value = binary.AppendUvarint(appendProtoTag(nil, 3, wireVarint), uint64(v))
+		} else {
+			value = binary.AppendUvarint(appendProtoTag(nil, 1, wireBytes), uint64(len(kv.Value.StringValue)))
+			value = append(value, kv.Value.StringValue...)
+		}
+		b = appendProtoMessage(b, field, appendProtoMessage(appendProtoString(nil, 1, kv.Key), 2, value))
+	}
+	return b
+}
+
+// otlpRequest is an export request of a signal
+type otlpRequest interface {
+	appendProto(b []byte) []byte
+}
+
+// gRPC methods of the OTLP collector services
+const (
+	otlpMetricsMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+	otlpTracesMethod  = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+)
+
+// otlpExporter sends the export requests of a signal over one of the OTLP
+// transports: JSON or protobuf posted to the signal path of the endpoint, or
+// a unary gRPC call, over HTTP/2 without TLS for http:// endpoints
+type otlpExporter struct {
+	protocol string
+	client   *http.Client
+	url      string
+	headers  map[string]string
+}
+
+func newOTLPExporter(endpoint *url.URL, protocol, path, method string, headers map[string]string, timeout time.Duration) *otlpExporter {
+	e := &otlpExporter{
+		protocol: protocol,
+		client:   &http.Client{Timeout: timeout},
+		url:      endpoint.JoinPath(path).String(),
+		headers:  headers,
+	}
+	if protocol == otlpProtocolGRPC {
+		// gRPC ignores the path of the endpoint
+		e.url = endpoint.ResolveReference(&url.URL{Path: method}).String()
+		transport := &http2.Transport{}
+		if endpoint.Scheme == "http" {
+			transport.AllowHTTP = true
+			transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, addr)
+			}
+		}
+		e.client.Transport = transport
+	}
+	return e
+}
+
+// export sends one export request
+func (e *otlpExporter) export(ctx context.Context, request otlpRequest) error {
+	var body []byte
+	contentType := "application/json"
+	switch e.protocol {
+	case otlpProtocolGRPC:
+		// A length-prefixed message, not compressed
+		body = binary.BigEndian.AppendUint32([]byte{0}, 0)
+		body = request.appendProto(body)
+		binary.BigEndian.PutUint32(body[1:], uint32(len(body)-5))
+		contentType = "application/grpc"
+	case otlpProtocolProtobuf:
+		body = request.appendProto(nil)
+		contentType = "application/x-protobuf"
+	default:
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	if e.protocol != otlpProtocolGRPC {
+		return postSinkRequest(e.client, req)
+	}
+
+	req.Header.Set("TE", "trailers")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &sinkStatusError{
+			StatusCode: resp.StatusCode,
+			msg:        fmt.Sprintf("%s returned %s", req.URL.Redacted(), resp.Status),
+		}
+	}
+	// The status is in the trailers, or in the headers of a response
+	// without messages
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	switch status {
+	case "0":
+		return nil
+	case "":
+		return fmt.Errorf("%s returned no gRPC status", req.URL.Redacted())
+	}
+	if unescaped, err := url.PathUnescape(message); err == nil {
+		message = unescaped
+	}
+	return fmt.Errorf("%s returned gRPC status %s: %s", req.URL.Redacted(), status, message)
+}
+
+// otlpAttributes converts a map to OTLP attributes sorted by key
+func otlpAttributes(attrs map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, len(keys))
+	for i, key := range keys {
+		kvs[i] = otlpKeyValue{Key: key, Value: otlpValue{StringValue: attrs[key]}}
+	}
+	return kvs
+}
+
+// otlpTime formats t as the decimal string OTLP/JSON uses for fixed64 nanoseconds
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlpNanos parses the nanoseconds formatted by otlpTime, 0 when unset
+func otlpNanos(s string) uint64 {
+	v, _ := strconv.ParseUint(s, 10, 64)
+	return v
+}
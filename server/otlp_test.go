@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// otlpCall is an export request received by testOTLPReceiver, with the
+// gRPC length prefix removed
+type otlpCall struct {
+	path          string
+	contentType   string
+	authorization string
+	body          []byte
+}
+
+// testOTLPReceiver records export requests, over HTTP/1.1 or HTTP/2 without
+// TLS, and answers gRPC calls with grpcStatus in the trailers
+func testOTLPReceiver(t *testing.T, grpcStatus string) (string, chan otlpCall) {
+	t.Helper()
+	calls := make(chan otlpCall, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		call := otlpCall{path: r.URL.Path, contentType: r.Header.Get("Content-Type"), authorization: r.Header.Get("Authorization"), body: body}
+		if call.contentType != "application/grpc" {
+			calls <- call
+			return
+		}
+		if r.ProtoMajor != 2 || len(body) < 5 || body[0] != 0 || int(binary.BigEndian.Uint32(body[1:])) != len(body)-5 {
+			t.Errorf("malformed gRPC request over %s: % x", r.Proto, body[:min(len(body), 5)])
+		} else {
+			call.body = body[5:]
+		}
+		calls <- call
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", grpcStatus)
+		if grpcStatus != "0" {
+			w.Header().Set(http.TrailerPrefix+"Grpc-Message", "collector%20unavailable")
+		}
+	})
+	srv := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	t.Cleanup(srv.Close)
+	return srv.URL, calls
+}
+
+func otlpSamples() []models.Sample {
+	return []models.Sample{{
+		Seq:       1,
+		Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Stats: &models.SystemStats{
+			CPUUsage:   12.5,
+			MemUsage:   50,
+			NetTraffic: 1048576,
+			Filesystems: []models.Filesystem{
+				{Mountpoint: "/", UsedPercent: 75},
+				{Mountpoint: "/data", UsedPercent: 0},
+			},
+			Processes: make([]models.ProcessInfo, 3),
+		},
+	}}
+}
+
+func TestOTLPSinkProtocols(t *testing.T) {
+	tests := []struct {
+		protocol        string
+		wantPath        string
+		wantContentType string
+	}{
+		{otlpProtocolJSON, "/otel/v1/metrics", "application/json"},
+		{otlpProtocolProtobuf, "/otel/v1/metrics", "application/x-protobuf"},
+		{otlpProtocolGRPC, otlpMetricsMethod, "application/grpc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			endpoint, calls := testOTLPReceiver(t, "0")
+			cfg := OTLPConfig{Endpoint: endpoint + "/otel", Protocol: tt.protocol, Headers: map[string]string{"Authorization": "Bearer secret"}, Timeout: 5 * time.Second}
+			s, err := newOTLPSink(cfg, "web-01", map[string]string{"env": "prod"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.start = time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC)
+			samples := otlpSamples()
+			if err := s.Write(context.Background(), samples); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			call := <-calls
+			if call.path != tt.wantPath || call.contentType != tt.wantContentType || call.authorization != "Bearer secret" {
+				t.Errorf("got %s %s with authorization %q, want %s %s", call.path, call.contentType, call.authorization, tt.wantPath, tt.wantContentType)
+			}
+			// ExportMetricsServiceRequest has the same fields as MetricsData
+			got := &metricspb.MetricsData{}
+			if tt.protocol == otlpProtocolJSON {
+				err = protojson.Unmarshal(call.body, got)
+			} else {
+				err = proto.Unmarshal(call.body, got)
+			}
+			if err != nil {
+				t.Fatalf("decoding the request: %v", err)
+			}
+
+			body, err := json.Marshal(s.request(samples))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := &metricspb.MetricsData{}
+			if err := protojson.Unmarshal(body, want); err != nil {
+				t.Fatalf("decoding the OTLP/JSON request: %v", err)
+			}
+			if !proto.Equal(got, want) {
+				t.Errorf("got request\n%v\nwant\n%v", got, want)
+			}
+
+			rm := got.GetResourceMetrics()[0]
+			metrics := rm.GetScopeMetrics()[0].GetMetrics()
+			if attrs := rm.GetResource().GetAttributes(); len(attrs) != 3 || attrs[1].GetKey() != "host.name" || attrs[1].GetValue().GetStringValue() != "web-01" {
+				t.Errorf("got resource attributes %v", attrs)
+			}
+			if v := metrics[0].GetGauge().GetDataPoints()[0].GetAsDouble(); v != 0.125 {
+				t.Errorf("system.cpu.utilization = %v, want 0.125", v)
+			}
+			// An empty filesystem still carries its value of 0
+			if point := metrics[2].GetGauge().GetDataPoints()[1]; point.GetValue() == nil || point.GetAsDouble() != 0 {
+				t.Errorf("system.filesystem.utilization of /data = %v, want 0", point)
+			}
+			network := metrics[3].GetSum()
+			if network.GetAggregationTemporality() != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE || !network.GetIsMonotonic() ||
+				network.GetDataPoints()[0].GetAsInt() != 1048576 || network.GetDataPoints()[0].GetStartTimeUnixNano() != uint64(s.start.UnixNano()) {
+				t.Errorf("system.network.io = %v", network)
+			}
+			if n := metrics[4].GetGauge().GetDataPoints()[0].GetAsInt(); n != 3 {
+				t.Errorf("system.process.count = %d, want 3", n)
+			}
+		})
+	}
+}
+
+func TestOTLPGRPCStatus(t *testing.T) {
+	endpoint, calls := testOTLPReceiver(t, "14")
+	s, err := newOTLPSink(OTLPConfig{Endpoint: endpoint, Protocol: otlpProtocolGRPC, Timeout: 5 * time.Second}, "web-01", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Write(context.Background(), otlpSamples())
+	<-calls
+	if err == nil || !strings.HasSuffix(err.Error(), "returned gRPC status 14: collector unavailable") {
+		t.Errorf("Write() error = %v, want gRPC status 14", err)
+	}
+}
+
+func TestOTLPGRPCTrailersOnly(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     http.Header
+		status     int
+		wantErr    string
+		wantStatus int
+	}{
+		{"ok", http.Header{"Grpc-Status": {"0"}}, http.StatusOK, "", 0},
+		{"unimplemented", http.Header{"Grpc-Status": {"12"}, "Grpc-Message": {"unknown service"}}, http.StatusOK, "gRPC status 12: unknown service", 0},
+		{"no status", http.Header{}, http.StatusOK, "no gRPC status", 0},
+		{"not found", http.Header{}, http.StatusNotFound, "404 Not Found", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for key, values := range tt.header {
+					w.Header()[key] = values
+				}
+				w.Header().Set("Content-Type", "application/grpc")
+				w.WriteHeader(tt.status)
+			}), &http2.Server{}))
+			defer srv.Close()
+
+			s, err := newOTLPSink(OTLPConfig{Endpoint: srv.URL, Protocol: otlpProtocolGRPC, Timeout: 5 * time.Second}, "web-01", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.Write(context.Background(), otlpSamples())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Write() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Write() error = %v, want %q", err, tt.wantErr)
+			}
+			var statusErr *sinkStatusError
+			if tt.wantStatus != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus) {
+				t.Errorf("Write() error = %v, want status %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestValidateOTLPProtocol(t *testing.T) {
+	tests := []struct {
+		protocol string
+		wantErr  bool
+	}{
+		{"grpc", false},
+		{"http/protobuf", false},
+		{"http/json", false},
+		{"", true},
+		{"http", true},
+		{"grpc/json", true},
+	}
+	for _, tt := range tests {
+		cfg := SinksConfig{OTLP: OTLPConfig{Enabled: true, Endpoint: "http://localhost:4317", Protocol: tt.protocol, Timeout: time.Second}}
+		if err := validateSinks(cfg); (err != nil) != tt.wantErr {
+			t.Errorf("validateSinks() with protocol %q: error = %v, wantErr %v", tt.protocol, err, tt.wantErr)
+		}
+	}
+}
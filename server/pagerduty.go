@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// PagerDutyConfig configures paging through the PagerDuty Events API v2
+type PagerDutyConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// RoutingKey is the integration key of an Events API v2 integration of
+	// the service to page
+	RoutingKey string `yaml:"routingKey"`
+	// URL is the events endpoint
+	URL string `yaml:"url"`
+	// Severity of the incidents: critical, error, warning, or info
+	Severity string        `yaml:"severity"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// pagerDutyNotifier triggers a PagerDuty incident when an alert fires and
+// resolves it when the alert resolves. Repeats are deduplicated by PagerDuty
+// into the open incident.
+type pagerDutyNotifier struct {
+	cfg      PagerDutyConfig
+	client   *http.Client
+	hostname string
+}
+
+// pagerDutyEvent is the body of an Events API v2 request
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Client      string            `json:"client,omitempty"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+// pagerDutyPayload describes the incident of a trigger event
+type pagerDutyPayload struct {
+	Summary       string `json:"summary"`
+	Source        string `json:"source"`
+	Severity      string `json:"severity"`
+	Timestamp     string `json:"timestamp"`
+	Component     string `json:"component"`
+	Group         string `json:"group,omitempty"`
+	Class         string `json:"class"`
+	CustomDetails Alert  `json:"custom_details"`
+}
+
+// newPagerDutyNotifier creates a PagerDuty notifier reporting incidents on hostname
+func newPagerDutyNotifier(cfg PagerDutyConfig, hostname string) (*pagerDutyNotifier, error) {
+	if cfg.RoutingKey == "" || cfg.URL == "" || cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("alerts.pagerduty.routingKey, url, and timeout are required")
+	}
+	switch cfg.Severity {
+	case "critical", "error", "warning", "info":
+	default:
+		return nil, fmt.Errorf("invalid alerts.pagerduty.severity %q (want critical, error, warning, or info)", cfg.Severity)
+	}
+	return &pagerDutyNotifier{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}, hostname: hostname}, nil
+}
+
+func (n *pagerDutyNotifier) Name() string {
+	return "pagerduty"
+}
+
+// Notify sends a trigger event for a firing alert and a resolve event for a
+// resolved one, both keyed by the rule or its group
+func (n *pagerDutyNotifier) Notify(ctx context.Context, alert Alert) error {
+	event := pagerDutyEvent{
+		RoutingKey:  n.cfg.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    alertKey(n.hostname, alert),
+		Client:      "system-stats-backend",
+	}
+	if alert.State == alertResolved {
+		event.EventAction = "resolve"
+	} else {
+		event.Payload = &pagerDutyPayload{
+			Summary:       truncate(alert.Message, 1024),
+			Source:        n.hostname,
+			Severity:      n.cfg.Severity,
+			Timestamp:     alert.Timestamp.Format(time.RFC3339),
+			Component:     alert.Metric,
+			Group:         alert.Group,
+			Class:         alert.Type,
+			CustomDetails: alert,
+		}
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return postSinkRequest(n.client, req)
+}
@@ -0,0 +1,487 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// postgresSink stores every sample as a row of a PostgreSQL table, so that
+// several instances can keep their history in one shared database. The
+// table is created on the first connection and turned into a hypertable
+// when the TimescaleDB extension is installed. It speaks the simple query
+// protocol, with the values of each batch inlined into one INSERT, and
+// reconnects on the next write after an error.
+type postgresSink struct {
+	cfg       PostgresConfig
+	address   string
+	user      string
+	password  string
+	database  string
+	sslMode   string
+	tlsConfig *tls.Config
+	hostname  string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	// created is set once the table is known to exist
+	created bool
+}
+
+// postgresError is an ErrorResponse of the server
+type postgresError struct {
+	Severity string
+	Code     string
+	Message  string
+}
+
+func (e *postgresError) Error() string {
+	return fmt.Sprintf("postgres: %s: %s (SQLSTATE %s)", e.Severity, e.Message, e.Code)
+}
+
+// postgresMaxSCRAMIterations bounds the PBKDF2 iterations a server can ask
+// for, 256 times the PostgreSQL default of 4096, so that a rogue server
+// cannot pin a CPU on every connection
+const postgresMaxSCRAMIterations = 1 << 20
+
+// newPostgresSink creates a PostgreSQL sink from a postgres:// URL. The
+// sslmode query parameter is verify-full (the default), require, prefer, or
+// disable; require and prefer do not verify the server certificate, and
+// prefer and disable may send the password in the clear.
+func newPostgresSink(cfg PostgresConfig, hostname string) (*postgresSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sinks.postgres.url: %w", err)
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return nil, fmt.Errorf("invalid sinks.postgres.url: unsupported scheme %q (want postgres)", u.Scheme)
+	}
+
+	s := &postgresSink{
+		cfg:      cfg,
+		address:  u.Host,
+		database: strings.TrimPrefix(u.Path, "/"),
+		sslMode:  u.Query().Get("sslmode"),
+		hostname: hostname,
+	}
+	if u.Port() == "" {
+		s.address = net.JoinHostPort(u.Hostname(), "5432")
+	}
+	if u.User != nil {
+		s.user = u.User.Username()
+		s.password, _ = u.User.Password()
+	}
+	if s.user == "" {
+		return nil, fmt.Errorf("invalid sinks.postgres.url: a user is required")
+	}
+	if s.database == "" {
+		s.database = s.user
+	}
+	switch s.sslMode {
+	case "prefer", "require":
+		slog.Warn("PostgreSQL server certificate not verified", "sslmode", s.sslMode)
+		s.tlsConfig = &tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS12}
+	case "", "verify-full":
+		s.sslMode = "verify-full"
+		if s.tlsConfig, err = clientTLSConfig(cfg.TLS, u.Hostname(), "sinks.postgres.tls"); err != nil {
+			return nil, err
+		}
+	case "disable":
+		slog.Warn("PostgreSQL connection not encrypted", "sslmode", s.sslMode)
+	default:
+		return nil, fmt.Errorf("invalid sinks.postgres.url: sslmode must be verify-full, require, prefer, or disable")
+	}
+	return s, nil
+}
+
+func (s *postgresSink) Name() string {
+	return "postgres"
+}
+
+// Write inserts the samples in one statement
+func (s *postgresSink) Write(ctx context.Context, samples []models.Sample) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (time, host, seq, cpu_usage, mem_usage, disk_usage, net_traffic, process_count, labels, errors) VALUES ", s.cfg.Table)
+	for i, sample := range samples {
+		stats := sample.Stats
+		processCount := stats.ProcessCount
+		if processCount == 0 {
+			processCount = len(stats.Processes)
+		}
+		labels, err := json.Marshal(stats.Labels)
+		if err != nil {
+			return err
+		}
+		errs, err := json.Marshal(stats.Errors)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "(%s, %s, %d, %s, %s, %s, %d, %d, %s, %s)",
+			postgresQuote(sample.Timestamp.Format(time.RFC3339Nano)), postgresQuote(s.hostname), sample.Seq,
+			formatPostgresFloat(stats.CPUUsage), formatPostgresFloat(stats.MemUsage), formatPostgresFloat(stats.DiskUsage),
+			stats.NetTraffic, processCount, postgresQuote(string(labels)), postgresQuote(string(errs)))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+	err := s.createTable()
+	if err == nil {
+		_, err = s.query(b.String())
+	}
+	var pgErr *postgresError
+	if err != nil && !errors.As(err, &pgErr) {
+		// The connection is only reusable after errors of the statement
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// createTable creates the table and its index unless they exist, and makes
+// it a hypertable when TimescaleDB is installed
+func (s *postgresSink) createTable() error {
+	if s.created {
+		return nil
+	}
+	table := s.cfg.Table
+	// An index is created in the schema of its table and its name cannot be
+	// qualified
+	index := table[strings.LastIndexByte(table, '.')+1:] + "_host_time_idx"
+	_, err := s.query(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	time timestamptz NOT NULL,
+	host text NOT NULL,
+	seq bigint NOT NULL,
+	cpu_usage double precision NOT NULL,
+	mem_usage double precision NOT NULL,
+	disk_usage double precision NOT NULL,
+	net_traffic bigint NOT NULL,
+	process_count integer NOT NULL,
+	labels jsonb,
+	errors jsonb
+);
+CREATE INDEX IF NOT EXISTS %s ON %s (host, time DESC)`, table, index, table))
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.query("SELECT extversion FROM pg_extension WHERE extname = 'timescaledb'")
+	if err != nil {
+		return err
+	}
+	if len(rows) > 0 {
+		if _, err := s.query(fmt.Sprintf("SELECT create_hypertable(%s, 'time', if_not_exists => TRUE, migrate_data => TRUE)", postgresQuote(table))); err != nil {
+			return err
+		}
+	}
+	s.created = true
+	return nil
+}
+
+// connect dials the server, negotiates TLS according to the sslmode, and
+// authenticates
+func (s *postgresSink) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: s.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+
+	if err := s.startup(ctx); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *postgresSink) startup(ctx context.Context) error {
+	s.conn.SetDeadline(time.Now().Add(s.cfg.Timeout))
+	if s.tlsConfig != nil {
+		// SSLRequest
+		if _, err := s.conn.Write([]byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}); err != nil {
+			return err
+		}
+		answer, err := s.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case answer == 'S':
+			tlsConn := tls.Client(s.conn, s.tlsConfig)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				return err
+			}
+			s.conn = tlsConn
+			s.reader = bufio.NewReader(tlsConn)
+		case s.sslMode != "prefer":
+			return errors.New("postgres server does not support TLS")
+		}
+	}
+
+	var params []byte
+	for _, kv := range [][2]string{{"user", s.user}, {"database", s.database}, {"application_name", "system-stats-backend"}} {
+		params = append(params, kv[0]...)
+		params = append(params, 0)
+		params = append(params, kv[1]...)
+		params = append(params, 0)
+	}
+	params = append(params, 0)
+	msg := binary.BigEndian.AppendUint32(nil, uint32(8+len(params)))
+	msg = binary.BigEndian.AppendUint32(msg, 196608) // protocol 3.0
+	if _, err := s.conn.Write(append(msg, params...)); err != nil {
+		return err
+	}
+
+	var scram *scramClient
+	for {
+		kind, body, err := s.receive()
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case 'E':
+			return parsePostgresError(body)
+		case 'Z':
+			return nil
+		case 'R':
+			if len(body) < 4 {
+				return errors.New("malformed postgres authentication request")
+			}
+			switch method := binary.BigEndian.Uint32(body); method {
+			case 0: // ok
+			case 3: // cleartext
+				err = s.send('p', append([]byte(s.password), 0))
+			case 5: // MD5, salted with body[4:8]
+				inner := md5.Sum([]byte(s.password + s.user))
+				outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), body[4:]...))
+				err = s.send('p', append([]byte("md5"+hex.EncodeToString(outer[:])), 0))
+			case 10: // SASL
+				if !strings.Contains(string(body[4:]), "SCRAM-SHA-256\x00") {
+					return errors.New("postgres server offers no supported SASL mechanism")
+				}
+				scram = newSCRAMClient(s.user, s.password)
+				first := scram.clientFirst()
+				msg := append([]byte("SCRAM-SHA-256\x00"), binary.BigEndian.AppendUint32(nil, uint32(len(first)))...)
+				err = s.send('p', append(msg, first...))
+			case 11: // SASL continue
+				if scram == nil {
+					return errors.New("unexpected postgres SASL challenge")
+				}
+				var final string
+				if final, err = scram.clientFinal(string(body[4:])); err == nil {
+					err = s.send('p', []byte(final))
+				}
+			case 12: // SASL final
+				if scram == nil {
+					return errors.New("unexpected postgres SASL outcome")
+				}
+				err = scram.verifyServer(string(body[4:]))
+			default:
+				return fmt.Errorf("unsupported postgres authentication method %d", method)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// query runs one or more statements with the simple query protocol and
+// returns the first column of the rows they return
+func (s *postgresSink) query(sql string) ([]string, error) {
+	s.conn.SetDeadline(time.Now().Add(s.cfg.Timeout))
+	if err := s.send('Q', append([]byte(sql), 0)); err != nil {
+		return nil, err
+	}
+
+	var rows []string
+	var queryErr error
+	for {
+		kind, body, err := s.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case 'E':
+			queryErr = parsePostgresError(body)
+		case 'D':
+			if len(body) >= 6 && binary.BigEndian.Uint16(body) > 0 {
+				n := int32(binary.BigEndian.Uint32(body[2:]))
+				if n >= 0 && int(n) <= len(body)-6 {
+					rows = append(rows, string(body[6:6+n]))
+				} else {
+					rows = append(rows, "")
+				}
+			}
+		case 'Z':
+			return rows, queryErr
+		}
+	}
+}
+
+// send writes a message with its type byte
+func (s *postgresSink) send(kind byte, body []byte) error {
+	msg := binary.BigEndian.AppendUint32([]byte{kind}, uint32(4+len(body)))
+	_, err := s.conn.Write(append(msg, body...))
+	return err
+}
+
+// receive reads a message, returning its type byte and body
+func (s *postgresSink) receive() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(s.reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(header[1:])
+	if n < 4 || n > 64<<20 {
+		return 0, nil, fmt.Errorf("malformed postgres message of %d bytes", n)
+	}
+	body := make([]byte, n-4)
+	if _, err := io.ReadFull(s.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header[0], body, nil
+}
+
+// parsePostgresError decodes the fields of an ErrorResponse
+func parsePostgresError(body []byte) error {
+	var e postgresError
+	for _, field := range strings.Split(string(body), "\x00") {
+		if field == "" {
+			continue
+		}
+		switch field[0] {
+		case 'S':
+			e.Severity = field[1:]
+		case 'C':
+			e.Code = field[1:]
+		case 'M':
+			e.Message = field[1:]
+		}
+	}
+	return &e
+}
+
+// postgresQuote quotes a string literal, assuming standard_conforming_strings
+func postgresQuote(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, "\x00", ""), "'", "''") + "'"
+}
+
+// formatPostgresFloat formats a float literal, spelling out the values
+// numeric literals cannot hold
+func formatPostgresFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "'NaN'::float8"
+	case math.IsInf(v, 1):
+		return "'Infinity'::float8"
+	case math.IsInf(v, -1):
+		return "'-Infinity'::float8"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// scramClient performs SCRAM-SHA-256 authentication without channel binding
+type scramClient struct {
+	user, password  string
+	nonce           string
+	clientFirstBare string
+	serverSignature []byte
+}
+
+func newSCRAMClient(user, password string) *scramClient {
+	var nonce [18]byte
+	rand.Read(nonce[:])
+	return &scramClient{user: user, password: password, nonce: base64.StdEncoding.EncodeToString(nonce[:])}
+}
+
+func (c *scramClient) clientFirst() string {
+	// PostgreSQL takes the user from the startup message
+	c.clientFirstBare = "n=,r=" + c.nonce
+	return "n,," + c.clientFirstBare
+}
+
+func (c *scramClient) clientFinal(serverFirst string) (string, error) {
+	var nonce, salt string
+	iterations := 0
+	for _, attr := range strings.Split(serverFirst, ",") {
+		key, value, _ := strings.Cut(attr, "=")
+		switch key {
+		case "r":
+			nonce = value
+		case "s":
+			salt = value
+		case "i":
+			iterations, _ = strconv.Atoi(value)
+		}
+	}
+	saltBytes, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil || !strings.HasPrefix(nonce, c.nonce) || iterations < 1 {
+		return "", errors.New("malformed postgres SCRAM challenge")
+	}
+	if iterations > postgresMaxSCRAMIterations {
+		return "", fmt.Errorf("postgres SCRAM iteration count %d exceeds %d", iterations, postgresMaxSCRAMIterations)
+	}
+
+	salted := pbkdf2.Key([]byte(c.password), saltBytes, iterations, sha256.Size, sha256.New)
+	clientKey := hmacSHA256(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	withoutProof := "c=biws,r=" + nonce
+	authMessage := c.clientFirstBare + "," + serverFirst + "," + withoutProof
+	signature := hmacSHA256(storedKey[:], authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ signature[i]
+	}
+	c.serverSignature = hmacSHA256(hmacSHA256(salted, "Server Key"), authMessage)
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func (c *scramClient) verifyServer(serverFinal string) error {
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(serverFinal, "v="))
+	if err != nil || !hmac.Equal(signature, c.serverSignature) {
+		return errors.New("postgres server failed SCRAM verification")
+	}
+	return nil
+}
+
+func hmacSHA256(key []byte, message string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(message))
+	return h.Sum(nil)
+}
@@ -0,0 +1,440 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Backend messages in the wire format of protocol 3.0
+const (
+	pgAuthOK        = "R\x00\x00\x00\x08\x00\x00\x00\x00"
+	pgAuthCleartext = "R\x00\x00\x00\x08\x00\x00\x00\x03"
+	pgAuthMD5       = "R\x00\x00\x00\x0c\x00\x00\x00\x05\x01\x02\x03\x04"
+	pgAuthSASL      = "R\x00\x00\x00\x17\x00\x00\x00\x0aSCRAM-SHA-256\x00\x00"
+	pgParamStatus   = "S\x00\x00\x00\x18server_version\x0016.4\x00"
+	pgBackendKey    = "K\x00\x00\x00\x0c\x00\x00\x30\x39\x12\x34\x56\x78"
+	pgReadyIdle     = "Z\x00\x00\x00\x05I"
+	pgAuthFailed    = "E\x00\x00\x00\x44SFATAL\x00C28P01\x00Mpassword authentication failed for user \"stats\"\x00\x00"
+	pgSSLRequest    = "\x00\x00\x00\x08\x04\xd2\x16\x2f"
+)
+
+// pgStartup is the startup message of user stats to database stats
+var pgStartup = pgStartupMessage("user\x00stats\x00database\x00stats\x00application_name\x00system-stats-backend\x00\x00")
+
+func pgStartupMessage(params string) string {
+	msg := binary.BigEndian.AppendUint32(nil, uint32(8+len(params)))
+	msg = binary.BigEndian.AppendUint32(msg, 196608)
+	return string(msg) + params
+}
+
+// pgMessage builds a message with its type byte
+func pgMessage(kind byte, body string) string {
+	return string(binary.BigEndian.AppendUint32([]byte{kind}, uint32(4+len(body)))) + body
+}
+
+// testPostgresSink returns a sink connected to a server running script on
+// the other end of a pipe, and the channel of the result of the script
+func testPostgresSink(t *testing.T, url string, script func(r *bufio.Reader, w io.Writer) error) (*postgresSink, chan error) {
+	t.Helper()
+	s, err := newPostgresSink(PostgresConfig{URL: url, Table: "system_stats", Timeout: 5 * time.Second}, "web-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	s.conn, s.reader = client, bufio.NewReader(client)
+	done := make(chan error, 1)
+	go func() {
+		defer server.Close()
+		done <- script(bufio.NewReader(server), server)
+	}()
+	return s, done
+}
+
+// expectFrame reads len(want) bytes and compares them to want
+func expectFrame(r *bufio.Reader, want string) error {
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(r, got); err != nil {
+		return err
+	}
+	if string(got) != want {
+		return fmt.Errorf("got frame %q, want %q", got, want)
+	}
+	return nil
+}
+
+// readFrame reads a message of the client
+func readFrame(r *bufio.Reader) (byte, string, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, "", err
+	}
+	body := make([]byte, binary.BigEndian.Uint32(header[1:])-4)
+	_, err := io.ReadFull(r, body)
+	return header[0], string(body), err
+}
+
+func TestNewPostgresSink(t *testing.T) {
+	tests := []struct {
+		url          string
+		wantSSLMode  string
+		wantTLS      bool
+		wantInsecure bool
+		wantErr      bool
+	}{
+		{"postgres://stats@db/stats", "verify-full", true, false, false},
+		{"postgres://stats@db/stats?sslmode=verify-full", "verify-full", true, false, false},
+		{"postgresql://stats@db/stats?sslmode=require", "require", true, true, false},
+		{"postgres://stats@db/stats?sslmode=prefer", "prefer", true, true, false},
+		{"postgres://stats@db/stats?sslmode=disable", "disable", false, false, false},
+		{"postgres://stats@db/stats?sslmode=allow", "", false, false, true},
+		{"postgres://db/stats", "", false, false, true},
+		{"mysql://stats@db/stats", "", false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			s, err := newPostgresSink(PostgresConfig{URL: tt.url}, "web-01")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newPostgresSink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if s.sslMode != tt.wantSSLMode || (s.tlsConfig != nil) != tt.wantTLS {
+				t.Errorf("sslMode = %q, TLS %v, want %q, TLS %v", s.sslMode, s.tlsConfig != nil, tt.wantSSLMode, tt.wantTLS)
+			}
+			if s.tlsConfig != nil && s.tlsConfig.InsecureSkipVerify != tt.wantInsecure {
+				t.Errorf("InsecureSkipVerify = %v, want %v", s.tlsConfig.InsecureSkipVerify, tt.wantInsecure)
+			}
+			if s.address != "db:5432" || s.database != "stats" {
+				t.Errorf("address %q, database %q, want db:5432, stats", s.address, s.database)
+			}
+		})
+	}
+}
+
+func TestSCRAMClient(t *testing.T) {
+	// RFC 7677, section 3
+	c := &scramClient{user: "user", password: "pencil", nonce: "rOprNGfwEbeRWgbNEkqO", clientFirstBare: "n=user,r=rOprNGfwEbeRWgbNEkqO"}
+	final, err := c.clientFinal("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="; final != want {
+		t.Errorf("clientFinal() = %q, want %q", final, want)
+	}
+	if err := c.verifyServer("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="); err != nil {
+		t.Errorf("verifyServer() of the RFC signature: %v", err)
+	}
+	if err := c.verifyServer("v=AAAATRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="); err == nil {
+		t.Error("verifyServer() of a wrong signature succeeded")
+	}
+}
+
+func TestSCRAMClientInvalidChallenge(t *testing.T) {
+	for _, challenge := range []string{
+		"r=other,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+		"r=abcdef,s=not base64,i=4096",
+		"r=abcdef,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=0",
+		"r=abcdef,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=2147483647",
+	} {
+		c := &scramClient{password: "pencil", nonce: "abc", clientFirstBare: "n=,r=abc"}
+		if _, err := c.clientFinal(challenge); err == nil {
+			t.Errorf("clientFinal(%q) succeeded, want an error", challenge)
+		}
+	}
+}
+
+// scramServer verifies the proof of the client and returns the server
+// final message, following RFC 5802
+func scramServer(password, clientFirst, serverFirst, clientFinal string, salt []byte, iterations int) (string, error) {
+	bare := clientFirst[strings.Index(clientFirst, "n="):]
+	withoutProof, proof, ok := strings.Cut(clientFinal, ",p=")
+	if !ok {
+		return "", errors.New("no proof")
+	}
+	authMessage := bare + "," + serverFirst + "," + withoutProof
+	salted := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+	mac := func(key []byte, msg string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(msg))
+		return h.Sum(nil)
+	}
+	clientKey := mac(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	signature := mac(storedKey[:], authMessage)
+	want := make([]byte, len(clientKey))
+	for i := range want {
+		want[i] = clientKey[i] ^ signature[i]
+	}
+	if proof != base64.StdEncoding.EncodeToString(want) {
+		return "", errors.New("wrong proof")
+	}
+	return "v=" + base64.StdEncoding.EncodeToString(mac(mac(salted, "Server Key"), authMessage)), nil
+}
+
+func TestPostgresStartup(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	tests := []struct {
+		name    string
+		url     string
+		script  func(r *bufio.Reader, w io.Writer) error
+		wantErr string
+	}{
+		{
+			"trust",
+			"postgres://stats:secret@db/stats?sslmode=disable",
+			func(r *bufio.Reader, w io.Writer) error {
+				if err := expectFrame(r, pgStartup); err != nil {
+					return err
+				}
+				_, err := io.WriteString(w, pgAuthOK+pgParamStatus+pgBackendKey+pgReadyIdle)
+				return err
+			},
+			"",
+		},
+		{
+			"cleartext",
+			"postgres://stats:secret@db/stats?sslmode=disable",
+			func(r *bufio.Reader, w io.Writer) error {
+				if err := expectFrame(r, pgStartup); err != nil {
+					return err
+				}
+				io.WriteString(w, pgAuthCleartext)
+				if err := expectFrame(r, pgMessage('p', "secret\x00")); err != nil {
+					return err
+				}
+				_, err := io.WriteString(w, pgAuthOK+pgReadyIdle)
+				return err
+			},
+			"",
+		},
+		{
+			"md5",
+			"postgres://stats:secret@db/stats?sslmode=disable",
+			func(r *bufio.Reader, w io.Writer) error {
+				if err := expectFrame(r, pgStartup); err != nil {
+					return err
+				}
+				io.WriteString(w, pgAuthMD5)
+				if err := expectFrame(r, pgMessage('p', "md5de53612e6ec5b55a9a8065af24726c73\x00")); err != nil {
+					return err
+				}
+				_, err := io.WriteString(w, pgAuthOK+pgReadyIdle)
+				return err
+			},
+			"",
+		},
+		{
+			"scram",
+			"postgres://stats:secret@db/stats?sslmode=disable",
+			func(r *bufio.Reader, w io.Writer) error {
+				if err := expectFrame(r, pgStartup); err != nil {
+					return err
+				}
+				io.WriteString(w, pgAuthSASL)
+				_, initial, err := readFrame(r)
+				if err != nil {
+					return err
+				}
+				mechanism, rest, _ := strings.Cut(initial, "\x00")
+				if mechanism != "SCRAM-SHA-256" || len(rest) < 4 {
+					return fmt.Errorf("malformed SASLInitialResponse %q", initial)
+				}
+				clientFirst := rest[4:]
+				_, nonce, _ := strings.Cut(clientFirst, ",r=")
+				serverFirst := "r=" + nonce + "server,s=" + base64.StdEncoding.EncodeToString(salt) + ",i=4096"
+				io.WriteString(w, pgMessage('R', "\x00\x00\x00\x0b"+serverFirst))
+				_, clientFinal, err := readFrame(r)
+				if err != nil {
+					return err
+				}
+				serverFinal, err := scramServer("secret", clientFirst, serverFirst, clientFinal, salt, 4096)
+				if err != nil {
+					return err
+				}
+				_, err = io.WriteString(w, pgMessage('R', "\x00\x00\x00\x0c"+serverFinal)+pgAuthOK+pgReadyIdle)
+				return err
+			},
+			"",
+		},
+		{
+			"scram iterations over the cap",
+			"postgres://stats:secret@db/stats?sslmode=disable",
+			func(r *bufio.Reader, w io.Writer) error {
+				if err := expectFrame(r, pgStartup); err != nil {
+					return err
+				}
+				io.WriteString(w, pgAuthSASL)
+				_, initial, err := readFrame(r)
+				if err != nil {
+					return err
+				}
+				_, nonce, _ := strings.Cut(initial, ",r=")
+				_, err = io.WriteString(w, pgMessage('R', "\x00\x00\x00\x0br="+nonce+"x,s=MDEyMw==,i=100000000"))
+				return err
+			},
+			"iteration count",
+		},
+		{
+			"wrong password",
+			"postgres://stats:wrong@db/stats?sslmode=disable",
+			func(r *bufio.Reader, w io.Writer) error {
+				if err := expectFrame(r, pgStartup); err != nil {
+					return err
+				}
+				io.WriteString(w, pgAuthCleartext)
+				if err := expectFrame(r, pgMessage('p', "wrong\x00")); err != nil {
+					return err
+				}
+				_, err := io.WriteString(w, pgAuthFailed)
+				return err
+			},
+			"password authentication failed",
+		},
+		{
+			"prefer without TLS",
+			"postgres://stats:secret@db/stats?sslmode=prefer",
+			func(r *bufio.Reader, w io.Writer) error {
+				if err := expectFrame(r, pgSSLRequest); err != nil {
+					return err
+				}
+				io.WriteString(w, "N")
+				if err := expectFrame(r, pgStartup); err != nil {
+					return err
+				}
+				_, err := io.WriteString(w, pgAuthOK+pgReadyIdle)
+				return err
+			},
+			"",
+		},
+		{
+			"verify-full without TLS",
+			"postgres://stats:secret@db/stats",
+			func(r *bufio.Reader, w io.Writer) error {
+				if err := expectFrame(r, pgSSLRequest); err != nil {
+					return err
+				}
+				_, err := io.WriteString(w, "N")
+				return err
+			},
+			"does not support TLS",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, done := testPostgresSink(t, tt.url, tt.script)
+			err := s.startup(context.Background())
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("startup() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("startup() error = %v, want %q", err, tt.wantErr)
+			}
+			s.conn.Close()
+			if err := <-done; err != nil && !errors.Is(err, io.ErrClosedPipe) && !errors.Is(err, io.EOF) {
+				t.Errorf("server: %v", err)
+			}
+		})
+	}
+}
+
+func TestPostgresQuery(t *testing.T) {
+	rowDescription := pgMessage('T', "\x00\x01extversion\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x19\xff\xff\xff\xff\xff\xff\x00\x00")
+	tests := []struct {
+		name     string
+		reply    string
+		wantRows []string
+		wantCode string
+	}{
+		{
+			"rows",
+			rowDescription + pgMessage('D', "\x00\x01\x00\x00\x00\x062.17.0") + pgMessage('D', "\x00\x01\xff\xff\xff\xff") + pgMessage('C', "SELECT 2\x00") + pgReadyIdle,
+			[]string{"2.17.0", ""},
+			"",
+		},
+		{
+			"no rows",
+			rowDescription + pgMessage('C', "SELECT 0\x00") + pgReadyIdle,
+			nil,
+			"",
+		},
+		{
+			"error",
+			pgMessage('E', "SERROR\x00C42P01\x00Mrelation \"system_stats\" does not exist\x00\x00") + pgReadyIdle,
+			nil,
+			"42P01",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, done := testPostgresSink(t, "postgres://stats@db/stats?sslmode=disable", func(r *bufio.Reader, w io.Writer) error {
+				if err := expectFrame(r, pgMessage('Q', "SELECT 1\x00")); err != nil {
+					return err
+				}
+				_, err := io.WriteString(w, tt.reply)
+				return err
+			})
+			rows, err := s.query("SELECT 1")
+			var pgErr *postgresError
+			if tt.wantCode != "" {
+				if !errors.As(err, &pgErr) || pgErr.Code != tt.wantCode {
+					t.Errorf("query() error = %v, want SQLSTATE %s", err, tt.wantCode)
+				}
+			} else if err != nil {
+				t.Errorf("query() error = %v", err)
+			}
+			if !reflect.DeepEqual(rows, tt.wantRows) {
+				t.Errorf("query() = %q, want %q", rows, tt.wantRows)
+			}
+			if err := <-done; err != nil {
+				t.Errorf("server: %v", err)
+			}
+		})
+	}
+}
+
+func TestPostgresReceiveMalformed(t *testing.T) {
+	s, done := testPostgresSink(t, "postgres://stats@db/stats?sslmode=disable", func(r *bufio.Reader, w io.Writer) error {
+		_, err := w.Write([]byte("Z\x00\x00\x00\x02"))
+		return err
+	})
+	if _, _, err := s.receive(); err == nil {
+		t.Error("receive() of a message shorter than its length succeeded")
+	}
+	<-done
+}
+
+func TestPostgresQuote(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"web-01", "'web-01'"},
+		{"o'brien", "'o''brien'"},
+		{"a\x00b", "'ab'"},
+	}
+	for _, tt := range tests {
+		if got := postgresQuote(tt.in); got != tt.want {
+			t.Errorf("postgresQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+	if got := formatPostgresFloat(0.5); got != "0.5" {
+		t.Errorf("formatPostgresFloat(0.5) = %s", got)
+	}
+	if got := formatPostgresFloat(math.NaN()); got != "'NaN'::float8" {
+		t.Errorf("formatPostgresFloat(NaN) = %s", got)
+	}
+}
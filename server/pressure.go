@@ -0,0 +1,16 @@
+package server
+
+import (
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// pressureStats returns the Pressure Stall Information of a sample, or nil
+// when it has none
+func pressureStats(stats *models.SystemStats) *models.Pressure {
+	pressure, ok := stats.Extra[collector.TopicPressure].(models.Pressure)
+	if !ok {
+		return nil
+	}
+	return &pressure
+}
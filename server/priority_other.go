@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package server
+
+import (
+	"errors"
+	"fmt"
+)
+
+// getNice is not supported on this platform
+func getNice(pid int32) (int32, error) {
+	return 0, fmt.Errorf("reading process priority: %w", errors.ErrUnsupported)
+}
+
+// setNice is not supported on this platform
+func setNice(pid int32, nice int) error {
+	return fmt.Errorf("setting process priority: %w", errors.ErrUnsupported)
+}
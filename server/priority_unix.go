@@ -0,0 +1,26 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package server
+
+import (
+	"runtime"
+	"syscall"
+)
+
+// getNice returns the nice value of a process
+func getNice(pid int32) (int32, error) {
+	prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, int(pid))
+	if err != nil {
+		return 0, err
+	}
+	// The raw Linux system call returns 20 - nice to avoid negative return values
+	if runtime.GOOS == "linux" {
+		prio = 20 - prio
+	}
+	return int32(prio), nil
+}
+
+// setNice sets the nice value of a process
+func setNice(pid int32, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, int(pid), nice)
+}
@@ -0,0 +1,1043 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// ProcessDetail represents the full detail of a single process
+// @Description Detailed information about a single system process
+type ProcessDetail struct {
+	PID        int32     `json:"pid" example:"1234"`
+	PPID       int32     `json:"ppid" example:"1"`
+	Name       string    `json:"name" example:"chrome"`
+	Cmdline    string    `json:"cmdline" example:"/usr/bin/chrome --type=renderer"`
+	Cwd        string    `json:"cwd,omitempty" example:"/home/user"`
+	Username   string    `json:"username,omitempty" example:"user"`
+	StartTime  time.Time `json:"startTime" example:"2024-01-01T12:00:00Z"`
+	Status     string    `json:"status" example:"sleep"`
+	NumThreads int32     `json:"numThreads" example:"24"`
+	OpenFiles  int32     `json:"openFiles" example:"128"`
+	// Voluntary and involuntary context switches since the process started
+	VoluntaryCtxSwitches   int64          `json:"voluntaryCtxSwitches" example:"15000"`
+	InvoluntaryCtxSwitches int64          `json:"involuntaryCtxSwitches" example:"320"`
+	CPUPercent             float64        `json:"cpuPercent" example:"5.5"`
+	Nice                   int32          `json:"nice" example:"0"`
+	IONice                 *IONiceInfo    `json:"ionice,omitempty"`
+	Memory                 ProcessMemory  `json:"memory"`
+	IO                     *ProcessIOStat `json:"io,omitempty"`
+}
+
+// IONiceInfo represents the I/O scheduling priority of a process
+// @Description I/O scheduling class and level of a process (Linux only)
+type IONiceInfo struct {
+	Class string `json:"class" example:"best-effort"`
+	Level int    `json:"level" example:"4"`
+}
+
+// ProcessMemory represents the memory breakdown of a process
+// @Description Memory breakdown of a process in MB
+type ProcessMemory struct {
+	RSS  float32 `json:"rss" example:"256.5"`  // in MB
+	VMS  float32 `json:"vms" example:"1024.0"` // in MB
+	Swap float32 `json:"swap" example:"0"`     // in MB
+}
+
+// ProcessIOStat represents the I/O counters of a process
+// @Description I/O counters of a process
+type ProcessIOStat struct {
+	ReadCount  uint64 `json:"readCount" example:"1500"`
+	WriteCount uint64 `json:"writeCount" example:"300"`
+	ReadBytes  uint64 `json:"readBytes" example:"1048576"`
+	WriteBytes uint64 `json:"writeBytes" example:"524288"`
+}
+
+// ProcessList represents a page of the process table. It is streamed by
+// processesHandler, which writes the same fields.
+// @Description A filtered, sorted, and paginated page of the process table
+type ProcessList struct {
+	Total int `json:"total" example:"312"`
+	// Zombies is the number of zombie processes left out with
+	// collapseZombies
+	Zombies   int                  `json:"zombies,omitempty" example:"2"`
+	Offset    int                  `json:"offset" example:"0"`
+	Limit     int                  `json:"limit" example:"20"`
+	Processes []models.ProcessInfo `json:"processes"`
+}
+
+// ProcessNode represents a process and its children in the process tree
+// @Description A process with its child processes nested beneath it
+type ProcessNode struct {
+	models.ProcessInfo
+	Children []*ProcessNode `json:"children"`
+}
+
+// ProcessGroup represents the aggregated usage of a group of processes
+// @Description Summed resource usage of all processes sharing a user or executable name
+type ProcessGroup struct {
+	Key         string  `json:"key" example:"nginx"`
+	Count       int     `json:"count" example:"14"`
+	CPUPercent  float64 `json:"cpuPercent" example:"12.5"`
+	MemoryUsage float32 `json:"memoryUsage" example:"3276.8"` // in MB
+}
+
+// ProcessSummary represents processes aggregated by a grouping key
+// @Description Processes aggregated by user or executable name, ordered by memory usage
+type ProcessSummary struct {
+	GroupBy string         `json:"groupBy" example:"name"`
+	Groups  []ProcessGroup `json:"groups"`
+}
+
+// OpenFile represents a file held open by a process
+// @Description A file descriptor held open by a process
+type OpenFile struct {
+	FD   uint64 `json:"fd" example:"3"`
+	Path string `json:"path" example:"/var/log/app.log"`
+}
+
+// ProcessFiles represents the open files of a process. It is streamed by
+// processFilesHandler, which writes the same fields.
+// @Description Open files of a single process
+type ProcessFiles struct {
+	PID   int32      `json:"pid" example:"1234"`
+	Count int        `json:"count" example:"1"`
+	Files []OpenFile `json:"files"`
+}
+
+// Connection represents a socket owned by a process
+// @Description A network socket owned by a process
+type Connection struct {
+	FD         uint32 `json:"fd" example:"12"`
+	Protocol   string `json:"protocol" example:"tcp"`
+	LocalAddr  string `json:"localAddr" example:"10.0.0.5:51234"`
+	RemoteAddr string `json:"remoteAddr,omitempty" example:"93.184.216.34:443"`
+	Status     string `json:"status,omitempty" example:"ESTABLISHED"`
+}
+
+// ProcessConnections represents the network connections of a process. It is
+// streamed by processConnectionsHandler, which writes the same fields.
+// @Description Network connections owned by a single process
+type ProcessConnections struct {
+	PID         int32        `json:"pid" example:"1234"`
+	Count       int          `json:"count" example:"1"`
+	Connections []Connection `json:"connections"`
+}
+
+// SignalRequest represents a request to send a signal to a process
+// @Description Signal to send to a process
+type SignalRequest struct {
+	Signal string `json:"signal" example:"TERM"`
+}
+
+// SignalResult represents the outcome of sending a signal to a process
+// @Description Outcome of sending a signal to a process
+type SignalResult struct {
+	PID    int32  `json:"pid" example:"1234"`
+	Signal string `json:"signal" example:"TERM"`
+	Sent   bool   `json:"sent" example:"true"`
+}
+
+// signalsByName maps the supported signal names to their values
+var signalsByName = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+}
+
+// PriorityRequest represents a request to change the nice value of a process
+// @Description New nice value for a process, from -20 (highest priority) to 19 (lowest)
+type PriorityRequest struct {
+	Nice *int `json:"nice" example:"10"`
+}
+
+// PriorityResult represents the outcome of changing the nice value of a process
+// @Description Outcome of changing the nice value of a process
+type PriorityResult struct {
+	PID  int32 `json:"pid" example:"1234"`
+	Nice int32 `json:"nice" example:"10"`
+}
+
+// Valid range of nice values
+const (
+	minNice = -20
+	maxNice = 19
+)
+
+// processQuery holds the filtering, sorting, and pagination options for process lists
+type processQuery struct {
+	Sort              string
+	Order             string
+	Name              string
+	Status            string
+	HideKernelThreads bool
+	CollapseZombies   bool
+	Limit             int
+	Offset            int
+}
+
+var (
+	// errProcessNotFound is returned when the requested PID does not exist
+	errProcessNotFound = errors.New("process not found")
+	// errSignalNotAllowed is returned when a signal is unknown or not in the allowlist
+	errSignalNotAllowed = errors.New("signal not allowed")
+)
+
+// bytesToMB converts a byte count to megabytes
+func bytesToMB(b uint64) float32 {
+	return float32(b) / (1024 * 1024)
+}
+
+// parsePID parses a PID from a path value
+func parsePID(value string) (int32, error) {
+	pid, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid pid %q", value)
+	}
+	return int32(pid), nil
+}
+
+// findProcess returns a handle to a running process
+func findProcess(ctx context.Context, pid int32) (*process.Process, error) {
+	proc, err := process.NewProcessWithContext(ctx, pid)
+	if err != nil {
+		if errors.Is(err, process.ErrorProcessNotRunning) {
+			return nil, errProcessNotFound
+		}
+		return nil, fmt.Errorf("error getting process %d: %w", pid, err)
+	}
+	return proc, nil
+}
+
+// parseProcessQuery parses and validates process list query parameters
+func parseProcessQuery(values url.Values) (processQuery, error) {
+	query := processQuery{
+		Sort:   values.Get("sort"),
+		Order:  values.Get("order"),
+		Name:   values.Get("name"),
+		Status: values.Get("status"),
+	}
+
+	switch query.Sort {
+	case "", "pid", "name", "cpu", "mem", "fds", "threads":
+	default:
+		return query, fmt.Errorf("invalid sort %q: must be one of pid, name, cpu, mem, fds, threads", query.Sort)
+	}
+
+	switch query.Order {
+	case "":
+		query.Order = "desc"
+		if query.Sort == "" || query.Sort == "pid" || query.Sort == "name" {
+			query.Order = "asc"
+		}
+	case "asc", "desc":
+	default:
+		return query, fmt.Errorf("invalid order %q: must be asc or desc", query.Order)
+	}
+
+	for _, param := range []struct {
+		name string
+		dst  *bool
+	}{{"hideKernelThreads", &query.HideKernelThreads}, {"collapseZombies", &query.CollapseZombies}} {
+		if v := values.Get(param.name); v != "" {
+			var err error
+			if *param.dst, err = strconv.ParseBool(v); err != nil {
+				return query, fmt.Errorf("invalid %s %q: must be a boolean", param.name, v)
+			}
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return query, fmt.Errorf("invalid limit %q", v)
+		}
+		query.Limit = limit
+	}
+
+	if v := values.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return query, fmt.Errorf("invalid offset %q", v)
+		}
+		query.Offset = offset
+	}
+
+	return query, nil
+}
+
+// filterProcesses returns the processes whose name contains the given substring
+// (case-insensitive) and whose status matches, if given
+func filterProcesses(procs []models.ProcessInfo, name, status string) []models.ProcessInfo {
+	if name == "" && status == "" {
+		return procs
+	}
+
+	name = strings.ToLower(name)
+	filtered := []models.ProcessInfo{}
+	for _, proc := range procs {
+		if !strings.Contains(strings.ToLower(proc.Name), name) {
+			continue
+		}
+		if status != "" && !slices.Contains(strings.Split(proc.Status, ","), status) {
+			continue
+		}
+		filtered = append(filtered, proc)
+	}
+	return filtered
+}
+
+// sortProcesses sorts processes in place by the given key and order
+func sortProcesses(procs []models.ProcessInfo, key, order string) {
+	less := func(i, j int) bool { return procs[i].PID < procs[j].PID }
+	switch key {
+	case "name":
+		less = func(i, j int) bool { return procs[i].Name < procs[j].Name }
+	case "cpu":
+		less = func(i, j int) bool { return procs[i].CPUPercent < procs[j].CPUPercent }
+	case "mem":
+		less = func(i, j int) bool { return procs[i].MemoryUsage < procs[j].MemoryUsage }
+	case "fds":
+		less = func(i, j int) bool { return procs[i].NumFDs < procs[j].NumFDs }
+	case "threads":
+		less = func(i, j int) bool { return procs[i].NumThreads < procs[j].NumThreads }
+	}
+
+	if order == "desc" {
+		sort.SliceStable(procs, func(i, j int) bool { return less(j, i) })
+		return
+	}
+	sort.SliceStable(procs, less)
+}
+
+// paginateProcesses returns the page of processes described by offset and limit (0 means no limit)
+func paginateProcesses(procs []models.ProcessInfo, offset, limit int) []models.ProcessInfo {
+	if offset >= len(procs) {
+		return []models.ProcessInfo{}
+	}
+	procs = procs[offset:]
+	if limit > 0 && limit < len(procs) {
+		procs = procs[:limit]
+	}
+	return procs
+}
+
+// topProcsQuery holds the options for trimming the embedded process list to the heaviest processes
+type topProcsQuery struct {
+	N      int
+	SortBy string
+}
+
+// parseTopProcsQuery parses the topProcs and sortBy query parameters. The
+// number of processes is capped at limit, which is also the default (0
+// means no cap).
+func parseTopProcsQuery(values url.Values, limit int) (topProcsQuery, error) {
+	query := topProcsQuery{SortBy: values.Get("sortBy")}
+
+	switch query.SortBy {
+	case "":
+		query.SortBy = "cpu"
+	case "cpu", "mem":
+	default:
+		return query, fmt.Errorf("invalid sortBy %q: must be cpu or mem", query.SortBy)
+	}
+
+	if v := values.Get("topProcs"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return query, fmt.Errorf("invalid topProcs %q", v)
+		}
+		query.N = n
+	}
+	if limit > 0 && (query.N == 0 || query.N > limit) {
+		query.N = limit
+	}
+
+	return query, nil
+}
+
+// trimProcesses trims the process list of a copied sample according to the
+// query, recording how many processes there were
+func trimProcesses(stats *models.SystemStats, query topProcsQuery) {
+	// Samples whose processes were removed by the retention janitor keep
+	// their count
+	stats.ProcessCount = max(stats.ProcessCount, len(stats.Processes))
+	stats.Processes = topProcesses(stats.Processes, query)
+}
+
+// topProcesses returns the heaviest processes according to the query (0 means all, unsorted).
+// The input slice is left untouched so that shared samples can be trimmed safely.
+func topProcesses(procs []models.ProcessInfo, query topProcsQuery) []models.ProcessInfo {
+	if query.N == 0 {
+		return procs
+	}
+	procs = slices.Clone(procs)
+	sortProcesses(procs, query.SortBy, "desc")
+	return paginateProcesses(procs, 0, query.N)
+}
+
+// Fetch a filtered, sorted, and paginated page of the process table
+func listProcesses(ctx context.Context, stats StatsProvider, query processQuery) (*ProcessList, error) {
+	procs, err := stats.Processes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	zombies := 0
+	if query.HideKernelThreads || query.CollapseZombies {
+		kept := []models.ProcessInfo{}
+		for _, proc := range procs {
+			switch {
+			case query.HideKernelThreads && proc.KernelThread:
+			case query.CollapseZombies && collector.IsZombie(proc):
+				zombies++
+			default:
+				kept = append(kept, proc)
+			}
+		}
+		procs = kept
+	}
+	procs = filterProcesses(procs, query.Name, query.Status)
+	sortProcesses(procs, query.Sort, query.Order)
+
+	return &ProcessList{
+		Total:     len(procs),
+		Zombies:   zombies,
+		Offset:    query.Offset,
+		Limit:     query.Limit,
+		Processes: paginateProcesses(procs, query.Offset, query.Limit),
+	}, nil
+}
+
+// buildProcessTree nests processes under their parents. Processes whose parent
+// is not in the list (or is themselves) become roots. Siblings are ordered by PID.
+func buildProcessTree(procs []models.ProcessInfo) []*ProcessNode {
+	nodes := make(map[int32]*ProcessNode, len(procs))
+	for _, proc := range procs {
+		nodes[proc.PID] = &ProcessNode{ProcessInfo: proc, Children: []*ProcessNode{}}
+	}
+
+	roots := []*ProcessNode{}
+	for _, proc := range procs {
+		node := nodes[proc.PID]
+		parent, ok := nodes[proc.PPID]
+		if !ok || proc.PPID == proc.PID {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+
+	var sortNodes func([]*ProcessNode)
+	sortNodes = func(list []*ProcessNode) {
+		sort.Slice(list, func(i, j int) bool { return list[i].PID < list[j].PID })
+		for _, node := range list {
+			sortNodes(node.Children)
+		}
+	}
+	sortNodes(roots)
+
+	return roots
+}
+
+// summarizeProcesses groups processes by user or name and sums their usage
+func summarizeProcesses(procs []models.ProcessInfo, groupBy string) *ProcessSummary {
+	groups := map[string]*ProcessGroup{}
+	for _, proc := range procs {
+		key := proc.Name
+		if groupBy == "user" {
+			key = proc.Username
+		}
+
+		group, ok := groups[key]
+		if !ok {
+			group = &ProcessGroup{Key: key}
+			groups[key] = group
+		}
+		group.Count++
+		group.CPUPercent += proc.CPUPercent
+		group.MemoryUsage += proc.MemoryUsage
+	}
+
+	summary := &ProcessSummary{GroupBy: groupBy, Groups: make([]ProcessGroup, 0, len(groups))}
+	for _, group := range groups {
+		summary.Groups = append(summary.Groups, *group)
+	}
+	sort.Slice(summary.Groups, func(i, j int) bool {
+		if summary.Groups[i].MemoryUsage != summary.Groups[j].MemoryUsage {
+			return summary.Groups[i].MemoryUsage > summary.Groups[j].MemoryUsage
+		}
+		return summary.Groups[i].Key < summary.Groups[j].Key
+	})
+
+	return summary
+}
+
+// Fetch full detail for a single process
+func getProcessDetail(ctx context.Context, pid int32) (*ProcessDetail, error) {
+	proc, err := findProcess(ctx, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := proc.NameWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting process name: %w", err)
+	}
+
+	detail := &ProcessDetail{
+		PID:  proc.Pid,
+		Name: name,
+	}
+
+	// The remaining fields are best-effort: many of them require elevated
+	// privileges for processes owned by other users.
+	if ppid, err := proc.PpidWithContext(ctx); err == nil {
+		detail.PPID = ppid
+	}
+	if cmdline, err := proc.CmdlineWithContext(ctx); err == nil {
+		detail.Cmdline = cmdline
+	}
+	if cwd, err := proc.CwdWithContext(ctx); err == nil {
+		detail.Cwd = cwd
+	}
+	if username, err := proc.UsernameWithContext(ctx); err == nil {
+		detail.Username = username
+	}
+	if createTime, err := proc.CreateTimeWithContext(ctx); err == nil {
+		detail.StartTime = time.UnixMilli(createTime).UTC()
+	}
+	if status, err := proc.StatusWithContext(ctx); err == nil {
+		detail.Status = strings.Join(status, ",")
+	}
+	if numThreads, err := proc.NumThreadsWithContext(ctx); err == nil {
+		detail.NumThreads = numThreads
+	}
+	if numFDs, err := proc.NumFDsWithContext(ctx); err == nil {
+		detail.OpenFiles = numFDs
+	}
+	if ctxSwitches, err := proc.NumCtxSwitchesWithContext(ctx); err == nil {
+		detail.VoluntaryCtxSwitches = ctxSwitches.Voluntary
+		detail.InvoluntaryCtxSwitches = ctxSwitches.Involuntary
+	}
+	if cpuPercent, err := collector.ProcessCPUPercent(ctx, proc); err == nil {
+		detail.CPUPercent = cpuPercent
+	}
+	if nice, err := getNice(proc.Pid); err == nil {
+		detail.Nice = nice
+	}
+	if ionice, err := getIONice(proc.Pid); err == nil {
+		detail.IONice = ionice
+	}
+	if memInfo, err := proc.MemoryInfoWithContext(ctx); err == nil {
+		detail.Memory = ProcessMemory{
+			RSS:  bytesToMB(memInfo.RSS),
+			VMS:  bytesToMB(memInfo.VMS),
+			Swap: bytesToMB(memInfo.Swap),
+		}
+	}
+	if ioCounters, err := proc.IOCountersWithContext(ctx); err == nil {
+		detail.IO = &ProcessIOStat{
+			ReadCount:  ioCounters.ReadCount,
+			WriteCount: ioCounters.WriteCount,
+			ReadBytes:  ioCounters.ReadBytes,
+			WriteBytes: ioCounters.WriteBytes,
+		}
+	}
+
+	return detail, nil
+}
+
+// normalizeSignalName converts a signal name such as "sigterm" to its canonical form "TERM"
+func normalizeSignalName(name string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "SIG")
+}
+
+// signalProcess sends the named signal to a process after checking it against the allowlist
+func signalProcess(ctx context.Context, pid int32, name string, allowed []string) error {
+	sig, ok := signalsByName[name]
+	if !ok || !slices.Contains(allowed, name) {
+		return fmt.Errorf("%w: %q", errSignalNotAllowed, name)
+	}
+	if int(pid) == os.Getpid() {
+		return fmt.Errorf("%w: refusing to signal the server itself", errSignalNotAllowed)
+	}
+	// Signalling init would take the whole host or container down
+	if pid == 1 {
+		return fmt.Errorf("%w: refusing to signal PID 1", errSignalNotAllowed)
+	}
+
+	proc, err := findProcess(ctx, pid)
+	if err != nil {
+		return err
+	}
+	if err := proc.SendSignalWithContext(ctx, sig); err != nil {
+		return fmt.Errorf("error sending %s to process %d: %w", name, pid, err)
+	}
+	return nil
+}
+
+// Fetch the open files of a single process
+func getProcessFiles(ctx context.Context, pid int32) (*ProcessFiles, error) {
+	proc, err := findProcess(ctx, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	openFiles, err := proc.OpenFilesWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting open files of process %d: %w", pid, err)
+	}
+
+	files := make([]OpenFile, 0, len(openFiles))
+	for _, f := range openFiles {
+		files = append(files, OpenFile{FD: f.Fd, Path: f.Path})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].FD < files[j].FD })
+
+	return &ProcessFiles{PID: pid, Count: len(files), Files: files}, nil
+}
+
+// connectionProtocol names the protocol of a socket from its address family and type
+func connectionProtocol(family, sockType uint32) string {
+	var proto string
+	switch sockType {
+	case syscall.SOCK_STREAM:
+		proto = "tcp"
+	case syscall.SOCK_DGRAM:
+		proto = "udp"
+	default:
+		proto = "raw"
+	}
+
+	switch family {
+	case syscall.AF_INET6:
+		return proto + "6"
+	case syscall.AF_UNIX:
+		return "unix"
+	}
+	return proto
+}
+
+// formatAddr formats a socket address, returning "" for unset addresses
+func formatAddr(ip string, port uint32) string {
+	if port == 0 && (ip == "" || net.ParseIP(ip).IsUnspecified()) {
+		return ""
+	}
+	return net.JoinHostPort(ip, strconv.FormatUint(uint64(port), 10))
+}
+
+// newConnection converts a gopsutil socket
+func newConnection(c psnet.ConnectionStat) Connection {
+	status := c.Status
+	if status == "NONE" {
+		status = ""
+	}
+	return Connection{
+		FD:         c.Fd,
+		Protocol:   connectionProtocol(c.Family, c.Type),
+		LocalAddr:  formatAddr(c.Laddr.IP, c.Laddr.Port),
+		RemoteAddr: formatAddr(c.Raddr.IP, c.Raddr.Port),
+		Status:     status,
+	}
+}
+
+// Fetch the network connections of a single process
+func getProcessConnections(ctx context.Context, pid int32) (*ProcessConnections, error) {
+	proc, err := findProcess(ctx, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	conns, err := proc.ConnectionsWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting connections of process %d: %w", pid, err)
+	}
+
+	connections := make([]Connection, 0, len(conns))
+	for _, c := range conns {
+		connections = append(connections, newConnection(c))
+	}
+	sort.Slice(connections, func(i, j int) bool { return connections[i].FD < connections[j].FD })
+
+	return &ProcessConnections{PID: pid, Count: len(connections), Connections: connections}, nil
+}
+
+// setProcessPriority changes the nice value of a process and returns the resulting value
+func setProcessPriority(ctx context.Context, pid int32, nice int) (int32, error) {
+	if _, err := findProcess(ctx, pid); err != nil {
+		return 0, err
+	}
+	if err := setNice(pid, nice); err != nil {
+		return 0, fmt.Errorf("error setting priority of process %d: %w", pid, err)
+	}
+
+	current, err := getNice(pid)
+	if err != nil {
+		return 0, fmt.Errorf("error reading priority of process %d: %w", pid, err)
+	}
+	return current, nil
+}
+
+// writeProcessError maps a process lookup error to the matching HTTP status
+func writeProcessError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errProcessNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, os.ErrPermission):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// processListHandler godoc
+// @Summary List processes
+// @Description Returns the process table filtered by name, sorted by the given key, and paginated
+// @Tags processes
+// @Produce json
+// @Param sort query string false "Sort key" Enums(pid, name, cpu, mem, fds, threads)
+// @Param order query string false "Sort order (defaults to desc for cpu/mem/fds/threads, asc otherwise)" Enums(asc, desc)
+// @Param name query string false "Case-insensitive substring match on process name"
+// @Param status query string false "Only include processes with this status" Enums(running, sleep, stop, idle, zombie, wait, lock)
+// @Param hideKernelThreads query bool false "Leave out the kernel threads of Linux"
+// @Param collapseZombies query bool false "Leave out the zombie processes, counting them in zombies"
+// @Param limit query int false "Maximum number of processes to return (0 for all)"
+// @Param offset query int false "Number of processes to skip"
+// @Success 200 {object} ProcessList
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /processes [get]
+func (s *Server) processListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := parseProcessQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := listProcesses(r.Context(), s.stats, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fields := []jsonField{{"total", list.Total}}
+	if list.Zombies > 0 {
+		fields = append(fields, jsonField{"zombies", list.Zombies})
+	}
+	writeJSONObject(w, r, append(fields, []jsonField{
+		{"offset", list.Offset},
+		{"limit", list.Limit},
+	}...), "processes", list.Processes)
+}
+
+// processTreeHandler godoc
+// @Summary Get process tree
+// @Description Returns processes nested by parent/child (PPID) relationship, suitable for rendering an htop-style tree
+// @Tags processes
+// @Produce json
+// @Success 200 {array} ProcessNode
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /processes/tree [get]
+func (s *Server) processTreeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	procs, err := s.stats.Processes(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(buildProcessTree(procs)); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
+
+// processSummaryHandler godoc
+// @Summary Get aggregated process usage
+// @Description Groups processes by username or executable name with summed CPU percent, memory usage, and process counts
+// @Tags processes
+// @Produce json
+// @Param groupBy query string false "Grouping key (defaults to name)" Enums(user, name)
+// @Success 200 {object} ProcessSummary
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /processes/summary [get]
+func (s *Server) processSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	groupBy := r.URL.Query().Get("groupBy")
+	switch groupBy {
+	case "":
+		groupBy = "name"
+	case "user", "name":
+	default:
+		http.Error(w, fmt.Sprintf("invalid groupBy %q: must be user or name", groupBy), http.StatusBadRequest)
+		return
+	}
+
+	procs, err := s.stats.Processes(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(summarizeProcesses(procs, groupBy)); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
+
+// processDetailHandler godoc
+// @Summary Get process detail
+// @Description Returns full detail for a single process including command line, working directory, user, start time, status, threads, open files, memory breakdown, and I/O counters
+// @Tags processes
+// @Produce json
+// @Param pid path int true "Process ID"
+// @Success 200 {object} ProcessDetail
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /processes/{pid} [get]
+func (s *Server) processDetailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pid, err := parsePID(r.PathValue("pid"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	detail, err := getProcessDetail(r.Context(), pid)
+	if err != nil {
+		writeProcessError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(detail); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
+
+// processFilesHandler godoc
+// @Summary List open files of a process
+// @Description Returns the file descriptors held open by a process and the paths they refer to, to help diagnose FD leaks
+// @Tags processes
+// @Produce json
+// @Param pid path int true "Process ID"
+// @Success 200 {object} ProcessFiles
+// @Failure 400 {string} string "Bad Request"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /processes/{pid}/files [get]
+func (s *Server) processFilesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pid, err := parsePID(r.PathValue("pid"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	files, err := getProcessFiles(r.Context(), pid)
+	if err != nil {
+		writeProcessError(w, err)
+		return
+	}
+
+	writeJSONObject(w, r, []jsonField{
+		{"pid", files.PID},
+		{"count", files.Count},
+	}, "files", files.Files)
+}
+
+// processConnectionsHandler godoc
+// @Summary List network connections of a process
+// @Description Returns the sockets owned by a process with local and remote addresses, answering "which process is talking to that IP"
+// @Tags processes
+// @Produce json
+// @Param pid path int true "Process ID"
+// @Success 200 {object} ProcessConnections
+// @Failure 400 {string} string "Bad Request"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /processes/{pid}/connections [get]
+func (s *Server) processConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pid, err := parsePID(r.PathValue("pid"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conns, err := getProcessConnections(r.Context(), pid)
+	if err != nil {
+		writeProcessError(w, err)
+		return
+	}
+
+	writeJSONObject(w, r, []jsonField{
+		{"pid", conns.PID},
+		{"count", conns.Count},
+	}, "connections", conns.Connections)
+}
+
+// processSignalHandler godoc
+// @Summary Send a signal to a process
+// @Description Sends TERM, KILL, HUP, or another allowlisted signal to a process. Disabled unless signals.enabled is set in the config, and requires the admin token.
+// @Tags processes
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param pid path int true "Process ID"
+// @Param request body SignalRequest true "Signal to send"
+// @Success 200 {object} SignalResult
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /processes/{pid}/signal [post]
+func (s *Server) processSignalHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.config.Signals.Enabled {
+		http.Error(w, "Process signals are disabled", http.StatusForbidden)
+		return
+	}
+
+	pid, err := parsePID(r.PathValue("pid"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req SignalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	name := normalizeSignalName(req.Signal)
+	if err := signalProcess(r.Context(), pid, name, s.config.Signals.Allowed); err != nil {
+		if errors.Is(err, errSignalNotAllowed) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		writeProcessError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Sent signal to process", "signal", name, "pid", pid)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(SignalResult{PID: pid, Signal: name, Sent: true}); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
+
+// processPriorityHandler godoc
+// @Summary Change process priority
+// @Description Sets the nice value of a process. Requires the admin token; raising priority (lowering nice) usually also requires the server to run as root.
+// @Tags processes
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param pid path int true "Process ID"
+// @Param request body PriorityRequest true "New nice value"
+// @Success 200 {object} PriorityResult
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /processes/{pid}/priority [post]
+func (s *Server) processPriorityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pid, err := parsePID(r.PathValue("pid"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req PriorityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Nice == nil || *req.Nice < minNice || *req.Nice > maxNice {
+		http.Error(w, fmt.Sprintf("nice must be between %d and %d", minNice, maxNice), http.StatusBadRequest)
+		return
+	}
+
+	nice, err := setProcessPriority(r.Context(), pid, *req.Nice)
+	if err != nil {
+		writeProcessError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Set process nice value", "pid", pid, "nice", nice)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(PriorityResult{PID: pid, Nice: nice}); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+func TestParsePID(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int32
+		wantErr bool
+	}{
+		{"1", 1, false},
+		{"1234", 1234, false},
+		{"2147483647", 2147483647, false},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"2147483648", 0, true},
+		{"", 0, true},
+		{"12a", 0, true},
+		{" 12", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePID(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parsePID(%q) = %d, %v, want %d, wantErr %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSignalProcessRefused(t *testing.T) {
+	tests := []struct {
+		name    string
+		pid     int32
+		signal  string
+		allowed []string
+	}{
+		{"server itself", int32(os.Getpid()), "TERM", []string{"TERM"}},
+		{"init", 1, "KILL", []string{"TERM", "KILL"}},
+		{"not allowed", 1 << 30, "KILL", []string{"TERM"}},
+		{"unknown", 1 << 30, "FOO", []string{"FOO"}},
+	}
+	for _, tt := range tests {
+		err := signalProcess(context.Background(), tt.pid, tt.signal, tt.allowed)
+		if !errors.Is(err, errSignalNotAllowed) {
+			t.Errorf("%s: signalProcess(%d, %s) error = %v, want %v", tt.name, tt.pid, tt.signal, err, errSignalNotAllowed)
+		}
+	}
+}
+
+func TestProcessHandlersRejectPID(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Signals.Enabled = true
+	s := &Server{config: cfg}
+	handlers := []struct {
+		method  string
+		path    string
+		body    string
+		handler http.HandlerFunc
+	}{
+		{http.MethodGet, "/api/processes/{pid}", "", s.processDetailHandler},
+		{http.MethodPost, "/api/processes/{pid}/signal", `{"signal":"TERM"}`, s.processSignalHandler},
+		{http.MethodPost, "/api/processes/{pid}/priority", `{"nice":10}`, s.processPriorityHandler},
+	}
+	for _, h := range handlers {
+		for _, pid := range []string{"0", "-1", "abc"} {
+			path := strings.Replace(h.path, "{pid}", pid, 1)
+			r := httptest.NewRequest(h.method, path, strings.NewReader(h.body))
+			r.SetPathValue("pid", pid)
+			w := httptest.NewRecorder()
+			h.handler(w, r)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s %s = %d, want 400", h.method, path, w.Code)
+			}
+		}
+	}
+}
+
+// processTable is a StatsProvider serving a fixed process table
+type processTable []models.ProcessInfo
+
+func (p processTable) Collect(context.Context, collector.TopicSet) (*models.SystemStats, error) {
+	return &models.SystemStats{Processes: slices.Clone(p)}, nil
+}
+
+func (p processTable) Processes(context.Context) ([]models.ProcessInfo, error) {
+	return slices.Clone(p), nil
+}
+
+// testProcesses is a process table whose PIDs are in none of the sort orders
+var testProcesses = processTable{
+	{PID: 30, Name: "nginx", CPUPercent: 2.5, MemoryUsage: 40, NumFDs: 120, NumThreads: 4, Status: "sleep"},
+	{PID: 10, Name: "postgres", CPUPercent: 12, MemoryUsage: 300, NumFDs: 30, NumThreads: 1, Status: "running"},
+	{PID: 50, Name: "kworker/0:1", Status: "idle", KernelThread: true},
+	{PID: 20, Name: "Nginx-worker", CPUPercent: 40, MemoryUsage: 60, NumFDs: 64, NumThreads: 8, Status: "running"},
+	{PID: 40, Name: "defunct", Status: "zombie"},
+}
+
+// processPIDs returns the PIDs of procs in order
+func processPIDs(procs []models.ProcessInfo) []int32 {
+	pids := make([]int32, len(procs))
+	for i, proc := range procs {
+		pids[i] = proc.PID
+	}
+	return pids
+}
+
+func TestSortProcesses(t *testing.T) {
+	tests := []struct {
+		key, order string
+		want       []int32
+	}{
+		{"", "", []int32{10, 20, 30, 40, 50}},
+		{"pid", "desc", []int32{50, 40, 30, 20, 10}},
+		{"name", "asc", []int32{20, 40, 50, 30, 10}},
+		{"name", "desc", []int32{10, 30, 50, 40, 20}},
+		{"cpu", "desc", []int32{20, 10, 30, 50, 40}},
+		{"mem", "asc", []int32{50, 40, 30, 20, 10}},
+		{"fds", "desc", []int32{30, 20, 10, 50, 40}},
+		{"threads", "asc", []int32{50, 40, 10, 30, 20}},
+		// Unknown keys sort by PID
+		{"uptime", "asc", []int32{10, 20, 30, 40, 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+" "+tt.order, func(t *testing.T) {
+			procs := slices.Clone(testProcesses)
+			sortProcesses(procs, tt.key, tt.order)
+			if got := processPIDs(procs); !slices.Equal(got, tt.want) {
+				t.Errorf("sortProcesses(%q, %q) = %v, want %v", tt.key, tt.order, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginateProcesses(t *testing.T) {
+	tests := []struct {
+		name          string
+		offset, limit int
+		want          []int32
+	}{
+		{"all", 0, 0, []int32{30, 10, 50, 20, 40}},
+		{"first page", 0, 2, []int32{30, 10}},
+		{"middle page", 2, 2, []int32{50, 20}},
+		{"short last page", 4, 2, []int32{40}},
+		{"offset without limit", 3, 0, []int32{20, 40}},
+		{"limit past the end", 0, 10, []int32{30, 10, 50, 20, 40}},
+		{"offset at the end", 5, 2, []int32{}},
+		{"offset past the end", 9, 0, []int32{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := paginateProcesses(slices.Clone(testProcesses), tt.offset, tt.limit)
+			// Pages past the end are empty rather than nil so they encode as []
+			if got == nil {
+				t.Fatalf("paginateProcesses(%d, %d) = nil", tt.offset, tt.limit)
+			}
+			if pids := processPIDs(got); !slices.Equal(pids, tt.want) {
+				t.Errorf("paginateProcesses(%d, %d) = %v, want %v", tt.offset, tt.limit, pids, tt.want)
+			}
+		})
+	}
+}
+
+func TestListProcesses(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       processQuery
+		want        []int32
+		wantTotal   int
+		wantZombies int
+	}{
+		{"everything", processQuery{}, []int32{10, 20, 30, 40, 50}, 5, 0},
+		{"name is case-insensitive", processQuery{Name: "NGINX"}, []int32{20, 30}, 2, 0},
+		{"name substring", processQuery{Name: "gres"}, []int32{10}, 1, 0},
+		{"status", processQuery{Status: "running", Sort: "cpu", Order: "desc"}, []int32{20, 10}, 2, 0},
+		{"name and status", processQuery{Name: "nginx", Status: "sleep"}, []int32{30}, 1, 0},
+		{"no match", processQuery{Name: "redis"}, []int32{}, 0, 0},
+		{"hide kernel threads", processQuery{HideKernelThreads: true}, []int32{10, 20, 30, 40}, 4, 0},
+		{"collapse zombies", processQuery{CollapseZombies: true, Sort: "name"}, []int32{20, 50, 30, 10}, 4, 1},
+		{"sorted page", processQuery{Sort: "mem", Order: "desc", Offset: 1, Limit: 2}, []int32{20, 30}, 5, 0},
+		{"filtered page", processQuery{Name: "nginx", Offset: 1, Limit: 5}, []int32{30}, 2, 0},
+		{"offset past the end", processQuery{Offset: 10, Limit: 5}, []int32{}, 5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := listProcesses(context.Background(), testProcesses, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := processPIDs(list.Processes); !slices.Equal(got, tt.want) {
+				t.Errorf("processes = %v, want %v", got, tt.want)
+			}
+			if list.Total != tt.wantTotal || list.Zombies != tt.wantZombies {
+				t.Errorf("total, zombies = %d, %d, want %d, %d", list.Total, list.Zombies, tt.wantTotal, tt.wantZombies)
+			}
+			if list.Offset != tt.query.Offset || list.Limit != tt.query.Limit {
+				t.Errorf("offset, limit = %d, %d, want %d, %d", list.Offset, list.Limit, tt.query.Offset, tt.query.Limit)
+			}
+		})
+	}
+}
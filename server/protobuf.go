@@ -0,0 +1,270 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// The encoders below hand-marshal the messages of proto/stats.proto. Like
+// proto3, fields holding their zero value are omitted.
+
+// marshalStatsProto encodes stats as a SystemStats message
+func marshalStatsProto(stats *models.SystemStats) []byte {
+	return appendStatsProto(nil, stats)
+}
+
+// marshalSamplesProto encodes samples as a SampleList message
+func marshalSamplesProto(samples []models.Sample) []byte {
+	var b []byte
+	for _, sample := range samples {
+		b = appendProtoMessage(b, 1, appendSampleProto(nil, sample))
+	}
+	return b
+}
+
+func appendSampleProto(b []byte, sample models.Sample) []byte {
+	b = appendProtoUint(b, 1, sample.Seq)
+	b = appendProtoMessage(b, 2, appendTimestampProto(nil, sample.Timestamp))
+	if sample.Stats != nil {
+		b = appendProtoMessage(b, 3, appendStatsProto(nil, sample.Stats))
+	}
+	return b
+}
+
+// appendTimestampProto encodes t as a google.protobuf.Timestamp
+func appendTimestampProto(b []byte, t time.Time) []byte {
+	b = appendProtoInt(b, 1, t.Unix())
+	return appendProtoInt(b, 2, int64(t.Nanosecond()))
+}
+
+func appendStatsProto(b []byte, stats *models.SystemStats) []byte {
+	b = appendProtoDouble(b, 1, stats.CPUUsage)
+	b = appendProtoDouble(b, 2, stats.MemUsage)
+	b = appendProtoDouble(b, 3, stats.DiskUsage)
+	b = appendProtoInt(b, 4, stats.NetTraffic)
+	for _, proc := range stats.Processes {
+		b = appendProtoMessage(b, 5, appendProcessProto(nil, proc))
+	}
+	b = appendProtoUint(b, 6, stats.MemUsed)
+	b = appendProtoUint(b, 7, stats.DiskUsed)
+	for _, fs := range stats.Filesystems {
+		b = appendProtoMessage(b, 8, appendFilesystemProto(nil, fs))
+	}
+	b = appendProtoInt(b, 9, int64(stats.ProcessCount))
+	b = appendProtoInt(b, 10, int64(stats.Zombies))
+	if extra, ok := jsonValue(stats.Extra).(map[string]interface{}); ok && len(extra) > 0 {
+		b = appendProtoMessage(b, 11, appendStructProto(nil, extra))
+	}
+	b = appendProtoStringMap(b, 12, stats.Errors)
+	b = appendProtoStringMap(b, 13, stats.Labels)
+	if rates := stats.Rates; rates != nil {
+		msg := appendProtoDouble(nil, 1, rates.MemGrowth)
+		msg = appendProtoDouble(msg, 2, rates.DiskFill)
+		b = appendProtoMessage(b, 14, appendProtoDouble(msg, 3, rates.NetThroughput))
+	}
+	if stats.Runtime != nil {
+		b = appendProtoMessage(b, 15, appendRuntimeProto(nil, stats.Runtime))
+	}
+	return b
+}
+
+func appendRuntimeProto(b []byte, rt *models.RuntimeInfo) []byte {
+	b = appendProtoBool(b, 1, rt.Container)
+	b = appendProtoString(b, 2, rt.Engine)
+	b = appendProtoInt(b, 3, int64(rt.CgroupVersion))
+	b = appendProtoString(b, 4, rt.CgroupPath)
+	if rt.CPU != nil {
+		b = appendProtoMessage(b, 5, appendContainerResourceProto(nil, rt.CPU))
+	}
+	if rt.Memory != nil {
+		b = appendProtoMessage(b, 6, appendContainerResourceProto(nil, rt.Memory))
+	}
+	return b
+}
+
+func appendContainerResourceProto(b []byte, res *models.ContainerResource) []byte {
+	b = appendProtoDouble(b, 1, res.Limit)
+	b = appendProtoDouble(b, 2, res.Used)
+	if res.OfLimit != nil {
+		// optional: written even when 0 so that it is set
+		b = binary.LittleEndian.AppendUint64(appendProtoTag(b, 3, wireFixed64), math.Float64bits(*res.OfLimit))
+	}
+	b = appendProtoDouble(b, 4, res.OfHost)
+	return appendProtoDouble(b, 5, res.HostUsage)
+}
+
+func appendFilesystemProto(b []byte, fs models.Filesystem) []byte {
+	b = appendProtoString(b, 1, fs.Mountpoint)
+	b = appendProtoString(b, 2, fs.Device)
+	b = appendProtoString(b, 3, fs.Fstype)
+	b = appendProtoUint(b, 4, fs.Total)
+	b = appendProtoUint(b, 5, fs.Used)
+	b = appendProtoDouble(b, 6, fs.UsedPercent)
+	b = appendProtoBool(b, 7, fs.Network)
+	return appendProtoBool(b, 8, fs.Stale)
+}
+
+// jsonValue converts v to the values of its JSON representation: maps,
+// slices, float64, string, bool, and nil. It is nil when v cannot be encoded.
+func jsonValue(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var value interface{}
+	if json.Unmarshal(data, &value) != nil {
+		return nil
+	}
+	return value
+}
+
+// appendStructProto encodes a JSON object as a google.protobuf.Struct
+func appendStructProto(b []byte, fields map[string]interface{}) []byte {
+	for _, key := range sortedKeys(fields) {
+		entry := appendProtoString(nil, 1, key)
+		entry = appendProtoMessage(entry, 2, appendValueProto(nil, fields[key]))
+		b = appendProtoMessage(b, 1, entry)
+	}
+	return b
+}
+
+// appendValueProto encodes a JSON value as a google.protobuf.Value. The
+// fields of its oneof are written even when zero.
+func appendValueProto(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case float64:
+		return binary.LittleEndian.AppendUint64(appendProtoTag(b, 2, wireFixed64), math.Float64bits(v))
+	case string:
+		b = binary.AppendUvarint(appendProtoTag(b, 3, wireBytes), uint64(len(v)))
+		return append(b, v...)
+	case bool:
+		return append(appendProtoTag(b, 4, wireVarint), boolByte(v))
+	case map[string]interface{}:
+		return appendProtoMessage(b, 5, appendStructProto(nil, v))
+	case []interface{}:
+		var list []byte
+		for _, item := range v {
+			list = appendProtoMessage(list, 1, appendValueProto(nil, item))
+		}
+		return appendProtoMessage(b, 6, list)
+	}
+	// null_value
+	return append(appendProtoTag(b, 1, wireVarint), 0)
+}
+
+func appendProcessProto(b []byte, proc models.ProcessInfo) []byte {
+	b = appendProtoInt(b, 1, int64(proc.PID))
+	b = appendProtoInt(b, 2, int64(proc.PPID))
+	b = appendProtoString(b, 3, proc.Name)
+	b = appendProtoString(b, 4, proc.Username)
+	b = appendProtoDouble(b, 5, proc.CPUPercent)
+	b = appendProtoFloat(b, 6, proc.MemoryUsage)
+	b = appendProtoInt(b, 7, int64(proc.NumFDs))
+	b = appendProtoInt(b, 8, int64(proc.NumThreads))
+	b = appendProtoString(b, 9, proc.Status)
+	b = appendProtoInt(b, 10, proc.VoluntaryCtxSwitches)
+	return appendProtoInt(b, 11, proc.InvoluntaryCtxSwitches)
+}
+
+func appendProtoTag(b []byte, field int, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+// appendProtoInt encodes an int32 or int64 field; negative values take ten bytes as in proto3
+func appendProtoInt(b []byte, field int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.AppendUvarint(appendProtoTag(b, field, wireVarint), uint64(v))
+}
+
+func appendProtoUint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.AppendUvarint(appendProtoTag(b, field, wireVarint), v)
+}
+
+func appendProtoDouble(b []byte, field int, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.LittleEndian.AppendUint64(appendProtoTag(b, field, wireFixed64), math.Float64bits(v))
+}
+
+func appendProtoFloat(b []byte, field int, v float32) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.LittleEndian.AppendUint32(appendProtoTag(b, field, wireFixed32), math.Float32bits(v))
+}
+
+func appendProtoFixed64(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.LittleEndian.AppendUint64(appendProtoTag(b, field, wireFixed64), v)
+}
+
+func appendProtoBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return append(appendProtoTag(b, field, wireVarint), 1)
+}
+
+func boolByte(v bool) byte {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func appendProtoString(b []byte, field int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = binary.AppendUvarint(appendProtoTag(b, field, wireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+// appendProtoStringMap encodes a map<string, string> field as its entries,
+// sorted by key
+func appendProtoStringMap(b []byte, field int, m map[string]string) []byte {
+	for _, key := range sortedKeys(m) {
+		entry := appendProtoString(nil, 1, key)
+		b = appendProtoMessage(b, field, appendProtoString(entry, 2, m[key]))
+	}
+	return b
+}
+
+// sortedKeys returns the keys of m in order, so that maps encode the same
+// way every time
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendProtoMessage encodes an embedded message. Unlike scalars it is written
+// even when empty, so repeated entries keep their position.
+func appendProtoMessage(b []byte, field int, msg []byte) []byte {
+	b = binary.AppendUvarint(appendProtoTag(b, field, wireBytes), uint64(len(msg)))
+	return append(b, msg...)
+}
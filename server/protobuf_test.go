@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// encodingStats returns stats setting every field, with values needing the
+// larger encodings
+func encodingStats() *models.SystemStats {
+	ofLimit := 96.0
+	return &models.SystemStats{
+		CPUUsage:   45.2,
+		MemUsage:   60.5,
+		DiskUsage:  75,
+		NetTraffic: 1 << 40,
+		MemUsed:    8589934592,
+		DiskUsed:   107374182400,
+		Filesystems: []models.Filesystem{
+			{Mountpoint: "/", Device: "/dev/nvme0n1p2", Fstype: "ext4", Total: 536870912000, Used: 402653184000, UsedPercent: 75},
+			{Mountpoint: "/mnt/nfs", Fstype: "nfs4", Network: true, Stale: true},
+		},
+		Processes: []models.ProcessInfo{
+			{PID: 1234, PPID: 1, Name: "chrome", Username: "user", CPUPercent: 5.5, MemoryUsage: 256.5, NumFDs: 64, NumThreads: 24, Status: "sleep", VoluntaryCtxSwitches: 15000, InvoluntaryCtxSwitches: 320},
+			{PID: 2, Name: "kthreadd", Status: "idle", VoluntaryCtxSwitches: -1},
+		},
+		ProcessCount: 312,
+		Zombies:      2,
+		Extra: map[string]interface{}{
+			"gpu":     map[string]interface{}{"usage": 12.5, "name": "A100", "ecc": true, "temps": []interface{}{41, 43.5}},
+			"queue":   -3,
+			"missing": nil,
+			"empty":   "",
+		},
+		Errors: map[string]string{"disk": "permission denied"},
+		Labels: map[string]string{"env": "prod", "role": "web"},
+		Rates:  &models.Rates{MemGrowth: 1048576, DiskFill: -52428800},
+		Runtime: &models.RuntimeInfo{
+			Container:     true,
+			Engine:        "kubernetes",
+			CgroupVersion: 2,
+			CgroupPath:    "/",
+			CPU:           &models.ContainerResource{Limit: 0.5, Used: 0.48, OfLimit: &ofLimit, OfHost: 2, HostUsage: 35.5},
+			Memory:        &models.ContainerResource{Used: 1 << 30, OfHost: 12.5, HostUsage: 60.5},
+		},
+	}
+}
+
+// compileStatsProto compiles proto/stats.proto and returns its message name
+func compileStatsProto(t *testing.T, name string) protoreflect.MessageDescriptor {
+	t.Helper()
+	source, err := os.ReadFile("../proto/stats.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compileProto(t, string(source), name)
+}
+
+// assertProtoMatchesJSON decodes the protobuf encoding b and compares it with
+// the JSON encoding of v decoded by the same schema, which follows the JSON
+// field names
+func assertProtoMatchesJSON(t *testing.T, name string, b []byte, v interface{}) {
+	t.Helper()
+	md := compileStatsProto(t, name)
+	got := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(b, got); err != nil {
+		t.Fatalf("decoding %s: %v", name, err)
+	}
+	if unknown := got.GetUnknown(); len(unknown) > 0 {
+		t.Errorf("%s has unknown fields % x", name, unknown)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal(data, want); err != nil {
+		t.Fatalf("decoding the JSON encoding %s: %v", data, err)
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("got %s\n%s\nwant\n%s", name, protojson.Format(got), protojson.Format(want))
+	}
+}
+
+func TestMarshalStatsProto(t *testing.T) {
+	zeroLimit := 0.0
+	tests := []struct {
+		name  string
+		stats *models.SystemStats
+	}{
+		{"every field", encodingStats()},
+		{"zero", &models.SystemStats{}},
+		{"negative", &models.SystemStats{NetTraffic: -1, Rates: &models.Rates{DiskFill: -1}, Processes: []models.ProcessInfo{{PID: -1, MemoryUsage: -0.5}}}},
+		// of_limit is optional, so 0 is distinct from unset
+		{"zero of limit", &models.SystemStats{Runtime: &models.RuntimeInfo{CPU: &models.ContainerResource{OfLimit: &zeroLimit}, Memory: &models.ContainerResource{}}}},
+		{"empty rates", &models.SystemStats{Rates: &models.Rates{}, Runtime: &models.RuntimeInfo{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertProtoMatchesJSON(t, "SystemStats", marshalStatsProto(tt.stats), tt.stats)
+		})
+	}
+}
+
+func TestMarshalSamplesProto(t *testing.T) {
+	samples := []models.Sample{
+		{Seq: 1, Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Stats: encodingStats()},
+		{Seq: 1 << 40, Timestamp: time.Date(2024, 5, 1, 12, 0, 1, 500, time.UTC), Stats: &models.SystemStats{CPUUsage: 1}},
+		// before 1970 the seconds are negative
+		{Seq: 3, Timestamp: time.Date(1969, 12, 31, 23, 59, 59, 250000000, time.UTC)},
+	}
+	assertProtoMatchesJSON(t, "SampleList", marshalSamplesProto(samples), map[string]interface{}{"samples": samples})
+	assertProtoMatchesJSON(t, "SampleList", marshalSamplesProto(nil), map[string]interface{}{})
+}
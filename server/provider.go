@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// StatsProvider supplies the statistics the server serves. The server uses
+// the registered collectors unless another provider is injected with
+// WithStatsProvider.
+type StatsProvider interface {
+	// Collect fetches the subsystems in topics, leaving the others zero
+	Collect(ctx context.Context, topics collector.TopicSet) (*models.SystemStats, error)
+	// Processes fetches the slim process list
+	Processes(ctx context.Context) ([]models.ProcessInfo, error)
+}
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithStatsProvider replaces the collectors as the source of the statistics
+func WithStatsProvider(provider StatsProvider) Option {
+	return func(s *Server) {
+		s.stats = provider
+	}
+}
+
+// collectorProvider collects from the registered collectors
+type collectorProvider struct{}
+
+func (collectorProvider) Collect(ctx context.Context, topics collector.TopicSet) (*models.SystemStats, error) {
+	return collector.Collect(ctx, topics)
+}
+
+func (collectorProvider) Processes(ctx context.Context) ([]models.ProcessInfo, error) {
+	return collector.Processes(ctx)
+}
+
+// labelProvider attaches the configured host labels to the stats collected
+// by another provider
+type labelProvider struct {
+	StatsProvider
+	labels map[string]string
+}
+
+func (p labelProvider) Collect(ctx context.Context, topics collector.TopicSet) (*models.SystemStats, error) {
+	stats, err := p.StatsProvider.Collect(ctx, topics)
+	if stats != nil {
+		stats.Labels = p.labels
+	}
+	return stats, err
+}
+
+// FakeStatsProvider serves fixed statistics, so that handlers and the SSE
+// stream can be exercised deterministically. Every collection returns a copy
+// of Stats, or Err when it is set.
+type FakeStatsProvider struct {
+	mu    sync.Mutex
+	stats models.SystemStats
+	err   error
+	calls int
+}
+
+// NewFakeStatsProvider returns a provider serving stats
+func NewFakeStatsProvider(stats models.SystemStats) *FakeStatsProvider {
+	return &FakeStatsProvider{stats: stats}
+}
+
+// Set replaces the served statistics
+func (f *FakeStatsProvider) Set(stats models.SystemStats) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stats = stats
+}
+
+// SetError makes collections fail with err, or succeed again when it is nil
+func (f *FakeStatsProvider) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Calls returns the number of collections so far
+func (f *FakeStatsProvider) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func (f *FakeStatsProvider) Collect(ctx context.Context, topics collector.TopicSet) (*models.SystemStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	stats := f.stats
+	stats.Processes = slices.Clone(f.stats.Processes)
+	if stats.Processes == nil {
+		stats.Processes = []models.ProcessInfo{}
+	}
+	topics.Mask(&stats)
+	return &stats, nil
+}
+
+func (f *FakeStatsProvider) Processes(ctx context.Context) ([]models.ProcessInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	procs := slices.Clone(f.stats.Processes)
+	if procs == nil {
+		procs = []models.ProcessInfo{}
+	}
+	return procs, nil
+}
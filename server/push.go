@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// maxPushBatch bounds the samples sent in one request, keeping the request
+// below the body limit of the aggregator when a full buffer is flushed
+const maxPushBatch = 100
+
+// pushSink pushes the samples of this host to an aggregator. It registers
+// the node before the first push and again whenever the aggregator does not
+// know it, e.g. after the aggregator restarted. Samples are buffered between
+// pushes and while the aggregator is unreachable.
+type pushSink struct {
+	cfg        PushConfig
+	client     *http.Client
+	nodeURL    *url.URL
+	node       string
+	hostname   string
+	top        topProcsQuery
+	registered bool
+
+	buffer      []models.Sample
+	dropping    bool
+	lastPush    time.Time
+	nextAttempt time.Time
+	backoff     time.Duration
+}
+
+// newPushSink creates the sink of an agent named node, trimming the
+// processes it sends to the embedded limit
+func newPushSink(cfg PushConfig, hostname string, embeddedLimit int) (*pushSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid push.url: %w", err)
+	}
+	node := cfg.Node
+	if node == "" {
+		node = hostname
+	}
+	if _, err := parseNodeName(node); err != nil {
+		return nil, fmt.Errorf("invalid push.node: %w", err)
+	}
+
+	return &pushSink{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		nodeURL:  u.JoinPath(apiPrefix, "nodes", node),
+		node:     node,
+		hostname: hostname,
+		top:      topProcsQuery{N: embeddedLimit, SortBy: "cpu"},
+		backoff:  cfg.MinBackoff,
+	}, nil
+}
+
+func (s *pushSink) Name() string {
+	return "push"
+}
+
+// Write buffers the samples and pushes the buffer once the interval has
+// passed. After a failed push the buffer is kept and the next attempt is
+// made with a later write, once the backoff has passed.
+func (s *pushSink) Write(ctx context.Context, samples []models.Sample) error {
+	for _, sample := range samples {
+		stats := *sample.Stats
+		trimProcesses(&stats, s.top)
+		s.buffer = append(s.buffer, models.Sample{Seq: sample.Seq, Timestamp: sample.Timestamp, Stats: &stats})
+	}
+	if over := len(s.buffer) - s.cfg.Buffer; over > 0 {
+		if !s.dropping {
+			slog.Warn("Push buffer full, dropping the oldest samples", "buffer", s.cfg.Buffer)
+			s.dropping = true
+		}
+		s.buffer = s.buffer[over:]
+	}
+
+	now := time.Now()
+	if now.Before(s.nextAttempt) || now.Sub(s.lastPush) < s.cfg.Interval {
+		return nil
+	}
+	if err := s.flush(ctx); err != nil {
+		s.nextAttempt = now.Add(s.backoff)
+		retry := s.backoff
+		s.backoff = min(2*s.backoff, s.cfg.MaxBackoff)
+		return fmt.Errorf("keeping %d samples, retrying in %s: %w", len(s.buffer), retry, err)
+	}
+	s.lastPush = now
+	s.nextAttempt = time.Time{}
+	s.backoff = s.cfg.MinBackoff
+	s.dropping = false
+	return nil
+}
+
+// flush pushes the buffer in batches, removing each batch once the
+// aggregator accepted it
+func (s *pushSink) flush(ctx context.Context) error {
+	for len(s.buffer) > 0 {
+		batch := s.buffer[:min(len(s.buffer), maxPushBatch)]
+		if err := s.push(ctx, batch); err != nil {
+			return err
+		}
+		s.buffer = s.buffer[len(batch):]
+	}
+	return nil
+}
+
+// push posts a batch of samples, registering first if needed
+func (s *pushSink) push(ctx context.Context, batch []models.Sample) error {
+	if !s.registered {
+		if err := s.register(ctx); err != nil {
+			return err
+		}
+	}
+	err := s.post(ctx, s.nodeURL.JoinPath("samples"), batch)
+	var statusErr *sinkStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		s.registered = false
+		if err := s.register(ctx); err != nil {
+			return err
+		}
+		err = s.post(ctx, s.nodeURL.JoinPath("samples"), batch)
+	}
+	return err
+}
+
+// register registers the node with the aggregator
+func (s *pushSink) register(ctx context.Context) error {
+	registration := NodeRegistration{Hostname: s.hostname, Version: BuildVersionInfo()}
+	if err := s.post(ctx, s.nodeURL, registration); err != nil {
+		return fmt.Errorf("error registering node: %w", err)
+	}
+	s.registered = true
+	slog.Info("Registered with aggregator", "node", s.node, "url", s.cfg.URL)
+	return nil
+}
+
+// post sends v as JSON to the aggregator
+func (s *pushSink) post(ctx context.Context, u *url.URL, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	}
+	return postSinkRequest(s.client, req)
+}
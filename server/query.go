@@ -0,0 +1,351 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// queryMetric is a headline metric that can be aggregated over the history
+type queryMetric struct {
+	// topic is the subsystem of the metric; samples where it failed to
+	// collect are left out
+	topic string
+	// rate is set for metrics derived from the previous sample, so that the
+	// first sample, which has no rates, is left out
+	rate  bool
+	value func(*models.SystemStats) float64
+}
+
+var queryMetrics = map[string]queryMetric{
+	"cpuUsage":      {collector.TopicCPU, false, func(s *models.SystemStats) float64 { return s.CPUUsage }},
+	"memUsage":      {collector.TopicMem, false, func(s *models.SystemStats) float64 { return s.MemUsage }},
+	"memUsed":       {collector.TopicMem, false, func(s *models.SystemStats) float64 { return float64(s.MemUsed) }},
+	"memGrowth":     {collector.TopicMem, true, func(s *models.SystemStats) float64 { return s.Rates.MemGrowth }},
+	"diskUsage":     {collector.TopicDisk, false, func(s *models.SystemStats) float64 { return s.DiskUsage }},
+	"diskUsed":      {collector.TopicDisk, false, func(s *models.SystemStats) float64 { return float64(s.DiskUsed) }},
+	"diskFill":      {collector.TopicDisk, true, func(s *models.SystemStats) float64 { return s.Rates.DiskFill }},
+	"netTraffic":    {collector.TopicNet, false, func(s *models.SystemStats) float64 { return float64(s.NetTraffic) }},
+	"netThroughput": {collector.TopicNet, true, func(s *models.SystemStats) float64 { return s.Rates.NetThroughput }},
+	"processCount":  {collector.TopicProcesses, false, func(s *models.SystemStats) float64 { return float64(max(s.ProcessCount, len(s.Processes))) }},
+	// The pressure, ZFS, and software RAID metrics are 0 on the hosts
+	// without them. The pressure metrics are the avg10 of some.
+	"cpuPressure": {collector.TopicPressure, false, func(s *models.SystemStats) float64 {
+		if pressure := pressureStats(s); pressure != nil {
+			return pressure.CPU.Some.Avg10
+		}
+		return 0
+	}},
+	"memPressure": {collector.TopicPressure, false, func(s *models.SystemStats) float64 {
+		if pressure := pressureStats(s); pressure != nil {
+			return pressure.Memory.Some.Avg10
+		}
+		return 0
+	}},
+	"ioPressure": {collector.TopicPressure, false, func(s *models.SystemStats) float64 {
+		if pressure := pressureStats(s); pressure != nil {
+			return pressure.IO.Some.Avg10
+		}
+		return 0
+	}},
+	"zfsDegradedPools": {collector.TopicZFS, false, func(s *models.SystemStats) float64 {
+		if zfs := zfsStats(s); zfs != nil {
+			return float64(zfs.Degraded)
+		}
+		return 0
+	}},
+	"zfsArcHitRate": {collector.TopicZFS, false, func(s *models.SystemStats) float64 {
+		if zfs := zfsStats(s); zfs != nil && zfs.ARC != nil {
+			return zfs.ARC.HitRate
+		}
+		return 0
+	}},
+	"mdraidDegradedArrays": {collector.TopicMDRaid, false, func(s *models.SystemStats) float64 {
+		if mdraid := mdraidStats(s); mdraid != nil {
+			return float64(mdraid.Degraded)
+		}
+		return 0
+	}},
+}
+
+// QueryResult represents an aggregate of a metric over a window of the history
+// @Description Aggregate of a metric over the samples of a window of the history
+type QueryResult struct {
+	Metric string `json:"metric" example:"cpuUsage"`
+	Agg    string `json:"agg" example:"p95"`
+	// Window is the requested window, empty for the whole history
+	Window string `json:"window,omitempty" example:"1h0m0s"`
+	// From and To are the timestamps of the oldest and newest samples
+	// aggregated; From is later than the start of the window when the
+	// history does not reach that far back
+	From    *time.Time `json:"from,omitempty" example:"2024-01-01T11:00:00Z"`
+	To      *time.Time `json:"to,omitempty" example:"2024-01-01T12:00:00Z"`
+	Samples int        `json:"samples" example:"1800"`
+	// Value is null when the window holds no samples
+	Value *float64 `json:"value" example:"72.5"`
+}
+
+// aggQuery is a parsed aggregation query
+type aggQuery struct {
+	Metric string
+	Agg    string
+	// Quantile is set for pNN aggregations, between 0 and 1
+	Quantile float64
+	Window   time.Duration
+}
+
+// parseAggQuery parses the metric, agg, and window query parameters
+func parseAggQuery(values url.Values) (aggQuery, error) {
+	query := aggQuery{Metric: values.Get("metric"), Agg: values.Get("agg")}
+	if _, ok := queryMetrics[query.Metric]; !ok {
+		names := make([]string, 0, len(queryMetrics))
+		for name := range queryMetrics {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return query, fmt.Errorf("invalid metric %q: must be one of %s", query.Metric, strings.Join(names, ", "))
+	}
+
+	switch query.Agg {
+	case "":
+		query.Agg = "avg"
+	case "min", "max", "avg", "sum", "count", "last", "stddev":
+	default:
+		p, ok := strings.CutPrefix(query.Agg, "p")
+		percentile, err := strconv.ParseFloat(p, 64)
+		if !ok || err != nil || percentile < 0 || percentile > 100 {
+			return query, fmt.Errorf("invalid agg %q: must be min, max, avg, sum, count, last, stddev, or a percentile such as p95", query.Agg)
+		}
+		query.Quantile = percentile / 100
+	}
+
+	if v := values.Get("window"); v != "" {
+		window, err := time.ParseDuration(v)
+		if err != nil || window <= 0 {
+			return query, fmt.Errorf("invalid window %q: must be a positive duration such as 1h", v)
+		}
+		query.Window = window
+	}
+	return query, nil
+}
+
+// aggregate computes the aggregate of the query over values, which must not
+// be empty. Percentiles interpolate linearly between the closest ranks.
+func (q aggQuery) aggregate(values []float64) float64 {
+	switch q.Agg {
+	case "min":
+		return slices.Min(values)
+	case "max":
+		return slices.Max(values)
+	case "count":
+		return float64(len(values))
+	case "last":
+		return values[len(values)-1]
+	}
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	switch q.Agg {
+	case "sum":
+		return sum
+	case "avg":
+		return mean
+	case "stddev":
+		variance := 0.0
+		for _, v := range values {
+			variance += (v - mean) * (v - mean)
+		}
+		return math.Sqrt(variance / float64(len(values)))
+	}
+
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	rank := q.Quantile * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// run aggregates the metric over the samples, skipping those where its
+// subsystem failed
+func (q aggQuery) run(samples []models.Sample) QueryResult {
+	result := QueryResult{Metric: q.Metric, Agg: q.Agg}
+	if q.Window > 0 {
+		result.Window = q.Window.String()
+	}
+
+	metric := queryMetrics[q.Metric]
+	values := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		if _, failed := sample.Stats.Errors[metric.topic]; failed {
+			continue
+		}
+		if metric.rate && sample.Stats.Rates == nil {
+			continue
+		}
+		values = append(values, metric.value(sample.Stats))
+		if result.From == nil {
+			result.From = &sample.Timestamp
+		}
+		result.To = &sample.Timestamp
+	}
+
+	result.Samples = len(values)
+	if len(values) > 0 {
+		value := q.aggregate(values)
+		result.Value = &value
+	}
+	return result
+}
+
+// queryHandler godoc
+// @Summary Aggregate a metric
+// @Description Computes an aggregate of a headline metric over the samples of the in-memory history taken within the window, so that thresholds and capacity can be assessed without exporting raw samples. Samples where the subsystem of the metric failed to collect are left out. memGrowth and diskFill are in bytes per minute, netThroughput in bytes per second.
+// @Tags stats
+// @Produce json
+// @Param metric query string true "Metric to aggregate" Enums(cpuUsage, memUsage, memUsed, memGrowth, diskUsage, diskUsed, diskFill, netTraffic, netThroughput, processCount, cpuPressure, memPressure, ioPressure, zfsDegradedPools, zfsArcHitRate, mdraidDegradedArrays)
+// @Param agg query string false "Aggregation: min, max, avg, sum, count, last, stddev, or a percentile pNN such as p95 or p99.9 (default avg)"
+// @Param window query string false "Only aggregate the samples taken within this duration before now, e.g. 15m or 1h (default the whole history)"
+// @Success 200 {object} QueryResult
+// @Failure 400 {string} string "Bad Request"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /query [get]
+func (s *Server) queryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := parseAggQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var from time.Time
+	if query.Window > 0 {
+		from = time.Now().Add(-query.Window)
+	}
+	result := query.run(s.history.Range(from, time.Time{}))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
+
+// compareMetrics are the headline metrics of /api/compare
+var compareMetrics = []string{"cpuUsage", "memUsage", "diskUsage", "netThroughput", "processCount"}
+
+// MetricComparison represents a metric now and one window ago
+// @Description A metric averaged over the current span and over the same span one window ago
+type MetricComparison struct {
+	// Current and Previous are null when their span holds no samples
+	Current  *float64 `json:"current" example:"45.2"`
+	Previous *float64 `json:"previous" example:"30.1"`
+	// Delta is Current minus Previous
+	Delta *float64 `json:"delta,omitempty" example:"15.1"`
+	// DeltaPercent is Delta relative to Previous, unset when Previous is 0
+	DeltaPercent *float64 `json:"deltaPercent,omitempty" example:"50.17"`
+}
+
+// Comparison represents the headline metrics now and one window ago
+// @Description Headline metrics averaged over the current span and over the same span one window ago
+type Comparison struct {
+	Window string `json:"window" example:"24h0m0s"`
+	Span   string `json:"span" example:"5m0s"`
+	// Current and Previous are the ends of the compared spans
+	Current  time.Time                   `json:"current" example:"2024-01-02T12:00:00Z"`
+	Previous time.Time                   `json:"previous" example:"2024-01-01T12:00:00Z"`
+	Metrics  map[string]MetricComparison `json:"metrics"`
+}
+
+// compare averages the headline metrics over the span before now and the
+// span before now minus window
+func (s *Server) compare(window, span time.Duration, now time.Time) Comparison {
+	then := now.Add(-window)
+	current := s.history.Range(now.Add(-span), now)
+	previous := s.history.Range(then.Add(-span), then)
+
+	comparison := Comparison{
+		Window:   window.String(),
+		Span:     span.String(),
+		Current:  now.UTC(),
+		Previous: then.UTC(),
+		Metrics:  map[string]MetricComparison{},
+	}
+	for _, metric := range compareMetrics {
+		query := aggQuery{Metric: metric, Agg: "avg"}
+		m := MetricComparison{
+			Current:  query.run(current).Value,
+			Previous: query.run(previous).Value,
+		}
+		if m.Current != nil && m.Previous != nil {
+			delta := *m.Current - *m.Previous
+			m.Delta = &delta
+			if *m.Previous != 0 {
+				percent := delta / math.Abs(*m.Previous) * 100
+				m.DeltaPercent = &percent
+			}
+		}
+		comparison.Metrics[metric] = m
+	}
+	return comparison
+}
+
+// compareHandler godoc
+// @Summary Compare now with the past
+// @Description Returns the headline metrics averaged over the last span alongside the same metrics averaged over the span ending one window ago, with their deltas, to tell at a glance whether the current values are usual. A previous value is null when the in-memory history does not reach back that far; raise history.size to compare over longer windows.
+// @Tags stats
+// @Produce json
+// @Param window query string false "How far back to compare, e.g. 1h, 24h, or 168h (default 24h)"
+// @Param span query string false "Duration averaged at both ends, at most the window (default 5m)"
+// @Success 200 {object} Comparison
+// @Failure 400 {string} string "Bad Request"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /compare [get]
+func (s *Server) compareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window, span := 24*time.Hour, 5*time.Minute
+	for _, param := range []struct {
+		name string
+		dst  *time.Duration
+	}{{"window", &window}, {"span", &span}} {
+		v := r.URL.Query().Get(param.name)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid %s %q: must be a positive duration such as 1h", param.name, v), http.StatusBadRequest)
+			return
+		}
+		*param.dst = d
+	}
+	if span > window {
+		http.Error(w, fmt.Sprintf("invalid span %s: must not exceed the window %s", span, window), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.compare(window, span, time.Now())); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
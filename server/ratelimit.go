@@ -0,0 +1,150 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxBuckets caps the clients tracked at once; when it is reached the least
+// recently seen client is forgotten
+const maxBuckets = 10000
+
+// bucket is the token bucket of a single client
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+	// elem is the element of the bucket in rateLimiter.recent
+	elem *list.Element
+}
+
+// rateLimiter keeps a token bucket per client key
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	// recent orders the buckets from the most to the least recently seen
+	recent *list.List
+}
+
+// newRateLimiter creates a limiter refilling rate tokens per second up to burst
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: map[string]*bucket{},
+		recent:  list.New(),
+	}
+}
+
+// Allow takes a token from the client's bucket. When the bucket is empty it
+// returns false and how long until the next token is available.
+func (l *rateLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if ok {
+		l.recent.MoveToFront(b.elem)
+	} else {
+		if len(l.buckets) >= maxBuckets {
+			l.evict(l.recent.Back().Value.(*bucket))
+		}
+		b = &bucket{key: key, tokens: l.burst, last: now}
+		b.elem = l.recent.PushFront(b)
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// evict forgets a client. The caller holds l.mu.
+func (l *rateLimiter) evict(b *bucket) {
+	l.recent.Remove(b.elem)
+	delete(l.buckets, b.key)
+}
+
+// cleanup forgets clients whose bucket has been full for a while, starting
+// from the least recently seen
+func (l *rateLimiter) cleanup(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	idle := time.Duration(l.burst/l.rate*float64(time.Second)) + time.Minute
+	for elem := l.recent.Back(); elem != nil; elem = l.recent.Back() {
+		b := elem.Value.(*bucket)
+		if now.Sub(b.last) <= idle {
+			return
+		}
+		l.evict(b)
+	}
+}
+
+// run periodically evicts idle buckets until ctx is cancelled
+func (l *rateLimiter) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.cleanup(now)
+		}
+	}
+}
+
+// clientKey identifies the client of a request: the principal of valid
+// credentials, otherwise the client IP resolved through the trusted proxies.
+// Unverified credentials are ignored, so sending a different Authorization
+// header with every request does not get a fresh bucket.
+func (s *Server) clientKey(r *http.Request) string {
+	if role, name := s.credentials(r); role != "" {
+		return "principal:" + role + ":" + name
+	}
+	return s.ipKey(r)
+}
+
+// ipKey identifies the client of a request by its IP address, resolved
+// through the trusted proxies
+func (s *Server) ipKey(r *http.Request) string {
+	if addr := s.access.clientIP(r); addr.IsValid() {
+		return "ip:" + addr.String()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimitMiddleware wraps an http.HandlerFunc and rejects clients that exceed the rate limit
+func (s *Server) rateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	if s.limiter == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := s.limiter.Allow(s.clientKey(r), time.Now())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next(w, r)
+	}
+}
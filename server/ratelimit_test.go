@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	start := time.Unix(0, 0)
+	tests := []struct {
+		name     string
+		rate     float64
+		burst    int
+		requests []time.Duration
+		want     []bool
+	}{
+		{"burst", 1, 3, []time.Duration{0, 0, 0, 0}, []bool{true, true, true, false}},
+		{"refill", 1, 1, []time.Duration{0, 0, time.Second}, []bool{true, false, true}},
+		{"partial refill", 2, 1, []time.Duration{0, 0, 250 * time.Millisecond, 500 * time.Millisecond}, []bool{true, false, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(tt.rate, tt.burst)
+			for i, offset := range tt.requests {
+				ok, wait := l.Allow("client", start.Add(offset))
+				if ok != tt.want[i] {
+					t.Fatalf("request %d: Allow() = %v, want %v", i, ok, tt.want[i])
+				}
+				if !ok && wait <= 0 {
+					t.Errorf("request %d: wait = %v, want positive", i, wait)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterBounded(t *testing.T) {
+	l := newRateLimiter(1, 1)
+	start := time.Unix(0, 0)
+	for i := 0; i < maxBuckets; i++ {
+		l.Allow(fmt.Sprintf("client-%d", i), start.Add(time.Duration(i)))
+	}
+	// Seeing client-0 again makes client-1 the least recently seen
+	l.Allow("client-0", start.Add(maxBuckets))
+	for i := maxBuckets; i < maxBuckets+10; i++ {
+		l.Allow(fmt.Sprintf("client-%d", i), start.Add(time.Duration(i+1)))
+	}
+	if len(l.buckets) != maxBuckets || l.recent.Len() != maxBuckets {
+		t.Errorf("buckets = %d, recent = %d, want %d", len(l.buckets), l.recent.Len(), maxBuckets)
+	}
+	if _, ok := l.buckets["client-0"]; !ok {
+		t.Error("the recently seen client-0 was evicted")
+	}
+	for i := 1; i <= 10; i++ {
+		if _, ok := l.buckets[fmt.Sprintf("client-%d", i)]; ok {
+			t.Errorf("the least recently seen client-%d was not evicted", i)
+		}
+	}
+
+	l.cleanup(start.Add(time.Hour))
+	if len(l.buckets) != 0 || l.recent.Len() != 0 {
+		t.Errorf("buckets after cleanup = %d, recent = %d, want 0", len(l.buckets), l.recent.Len())
+	}
+}
+
+func TestRateLimiterCleanup(t *testing.T) {
+	// Buckets refill in 2s, so they are idle after 1m2s
+	l := newRateLimiter(1, 2)
+	start := time.Unix(0, 0)
+	l.Allow("a", start)
+	l.Allow("b", start.Add(10*time.Second))
+	l.Allow("c", start.Add(20*time.Second))
+	l.Allow("a", start.Add(30*time.Second))
+
+	l.cleanup(start.Add(time.Minute + 15*time.Second))
+	if _, ok := l.buckets["b"]; ok || len(l.buckets) != 2 || l.recent.Len() != 2 {
+		t.Errorf("after the first cleanup: buckets %v, recent %d, want a and c", l.buckets, l.recent.Len())
+	}
+	l.cleanup(start.Add(time.Minute + 25*time.Second))
+	if _, ok := l.buckets["a"]; !ok || len(l.buckets) != 1 {
+		t.Errorf("after the second cleanup: buckets %v, want a", l.buckets)
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Admin.Token = "admin-secret"
+	cfg.Auth.Tokens = []APIToken{{Name: "grafana", Token: "viewer-secret", Role: "viewer"}}
+	access, err := newIPAccess(AccessConfig{TrustedProxies: []string{"10.0.0.1"}, ClientIPHeader: "X-Forwarded-For"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{config: cfg, access: access}
+
+	tests := []struct {
+		name          string
+		remote        string
+		authorization string
+		forwarded     string
+		want          string
+	}{
+		{"anonymous", "192.0.2.1:1234", "", "", "ip:192.0.2.1"},
+		{"admin token", "192.0.2.1:1234", "Bearer admin-secret", "", "principal:admin:admin"},
+		{"api token", "192.0.2.1:1234", "Bearer viewer-secret", "", "principal:viewer:grafana"},
+		{"invalid token", "192.0.2.1:1234", "Bearer guess-1", "", "ip:192.0.2.1"},
+		{"other invalid token", "192.0.2.1:4321", "Bearer guess-2", "", "ip:192.0.2.1"},
+		{"trusted proxy", "10.0.0.1:1234", "", "198.51.100.7", "ip:198.51.100.7"},
+		{"untrusted proxy", "192.0.2.1:1234", "", "198.51.100.7", "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/stats", nil)
+			r.RemoteAddr = tt.remote
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := s.clientKey(r); got != tt.want {
+				t.Errorf("clientKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
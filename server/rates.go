@@ -0,0 +1,40 @@
+package server
+
+import (
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// deriveRates computes the rates of change from prev, taken at prevAt, to
+// stats, taken at now. A rate is left 0 when its subsystem failed in either
+// sample. A network counter lower than before was reset, e.g. by an
+// interface going down, so the traffic since the reset is all that counts.
+func deriveRates(prev *models.SystemStats, prevAt time.Time, stats *models.SystemStats, now time.Time) *models.Rates {
+	elapsed := now.Sub(prevAt)
+	if elapsed <= 0 {
+		return nil
+	}
+	collected := func(topic string) bool {
+		_, failedBefore := prev.Errors[topic]
+		_, failedNow := stats.Errors[topic]
+		return !failedBefore && !failedNow
+	}
+
+	rates := &models.Rates{}
+	if collected(collector.TopicMem) && prev.MemUsed > 0 && stats.MemUsed > 0 {
+		rates.MemGrowth = (float64(stats.MemUsed) - float64(prev.MemUsed)) / elapsed.Minutes()
+	}
+	if collected(collector.TopicDisk) && prev.DiskUsed > 0 && stats.DiskUsed > 0 {
+		rates.DiskFill = (float64(stats.DiskUsed) - float64(prev.DiskUsed)) / elapsed.Minutes()
+	}
+	if collected(collector.TopicNet) {
+		traffic := stats.NetTraffic - prev.NetTraffic
+		if traffic < 0 {
+			traffic = stats.NetTraffic
+		}
+		rates.NetThroughput = float64(traffic) / elapsed.Seconds()
+	}
+	return rates
+}
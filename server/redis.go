@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// redisSink publishes every sample to a Redis channel and keeps the latest
+// one under a key expiring after the TTL, over a persistent connection. The
+// commands of a write are pipelined. The connection is re-established on the
+// next write after an error.
+type redisSink struct {
+	cfg       RedisConfig
+	address   string
+	tlsConfig *tls.Config
+	username  string
+	password  string
+	db        int
+	channel   string
+	key       string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// newRedisSink creates a Redis sink from a redis:// or rediss:// URL, whose
+// user info authenticates and whose path selects the database. The {host}
+// placeholder of the channel and key templates is replaced once.
+func newRedisSink(cfg RedisConfig, hostname string) (*redisSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sinks.redis.url: %w", err)
+	}
+
+	s := &redisSink{
+		cfg:     cfg,
+		address: u.Host,
+		channel: strings.ReplaceAll(cfg.Channel, "{host}", hostname),
+		key:     strings.ReplaceAll(cfg.Key, "{host}", hostname),
+	}
+	if u.Port() == "" {
+		s.address = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		s.username = u.User.Username()
+		s.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil || s.db < 0 {
+			return nil, fmt.Errorf("invalid sinks.redis.url: database %q is not a number", db)
+		}
+	}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		if s.tlsConfig, err = clientTLSConfig(cfg.TLS, u.Hostname(), "sinks.redis.tls"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid sinks.redis.url: unsupported scheme %q (want redis or rediss)", u.Scheme)
+	}
+	return s, nil
+}
+
+func (s *redisSink) Name() string {
+	return "redis"
+}
+
+// Write publishes the samples, as {"seq":..,"timestamp":..,"stats":{..}},
+// and stores the newest one
+func (s *redisSink) Write(ctx context.Context, samples []models.Sample) error {
+	var cmds [][]string
+	var payload []byte
+	for _, sample := range samples {
+		stats := *sample.Stats
+		if s.cfg.Processes > 0 {
+			trimProcesses(&stats, topProcsQuery{N: s.cfg.Processes, SortBy: "cpu"})
+		} else {
+			stats.ProcessCount = len(stats.Processes)
+			stats.Processes = []models.ProcessInfo{}
+		}
+		var err error
+		payload, err = json.Marshal(models.Sample{Seq: sample.Seq, Timestamp: sample.Timestamp, Stats: &stats})
+		if err != nil {
+			return err
+		}
+		if s.channel != "" {
+			cmds = append(cmds, []string{"PUBLISH", s.channel, string(payload)})
+		}
+	}
+	if s.key != "" {
+		cmds = append(cmds, []string{"SET", s.key, string(payload), "PX", strconv.FormatInt(s.cfg.TTL.Milliseconds(), 10)})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+	err := s.do(cmds)
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// connect dials the server, then authenticates and selects the database
+func (s *redisSink) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: s.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return err
+	}
+	if s.tlsConfig != nil {
+		tlsConn := tls.Client(conn, s.tlsConfig)
+		tlsConn.SetDeadline(time.Now().Add(s.cfg.Timeout))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return err
+		}
+		conn = tlsConn
+	}
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+
+	var cmds [][]string
+	switch {
+	case s.username != "":
+		cmds = append(cmds, []string{"AUTH", s.username, s.password})
+	case s.password != "":
+		cmds = append(cmds, []string{"AUTH", s.password})
+	}
+	if s.db != 0 {
+		cmds = append(cmds, []string{"SELECT", strconv.Itoa(s.db)})
+	}
+	if err := s.do(cmds); err != nil {
+		conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// do sends the commands in one pipeline and reads their replies, returning
+// the first error reply
+func (s *redisSink) do(cmds [][]string) error {
+	if len(cmds) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	for _, cmd := range cmds {
+		fmt.Fprintf(&b, "*%d\r\n", len(cmd))
+		for _, arg := range cmd {
+			fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	s.conn.SetDeadline(time.Now().Add(s.cfg.Timeout))
+	if _, err := s.conn.Write([]byte(b.String())); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, cmd := range cmds {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "-"):
+			errs = append(errs, fmt.Errorf("redis %s: %s", cmd[0], line[1:]))
+		case strings.HasPrefix(line, "+"), strings.HasPrefix(line, ":"):
+		default:
+			// PUBLISH, SET, AUTH, and SELECT only answer with simple
+			// strings, integers, or errors
+			return fmt.Errorf("unexpected redis reply %q to %s", line, cmd[0])
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// remoteWriteSink pushes samples to a Prometheus remote_write endpoint (e.g.
+// Mimir, Thanos receive, VictoriaMetrics) for hosts that cannot be scraped
+type remoteWriteSink struct {
+	cfg    RemoteWriteConfig
+	client *http.Client
+	labels []promLabel
+}
+
+// promLabel is a Prometheus label pair
+type promLabel struct {
+	name, value string
+}
+
+// remoteWriteSeries describes how one series is derived from a sample
+var remoteWriteSeries = []struct {
+	name   string
+	labels []promLabel
+	value  func(*models.SystemStats) float64
+}{
+	{"system_cpu_usage_percent", nil, func(s *models.SystemStats) float64 { return s.CPUUsage }},
+	{"system_memory_usage_percent", nil, func(s *models.SystemStats) float64 { return s.MemUsage }},
+	{"system_disk_usage_percent", []promLabel{{"mountpoint", "/"}}, func(s *models.SystemStats) float64 { return s.DiskUsage }},
+	{"system_network_traffic_bytes_total", nil, func(s *models.SystemStats) float64 { return float64(s.NetTraffic) }},
+	{"system_processes", nil, func(s *models.SystemStats) float64 { return float64(len(s.Processes)) }},
+}
+
+// newRemoteWriteSink creates a remote_write sink labelling every series with
+// the hostname, the host labels, and the configured external labels, which
+// take precedence over the host labels
+func newRemoteWriteSink(cfg RemoteWriteConfig, hostname string, hostLabels map[string]string) *remoteWriteSink {
+	external := make(map[string]string, len(hostLabels)+len(cfg.ExternalLabels))
+	for name, value := range hostLabels {
+		external[name] = value
+	}
+	for name, value := range cfg.ExternalLabels {
+		external[name] = value
+	}
+	labels := []promLabel{{"host", hostname}}
+	for name, value := range external {
+		if name != "host" {
+			labels = append(labels, promLabel{name, value})
+		}
+	}
+
+	return &remoteWriteSink{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		labels: labels,
+	}
+}
+
+func (s *remoteWriteSink) Name() string {
+	return "remote_write"
+}
+
+// Write sends the samples in batches of at most batchSize, retrying each
+// batch with exponential backoff on network errors, 5xx, and 429 responses
+func (s *remoteWriteSink) Write(ctx context.Context, samples []models.Sample) error {
+	for len(samples) > 0 {
+		n := min(len(samples), s.cfg.BatchSize)
+		body := snappyEncode(s.writeRequest(samples[:n]))
+		if err := s.send(ctx, body); err != nil {
+			return err
+		}
+		samples = samples[n:]
+	}
+	return nil
+}
+
+func (s *remoteWriteSink) send(ctx context.Context, body []byte) error {
+	backoff := s.cfg.MinBackoff
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+		req.Header.Set("User-Agent", "system-stats-backend")
+		if s.cfg.BearerToken != "" {
+			req.Header.Set("Authorization", "Bearer "+s.cfg.BearerToken)
+		} else if s.cfg.Username != "" {
+			req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+		}
+		for key, value := range s.cfg.Headers {
+			req.Header.Set(key, value)
+		}
+
+		err = postSinkRequest(s.client, req)
+		var statusErr *sinkStatusError
+		retryable := err != nil && (!errors.As(err, &statusErr) ||
+			statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests)
+		if !retryable || attempt >= s.cfg.MaxRetries {
+			if err != nil && attempt > 0 {
+				return fmt.Errorf("giving up after %d attempts: %w", attempt+1, err)
+			}
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, s.cfg.MaxBackoff)
+	}
+}
+
+// writeRequest encodes a prometheus.WriteRequest holding one time series per
+// metric, each with one sample per collected sample
+func (s *remoteWriteSink) writeRequest(samples []models.Sample) []byte {
+	var b []byte
+	for _, series := range remoteWriteSeries {
+		labels := append([]promLabel{{"__name__", series.name}}, series.labels...)
+		labels = append(labels, s.labels...)
+		sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+		var ts []byte
+		for _, label := range labels {
+			var l []byte
+			l = appendProtoString(l, 1, label.name)
+			l = appendProtoString(l, 2, label.value)
+			ts = appendProtoMessage(ts, 1, l)
+		}
+		for _, sample := range samples {
+			var p []byte
+			p = appendProtoDouble(p, 1, series.value(sample.Stats))
+			p = appendProtoInt(p, 2, sample.Timestamp.UnixMilli())
+			ts = appendProtoMessage(ts, 2, p)
+		}
+		b = appendProtoMessage(b, 1, ts)
+	}
+	return b
+}
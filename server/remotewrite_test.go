@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// remoteWriteProto holds the messages of prometheus/prompb that remote write
+// requests are made of
+const remoteWriteProto = `
+syntax = "proto3";
+package prometheus;
+
+message WriteRequest {
+  repeated TimeSeries timeseries = 1;
+}
+message TimeSeries {
+  repeated Label labels = 1;
+  repeated Sample samples = 2;
+}
+message Label {
+  string name = 1;
+  string value = 2;
+}
+message Sample {
+  double value = 1;
+  int64 timestamp = 2;
+}
+`
+
+// compileProto compiles a .proto file and returns its message named name
+func compileProto(t *testing.T, source, name string) protoreflect.MessageDescriptor {
+	t.Helper()
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{"test.proto": source}),
+		}),
+	}
+	files, err := compiler.Compile(context.Background(), "test.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := files[0].Messages().ByName(protoreflect.Name(name))
+	if md == nil {
+		t.Fatalf("no message %s", name)
+	}
+	return md
+}
+
+// assertProtoJSON decodes b as a message of md and compares it with the
+// message in protobuf JSON
+func assertProtoJSON(t *testing.T, md protoreflect.MessageDescriptor, b []byte, want string) {
+	t.Helper()
+	got := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(b, got); err != nil {
+		t.Fatalf("decoding %s: %v", md.Name(), err)
+	}
+	if unknown := got.GetUnknown(); len(unknown) > 0 {
+		t.Errorf("%s has unknown fields % x", md.Name(), unknown)
+	}
+	wantMsg := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal([]byte(want), wantMsg); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, wantMsg) {
+		t.Errorf("got %s\n%s\nwant\n%s", md.Name(), protojson.Format(got), protojson.Format(wantMsg))
+	}
+}
+
+func remoteWriteSamples() []models.Sample {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return []models.Sample{
+		{Seq: 1, Timestamp: start, Stats: &models.SystemStats{CPUUsage: 12.5, MemUsage: 50, DiskUsage: 75, NetTraffic: 1024, Processes: make([]models.ProcessInfo, 3)}},
+		{Seq: 2, Timestamp: start.Add(15 * time.Second), Stats: &models.SystemStats{MemUsage: 50.5, DiskUsage: 75, NetTraffic: 2048}},
+	}
+}
+
+func TestRemoteWriteRequest(t *testing.T) {
+	var requests []*http.Request
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	cfg := RemoteWriteConfig{URL: srv.URL, BearerToken: "secret", ExternalLabels: map[string]string{"region": "eu", "env": "staging", "host": "ignored"}, BatchSize: 10, Timeout: 5 * time.Second}
+	s := newRemoteWriteSink(cfg, "web-01", map[string]string{"env": "prod"})
+	if err := s.Write(context.Background(), remoteWriteSamples()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	r := requests[0]
+	if r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("Content-Encoding") != "snappy" ||
+		r.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" || r.Header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("got headers %v", r.Header)
+	}
+	body, err := snappy.Decode(nil, bodies[0])
+	if err != nil {
+		t.Fatalf("decoding the body: %v", err)
+	}
+
+	labels := func(name string, extra ...string) string {
+		l := []string{`{"name": "__name__", "value": "` + name + `"}`, `{"name": "env", "value": "staging"}`, `{"name": "host", "value": "web-01"}`}
+		l = append(l, extra...)
+		return strings.Join(append(l, `{"name": "region", "value": "eu"}`), ", ")
+	}
+	want := `{"timeseries": [
+		{"labels": [` + labels("system_cpu_usage_percent") + `], "samples": [{"value": 12.5, "timestamp": "1714564800000"}, {"value": 0, "timestamp": "1714564815000"}]},
+		{"labels": [` + labels("system_memory_usage_percent") + `], "samples": [{"value": 50, "timestamp": "1714564800000"}, {"value": 50.5, "timestamp": "1714564815000"}]},
+		{"labels": [` + labels("system_disk_usage_percent", `{"name": "mountpoint", "value": "/"}`) + `], "samples": [{"value": 75, "timestamp": "1714564800000"}, {"value": 75, "timestamp": "1714564815000"}]},
+		{"labels": [` + labels("system_network_traffic_bytes_total") + `], "samples": [{"value": 1024, "timestamp": "1714564800000"}, {"value": 2048, "timestamp": "1714564815000"}]},
+		{"labels": [` + labels("system_processes") + `], "samples": [{"value": 3, "timestamp": "1714564800000"}, {"value": 0, "timestamp": "1714564815000"}]}
+	]}`
+	assertProtoJSON(t, compileProto(t, remoteWriteProto, "WriteRequest"), body, want)
+}
+
+func TestRemoteWriteRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		batchSize    int
+		wantRequests int
+		wantErr      string
+	}{
+		{"batches", []int{204, 204}, 1, 2, ""},
+		{"retried", []int{503, 429, 204}, 10, 3, ""},
+		{"gives up", []int{500, 500, 500, 500}, 10, 4, "giving up after 4 attempts"},
+		{"not retried", []int{400, 204}, 10, 1, "400 Bad Request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(io.Discard, r.Body)
+				w.WriteHeader(tt.statuses[min(requests, len(tt.statuses)-1)])
+				requests++
+			}))
+			defer srv.Close()
+
+			cfg := RemoteWriteConfig{URL: srv.URL, BatchSize: tt.batchSize, MaxRetries: 3, MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, Timeout: 5 * time.Second}
+			err := newRemoteWriteSink(cfg, "web-01", nil).Write(context.Background(), remoteWriteSamples())
+			if requests != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", requests, tt.wantRequests)
+			}
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Write() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
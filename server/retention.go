@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// janitor enforces the retention of the history, the snapshots, the watch
+// points, the alert history, and the audit log, which are otherwise only
+// bounded by their sizes
+type janitor struct {
+	cfg       RetentionConfig
+	history   *history
+	snapshots *snapshotter
+	watcher   *watcher
+	alerts    *alertEngine
+	audit     *auditLog
+}
+
+// expire drops or strips the data older than its retention
+func (j *janitor) expire(now time.Time) {
+	statsBefore := cutoff(now, j.cfg.Stats)
+	processesBefore := cutoff(now, j.cfg.Processes)
+	connectionsBefore := cutoff(now, j.cfg.Connections)
+
+	samplesDropped, samplesStripped := j.history.Expire(statsBefore, processesBefore)
+	snapshotsDropped, snapshotsStripped := j.snapshots.Expire(statsBefore, processesBefore, connectionsBefore)
+	pointsDropped := 0
+	if !processesBefore.IsZero() {
+		pointsDropped = j.watcher.Expire(processesBefore)
+	}
+	alertsDropped := 0
+	if alertsBefore := cutoff(now, j.cfg.Alerts); !alertsBefore.IsZero() {
+		alertsDropped = j.alerts.Expire(alertsBefore)
+	}
+	auditDropped := 0
+	if auditBefore := cutoff(now, j.cfg.Audit); !auditBefore.IsZero() {
+		auditDropped = j.audit.Expire(auditBefore)
+	}
+
+	if samplesDropped+samplesStripped+snapshotsDropped+snapshotsStripped+pointsDropped+alertsDropped+auditDropped > 0 {
+		slog.Debug("Expired data past its retention",
+			"samplesDropped", samplesDropped, "samplesStripped", samplesStripped,
+			"snapshotsDropped", snapshotsDropped, "snapshotsStripped", snapshotsStripped,
+			"watchPointsDropped", pointsDropped, "alertsDropped", alertsDropped, "auditDropped", auditDropped)
+	}
+}
+
+// run expires data every interval until ctx is cancelled
+func (j *janitor) run(ctx context.Context) {
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			j.expire(now.UTC())
+		}
+	}
+}
+
+// cutoff returns the time before which data older than retention expires,
+// or the zero time when retention is 0
+func cutoff(now time.Time, retention time.Duration) time.Time {
+	if retention == 0 {
+		return time.Time{}
+	}
+	return now.Add(-retention)
+}
+
+// withoutProcesses returns a copy of stats without the process list, keeping
+// the process count. Stored stats are shared, so they are never modified.
+func withoutProcesses(stats *models.SystemStats) *models.SystemStats {
+	stripped := *stats
+	stripped.ProcessCount = max(stats.ProcessCount, len(stats.Processes))
+	stripped.Processes = []models.ProcessInfo{}
+	return &stripped
+}
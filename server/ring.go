@@ -0,0 +1,72 @@
+package server
+
+// ring is a fixed-capacity buffer that keeps the most recently pushed items
+type ring[T any] struct {
+	items []T
+	start int
+	size  int
+}
+
+// newRing creates a ring buffer holding at most capacity items
+func newRing[T any](capacity int) *ring[T] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &ring[T]{items: make([]T, capacity)}
+}
+
+// Push appends an item, overwriting the oldest one when the buffer is full
+func (r *ring[T]) Push(item T) {
+	end := (r.start + r.size) % len(r.items)
+	r.items[end] = item
+	if r.size < len(r.items) {
+		r.size++
+		return
+	}
+	r.start = (r.start + 1) % len(r.items)
+}
+
+// Len returns the number of items in the buffer
+func (r *ring[T]) Len() int {
+	return r.size
+}
+
+// Last returns the most recently pushed item
+func (r *ring[T]) Last() (T, bool) {
+	var zero T
+	if r.size == 0 {
+		return zero, false
+	}
+	return r.items[(r.start+r.size-1)%len(r.items)], true
+}
+
+// DropWhile removes the oldest items while drop reports true for them and
+// returns the number removed
+func (r *ring[T]) DropWhile(drop func(T) bool) int {
+	var zero T
+	n := 0
+	for r.size > 0 && drop(r.items[r.start]) {
+		r.items[r.start] = zero
+		r.start = (r.start + 1) % len(r.items)
+		r.size--
+		n++
+	}
+	return n
+}
+
+// Update replaces every item, oldest first, with the result of fn
+func (r *ring[T]) Update(fn func(T) T) {
+	for i := 0; i < r.size; i++ {
+		j := (r.start + i) % len(r.items)
+		r.items[j] = fn(r.items[j])
+	}
+}
+
+// Slice returns a copy of the items from oldest to newest
+func (r *ring[T]) Slice() []T {
+	out := make([]T, r.size)
+	for i := range out {
+		out[i] = r.items[(r.start+i)%len(r.items)]
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecurityConfig hardens the responses and bounds the requests of every
+// route, for instances exposed on a network beyond localhost
+type SecurityConfig struct {
+	// Headers adds X-Content-Type-Options, X-Frame-Options, Referrer-Policy,
+	// and ContentSecurityPolicy to every response
+	Headers               bool   `yaml:"headers"`
+	ContentSecurityPolicy string `yaml:"contentSecurityPolicy"`
+	// HSTSMaxAge adds Strict-Transport-Security to the responses over TLS;
+	// 0 leaves it out
+	HSTSMaxAge time.Duration `yaml:"hstsMaxAge"`
+	// MaxBodyBytes bounds request bodies. The bodies agents push to the
+	// aggregator are bounded separately.
+	MaxBodyBytes int64 `yaml:"maxBodyBytes"`
+	// MaxHeaderBytes bounds the request line and headers
+	MaxHeaderBytes int `yaml:"maxHeaderBytes"`
+	// AllowedMethods are the methods accepted on any route; the others, e.g.
+	// TRACE, are refused before routing
+	AllowedMethods []string `yaml:"allowedMethods"`
+}
+
+// validate checks the limits and methods
+func (c SecurityConfig) validate() error {
+	if c.MaxBodyBytes < 1 || c.MaxHeaderBytes < 4096 {
+		return fmt.Errorf("security.maxBodyBytes must be positive and security.maxHeaderBytes at least 4096")
+	}
+	if c.HSTSMaxAge < 0 {
+		return fmt.Errorf("security.hstsMaxAge must not be negative")
+	}
+	if len(c.AllowedMethods) == 0 {
+		return fmt.Errorf("security.allowedMethods must not be empty")
+	}
+	for _, method := range c.AllowedMethods {
+		if method == "" || method != strings.ToUpper(method) || strings.ContainsAny(method, " \t,") {
+			return fmt.Errorf("invalid security.allowedMethods entry %q", method)
+		}
+	}
+	return nil
+}
+
+// securityHandler wraps an http.Handler, refuses the methods not allowed and
+// the bodies over the limit, and adds the security headers
+func (s *Server) securityHandler(next http.Handler) http.Handler {
+	cfg := s.config.Security
+	allow := strings.Join(cfg.AllowedMethods, ", ")
+	hsts := ""
+	if cfg.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(cfg.HSTSMaxAge.Seconds()))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.Headers {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "DENY")
+			h.Set("Referrer-Policy", "no-referrer")
+			if cfg.ContentSecurityPolicy != "" {
+				h.Set("Content-Security-Policy", cfg.ContentSecurityPolicy)
+			}
+		}
+		if hsts != "" && r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", hsts)
+		}
+
+		if !slices.Contains(cfg.AllowedMethods, r.Method) {
+			w.Header().Set("Allow", allow)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Body != nil && r.Body != http.NoBody {
+			// Agents push batches of samples with the aggregator token
+			limit := cfg.MaxBodyBytes
+			if role, _ := s.credentials(r); role == roleAgent {
+				limit = max(limit, maxNodeBody)
+			}
+			if r.ContentLength > limit {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,564 @@
+// Package server serves the system stats API: the HTTP handlers, the SSE
+// stream, the shared collection hub, and the push sinks. A Server can run its
+// own listeners with Start, or be mounted in another program through Handler
+// and Run.
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// Constants
+const (
+	defaultPort = "3000"
+	apiPrefix   = "/api"
+)
+
+// Server represents our HTTP server
+type Server struct {
+	router    *http.ServeMux
+	port      string
+	config    *Config
+	watcher   *watcher
+	snapshots *snapshotter
+	alerts    *alertEngine
+	audit     *auditLog
+	history   *history
+	hub       *hub
+	limiter   *rateLimiter
+	access    *ipAccess
+	basicAuth *basicAuth
+	sinks     []*sinkRunner
+	telemetry *telemetry
+	tracer    *tracer
+	stats     StatsProvider
+	cache     *statsCache
+	// nodeRegistry holds the agents of the aggregator mode
+	nodeRegistry *nodeRegistry
+	// announcer and discovery are the mDNS announcement of this instance
+	// and the polling of the agents discovered by the aggregator
+	announcer *mdnsResponder
+	discovery *discovery
+	hostname  string
+	started   time.Time
+}
+
+// New creates a new server instance with its routes set up
+func New(cfg *Config, opts ...Option) (*Server, error) {
+	s := &Server{
+		router:  http.NewServeMux(),
+		port:    cfg.Port,
+		config:  cfg,
+		stats:   collectorProvider{},
+		started: time.Now(),
+	}
+	if s.port == "" {
+		s.port = defaultPort
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if len(cfg.Labels) > 0 {
+		s.stats = labelProvider{StatsProvider: s.stats, labels: cfg.Labels}
+	}
+
+	if err := applyCollectorConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	watcher, err := newWatcher(cfg.Watch)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := newSnapshotter(cfg.Snapshots, s.stats)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	history := newHistory(cfg.History.Size, cfg.Processes.EmbeddedLimit)
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("error getting hostname: %w", err)
+	}
+
+	var limiter *rateLimiter
+	if cfg.RateLimit.Enabled {
+		limiter = newRateLimiter(cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst)
+	}
+	access, err := newIPAccess(cfg.Access)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	audit, err := newAuditLog(cfg.Audit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if cfg.BasicAuth.Enabled {
+		if s.basicAuth, err = newBasicAuth(cfg.BasicAuth); err != nil {
+			return nil, fmt.Errorf("invalid config: %w", err)
+		}
+	}
+
+	tracer, err := newTracer(cfg.Tracing, hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	telemetry := newTelemetry()
+	hub := newHub(cfg.Collector, cfg.SSE, s.stats, history, telemetry, tracer)
+	sinks, err := newSinks(cfg.Sinks, hostname, cfg.Labels)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Push.Enabled {
+		push, err := newPushSink(cfg.Push, hostname, cfg.Processes.EmbeddedLimit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config: %w", err)
+		}
+		sinks = append(sinks, newSinkRunner(push))
+	}
+	for _, runner := range sinks {
+		hub.AddSink(runner)
+	}
+	alerts, err := newAlertEngine(cfg.Alerts, cfg.Labels, history, watcher)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	alerts.publish = hub.Publish
+	if alerts.notifiers, err = newNotifiers(cfg.Alerts, hostname); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	hub.alerts = alerts
+	hub.watcher = watcher
+
+	s.watcher = watcher
+	s.snapshots = snapshots
+	s.alerts = alerts
+	s.history = history
+	s.hub = hub
+	s.limiter = limiter
+	s.access = access
+	s.audit = audit
+	s.sinks = sinks
+	s.telemetry = telemetry
+	s.tracer = tracer
+	s.hostname = hostname
+	s.cache = newStatsCache(cfg.Collector.CacheTTL, s.stats)
+	if cfg.Aggregator.Enabled {
+		s.nodeRegistry = newNodeRegistry(cfg.Aggregator)
+	}
+	if cfg.MDNS.Announce || cfg.MDNS.Discover {
+		name := cmp.Or(cfg.MDNS.Name, cfg.Push.Node, hostname)
+		if cfg.MDNS.Announce {
+			port, tls, err := announcedEndpoint(cfg)
+			if err != nil {
+				return nil, err
+			}
+			if s.announcer, err = newMDNSResponder(name, hostname, port, tls); err != nil {
+				return nil, fmt.Errorf("invalid config: %w", err)
+			}
+		}
+		if cfg.MDNS.Discover {
+			s.discovery = newDiscovery(s.nodeRegistry, cfg.Collector.Interval, name)
+		}
+	}
+	s.setupRoutes()
+	return s, nil
+}
+
+// applyCollectorConfig configures the collectors with the collector and
+// process settings of cfg
+func applyCollectorConfig(cfg *Config) error {
+	collector.SetDiskPaths(cfg.Collector.DiskPaths)
+	collector.SetNetworkFilesystems(cfg.Collector.NetworkFilesystems.Monitor, cfg.Collector.NetworkFilesystems.Timeout)
+	collector.SetInterfaces(cfg.Collector.Interfaces.Include, cfg.Collector.Interfaces.Exclude)
+	collector.SetCgroupRelative(cfg.Collector.Cgroup.Relative)
+	collector.SetServices(cfg.Collector.Services)
+	processFilter, err := cfg.Processes.processFilter()
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	collector.SetProcessFilter(processFilter)
+	// Collectors may be registered until the config is applied, so their
+	// names are only checked now
+	collector.SetTimeout("", cfg.Collector.Timeout)
+	for name, timeout := range cfg.Collector.Timeouts {
+		if !slices.Contains(collector.Topics(), name) {
+			return fmt.Errorf("invalid config: collector.timeouts: unknown collector %q", name)
+		}
+		collector.SetTimeout(name, timeout)
+	}
+	return nil
+}
+
+// setupRoutes configures all the routes for the server
+func (s *Server) setupRoutes() {
+	// Swagger documentation endpoint
+	if s.config.Docs.Enabled {
+		s.setupDocsRoutes()
+	}
+
+	if s.config.Debug.Enabled {
+		s.setupDebugRoutes()
+	}
+
+	// Web dashboard, built on the public API
+	if s.config.UI.Enabled {
+		s.router.Handle("/ui/", uiHandler())
+	}
+
+	// Probes for Kubernetes and load balancers, outside the API so they are
+	// never rate limited
+	s.router.HandleFunc("/healthz", s.healthzHandler)
+	s.router.HandleFunc("/readyz", s.readyzHandler)
+	s.router.HandleFunc("/metrics", s.metricsHandler)
+
+	// Wrap root handler with CORS
+	s.router.HandleFunc("/", s.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		info := map[string]interface{}{
+			"name":        "System Stats API",
+			"version":     "1.0",
+			"description": "API for monitoring system resources and processes",
+			"endpoints": map[string]string{
+				"/ui/":                             "Web dashboard with live charts and processes",
+				"/docs/":                           "Swagger UI and OpenAPI spec of the API",
+				"/healthz":                         "Liveness probe",
+				"/readyz":                          "Readiness probe (collection working, latest sample fresh)",
+				"/metrics":                         "Prometheus metrics of the host and the server itself",
+				"/api/self":                        "Get the server's own operational metrics",
+				"/api/version":                     "Get build and version information",
+				"/api/openapi.json":                "Get the OpenAPI 3 spec of the API",
+				"/api/stats":                       "Get current system statistics",
+				"/api/events":                      "SSE endpoint for real-time system statistics",
+				"/api/query":                       "Aggregate a metric (min/max/avg/pNN) over a window of the history",
+				"/api/compare":                     "Compare the headline metrics with one window ago (e.g. 1h, 24h, 168h)",
+				"/api/forecast/disk":               "Project when the disk fills up from its usage trend",
+				"/api/zfs":                         "Get the health of the ZFS pools, their scrubs, and the ARC hit rate",
+				"/api/mdraid":                      "Get the state of the software RAID arrays and their rebuilds",
+				"/api/alerts":                      "List the alert rules with their state",
+				"/api/alerts/history":              "List the alerts that fired or resolved",
+				"/api/processes":                   "List processes with filtering, sorting, and pagination",
+				"/api/processes/tree":              "Get processes nested by parent/child relationship",
+				"/api/processes/summary":           "Get processes aggregated by user or name",
+				"/api/processes/{pid}":             "Get full detail for a single process",
+				"/api/processes/{pid}/files":       "List the open files of a process",
+				"/api/processes/{pid}/connections": "List the network connections of a process",
+				"/api/processes/{pid}/signal":      "Send a signal to a process (admin)",
+				"/api/processes/{pid}/priority":    "Change the nice value of a process (admin)",
+				"/api/audit":                       "List the admin actions with their principal and outcome (admin)",
+				"/api/snapshots":                   "List the scheduled snapshots",
+				"/api/snapshots/{name}":            "Get the retained snapshots of a schedule",
+				"/api/nodes":                       "List the nodes of the fleet with their health (aggregator mode)",
+				"/api/nodes/{node}/stats":          "Get the statistics of a node (aggregator mode)",
+				"/api/fleet":                       "Get the statistics of every node (aggregator mode)",
+			},
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	}))
+
+	// Wrap API endpoints with CORS and, except for the long-lived SSE stream, rate limiting
+	s.router.HandleFunc(apiPrefix+"/stats", s.corsMiddleware(s.rateLimitMiddleware(s.statsHandler)))
+	s.router.HandleFunc(apiPrefix+"/events", s.corsMiddleware(s.sseHandler))
+	s.router.HandleFunc(apiPrefix+"/self", s.corsMiddleware(s.rateLimitMiddleware(s.selfHandler)))
+	s.router.HandleFunc(apiPrefix+"/version", s.corsMiddleware(s.rateLimitMiddleware(s.versionHandler)))
+	s.router.HandleFunc(apiPrefix+"/check", s.corsMiddleware(s.rateLimitMiddleware(s.checkHandler)))
+	s.router.HandleFunc(apiPrefix+"/history", s.corsMiddleware(s.rateLimitMiddleware(s.historyHandler)))
+	s.router.HandleFunc(apiPrefix+"/query", s.corsMiddleware(s.rateLimitMiddleware(s.queryHandler)))
+	s.router.HandleFunc(apiPrefix+"/compare", s.corsMiddleware(s.rateLimitMiddleware(s.compareHandler)))
+	s.router.HandleFunc(apiPrefix+"/forecast/disk", s.corsMiddleware(s.rateLimitMiddleware(s.diskForecastHandler)))
+	s.router.HandleFunc(apiPrefix+"/zfs", s.corsMiddleware(s.rateLimitMiddleware(s.zfsHandler)))
+	s.router.HandleFunc(apiPrefix+"/mdraid", s.corsMiddleware(s.rateLimitMiddleware(s.mdraidHandler)))
+	s.router.HandleFunc(apiPrefix+"/alerts", s.corsMiddleware(s.rateLimitMiddleware(s.alertsHandler)))
+	s.router.HandleFunc(apiPrefix+"/alerts/history", s.corsMiddleware(s.rateLimitMiddleware(s.alertHistoryHandler)))
+	s.router.HandleFunc(apiPrefix+"/processes", s.corsMiddleware(s.rateLimitMiddleware(s.processListHandler)))
+	s.router.HandleFunc(apiPrefix+"/processes/tree", s.corsMiddleware(s.rateLimitMiddleware(s.processTreeHandler)))
+	s.router.HandleFunc(apiPrefix+"/processes/summary", s.corsMiddleware(s.rateLimitMiddleware(s.processSummaryHandler)))
+	s.router.HandleFunc(apiPrefix+"/processes/{pid}", s.corsMiddleware(s.rateLimitMiddleware(s.processDetailHandler)))
+	s.router.HandleFunc(apiPrefix+"/processes/{pid}/files", s.corsMiddleware(s.rateLimitMiddleware(s.processFilesHandler)))
+	s.router.HandleFunc(apiPrefix+"/processes/{pid}/connections", s.corsMiddleware(s.rateLimitMiddleware(s.processConnectionsHandler)))
+
+	s.router.HandleFunc(apiPrefix+"/watch", s.corsReadOnlyMiddleware(s.rateLimitMiddleware(s.watchHandler)))
+	s.router.HandleFunc(apiPrefix+"/watch/{id}", s.rateLimitMiddleware(s.watchItemHandler))
+	s.router.HandleFunc(apiPrefix+"/watch/{id}/history", s.corsMiddleware(s.rateLimitMiddleware(s.watchHistoryHandler)))
+
+	s.router.HandleFunc(apiPrefix+"/snapshots", s.corsMiddleware(s.rateLimitMiddleware(s.snapshotsHandler)))
+	s.router.HandleFunc(apiPrefix+"/snapshots/{name}", s.corsMiddleware(s.rateLimitMiddleware(s.snapshotHistoryHandler)))
+
+	// Grafana JSON datasource
+	s.router.HandleFunc(apiPrefix+"/grafana/{$}", s.corsMiddleware(s.rateLimitMiddleware(s.grafanaTestHandler)))
+	s.router.HandleFunc(apiPrefix+"/grafana/search", s.corsMiddleware(s.rateLimitMiddleware(s.grafanaSearchHandler)))
+	s.router.HandleFunc(apiPrefix+"/grafana/query", s.corsMiddleware(s.rateLimitMiddleware(s.grafanaQueryHandler)))
+	s.router.HandleFunc(apiPrefix+"/grafana/annotations", s.corsMiddleware(s.rateLimitMiddleware(s.grafanaAnnotationsHandler)))
+
+	// Aggregator mode: agents push samples with the aggregator token, which
+	// are not rate limited as many agents may share an address
+	if s.config.Aggregator.Enabled {
+		s.router.HandleFunc(apiPrefix+"/nodes", s.corsMiddleware(s.rateLimitMiddleware(s.nodesHandler)))
+		s.router.HandleFunc(apiPrefix+"/nodes/{node}", s.agentMiddleware(s.nodeRegisterHandler))
+		s.router.HandleFunc(apiPrefix+"/nodes/{node}/samples", s.agentMiddleware(s.nodeSamplesHandler))
+		s.router.HandleFunc(apiPrefix+"/nodes/{node}/stats", s.corsMiddleware(s.rateLimitMiddleware(s.nodeStatsHandler)))
+		s.router.HandleFunc(apiPrefix+"/fleet", s.corsMiddleware(s.rateLimitMiddleware(s.fleetHandler)))
+	}
+
+	// Admin endpoints additionally require the admin token, and those changing
+	// the host are audited. They get no CORS headers, so browsers never send
+	// them cross-origin.
+	s.router.HandleFunc(apiPrefix+"/processes/{pid}/signal", s.rateLimitMiddleware(s.auditMiddleware("process.signal", s.adminMiddleware(s.processSignalHandler))))
+	s.router.HandleFunc(apiPrefix+"/processes/{pid}/priority", s.rateLimitMiddleware(s.auditMiddleware("process.priority", s.adminMiddleware(s.processPriorityHandler))))
+	s.router.HandleFunc(apiPrefix+"/audit", s.rateLimitMiddleware(s.adminMiddleware(s.auditHandler)))
+}
+
+// Handler returns the routes wrapped in the access log, credential checks,
+// request hardening, IP access control, authentication, telemetry, and
+// compression middleware
+func (s *Server) Handler() http.Handler {
+	return s.accessLogHandler(s.credentialsHandler(s.securityHandler(s.accessHandler(s.authHandler(s.telemetryHandler(s.compressHandler(s.router)))))))
+}
+
+// Run runs the collection hub, the sinks, and the other background samplers
+// until ctx is cancelled. Start runs it; programs serving Handler themselves
+// must run it too.
+func (s *Server) Run(ctx context.Context) {
+	s.snapshots.run(ctx)
+	janitor := &janitor{cfg: s.config.Retention, history: s.history, snapshots: s.snapshots, watcher: s.watcher, alerts: s.alerts, audit: s.audit}
+	go janitor.run(ctx)
+	go s.hub.run(ctx)
+	if s.limiter != nil {
+		go s.limiter.run(ctx)
+	}
+	if s.basicAuth != nil {
+		go s.basicAuth.checks.run(ctx)
+	}
+	for _, runner := range s.sinks {
+		go runner.run(ctx)
+	}
+	for _, runner := range s.alerts.notifiers {
+		go runner.run(ctx)
+	}
+	if s.tracer != nil {
+		go s.tracer.run(ctx)
+	}
+	if s.announcer != nil {
+		go s.announcer.run(ctx)
+	}
+	if s.discovery != nil {
+		browser := &mdnsBrowser{
+			interval: s.config.MDNS.BrowseInterval,
+			found: func(name string, apiURL *url.URL) {
+				s.discovery.found(ctx, name, apiURL)
+			},
+		}
+		go browser.run(ctx)
+	}
+	<-ctx.Done()
+}
+
+// Start starts the server and handles graceful shutdown
+func (s *Server) Start() error {
+	// Sockets passed by systemd socket activation replace the configured listeners
+	listeners, err := systemdListeners()
+	if err != nil {
+		return err
+	}
+	if len(listeners) == 0 {
+		configs := s.config.Listen
+		if len(configs) == 0 {
+			configs = listenConfigs{{Address: net.JoinHostPort(s.config.Host, s.port)}}
+		}
+		for _, cfg := range configs {
+			l, err := listen(cfg, s.config.HTTP2.Enabled)
+			if err != nil {
+				for _, l := range listeners {
+					l.Close()
+				}
+				return err
+			}
+			listeners = append(listeners, l)
+		}
+	}
+
+	server := &http.Server{
+		Handler:        s.Handler(),
+		ReadTimeout:    15 * time.Second,
+		WriteTimeout:   15 * time.Second,
+		IdleTimeout:    60 * time.Second,
+		MaxHeaderBytes: s.config.Security.MaxHeaderBytes,
+	}
+	if err := s.configureHTTP2(server); err != nil {
+		return err
+	}
+	// Shutdown waits for active handlers, so SSE streams are told to finish
+	// with a final shutdown event instead of holding it up until the deadline
+	server.RegisterOnShutdown(s.hub.Shutdown)
+
+	// Channel for shutdown signals
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	// Channel for server errors
+	errChan := make(chan error, len(listeners))
+
+	// Background samplers run until the server stops
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	for _, l := range listeners {
+		go func() {
+			slog.Info("Server running", "url", listenURL(l))
+			errChan <- server.Serve(l)
+		}()
+	}
+	if err := sdNotify("READY=1"); err != nil {
+		slog.Warn("Error signaling readiness", "error", err)
+	}
+
+	// Wait for shutdown signal or error
+	select {
+	case <-stop:
+		slog.Info("Shutting down server", "sseClients", s.hub.Clients())
+		if err := sdNotify("STOPPING=1"); err != nil {
+			slog.Warn("Error signaling shutdown", "error", err)
+		}
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		return server.Shutdown(shutdownCtx)
+	case err := <-errChan:
+		return fmt.Errorf("server error: %w", err)
+	}
+}
+
+// statsETag returns the weak entity tag of a representation of a sample: its
+// sequence number and a hash of the fields, the process trimming, and the
+// format, so that different representations of a sample never match
+func statsETag(sample models.Sample, topics collector.TopicSet, top topProcsQuery, format string) string {
+	fields := make([]string, 0, len(topics))
+	for topic := range topics {
+		fields = append(fields, topic)
+	}
+	slices.Sort(fields)
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%d\x00%s\x00%s", strings.Join(fields, ","), top.N, top.SortBy, format)
+	return fmt.Sprintf(`W/"%d-%x"`, sample.Seq, h.Sum64())
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using weak comparison
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// statsHandler godoc
+// @Summary Get current system statistics
+// @Description Returns the most recently collected CPU, memory, disk usage, network traffic, and process information. The format is negotiated with the Accept header or the format parameter (JSON, MessagePack, Protobuf as described in proto/stats.proto, or CSV). The ETag identifies the sample along with the fields, topProcs, sortBy, and format, so pollers sending If-None-Match get 304 until a new sample is collected. With fresh=true a sample is collected on demand, and shared with the requests arriving within collector.cacheTTL; it has no ETag.
+// @Tags stats
+// @Produce json,application/msgpack,application/x-protobuf,text/csv
+// @Param topProcs query int false "Only include the N heaviest processes (0 for all, up to processes.embeddedLimit)"
+// @Param sortBy query string false "Key used to pick the heaviest processes" Enums(cpu, mem)
+// @Param format query string false "Response format, overriding the Accept header" Enums(json, msgpack, protobuf, csv)
+// @Param fields query string false "Comma-separated fields to include (cpuUsage, memUsage, diskUsage, netTraffic, processes); defaults to all"
+// @Param fresh query bool false "Collect a new sample instead of serving the latest one; concurrent fresh requests share one collection"
+// @Param If-None-Match header string false "ETag of a previously returned sample"
+// @Success 200 {object} models.SystemStats
+// @Success 304 "Not Modified"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /stats [get]
+func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	top, err := parseTopProcsQuery(r.URL.Query(), s.config.Processes.EmbeddedLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	topics, err := collector.ParseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fresh := false
+	if v := r.URL.Query().Get("fresh"); v != "" {
+		if fresh, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid fresh %q: must be a boolean", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Serve the sample the hub collected last. Fresh requests, and requests
+	// before the first sample, are collected on demand through the cache.
+	sample, ok := s.history.Latest()
+	if fresh || !ok {
+		cached, err := s.cache.Get(r.Context(), topics, fresh)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// An on-demand collection is not recorded in the history, so it has
+		// no ETag. Copy before trimming, cached stats are shared.
+		stats := *cached
+		trimProcesses(&stats, top)
+		w.Header().Set("Cache-Control", "no-cache")
+		writeStats(w, r, &stats, topics)
+		return
+	}
+
+	format, err := negotiateFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// The 304 must vary like the representation it stands for
+	addVary(w, "Accept")
+	etag := statsETag(sample, topics, top, format)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Copy before trimming, samples in the history are shared
+	stats := *sample.Stats
+	trimProcesses(&stats, top)
+	writeStats(w, r, &stats, topics)
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+func TestStatsETag(t *testing.T) {
+	sample := models.Sample{Seq: 7}
+	all := collector.AllTopicSet()
+	cpu := collector.TopicSet{collector.TopicCPU: true}
+	top := topProcsQuery{N: 10, SortBy: "cpu"}
+
+	base := statsETag(sample, all, top, mediaJSON)
+	if base != statsETag(sample, collector.AllTopicSet(), top, mediaJSON) {
+		t.Error("the ETag of equal representations differs")
+	}
+	for _, tt := range []struct {
+		name string
+		etag string
+	}{
+		{"seq", statsETag(models.Sample{Seq: 8}, all, top, mediaJSON)},
+		{"fields", statsETag(sample, cpu, top, mediaJSON)},
+		{"topProcs", statsETag(sample, all, topProcsQuery{N: 5, SortBy: "cpu"}, mediaJSON)},
+		{"sortBy", statsETag(sample, all, topProcsQuery{N: 10, SortBy: "mem"}, mediaJSON)},
+		{"format", statsETag(sample, all, top, mediaCSV)},
+	} {
+		if tt.etag == base {
+			t.Errorf("the ETag does not change with the %s: %s", tt.name, tt.etag)
+		}
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch string
+		etag        string
+		want        bool
+	}{
+		{`W/"1-a"`, `W/"1-a"`, true},
+		{`"1-a"`, `W/"1-a"`, true},
+		{`W/"2-a", W/"1-a"`, `W/"1-a"`, true},
+		{`*`, `W/"1-a"`, true},
+		{`W/"1-b"`, `W/"1-a"`, false},
+		{``, `W/"1-a"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifNoneMatch, tt.etag); got != tt.want {
+			t.Errorf("etagMatches(%q, %q) = %v, want %v", tt.ifNoneMatch, tt.etag, got, tt.want)
+		}
+	}
+}
+
+func TestStatsHandlerConditional(t *testing.T) {
+	s := &Server{config: defaultConfig(), history: newHistory(10, 0)}
+	s.history.Append(&models.SystemStats{CPUUsage: 12.5})
+
+	get := func(query, accept, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/stats"+query, nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		s.statsHandler(w, r)
+		return w
+	}
+
+	first := get("", "", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET = %d with ETag %q, want 200 with an ETag", first.Code, etag)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		accept string
+		want   int
+	}{
+		{"same representation", "", "", http.StatusNotModified},
+		{"other fields", "?fields=cpuUsage", "", http.StatusOK},
+		{"other topProcs", "?topProcs=1", "", http.StatusOK},
+		{"other format", "?format=csv", "", http.StatusOK},
+		{"other Accept", "", "text/csv", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.query, tt.accept, etag)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if !slices.Contains(w.Header().Values("Vary"), "Accept") {
+				t.Errorf("Vary = %q, want Accept", w.Header().Values("Vary"))
+			}
+		})
+	}
+}
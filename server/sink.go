@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// sinkBuffer is the number of samples queued for a sink that is busy writing
+const sinkBuffer = 64
+
+// sink pushes collected samples to an external system, e.g. a time-series database
+type sink interface {
+	// Name identifies the sink in logs
+	Name() string
+	// Write pushes a batch of samples, oldest first
+	Write(ctx context.Context, samples []models.Sample) error
+}
+
+// eventSink is a sink that also forwards the events published on the hub,
+// e.g. alerts
+type eventSink interface {
+	sink
+	// WriteEvent pushes one published event
+	WriteEvent(ctx context.Context, event hubEvent) error
+}
+
+// sinkRunner feeds the samples collected by the hub to a sink. Samples that
+// arrive while the sink is writing are batched into its next write.
+type sinkRunner struct {
+	sink sink
+	ch   chan models.Sample
+	// events queues the published events of an eventSink, and is nil for
+	// other sinks
+	events chan hubEvent
+	// Samples written, lost to failed writes, and dropped because the queue
+	// was full
+	written atomic.Uint64
+	failed  atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// newSinks creates the sinks enabled in the config
+func newSinks(cfg SinksConfig, hostname string, labels map[string]string) ([]*sinkRunner, error) {
+	var sinks []sink
+	if cfg.InfluxDB.Enabled {
+		s, err := newInfluxSink(cfg.InfluxDB, hostname, labels)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if cfg.OTLP.Enabled {
+		s, err := newOTLPSink(cfg.OTLP, hostname, labels)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if cfg.StatsD.Enabled {
+		s, err := newStatsDSink(cfg.StatsD, labels)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if cfg.Graphite.Enabled {
+		sinks = append(sinks, newGraphiteSink(cfg.Graphite, hostname, labels))
+	}
+	if cfg.RemoteWrite.Enabled {
+		sinks = append(sinks, newRemoteWriteSink(cfg.RemoteWrite, hostname, labels))
+	}
+	if cfg.Kafka.Enabled {
+		sinks = append(sinks, newKafkaSink(cfg.Kafka, hostname))
+	}
+	if cfg.Postgres.Enabled {
+		s, err := newPostgresSink(cfg.Postgres, hostname)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if cfg.Redis.Enabled {
+		s, err := newRedisSink(cfg.Redis, hostname)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if cfg.NATS.Enabled {
+		s, err := newNATSSink(cfg.NATS, hostname)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if cfg.MQTT.Enabled {
+		s, err := newMQTTSink(cfg.MQTT, hostname)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+
+	runners := make([]*sinkRunner, len(sinks))
+	for i, s := range sinks {
+		runners[i] = newSinkRunner(s)
+	}
+	return runners, nil
+}
+
+// newSinkRunner creates the runner of a sink
+func newSinkRunner(s sink) *sinkRunner {
+	runner := &sinkRunner{sink: s, ch: make(chan models.Sample, sinkBuffer)}
+	if _, ok := s.(eventSink); ok {
+		runner.events = make(chan hubEvent, sinkBuffer)
+	}
+	return runner
+}
+
+// run writes samples to the sink until ctx is cancelled
+func (r *sinkRunner) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sample := <-r.ch:
+			batch := []models.Sample{sample}
+			for len(r.ch) > 0 {
+				batch = append(batch, <-r.ch)
+			}
+			err := r.sink.Write(ctx, batch)
+			switch {
+			case err == nil:
+				r.written.Add(uint64(len(batch)))
+			case ctx.Err() == nil:
+				r.failed.Add(uint64(len(batch)))
+				slog.Error("Error writing samples", "sink", r.sink.Name(), "samples", len(batch), "error", err)
+			}
+		case event := <-r.events:
+			if err := r.sink.(eventSink).WriteEvent(ctx, event); err != nil && ctx.Err() == nil {
+				slog.Error("Error writing event", "sink", r.sink.Name(), "type", event.Type, "error", err)
+			}
+		}
+	}
+}
+
+// clientTLSConfig creates the TLS config of a sink connecting to serverName,
+// naming the config setting in errors
+func clientTLSConfig(cfg ClientTLSConfig, serverName, setting string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         serverName,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s.caFile: %w", setting, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("invalid %s.caFile: no PEM certificates found", setting)
+		}
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading %s.certFile: %w", setting, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// sinkStatusError is returned by postSinkRequest for non-2xx responses
+type sinkStatusError struct {
+	StatusCode int
+	msg        string
+}
+
+func (e *sinkStatusError) Error() string {
+	return e.msg
+}
+
+// postSinkRequest sends a request on behalf of a sink and turns non-2xx
+// responses into errors that include the start of the response body
+func postSinkRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &sinkStatusError{
+			StatusCode: resp.StatusCode,
+			msg:        fmt.Sprintf("%s returned %s: %s", req.URL.Redacted(), resp.Status, body),
+		}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,76 @@
+package server
+
+import "encoding/binary"
+
+// snappyBlockSize bounds the window searched for matches, so every copy
+// offset fits in the two-byte copy element
+const snappyBlockSize = 1 << 16
+
+// snappyEncode compresses src in the Snappy block format used by Prometheus
+// remote write. It is a simple greedy compressor: the ratio is lower than the
+// reference implementation's but the output is valid for any decoder.
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, len(src)/2+16), uint64(len(src)))
+	for start := 0; start < len(src); start += snappyBlockSize {
+		end := min(start+snappyBlockSize, len(src))
+		dst = snappyEncodeBlock(dst, src[start:end])
+	}
+	return dst
+}
+
+func snappyEncodeBlock(dst, block []byte) []byte {
+	const tableBits = 14
+	var table [1 << tableBits]int32
+
+	hash := func(i int) uint32 {
+		return binary.LittleEndian.Uint32(block[i:]) * 0x1e35a7bd >> (32 - tableBits)
+	}
+
+	lit := 0
+	for i := 0; i+4 <= len(block); {
+		h := hash(i)
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if candidate < 0 || binary.LittleEndian.Uint32(block[candidate:]) != binary.LittleEndian.Uint32(block[i:]) {
+			i++
+			continue
+		}
+
+		n := 4
+		for i+n < len(block) && block[candidate+n] == block[i+n] {
+			n++
+		}
+		dst = snappyAppendLiteral(dst, block[lit:i])
+		dst = snappyAppendCopy(dst, i-candidate, n)
+		i += n
+		lit = i
+	}
+	return snappyAppendLiteral(dst, block[lit:])
+}
+
+// snappyAppendLiteral appends a literal element
+func snappyAppendLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	switch n := uint32(len(lit) - 1); {
+	case n < 60:
+		dst = append(dst, byte(n)<<2)
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	default:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	}
+	return append(dst, lit...)
+}
+
+// snappyAppendCopy appends copy elements with a two-byte offset, each
+// copying at most 64 bytes
+func snappyAppendCopy(dst []byte, offset, length int) []byte {
+	for length > 0 {
+		n := min(length, 64)
+		dst = append(dst, byte(n-1)<<2|2, byte(offset), byte(offset>>8))
+		length -= n
+	}
+	return dst
+}
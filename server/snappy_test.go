@@ -0,0 +1,72 @@
+package server
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+func TestSnappyEncode(t *testing.T) {
+	random := make([]byte, 3*snappyBlockSize+100)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := []byte(strings.Repeat("system_cpu_usage_percent{host=\"web-01\"} 12.5\n", 5000))
+
+	tests := []struct {
+		name string
+		src  []byte
+		// maxLen bounds the compressed size, when the input compresses
+		maxLen int
+	}{
+		{"empty", nil, 1},
+		{"one byte", []byte("a"), 3},
+		{"short", []byte("abc"), 5},
+		{"60 literals", random[:60], 62},
+		{"61 literals", random[:61], 64},
+		{"256 literals", random[:256], 260},
+		{"257 literals", random[:257], 262},
+		{"random", random, 0},
+		{"run", bytes.Repeat([]byte{'x'}, 1000), 60},
+		{"run across blocks", bytes.Repeat([]byte{'x'}, 3*snappyBlockSize), 0},
+		{"text", text, len(text) / 10},
+		{"overlapping copy", []byte("abcdabcdabcdabcdabcde"), 12},
+		{"match at the end", append(random[:100:100], random[:100]...), 110},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := snappyEncode(tt.src)
+			decoded, err := snappy.Decode(nil, encoded)
+			if err != nil {
+				t.Fatalf("decoding: %v", err)
+			}
+			if !bytes.Equal(decoded, tt.src) {
+				t.Fatalf("decoded %d bytes differing from the %d encoded", len(decoded), len(tt.src))
+			}
+			if tt.maxLen > 0 && len(encoded) > tt.maxLen {
+				t.Errorf("compressed %d bytes to %d, want at most %d", len(tt.src), len(encoded), tt.maxLen)
+			}
+			if maxLen := snappy.MaxEncodedLen(len(tt.src)); len(encoded) > maxLen {
+				t.Errorf("compressed %d bytes to %d, more than snappy allows (%d)", len(tt.src), len(encoded), maxLen)
+			}
+		})
+	}
+}
+
+func TestSnappyEncodeGolden(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []byte
+	}{
+		{"", []byte{0x00}},
+		{"abc", []byte{0x03, 0x08, 'a', 'b', 'c'}},
+		// a literal of abcd followed by a copy of 12 bytes at offset 4
+		{"abcdabcdabcdabcd", []byte{0x10, 0x0c, 'a', 'b', 'c', 'd', 0x2e, 0x04, 0x00}},
+	}
+	for _, tt := range tests {
+		if got := snappyEncode([]byte(tt.src)); !bytes.Equal(got, tt.want) {
+			t.Errorf("snappyEncode(%q) = % x, want % x", tt.src, got, tt.want)
+		}
+	}
+}
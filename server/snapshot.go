@@ -0,0 +1,325 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// Snapshot kinds
+const (
+	// snapshotStats captures every subsystem with the full process list
+	snapshotStats = "stats"
+	// snapshotConnections captures the system-wide socket table
+	snapshotConnections = "connections"
+
+	defaultSnapshotKeep = 24
+)
+
+// SnapshotSchedule configures a snapshot taken on a cron schedule,
+// independently of the collection interval
+// @Description A snapshot schedule
+type SnapshotSchedule struct {
+	// Name identifies the schedule in /api/snapshots/{name}
+	Name string `json:"name" yaml:"name" example:"hourly-connections"`
+	// Schedule is a five-field cron expression in local time, or a macro
+	// such as @hourly
+	Schedule string `json:"schedule" yaml:"schedule" example:"0 * * * *"`
+	// Kind is stats or connections
+	Kind string `json:"kind" yaml:"kind" example:"connections" enums:"stats,connections"`
+	// Keep is the number of snapshots retained (0 means 24)
+	Keep int `json:"keep" yaml:"keep" example:"24"`
+}
+
+// SocketConnection represents a socket and the process owning it
+// @Description A network socket and its owning process
+type SocketConnection struct {
+	// PID is 0 when the owner is unknown, e.g. for sockets of other users
+	// when not running as root
+	PID int32 `json:"pid" example:"1234"`
+	Connection
+}
+
+// Snapshot represents the data captured by a schedule at one point in time
+// @Description Data captured by a snapshot schedule: full stats or the socket table
+type Snapshot struct {
+	Schedule  string    `json:"schedule" example:"hourly-connections"`
+	Timestamp time.Time `json:"timestamp" example:"2024-01-01T12:00:00Z"`
+	// Stats is set by stats snapshots, with every process
+	Stats *models.SystemStats `json:"stats,omitempty"`
+	// Connections is set by connections snapshots
+	Connections []SocketConnection `json:"connections,omitempty"`
+}
+
+// SnapshotScheduleStatus represents a schedule with its retained snapshots
+// @Description A snapshot schedule with the times of its last and next snapshots
+type SnapshotScheduleStatus struct {
+	SnapshotSchedule
+	Count int        `json:"count" example:"3"`
+	Last  *time.Time `json:"last,omitempty" example:"2024-01-01T12:00:00Z"`
+	Next  time.Time  `json:"next" example:"2024-01-01T13:00:00Z"`
+	// LastError is the error of the last attempt, cleared by the next
+	// successful one
+	LastError string `json:"lastError,omitempty" example:""`
+}
+
+// errSnapshotScheduleNotFound is returned for unknown schedule names
+var errSnapshotScheduleNotFound = errors.New("snapshot schedule not found")
+
+// snapshotEntry holds a schedule and its retained snapshots
+type snapshotEntry struct {
+	config    SnapshotSchedule
+	cron      *cronSchedule
+	snapshots *ring[Snapshot]
+	next      time.Time
+	lastError string
+}
+
+// snapshotter takes the scheduled snapshots and keeps the most recent ones
+// of each schedule in memory
+type snapshotter struct {
+	mu      sync.RWMutex
+	entries []*snapshotEntry
+	stats   StatsProvider
+}
+
+// newSnapshotter creates a snapshotter for the configured schedules
+func newSnapshotter(schedules []SnapshotSchedule, stats StatsProvider) (*snapshotter, error) {
+	s := &snapshotter{stats: stats}
+	names := map[string]bool{}
+	for _, schedule := range schedules {
+		if !watchIDPattern.MatchString(schedule.Name) {
+			return nil, fmt.Errorf("invalid snapshots name %q", schedule.Name)
+		}
+		if names[schedule.Name] {
+			return nil, fmt.Errorf("duplicate snapshots name %q", schedule.Name)
+		}
+		names[schedule.Name] = true
+		if schedule.Kind != snapshotStats && schedule.Kind != snapshotConnections {
+			return nil, fmt.Errorf("snapshots %q has invalid kind %q (want %s or %s)", schedule.Name, schedule.Kind, snapshotStats, snapshotConnections)
+		}
+		if schedule.Keep < 0 {
+			return nil, fmt.Errorf("snapshots %q keep must not be negative", schedule.Name)
+		}
+		if schedule.Keep == 0 {
+			schedule.Keep = defaultSnapshotKeep
+		}
+		cron, err := parseCron(schedule.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("snapshots %q: %w", schedule.Name, err)
+		}
+		if cron.Next(time.Now()).IsZero() {
+			return nil, fmt.Errorf("snapshots %q schedule %q never matches", schedule.Name, schedule.Schedule)
+		}
+		s.entries = append(s.entries, &snapshotEntry{
+			config:    schedule,
+			cron:      cron,
+			snapshots: newRing[Snapshot](schedule.Keep),
+		})
+	}
+	return s, nil
+}
+
+// List returns the schedules with the times of their snapshots
+func (s *snapshotter) List() []SnapshotScheduleStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	statuses := make([]SnapshotScheduleStatus, 0, len(s.entries))
+	for _, entry := range s.entries {
+		status := SnapshotScheduleStatus{
+			SnapshotSchedule: entry.config,
+			Count:            entry.snapshots.Len(),
+			Next:             entry.next,
+			LastError:        entry.lastError,
+		}
+		if last, ok := entry.snapshots.Last(); ok {
+			status.Last = &last.Timestamp
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Snapshots returns the retained snapshots of a schedule taken between from
+// and to (zero times are unbounded), oldest first
+func (s *snapshotter) Snapshots(name string, from, to time.Time) ([]Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, entry := range s.entries {
+		if entry.config.Name != name {
+			continue
+		}
+		snapshots := []Snapshot{}
+		for _, snapshot := range entry.snapshots.Slice() {
+			if !from.IsZero() && snapshot.Timestamp.Before(from) {
+				continue
+			}
+			if !to.IsZero() && snapshot.Timestamp.After(to) {
+				continue
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+		return snapshots, nil
+	}
+	return nil, errSnapshotScheduleNotFound
+}
+
+// Expire drops the stats snapshots taken before statsBefore and the
+// connections snapshots taken before connectionsBefore, and removes the
+// process lists of stats snapshots taken before processesBefore (zero times
+// disable each). It returns the number of snapshots dropped and stripped.
+func (s *snapshotter) Expire(statsBefore, processesBefore, connectionsBefore time.Time) (dropped, stripped int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.entries {
+		before := statsBefore
+		if entry.config.Kind == snapshotConnections {
+			before = connectionsBefore
+		}
+		if !before.IsZero() {
+			dropped += entry.snapshots.DropWhile(func(snapshot Snapshot) bool {
+				return snapshot.Timestamp.Before(before)
+			})
+		}
+		if entry.config.Kind == snapshotStats && !processesBefore.IsZero() {
+			entry.snapshots.Update(func(snapshot Snapshot) Snapshot {
+				if snapshot.Timestamp.Before(processesBefore) && len(snapshot.Stats.Processes) > 0 {
+					snapshot.Stats = withoutProcesses(snapshot.Stats)
+					stripped++
+				}
+				return snapshot
+			})
+		}
+	}
+	return dropped, stripped
+}
+
+// take captures one snapshot of the kind of a schedule
+func (s *snapshotter) take(ctx context.Context, entry *snapshotEntry) (Snapshot, error) {
+	snapshot := Snapshot{Schedule: entry.config.Name, Timestamp: time.Now().UTC()}
+	switch entry.config.Kind {
+	case snapshotStats:
+		stats, err := s.stats.Collect(ctx, collector.AllTopicSet())
+		if err != nil {
+			return snapshot, err
+		}
+		snapshot.Stats = stats
+	case snapshotConnections:
+		conns, err := psnet.ConnectionsWithContext(ctx, "all")
+		if err != nil {
+			return snapshot, fmt.Errorf("error getting connections: %w", err)
+		}
+		snapshot.Connections = make([]SocketConnection, 0, len(conns))
+		for _, c := range conns {
+			snapshot.Connections = append(snapshot.Connections, SocketConnection{PID: c.Pid, Connection: newConnection(c)})
+		}
+		sort.Slice(snapshot.Connections, func(i, j int) bool {
+			a, b := snapshot.Connections[i], snapshot.Connections[j]
+			if a.PID != b.PID {
+				return a.PID < b.PID
+			}
+			return a.FD < b.FD
+		})
+	}
+	return snapshot, nil
+}
+
+// runSchedule takes the snapshots of a schedule until ctx is cancelled
+func (s *snapshotter) runSchedule(ctx context.Context, entry *snapshotEntry) {
+	for {
+		next := entry.cron.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		s.mu.Lock()
+		entry.next = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		snapshot, err := s.take(ctx, entry)
+		s.mu.Lock()
+		if err != nil {
+			entry.lastError = err.Error()
+		} else {
+			entry.lastError = ""
+			entry.snapshots.Push(snapshot)
+		}
+		s.mu.Unlock()
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Error taking snapshot", "schedule", entry.config.Name, "error", err)
+		}
+	}
+}
+
+// run runs every schedule until ctx is cancelled
+func (s *snapshotter) run(ctx context.Context) {
+	for _, entry := range s.entries {
+		go s.runSchedule(ctx, entry)
+	}
+}
+
+// snapshotsHandler godoc
+// @Summary List snapshot schedules
+// @Description Returns the configured snapshot schedules with the number of retained snapshots and the times of the last and next ones
+// @Tags snapshots
+// @Produce json
+// @Success 200 {array} SnapshotScheduleStatus
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /snapshots [get]
+func (s *Server) snapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSONArray(w, r, s.snapshots.List())
+}
+
+// snapshotHistoryHandler godoc
+// @Summary Get scheduled snapshots
+// @Description Returns the retained snapshots of a schedule, oldest first, optionally limited to a time range. Stats snapshots include every process.
+// @Tags snapshots
+// @Produce json
+// @Param name path string true "Schedule name"
+// @Param from query string false "Only include snapshots taken at or after this RFC 3339 timestamp"
+// @Param to query string false "Only include snapshots taken at or before this RFC 3339 timestamp"
+// @Success 200 {array} Snapshot
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /snapshots/{name} [get]
+func (s *Server) snapshotHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := parseTimeRange(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snapshots, err := s.snapshots.Snapshots(r.PathValue("name"), from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSONArray(w, r, snapshots)
+}
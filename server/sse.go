@@ -0,0 +1,217 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// SSE event types
+const (
+	eventStats    = "stats"
+	eventAlert    = "alert"
+	eventError    = "error"
+	eventShutdown = "shutdown"
+)
+
+// writeEvent writes one SSE frame with the envelope as its data
+func writeEvent(w http.ResponseWriter, encoder *json.Encoder, eventType string, event models.Event) {
+	if eventType == eventStats {
+		fmt.Fprintf(w, "id: %d\n", event.Seq)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: ", eventType)
+	encoder.Encode(event)
+	fmt.Fprint(w, "\n")
+}
+
+// parseSSEInterval parses the interval query parameter, falling back to the
+// configured default and enforcing the configured bounds
+func parseSSEInterval(values url.Values, cfg SSEConfig) (time.Duration, error) {
+	v := values.Get("interval")
+	if v == "" {
+		return cfg.Interval, nil
+	}
+
+	interval, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval %q: %w", v, err)
+	}
+	if interval < cfg.MinInterval || interval > cfg.MaxInterval {
+		return 0, fmt.Errorf("invalid interval %q: must be between %s and %s", v, cfg.MinInterval, cfg.MaxInterval)
+	}
+	return interval, nil
+}
+
+// parseLastEventID returns the ID of the last event a reconnecting client
+// received, from the Last-Event-ID header or the lastEventId query parameter
+func parseLastEventID(r *http.Request) (uint64, bool) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("lastEventId")
+	}
+	if v == "" {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// writeStatsEvent writes a sample as an SSE stats event, trimmed to the client's topics and top processes
+func (s *Server) writeStatsEvent(w http.ResponseWriter, encoder *json.Encoder, sample models.Sample, topics collector.TopicSet, top topProcsQuery) {
+	stats := *sample.Stats
+	trimProcesses(&stats, top)
+
+	writeEvent(w, encoder, eventStats, models.Event{
+		Seq:       sample.Seq,
+		Timestamp: sample.Timestamp,
+		Host:      s.hostname,
+		Data:      topics.Filter(&stats),
+	})
+}
+
+// sseHandler godoc
+// @Summary Get real-time system statistics
+// @Description Provides Server-Sent Events (SSE) stream of system statistics. Every event's data is an Event envelope with seq, timestamp, and host. Event types: "stats" (data is SystemStats, id is seq), "alert" (data is the alert that changed state), "error" (data is ErrorData), and "shutdown" (data is ShutdownData), sent once before the server closes the stream on shutdown.
+// @Tags stats
+// @Produce text/event-stream
+// @Param Last-Event-ID header int false "ID of the last event received; missed samples still in the history buffer are replayed first"
+// @Param lastEventId query int false "Alternative to the Last-Event-ID header for clients that cannot set headers"
+// @Param topics query string false "Comma-separated subsystems to include (cpu, mem, disk, net, processes); defaults to all"
+// @Param interval query string false "Update interval as a Go duration, e.g. 500ms or 10s (bounded by the server's sse.minInterval and sse.maxInterval)"
+// @Param topProcs query int false "Only include the N heaviest processes (0 for all, up to processes.embeddedLimit)"
+// @Param sortBy query string false "Key used to pick the heaviest processes" Enums(cpu, mem)
+// @Success 200 {object} models.Event{data=models.SystemStats} "SSE stream of Event envelopes"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 503 {string} string "Too many SSE clients"
+// @Router /events [get]
+func (s *Server) sseHandler(w http.ResponseWriter, r *http.Request) {
+	top, err := parseTopProcsQuery(r.URL.Query(), s.config.Processes.EmbeddedLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	interval, err := parseSSEInterval(r.URL.Query(), s.config.SSE)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	topics, err := collector.ParseTopics(r.URL.Query().Get("topics"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Samples are collected once per tick by the hub and shared by all clients.
+	// Subscribe before replaying so that nothing is missed in between.
+	sub, err := s.hub.Subscribe(interval)
+	if err != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.config.SSE.Retry.Seconds())+1))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer s.hub.Unsubscribe(sub)
+
+	// Streams outlive the server's write timeout, so lift it for this connection
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		slog.WarnContext(r.Context(), "Error clearing write deadline for SSE stream", "error", err)
+	}
+
+	// Set headers for SSE
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Connection-specific headers are not allowed in HTTP/2
+	if r.ProtoMajor == 1 {
+		w.Header().Set("Connection", "keep-alive")
+	}
+
+	// Create encoder for JSON
+	encoder := json.NewEncoder(w)
+
+	// Tell EventSource clients how long to wait before reconnecting
+	if s.config.SSE.Retry > 0 {
+		fmt.Fprintf(w, "retry: %d\n\n", s.config.SSE.Retry.Milliseconds())
+	}
+
+	// Replay the samples a reconnecting client missed
+	var lastSeq uint64
+	if lastID, ok := parseLastEventID(r); ok {
+		for _, sample := range s.history.Since(lastID) {
+			s.writeStatsEvent(w, encoder, sample, topics, top)
+			lastSeq = sample.Seq
+		}
+	}
+	w.(http.Flusher).Flush()
+
+	// Heartbeat comments keep idle connections alive through proxies; a nil
+	// channel blocks forever when they are disabled
+	var heartbeat <-chan time.Time
+	if s.config.SSE.Heartbeat > 0 {
+		heartbeatTicker := time.NewTicker(s.config.SSE.Heartbeat)
+		defer heartbeatTicker.Stop()
+		heartbeat = heartbeatTicker.C
+	}
+	// Whether an event was written since the previous heartbeat tick
+	active := false
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.kicked:
+			slog.WarnContext(r.Context(), "Disconnected SSE client: fell behind", "droppedEvents", sub.dropped.Load())
+			return
+		case <-s.hub.Closing():
+			// End the stream on a frame boundary so clients know to reconnect
+			// elsewhere or later rather than seeing a cut connection
+			writeEvent(w, encoder, eventShutdown, models.Event{
+				Timestamp: time.Now().UTC(),
+				Host:      s.hostname,
+				Data:      models.ShutdownData{Message: errShuttingDown.Error(), RetryMs: s.config.SSE.Retry.Milliseconds()},
+			})
+			w.(http.Flusher).Flush()
+			return
+		case <-heartbeat:
+			if active {
+				active = false
+				continue
+			}
+			fmt.Fprint(w, ":heartbeat\n\n")
+			w.(http.Flusher).Flush()
+		case event := <-sub.ch:
+			switch event.Type {
+			case eventStats:
+				if event.Sample.Seq <= lastSeq {
+					continue // Already sent during replay
+				}
+				s.writeStatsEvent(w, encoder, event.Sample, topics, top)
+			case eventError:
+				writeEvent(w, encoder, eventError, models.Event{
+					Timestamp: event.Timestamp,
+					Host:      s.hostname,
+					Data:      models.ErrorData{Message: event.Err.Error()},
+				})
+			default:
+				writeEvent(w, encoder, event.Type, models.Event{
+					Timestamp: event.Timestamp,
+					Host:      s.hostname,
+					Data:      event.Data,
+				})
+			}
+			w.(http.Flusher).Flush()
+			active = true
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// statsdMaxPacket keeps datagrams below the typical Ethernet MTU
+const statsdMaxPacket = 1432
+
+// statsdSink emits gauges to a StatsD or DogStatsD daemon over UDP
+type statsdSink struct {
+	cfg    StatsDConfig
+	conn   net.Conn
+	suffix string
+}
+
+// newStatsDSink creates a StatsD sink. The host labels and the configured
+// tags, which take precedence, are sent in the DogStatsD format.
+func newStatsDSink(cfg StatsDConfig, labels map[string]string) (*statsdSink, error) {
+	conn, err := net.Dial("udp", cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]string, len(labels)+len(cfg.Tags))
+	for key, value := range labels {
+		merged[key] = value
+	}
+	for key, value := range cfg.Tags {
+		merged[key] = value
+	}
+
+	suffix := "|g"
+	if len(merged) > 0 {
+		keys := make([]string, 0, len(merged))
+		for key := range merged {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		tags := make([]string, len(keys))
+		for i, key := range keys {
+			tags[i] = key + ":" + merged[key]
+		}
+		suffix += "|#" + strings.Join(tags, ",")
+	}
+
+	return &statsdSink{cfg: cfg, conn: conn, suffix: suffix}, nil
+}
+
+func (s *statsdSink) Name() string {
+	return "statsd"
+}
+
+// Write sends the gauges of the newest sample. StatsD has no timestamps, so
+// older samples in the batch would only be overwritten.
+func (s *statsdSink) Write(ctx context.Context, samples []models.Sample) error {
+	stats := samples[len(samples)-1].Stats
+	gauges := []struct {
+		name  string
+		value string
+	}{
+		{"cpu.usage", strconv.FormatFloat(stats.CPUUsage, 'f', -1, 64)},
+		{"mem.usage", strconv.FormatFloat(stats.MemUsage, 'f', -1, 64)},
+		{"disk.usage", strconv.FormatFloat(stats.DiskUsage, 'f', -1, 64)},
+		{"net.traffic", strconv.FormatInt(stats.NetTraffic, 10)},
+		{"processes.count", strconv.Itoa(len(stats.Processes))},
+	}
+
+	var packet []byte
+	for _, gauge := range gauges {
+		line := s.cfg.Prefix + gauge.name + ":" + gauge.value + s.suffix
+		if len(packet) > 0 && len(packet)+1+len(line) > statsdMaxPacket {
+			if _, err := s.conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	_, err := s.conn.Write(packet)
+	return err
+}
@@ -0,0 +1,396 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds in seconds of the duration histograms
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram counts observations into cumulative latencyBuckets
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+	max    float64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(latencyBuckets))}
+}
+
+func (h *histogram) observe(seconds float64) {
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+	h.max = max(h.max, seconds)
+}
+
+// routeKey identifies a route and method for request metrics
+type routeKey struct {
+	route  string
+	method string
+}
+
+// routeMetrics holds the request metrics of one route and method
+type routeMetrics struct {
+	codes    map[int]uint64
+	duration *histogram
+}
+
+// telemetry tracks the server's own operational metrics
+type telemetry struct {
+	mu               sync.Mutex
+	routes           map[routeKey]*routeMetrics
+	collections      uint64
+	collectionErrors uint64
+	collectDuration  *histogram
+	lastCollect      time.Duration
+}
+
+func newTelemetry() *telemetry {
+	return &telemetry{
+		routes:          map[routeKey]*routeMetrics{},
+		collectDuration: newHistogram(),
+	}
+}
+
+// observeRequest records a finished request
+func (t *telemetry) observeRequest(route, method string, code int, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := routeKey{route, method}
+	m, ok := t.routes[key]
+	if !ok {
+		m = &routeMetrics{codes: map[int]uint64{}, duration: newHistogram()}
+		t.routes[key] = m
+	}
+	m.codes[code]++
+	m.duration.observe(d.Seconds())
+}
+
+// observeCollection records a stats collection
+func (t *telemetry) observeCollection(d time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.collections++
+	if err != nil {
+		t.collectionErrors++
+	}
+	t.collectDuration.observe(d.Seconds())
+	t.lastCollect = d
+}
+
+// statusRecorder captures the status code and body size written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	code  int
+	bytes int64
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// telemetryHandler wraps the router and records request metrics per route
+// pattern, so that e.g. every /api/processes/{pid} request shares one series.
+// When tracing is enabled, each request is also traced in a server span.
+func (s *Server) telemetryHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := s.router.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx, span := s.tracer.startRoot(r.Context(), r.Method+" "+route, otlpSpanKindServer, r.Header.Get("traceparent"))
+		if span != nil {
+			span.SetAttr("http.request.method", r.Method)
+			span.SetAttr("http.route", route)
+			span.SetAttr("url.path", r.URL.Path)
+			span.SetAttr("user_agent.original", r.UserAgent())
+			r = r.WithContext(withLogAttrs(ctx, slog.String("traceId", span.TraceID())))
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+		s.telemetry.observeRequest(route, r.Method, rec.code, time.Since(start))
+
+		if span != nil {
+			span.SetAttr("http.response.status_code", rec.code)
+			var err error
+			if rec.code >= 500 {
+				err = fmt.Errorf("%s", http.StatusText(rec.code))
+			}
+			span.End(err)
+		}
+	})
+}
+
+// RouteStats summarizes the requests served by one route and method
+// @Description Requests served by one route and method
+type RouteStats struct {
+	Route        string         `json:"route" example:"/api/stats"`
+	Method       string         `json:"method" example:"GET"`
+	Count        uint64         `json:"count" example:"1200"`
+	Codes        map[int]uint64 `json:"codes"`
+	AvgLatencyMs float64        `json:"avgLatencyMs" example:"1.8"`
+	MaxLatencyMs float64        `json:"maxLatencyMs" example:"35.2"`
+}
+
+// SinkStats counts the samples handed to one sink
+// @Description Samples handed to one sink since the server started
+type SinkStats struct {
+	Sink string `json:"sink" example:"kafka"`
+	// Written samples were accepted by the sink's destination
+	Written uint64 `json:"written" example:"1800"`
+	// Failed samples were part of writes that failed
+	Failed uint64 `json:"failed" example:"2"`
+	// Dropped samples were skipped because the sink was still busy
+	Dropped uint64 `json:"dropped" example:"0"`
+}
+
+// SelfStats reports the operational metrics of the server itself
+// @Description Operational metrics of the server itself
+type SelfStats struct {
+	UptimeSeconds    float64      `json:"uptimeSeconds" example:"3600"`
+	SSEClients       int          `json:"sseClients" example:"3"`
+	Collections      uint64       `json:"collections" example:"1800"`
+	CollectionErrors uint64       `json:"collectionErrors" example:"0"`
+	LastCollectionMs float64      `json:"lastCollectionMs" example:"42.5"`
+	AvgCollectionMs  float64      `json:"avgCollectionMs" example:"40.1"`
+	MaxCollectionMs  float64      `json:"maxCollectionMs" example:"120.3"`
+	Requests         []RouteStats `json:"requests"`
+	Sinks            []SinkStats  `json:"sinks"`
+}
+
+// selfStats snapshots the telemetry
+func (s *Server) selfStats() SelfStats {
+	t := s.telemetry
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := SelfStats{
+		UptimeSeconds:    time.Since(s.started).Seconds(),
+		SSEClients:       s.hub.Clients(),
+		Collections:      t.collections,
+		CollectionErrors: t.collectionErrors,
+		LastCollectionMs: float64(t.lastCollect) / float64(time.Millisecond),
+		MaxCollectionMs:  t.collectDuration.max * 1000,
+		Requests:         []RouteStats{},
+		Sinks:            []SinkStats{},
+	}
+	for _, runner := range s.sinks {
+		stats.Sinks = append(stats.Sinks, SinkStats{
+			Sink:    runner.sink.Name(),
+			Written: runner.written.Load(),
+			Failed:  runner.failed.Load(),
+			Dropped: runner.dropped.Load(),
+		})
+	}
+	if t.collections > 0 {
+		stats.AvgCollectionMs = t.collectDuration.sum / float64(t.collectDuration.count) * 1000
+	}
+
+	for key, m := range t.routes {
+		codes := make(map[int]uint64, len(m.codes))
+		for code, n := range m.codes {
+			codes[code] = n
+		}
+		stats.Requests = append(stats.Requests, RouteStats{
+			Route:        key.route,
+			Method:       key.method,
+			Count:        m.duration.count,
+			Codes:        codes,
+			AvgLatencyMs: m.duration.sum / float64(m.duration.count) * 1000,
+			MaxLatencyMs: m.duration.max * 1000,
+		})
+	}
+	slices.SortFunc(stats.Requests, func(a, b RouteStats) int {
+		return strings.Compare(a.Route+" "+a.Method, b.Route+" "+b.Method)
+	})
+	return stats
+}
+
+// writePrometheus writes the host metrics of the latest sample, labelled with
+// the hostname and the host labels, and the server's own metrics in the
+// Prometheus text exposition format
+func (s *Server) writePrometheus(w io.Writer) {
+	host := `host="` + escapePromLabel(s.hostname) + `"`
+
+	if sample, ok := s.history.Latest(); ok {
+		for _, name := range labelNames(sample.Stats.Labels) {
+			host += "," + name + `="` + escapePromLabel(sample.Stats.Labels[name]) + `"`
+		}
+		for _, series := range remoteWriteSeries {
+			labels := host
+			for _, label := range series.labels {
+				labels += "," + label.name + `="` + escapePromLabel(label.value) + `"`
+			}
+			kind := "gauge"
+			if strings.HasSuffix(series.name, "_total") {
+				kind = "counter"
+			}
+			fmt.Fprintf(w, "# TYPE %s %s\n", series.name, kind)
+			fmt.Fprintf(w, "%s{%s} %s\n", series.name, labels, formatPromFloat(series.value(sample.Stats)))
+		}
+	}
+
+	t := s.telemetry
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys := make([]routeKey, 0, len(t.routes))
+	for key := range t.routes {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b routeKey) int {
+		return strings.Compare(a.route+" "+a.method, b.route+" "+b.method)
+	})
+
+	fmt.Fprintln(w, "# HELP stats_backend_http_requests_total HTTP requests served, by route pattern, method, and status code.")
+	fmt.Fprintln(w, "# TYPE stats_backend_http_requests_total counter")
+	for _, key := range keys {
+		m := t.routes[key]
+		codes := make([]int, 0, len(m.codes))
+		for code := range m.codes {
+			codes = append(codes, code)
+		}
+		slices.Sort(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "stats_backend_http_requests_total{route=\"%s\",method=\"%s\",code=\"%d\"} %d\n",
+				escapePromLabel(key.route), escapePromLabel(key.method), code, m.codes[code])
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP stats_backend_http_request_duration_seconds HTTP request latency, by route pattern and method.")
+	fmt.Fprintln(w, "# TYPE stats_backend_http_request_duration_seconds histogram")
+	for _, key := range keys {
+		labels := fmt.Sprintf("route=\"%s\",method=\"%s\"", escapePromLabel(key.route), escapePromLabel(key.method))
+		writePromHistogram(w, "stats_backend_http_request_duration_seconds", labels, t.routes[key].duration)
+	}
+
+	fmt.Fprintln(w, "# HELP stats_backend_sse_clients Connected SSE clients.")
+	fmt.Fprintln(w, "# TYPE stats_backend_sse_clients gauge")
+	fmt.Fprintf(w, "stats_backend_sse_clients %d\n", s.hub.Clients())
+
+	fmt.Fprintln(w, "# HELP stats_backend_collections_total Stats collections, including failed ones.")
+	fmt.Fprintln(w, "# TYPE stats_backend_collections_total counter")
+	fmt.Fprintf(w, "stats_backend_collections_total %d\n", t.collections)
+
+	fmt.Fprintln(w, "# HELP stats_backend_collection_errors_total Failed stats collections.")
+	fmt.Fprintln(w, "# TYPE stats_backend_collection_errors_total counter")
+	fmt.Fprintf(w, "stats_backend_collection_errors_total %d\n", t.collectionErrors)
+
+	fmt.Fprintln(w, "# HELP stats_backend_collection_duration_seconds Duration of stats collections.")
+	fmt.Fprintln(w, "# TYPE stats_backend_collection_duration_seconds histogram")
+	writePromHistogram(w, "stats_backend_collection_duration_seconds", "", t.collectDuration)
+
+	if len(s.sinks) > 0 {
+		fmt.Fprintln(w, "# HELP stats_backend_sink_samples_total Samples handed to sinks, by sink and result (written, failed, or dropped).")
+		fmt.Fprintln(w, "# TYPE stats_backend_sink_samples_total counter")
+		for _, runner := range s.sinks {
+			name := escapePromLabel(runner.sink.Name())
+			fmt.Fprintf(w, "stats_backend_sink_samples_total{sink=\"%s\",result=\"written\"} %d\n", name, runner.written.Load())
+			fmt.Fprintf(w, "stats_backend_sink_samples_total{sink=\"%s\",result=\"failed\"} %d\n", name, runner.failed.Load())
+			fmt.Fprintf(w, "stats_backend_sink_samples_total{sink=\"%s\",result=\"dropped\"} %d\n", name, runner.dropped.Load())
+		}
+	}
+}
+
+func writePromHistogram(w io.Writer, name, labels string, h *histogram) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	for i, bound := range latencyBuckets {
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, formatPromFloat(bound), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatPromFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapePromLabel(s string) string {
+	return promLabelEscaper.Replace(s)
+}
+
+func formatPromFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricsHandler serves Prometheus metrics. It is outside the API prefix,
+// where scrapers expect it.
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.writePrometheus(w)
+}
+
+// selfHandler godoc
+// @Summary Get server self-telemetry
+// @Description Returns the server's own operational metrics: requests per route, connected SSE clients, and collection counts and durations. The same metrics are served in the Prometheus format at /metrics.
+// @Tags system
+// @Produce json
+// @Success 200 {object} SelfStats
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /self [get]
+func (s *Server) selfHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.selfStats()); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
@@ -0,0 +1,327 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+)
+
+// Span kinds and status codes of opentelemetry.proto.trace.v1
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindServer   = 2
+	otlpStatusCodeError  = 2
+)
+
+const (
+	// tracerBuffer is the number of finished spans queued for export
+	tracerBuffer = 2048
+	// tracerBatchSize is the number of spans that triggers an early export
+	tracerBatchSize = 512
+	// tracerFlushInterval is the longest a finished span waits for export
+	tracerFlushInterval = 5 * time.Second
+)
+
+// OTLP/JSON message types of
+// opentelemetry.proto.collector.trace.v1.ExportTraceServiceRequest
+type (
+	otlpTracesRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpInstrumentationScope `json:"scope"`
+		Spans []otlpSpan               `json:"spans"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Message string `json:"message,omitempty"`
+		Code    int    `json:"code,omitempty"`
+	}
+)
+
+// span is one timed operation of a trace. A nil span is a no-op, which is
+// what startSpan returns when tracing is disabled or the trace is not sampled.
+type span struct {
+	tracer   *tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+	attrs    []otlpKeyValue
+}
+
+// spanKey is the context key of the current span
+type spanKey struct{}
+
+// startSpan starts a child of the span in ctx, if any
+func startSpan(ctx context.Context, name string) (context.Context, *span) {
+	parent, _ := ctx.Value(spanKey{}).(*span)
+	if parent == nil {
+		return ctx, nil
+	}
+	s := &span{
+		tracer:   parent.tracer,
+		traceID:  parent.traceID,
+		spanID:   newSpanID(),
+		parentID: parent.spanID,
+		name:     name,
+		kind:     otlpSpanKindInternal,
+		start:    time.Now(),
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttr adds a string or integer attribute to the span
+func (s *span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	kv := otlpKeyValue{Key: key}
+	switch v := value.(type) {
+	case int:
+		kv.Value.IntValue = strconv.Itoa(v)
+	case int64:
+		kv.Value.IntValue = strconv.FormatInt(v, 10)
+	default:
+		kv.Value.StringValue = fmt.Sprint(v)
+	}
+	s.attrs = append(s.attrs, kv)
+}
+
+// End finishes the span, marking it failed if err is not nil, and queues it
+// for export
+func (s *span) End(err error) {
+	if s == nil {
+		return
+	}
+	status := otlpStatus{}
+	if err != nil {
+		status = otlpStatus{Code: otlpStatusCodeError, Message: err.Error()}
+	}
+	s.tracer.finish(s, time.Now(), status)
+}
+
+// TraceID returns the hex trace ID of the span
+func (s *span) TraceID() string {
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// tracer samples root spans and exports finished spans over OTLP, in batches
+type tracer struct {
+	cfg      TracingConfig
+	exporter *otlpExporter
+	resource otlpResource
+	ch       chan otlpSpan
+}
+
+// newTracer creates a tracer whose resource carries the hostname and the
+// configured resource attributes, or returns nil when tracing is disabled
+func newTracer(cfg TracingConfig, hostname string) (*tracer, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tracing.endpoint: %w", err)
+	}
+
+	attrs := map[string]string{
+		"host.name":    hostname,
+		"service.name": "system-stats-backend",
+	}
+	for key, value := range cfg.ResourceAttributes {
+		attrs[key] = value
+	}
+
+	return &tracer{
+		cfg:      cfg,
+		exporter: newOTLPExporter(u, cfg.Protocol, "v1/traces", otlpTracesMethod, cfg.Headers, cfg.Timeout),
+		resource: otlpResource{Attributes: otlpAttributes(attrs)},
+		ch:       make(chan otlpSpan, tracerBuffer),
+	}, nil
+}
+
+// startRoot starts the root span of a new trace, subject to sampling. A
+// W3C traceparent continues the trace of the caller and its sampling decision.
+func (t *tracer) startRoot(ctx context.Context, name string, kind int, traceparent string) (context.Context, *span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	s := &span{tracer: t, spanID: newSpanID(), name: name, kind: kind, start: time.Now()}
+	if traceID, parentID, sampled, ok := parseTraceparent(traceparent); ok {
+		if !sampled {
+			return ctx, nil
+		}
+		s.traceID, s.parentID = traceID, parentID
+	} else {
+		rand.Read(s.traceID[:])
+		// The low 8 bytes of the trace ID are random, so they are a uniform sampling key
+		if float64(binary.BigEndian.Uint64(s.traceID[8:])>>11)/(1<<53) >= t.cfg.SampleRatio {
+			return ctx, nil
+		}
+	}
+	// Collectors called with the context record their subsystems as child spans
+	ctx = collector.WithTrace(ctx, traceCollection)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// traceCollection records the collection of a subsystem as a child span
+func traceCollection(ctx context.Context, name string) func(error) {
+	_, span := startSpan(ctx, name)
+	return span.End
+}
+
+// finish queues a finished span, dropping it when the export queue is full
+func (t *tracer) finish(s *span, end time.Time, status otlpStatus) {
+	exported := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: otlpTime(s.start),
+		EndTimeUnixNano:   otlpTime(end),
+		Attributes:        s.attrs,
+		Status:            status,
+	}
+	if s.parentID != [8]byte{} {
+		exported.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	select {
+	case t.ch <- exported:
+	default:
+	}
+}
+
+// run exports finished spans until ctx is cancelled, then flushes the queue
+func (t *tracer) run(ctx context.Context) {
+	ticker := time.NewTicker(tracerFlushInterval)
+	defer ticker.Stop()
+
+	var batch []otlpSpan
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.export(ctx, batch); err != nil {
+			slog.Error("Error exporting spans", "spans", len(batch), "error", err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for len(t.ch) > 0 {
+				batch = append(batch, <-t.ch)
+			}
+			flushCtx, cancel := context.WithTimeout(context.Background(), t.cfg.Timeout)
+			flush(flushCtx)
+			cancel()
+			return
+		case s := <-t.ch:
+			batch = append(batch, s)
+			if len(batch) >= tracerBatchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+// export sends one batch of spans
+func (t *tracer) export(ctx context.Context, spans []otlpSpan) error {
+	return t.exporter.export(ctx, otlpTracesRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: t.resource,
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpInstrumentationScope{Name: otlpScope, Version: version},
+			Spans: spans,
+		}},
+	}}})
+}
+
+// appendProto encodes the request as an ExportTraceServiceRequest
+func (r otlpTracesRequest) appendProto(b []byte) []byte {
+	for _, rs := range r.ResourceSpans {
+		msg := appendProtoMessage(nil, 1, rs.Resource.appendProto(nil))
+		for _, ss := range rs.ScopeSpans {
+			scope := appendProtoMessage(nil, 1, ss.Scope.appendProto(nil))
+			for _, span := range ss.Spans {
+				scope = appendProtoMessage(scope, 2, span.appendProto(nil))
+			}
+			msg = appendProtoMessage(msg, 2, scope)
+		}
+		b = appendProtoMessage(b, 1, msg)
+	}
+	return b
+}
+
+// appendProto encodes a Span; its IDs are bytes rather than hex
+func (s otlpSpan) appendProto(b []byte) []byte {
+	traceID, _ := hex.DecodeString(s.TraceID)
+	spanID, _ := hex.DecodeString(s.SpanID)
+	parentID, _ := hex.DecodeString(s.ParentSpanID)
+	b = appendProtoString(b, 1, string(traceID))
+	b = appendProtoString(b, 2, string(spanID))
+	b = appendProtoString(b, 4, string(parentID))
+	b = appendProtoString(b, 5, s.Name)
+	b = appendProtoInt(b, 6, int64(s.Kind))
+	b = appendProtoFixed64(b, 7, otlpNanos(s.StartTimeUnixNano))
+	b = appendProtoFixed64(b, 8, otlpNanos(s.EndTimeUnixNano))
+	b = appendOTLPAttributesProto(b, 9, s.Attributes)
+	status := appendProtoString(nil, 2, s.Status.Message)
+	return appendProtoMessage(b, 15, appendProtoInt(status, 3, int64(s.Status.Code)))
+}
+
+func newSpanID() [8]byte {
+	var id [8]byte
+	rand.Read(id[:])
+	return id
+}
+
+// parseTraceparent parses a W3C traceparent header, e.g.
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+func parseTraceparent(header string) (traceID [16]byte, parentID [8]byte, sampled bool, ok bool) {
+	parts := strings.Split(header, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, parentID, false, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == [16]byte{} {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil || parentID == [8]byte{} {
+		return traceID, parentID, false, false
+	}
+	return traceID, parentID, flags[0]&1 == 1, true
+}
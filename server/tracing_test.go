@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTracerExport(t *testing.T) {
+	tests := []struct {
+		protocol string
+		wantPath string
+	}{
+		{otlpProtocolJSON, "/v1/traces"},
+		{otlpProtocolProtobuf, "/v1/traces"},
+		{otlpProtocolGRPC, otlpTracesMethod},
+	}
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			endpoint, calls := testOTLPReceiver(t, "0")
+			tr, err := newTracer(TracingConfig{Enabled: true, Endpoint: endpoint, Protocol: tt.protocol, SampleRatio: 1, Timeout: 5 * time.Second}, "web-01")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, root := tr.startRoot(context.Background(), "GET /api/stats", otlpSpanKindServer, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			_, child := startSpan(ctx, "disk")
+			child.SetAttr("disk.count", 3)
+			child.SetAttr("disk.path", "/data")
+			child.End(errors.New("permission denied"))
+			root.End(nil)
+			spans := []otlpSpan{<-tr.ch, <-tr.ch}
+			if err := tr.export(context.Background(), spans); err != nil {
+				t.Fatalf("export() error = %v", err)
+			}
+
+			call := <-calls
+			if call.path != tt.wantPath {
+				t.Errorf("exported to %s, want %s", call.path, tt.wantPath)
+			}
+			if tt.protocol == otlpProtocolJSON {
+				var got otlpTracesRequest
+				if err := json.Unmarshal(call.body, &got); err != nil {
+					t.Fatal(err)
+				}
+				if exported := got.ResourceSpans[0].ScopeSpans[0].Spans; len(exported) != 2 || exported[0].ParentSpanID != exported[1].SpanID {
+					t.Errorf("got spans %+v", exported)
+				}
+				return
+			}
+
+			// ExportTraceServiceRequest has the same fields as TracesData
+			got := &tracepb.TracesData{}
+			if err := proto.Unmarshal(call.body, got); err != nil {
+				t.Fatalf("decoding the request: %v", err)
+			}
+			rs := got.GetResourceSpans()[0]
+			if attrs := rs.GetResource().GetAttributes(); len(attrs) != 2 || attrs[0].GetKey() != "host.name" || attrs[0].GetValue().GetStringValue() != "web-01" {
+				t.Errorf("got resource attributes %v", attrs)
+			}
+			if scope := rs.GetScopeSpans()[0].GetScope(); scope.GetName() != otlpScope || scope.GetVersion() != version {
+				t.Errorf("got scope %v", scope)
+			}
+			exported := rs.GetScopeSpans()[0].GetSpans()
+			if len(exported) != 2 {
+				t.Fatalf("got %d spans, want 2", len(exported))
+			}
+			disk, server := exported[0], exported[1]
+			if traceID := hex.EncodeToString(server.GetTraceId()); traceID != "4bf92f3577b34da6a3ce929d0e0e4736" || hex.EncodeToString(disk.GetTraceId()) != traceID {
+				t.Errorf("got trace IDs %x and %x", server.GetTraceId(), disk.GetTraceId())
+			}
+			if hex.EncodeToString(server.GetParentSpanId()) != "00f067aa0ba902b7" || string(disk.GetParentSpanId()) != string(server.GetSpanId()) || len(disk.GetSpanId()) != 8 {
+				t.Errorf("got span %x with parent %x, child %x of %x", server.GetSpanId(), server.GetParentSpanId(), disk.GetSpanId(), disk.GetParentSpanId())
+			}
+			if server.GetName() != "GET /api/stats" || server.GetKind() != tracepb.Span_SPAN_KIND_SERVER || server.GetStatus().GetCode() != tracepb.Status_STATUS_CODE_UNSET {
+				t.Errorf("got server span %v", server)
+			}
+			if disk.GetKind() != tracepb.Span_SPAN_KIND_INTERNAL || disk.GetStatus().GetCode() != tracepb.Status_STATUS_CODE_ERROR || disk.GetStatus().GetMessage() != "permission denied" {
+				t.Errorf("got disk span %v", disk)
+			}
+			if disk.GetStartTimeUnixNano() == 0 || disk.GetEndTimeUnixNano() < disk.GetStartTimeUnixNano() {
+				t.Errorf("disk span from %d to %d", disk.GetStartTimeUnixNano(), disk.GetEndTimeUnixNano())
+			}
+			if attrs := disk.GetAttributes(); len(attrs) != 2 || attrs[0].GetValue().GetIntValue() != 3 || attrs[1].GetValue().GetStringValue() != "/data" {
+				t.Errorf("got disk attributes %v", attrs)
+			}
+		})
+	}
+}
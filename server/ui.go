@@ -0,0 +1,36 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// uiFiles holds the dashboard, a static page that follows the SSE stream
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// uiHandler serves the embedded dashboard under /ui/
+func uiHandler() http.Handler {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	fileServer := http.StripPrefix("/ui/", http.FileServer(http.FS(files)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// The files change with the binary, so always revalidate
+		w.Header().Set("Cache-Control", "no-cache")
+		// Serve the generated type definitions as text rather than by the
+		// system's guess for .ts files
+		if strings.HasSuffix(r.URL.Path, ".ts") {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,384 @@
+// Code generated by system-stats-backend -gen-types. DO NOT EDIT.
+
+export interface SystemStats {
+  cpuUsage: number;
+  memUsage: number;
+  diskUsage: number;
+  netTraffic: number;
+  memUsed?: number;
+  diskUsed?: number;
+  filesystems?: Filesystem[];
+  processes: ProcessInfo[];
+  processCount?: number;
+  zombies?: number;
+  extra?: Record<string, unknown>;
+  errors?: Record<string, string>;
+  labels?: Record<string, string>;
+  rates?: Rates;
+  runtime?: RuntimeInfo;
+}
+
+export interface Sample {
+  seq: number;
+  timestamp: string;
+  stats: SystemStats | null;
+}
+
+export interface Event {
+  seq?: number;
+  timestamp: string;
+  host: string;
+  data: unknown;
+}
+
+export interface ErrorData {
+  message: string;
+}
+
+export interface ShutdownData {
+  message: string;
+  retryMs: number;
+}
+
+export interface VersionInfo {
+  version: string;
+  commit?: string;
+  buildDate?: string;
+  goVersion: string;
+  platform: string;
+  collectors: string[];
+  sinks: string[];
+  demo?: boolean;
+}
+
+export interface ZFSStats {
+  pools: ZFSPool[];
+  degraded: number;
+  arc?: ZFSARC;
+}
+
+export interface MDRaidStats {
+  arrays: MDArray[];
+  degraded: number;
+}
+
+export interface Pressure {
+  cpu: PressureResource;
+  memory: PressureResource;
+  io: PressureResource;
+}
+
+export interface HugePages {
+  pools: HugePagePool[];
+  hugetlb: number;
+  anonHugePages: number;
+}
+
+export interface NUMAStats {
+  nodes: NUMANode[];
+}
+
+export interface HealthStatus {
+  status: string;
+  uptimeSeconds: number;
+}
+
+export interface ReadinessStatus {
+  status: string;
+  lastSample?: string;
+  sampleAgeSeconds?: number;
+  maxAgeSeconds: number;
+  error?: string;
+}
+
+export interface SelfStats {
+  uptimeSeconds: number;
+  sseClients: number;
+  collections: number;
+  collectionErrors: number;
+  lastCollectionMs: number;
+  avgCollectionMs: number;
+  maxCollectionMs: number;
+  requests: RouteStats[];
+  sinks: SinkStats[];
+}
+
+export interface RuntimeStats {
+  goroutines: number;
+  heapAlloc: number;
+  heapSys: number;
+  heapObjects: number;
+  totalAlloc: number;
+  sys: number;
+  numGc: number;
+  pauseTotalMs: number;
+  lastGc?: string;
+  gomaxprocs: number;
+}
+
+export interface ProcessList {
+  total: number;
+  zombies?: number;
+  offset: number;
+  limit: number;
+  processes: ProcessInfo[];
+}
+
+export interface ProcessDetail {
+  pid: number;
+  ppid: number;
+  name: string;
+  cmdline: string;
+  cwd?: string;
+  username?: string;
+  startTime: string;
+  status: string;
+  numThreads: number;
+  openFiles: number;
+  voluntaryCtxSwitches: number;
+  involuntaryCtxSwitches: number;
+  cpuPercent: number;
+  nice: number;
+  ionice?: IONiceInfo;
+  memory: ProcessMemory;
+  io?: ProcessIOStat;
+}
+
+export interface ProcessGroup {
+  key: string;
+  count: number;
+  cpuPercent: number;
+  memoryUsage: number;
+}
+
+export interface ProcessNode {
+  pid: number;
+  ppid: number;
+  name: string;
+  username?: string;
+  cpuPercent: number;
+  memoryUsage: number;
+  numFds: number;
+  numThreads: number;
+  status: string;
+  voluntaryCtxSwitches: number;
+  involuntaryCtxSwitches: number;
+  kernelThread?: boolean;
+  children: ProcessNode[];
+}
+
+export interface ProcessFiles {
+  pid: number;
+  count: number;
+  files: OpenFile[];
+}
+
+export interface ProcessConnections {
+  pid: number;
+  count: number;
+  connections: Connection[];
+}
+
+export interface SignalRequest {
+  signal: string;
+}
+
+export interface SignalResult {
+  pid: number;
+  signal: string;
+  sent: boolean;
+}
+
+export interface PriorityRequest {
+  nice: number | null;
+}
+
+export interface PriorityResult {
+  pid: number;
+  nice: number;
+}
+
+export interface Watch {
+  id: string;
+  pid?: number;
+  name?: string;
+  latest?: WatchPoint;
+}
+
+export interface WatchHistory {
+  id: string;
+  points: WatchPoint[];
+}
+
+export interface Filesystem {
+  mountpoint: string;
+  device?: string;
+  fstype?: string;
+  total: number;
+  used: number;
+  usedPercent: number;
+  network?: boolean;
+  stale?: boolean;
+}
+
+export interface ProcessInfo {
+  pid: number;
+  ppid: number;
+  name: string;
+  username?: string;
+  cpuPercent: number;
+  memoryUsage: number;
+  numFds: number;
+  numThreads: number;
+  status: string;
+  voluntaryCtxSwitches: number;
+  involuntaryCtxSwitches: number;
+  kernelThread?: boolean;
+}
+
+export interface Rates {
+  memGrowth: number;
+  diskFill: number;
+  netThroughput: number;
+}
+
+export interface RuntimeInfo {
+  container: boolean;
+  engine?: string;
+  cgroupVersion?: number;
+  cgroupPath?: string;
+  cpu?: ContainerResource;
+  memory?: ContainerResource;
+}
+
+export interface ZFSPool {
+  name: string;
+  health: string;
+  scan?: ZFSScan;
+}
+
+export interface ZFSARC {
+  size: number;
+  targetSize: number;
+  hits: number;
+  misses: number;
+  hitRate: number;
+}
+
+export interface MDArray {
+  name: string;
+  state: string;
+  level?: string;
+  disks: number;
+  active: number;
+  members: string[];
+  failed?: string[];
+  spare?: string[];
+  degraded: boolean;
+  sync?: MDSync;
+}
+
+export interface PressureResource {
+  some: PressureAverages;
+  full?: PressureAverages;
+}
+
+export interface HugePagePool {
+  size: number;
+  total: number;
+  free: number;
+  reserved?: number;
+  surplus: number;
+}
+
+export interface NUMANode {
+  node: number;
+  memTotal: number;
+  memFree: number;
+  memUsed: number;
+  usedPercent: number;
+  hugePages?: HugePagePool[];
+}
+
+export interface RouteStats {
+  route: string;
+  method: string;
+  count: number;
+  codes: Record<string, number>;
+  avgLatencyMs: number;
+  maxLatencyMs: number;
+}
+
+export interface SinkStats {
+  sink: string;
+  written: number;
+  failed: number;
+  dropped: number;
+}
+
+export interface IONiceInfo {
+  class: string;
+  level: number;
+}
+
+export interface ProcessMemory {
+  rss: number;
+  vms: number;
+  swap: number;
+}
+
+export interface ProcessIOStat {
+  readCount: number;
+  writeCount: number;
+  readBytes: number;
+  writeBytes: number;
+}
+
+export interface OpenFile {
+  fd: number;
+  path: string;
+}
+
+export interface Connection {
+  fd: number;
+  protocol: string;
+  localAddr: string;
+  remoteAddr?: string;
+  status?: string;
+}
+
+export interface WatchPoint {
+  timestamp: string;
+  count: number;
+  cpuPercent: number;
+  memoryUsage: number;
+}
+
+export interface ContainerResource {
+  limit: number;
+  used: number;
+  ofLimit?: number;
+  ofHost: number;
+  hostUsage: number;
+}
+
+export interface ZFSScan {
+  function: string;
+  state: string;
+  progress?: number;
+  errors: number;
+}
+
+export interface MDSync {
+  action: string;
+  progress: number;
+  finish?: string;
+  pending?: boolean;
+}
+
+export interface PressureAverages {
+  avg10: number;
+  avg60: number;
+  avg300: number;
+  total: number;
+}
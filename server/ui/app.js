@@ -0,0 +1,252 @@
+// Dashboard for system-stats-backend. It seeds the charts from the history
+// buffer, then follows the SSE stream; EventSource reconnects on its own and
+// resumes from the last event ID.
+"use strict";
+
+// The API types are generated from the Go structs into api.d.ts
+/** @typedef {import("./api").SystemStats} SystemStats */
+/** @typedef {import("./api").ProcessInfo} ProcessInfo */
+/** @typedef {import("./api").Sample} Sample */
+
+const api = new URL("../api/", location.href);
+const maxPoints = 150;
+const maxRows = 200;
+
+const series = { cpu: [], mem: [], disk: [], net: [] };
+let lastNet = null;
+// Errors of the subsystems that failed in the latest sample, by collector name
+/** @type {Record<string, string>} */
+let failed = {};
+/** @type {ProcessInfo[]} */
+let processes = [];
+// Number of processes on the host; the stream only lists the heaviest ones
+let processCount = 0;
+let sort = { key: "cpuPercent", asc: false };
+
+function formatBytes(n) {
+  const units = ["B", "KB", "MB", "GB", "TB"];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return n.toFixed(i === 0 ? 0 : 1) + " " + units[i];
+}
+
+function push(points, t, v) {
+  points.push({ t, v });
+  if (points.length > maxPoints) {
+    points.shift();
+  }
+}
+
+// addSample appends one sample to the series. Network traffic is a running
+// total, so its chart shows the rate between consecutive samples. Subsystems
+// that failed to collect are reported as zero, so they are skipped.
+/** @param {string} timestamp @param {SystemStats} stats */
+function addSample(timestamp, stats) {
+  const t = new Date(timestamp).getTime();
+  failed = stats.errors || {};
+  for (const topic of ["cpu", "mem", "disk"]) {
+    if (!failed[topic]) {
+      push(series[topic], t, stats[topic + "Usage"]);
+    }
+  }
+  if (failed.net) {
+    return;
+  }
+  if (lastNet && t > lastNet.t && stats.netTraffic >= lastNet.v) {
+    push(series.net, t, ((stats.netTraffic - lastNet.v) * 1000) / (t - lastNet.t));
+  }
+  lastNet = { t, v: stats.netTraffic };
+}
+
+// renderValue shows the latest value of a chart, or that its subsystem failed
+function renderValue(topic, text) {
+  const el = document.getElementById(topic + "-value");
+  el.textContent = failed[topic] ? "unavailable" : text;
+  el.title = failed[topic] || "";
+  el.classList.toggle("failed", !!failed[topic]);
+}
+
+function drawChart(id, points, max, color) {
+  const canvas = document.getElementById(id);
+  const ratio = window.devicePixelRatio || 1;
+  const width = canvas.clientWidth;
+  const height = canvas.clientHeight;
+  canvas.width = width * ratio;
+  canvas.height = height * ratio;
+
+  const ctx = canvas.getContext("2d");
+  ctx.scale(ratio, ratio);
+  ctx.clearRect(0, 0, width, height);
+
+  ctx.strokeStyle = "#26313d";
+  ctx.lineWidth = 1;
+  for (let i = 1; i < 4; i++) {
+    const y = Math.round((height * i) / 4) + 0.5;
+    ctx.beginPath();
+    ctx.moveTo(0, y);
+    ctx.lineTo(width, y);
+    ctx.stroke();
+  }
+  if (points.length < 2) {
+    return;
+  }
+
+  const top = max || Math.max(1, ...points.map((p) => p.v)) * 1.1;
+  const x = (i) => (i * width) / (maxPoints - 1);
+  const y = (v) => height - (Math.min(v, top) / top) * (height - 2) - 1;
+  const offset = maxPoints - points.length;
+
+  ctx.beginPath();
+  points.forEach((p, i) => {
+    if (i === 0) {
+      ctx.moveTo(x(offset + i), y(p.v));
+    } else {
+      ctx.lineTo(x(offset + i), y(p.v));
+    }
+  });
+  ctx.strokeStyle = color;
+  ctx.lineWidth = 1.5;
+  ctx.stroke();
+
+  ctx.lineTo(x(offset + points.length - 1), height);
+  ctx.lineTo(x(offset), height);
+  ctx.closePath();
+  ctx.fillStyle = color + "33";
+  ctx.fill();
+}
+
+function last(points) {
+  return points.length ? points[points.length - 1].v : null;
+}
+
+function renderCharts() {
+  const percent = (v) => (v === null ? "–" : v.toFixed(1) + " %");
+  renderValue("cpu", percent(last(series.cpu)));
+  renderValue("mem", percent(last(series.mem)));
+  renderValue("disk", percent(last(series.disk)));
+  const net = last(series.net);
+  renderValue("net", net === null ? "–" : formatBytes(net) + "/s");
+
+  drawChart("cpu-chart", series.cpu, 100, "#4fb3ff");
+  drawChart("mem-chart", series.mem, 100, "#a27cf2");
+  drawChart("disk-chart", series.disk, 100, "#f2b84b");
+  drawChart("net-chart", series.net, 0, "#5cd68a");
+}
+
+function renderProcesses() {
+  const filter = document.getElementById("filter").value.trim().toLowerCase();
+  const rows = processes.filter(
+    (p) =>
+      !filter ||
+      p.name.toLowerCase().includes(filter) ||
+      (p.username || "").toLowerCase().includes(filter) ||
+      String(p.pid) === filter
+  );
+
+  const dir = sort.asc ? 1 : -1;
+  rows.sort((a, b) => {
+    const x = a[sort.key] ?? "";
+    const y = b[sort.key] ?? "";
+    if (typeof x === "string" || typeof y === "string") {
+      return String(x).localeCompare(String(y)) * dir;
+    }
+    return (x - y) * dir;
+  });
+
+  const total = Math.max(processCount, processes.length);
+  document.getElementById("process-count").textContent =
+    rows.length === total ? `(${total})` : `(${rows.length} of ${total})`;
+
+  const tbody = document.getElementById("process-rows");
+  const fragment = document.createDocumentFragment();
+  for (const p of rows.slice(0, maxRows)) {
+    const tr = document.createElement("tr");
+    const cells = [
+      [p.pid, "num"],
+      [p.name, ""],
+      [p.username || "", ""],
+      [p.status, ""],
+      [p.cpuPercent.toFixed(1), p.cpuPercent >= 50 ? "num hot" : "num"],
+      [p.memoryUsage.toFixed(1), "num"],
+      [p.numThreads, "num"],
+      [p.numFds, "num"],
+    ];
+    for (const [text, className] of cells) {
+      const td = document.createElement("td");
+      td.textContent = text;
+      td.className = className;
+      tr.appendChild(td);
+    }
+    fragment.appendChild(tr);
+  }
+  tbody.replaceChildren(fragment);
+
+  document.querySelectorAll("th").forEach((th) => {
+    th.classList.toggle("sorted", th.dataset.key === sort.key);
+    th.classList.toggle("asc", th.dataset.key === sort.key && sort.asc);
+  });
+}
+
+function setStatus(text, state) {
+  const status = document.getElementById("status");
+  status.textContent = text;
+  status.className = "status " + state;
+}
+
+async function loadHistory() {
+  try {
+    const res = await fetch(new URL("history?topProcs=1", api), { headers: { Accept: "application/json" } });
+    if (!res.ok) {
+      return;
+    }
+    for (const sample of await res.json()) {
+      addSample(sample.timestamp, sample.stats);
+    }
+    renderCharts();
+  } catch (err) {
+    console.warn("Error loading history", err);
+  }
+}
+
+function connect() {
+  const events = new EventSource(new URL("events", api));
+
+  events.addEventListener("open", () => setStatus("live", "live"));
+
+  events.addEventListener("stats", (e) => {
+    const event = JSON.parse(e.data);
+    document.getElementById("host").textContent = event.host;
+    addSample(event.timestamp, event.data);
+    processes = event.data.processes || [];
+    processCount = event.data.processCount || 0;
+    renderCharts();
+    renderProcesses();
+  });
+
+  // Both connection failures and "error" events of failed collections
+  // arrive here; only the latter carry data
+  events.addEventListener("error", (e) => {
+    if (e.data) {
+      setStatus(JSON.parse(e.data).data.message, "down");
+    } else {
+      setStatus("reconnecting…", "down");
+    }
+  });
+
+  events.addEventListener("shutdown", () => setStatus("server restarting…", "down"));
+}
+
+document.querySelectorAll("th").forEach((th) => {
+  th.addEventListener("click", () => {
+    const key = th.dataset.key;
+    sort = sort.key === key ? { key, asc: !sort.asc } : { key, asc: key === "name" || key === "username" };
+    renderProcesses();
+  });
+});
+document.getElementById("filter").addEventListener("input", renderProcesses);
+window.addEventListener("resize", renderCharts);
+
+loadHistory().then(connect);
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// Build information, injected at build time with
+//
+//	-ldflags "-X $(pkg).version=1.2.0 -X $(pkg).commit=$(git rev-parse HEAD) -X $(pkg).buildDate=$(date -u +%FT%TZ)"
+//
+// where pkg is github.com/thatbeautifuldream/system-stats-backend/server.
+//
+// The commit and build date fall back to the VCS information Go embeds.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// BuildVersionInfo returns the build information, filling in the commit and
+// build date from the embedded VCS information when they were not injected
+func BuildVersionInfo() models.VersionInfo {
+	info := models.VersionInfo{
+		Version:    version,
+		Commit:     commit,
+		BuildDate:  buildDate,
+		GoVersion:  runtime.Version(),
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+		Collectors: collector.Topics(),
+		Sinks:      []string{},
+		Demo:       collector.Demo(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+// versionHandler godoc
+// @Summary Get build information
+// @Description Returns the version, git commit, build date, Go version, and enabled collectors and sinks of the running binary
+// @Tags system
+// @Produce json
+// @Success 200 {object} models.VersionInfo
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /version [get]
+func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info := BuildVersionInfo()
+	for _, runner := range s.sinks {
+		info.Sinks = append(info.Sinks, runner.sink.Name())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
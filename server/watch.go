@@ -0,0 +1,393 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// WatchTarget describes the processes tracked by a watch: either a single PID
+// or every process whose name matches a regular expression
+// @Description Processes tracked by a watch, selected by PID or name pattern
+type WatchTarget struct {
+	ID   string `json:"id" yaml:"id" example:"nginx"`
+	PID  int32  `json:"pid,omitempty" yaml:"pid" example:"0"`
+	Name string `json:"name,omitempty" yaml:"name" example:"^nginx"`
+}
+
+// WatchPoint represents the combined usage of the processes matched by a watch at one tick
+// @Description Combined usage of the processes matched by a watch at one point in time
+type WatchPoint struct {
+	Timestamp   time.Time `json:"timestamp" example:"2024-01-01T12:00:00Z"`
+	Count       int       `json:"count" example:"4"`
+	CPUPercent  float64   `json:"cpuPercent" example:"12.5"`
+	MemoryUsage float32   `json:"memoryUsage" example:"512.0"` // in MB
+}
+
+// Watch represents a watch and its most recent point
+// @Description A registered watch with its most recent point
+type Watch struct {
+	WatchTarget
+	Latest *WatchPoint `json:"latest,omitempty"`
+}
+
+// WatchHistory represents the recorded time series of a watch
+// @Description Recorded time series of a watch, oldest first
+type WatchHistory struct {
+	ID     string       `json:"id" example:"nginx"`
+	Points []WatchPoint `json:"points"`
+}
+
+var (
+	// errWatchNotFound is returned when the requested watch does not exist
+	errWatchNotFound = errors.New("watch not found")
+	// errWatchExists is returned when registering a watch with an ID already in use
+	errWatchExists = errors.New("watch already exists")
+
+	watchIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// watchEntry holds a registered watch and its recorded points
+type watchEntry struct {
+	target  WatchTarget
+	pattern *regexp.Regexp
+	points  *ring[WatchPoint]
+}
+
+// matches reports whether a process belongs to the watch
+func (e *watchEntry) matches(proc models.ProcessInfo) bool {
+	if e.pattern != nil {
+		return e.pattern.MatchString(proc.Name)
+	}
+	return proc.PID == e.target.PID
+}
+
+// watcher records the usage of the watched processes from the samples the
+// hub collects and keeps a per-watch history
+type watcher struct {
+	mu       sync.RWMutex
+	interval time.Duration
+	size     int
+	entries  map[string]*watchEntry
+	order    []string
+	// last is the time of the most recent recorded sample
+	last time.Time
+}
+
+// newWatcher creates a watcher for the configured targets
+func newWatcher(cfg WatchConfig) (*watcher, error) {
+	w := &watcher{
+		interval: cfg.Interval,
+		size:     cfg.HistorySize,
+		entries:  map[string]*watchEntry{},
+	}
+	for _, target := range cfg.Targets {
+		if err := w.Add(target); err != nil {
+			return nil, fmt.Errorf("invalid watch target: %w", err)
+		}
+	}
+	return w, nil
+}
+
+// Add registers a new watch
+func (w *watcher) Add(target WatchTarget) error {
+	if !watchIDPattern.MatchString(target.ID) {
+		return fmt.Errorf("invalid watch id %q", target.ID)
+	}
+	if (target.PID == 0) == (target.Name == "") {
+		return fmt.Errorf("watch %q must set exactly one of pid or name", target.ID)
+	}
+
+	entry := &watchEntry{target: target, points: newRing[WatchPoint](w.size)}
+	if target.Name != "" {
+		pattern, err := regexp.Compile(target.Name)
+		if err != nil {
+			return fmt.Errorf("watch %q has invalid name pattern: %w", target.ID, err)
+		}
+		entry.pattern = pattern
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.entries[target.ID]; ok {
+		return fmt.Errorf("%w: %q", errWatchExists, target.ID)
+	}
+	w.entries[target.ID] = entry
+	w.order = append(w.order, target.ID)
+	return nil
+}
+
+// Remove unregisters a watch
+func (w *watcher) Remove(id string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.entries[id]; !ok {
+		return errWatchNotFound
+	}
+	delete(w.entries, id)
+	for i, existing := range w.order {
+		if existing == id {
+			w.order = append(w.order[:i], w.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// List returns all watches with their most recent point
+func (w *watcher) List() []Watch {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	watches := make([]Watch, 0, len(w.order))
+	for _, id := range w.order {
+		entry := w.entries[id]
+		watch := Watch{WatchTarget: entry.target}
+		if latest, ok := entry.points.Last(); ok {
+			watch.Latest = &latest
+		}
+		watches = append(watches, watch)
+	}
+	return watches
+}
+
+// History returns the recorded points of a watch, oldest first
+func (w *watcher) History(id string) (*WatchHistory, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	entry, ok := w.entries[id]
+	if !ok {
+		return nil, errWatchNotFound
+	}
+	return &WatchHistory{ID: id, Points: entry.points.Slice()}, nil
+}
+
+// Expire drops the points recorded before t and returns the number dropped
+func (w *watcher) Expire(t time.Time) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	dropped := 0
+	for _, entry := range w.entries {
+		dropped += entry.points.DropWhile(func(point WatchPoint) bool {
+			return point.Timestamp.Before(t)
+		})
+	}
+	return dropped
+}
+
+// point sums the usage of the processes matched by the watch
+func (e *watchEntry) point(procs []models.ProcessInfo, at time.Time) WatchPoint {
+	point := WatchPoint{Timestamp: at}
+	for _, proc := range procs {
+		if e.matches(proc) {
+			point.Count++
+			point.CPUPercent += proc.CPUPercent
+			point.MemoryUsage += proc.MemoryUsage
+		}
+	}
+	return point
+}
+
+// observe records a point for every watch from the processes of a collected
+// sample, at most one per interval. Samples whose processes failed to
+// collect are skipped.
+func (w *watcher) observe(sample models.Sample) {
+	if sample.Stats == nil {
+		return
+	}
+	if _, failed := sample.Stats.Errors[collector.TopicProcesses]; failed {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// Allow a tenth of the interval of slack so that collection jitter does
+	// not skip every other sample
+	if sample.Timestamp.Sub(w.last) < w.interval-w.interval/10 {
+		return
+	}
+	w.last = sample.Timestamp
+	for _, entry := range w.entries {
+		entry.points.Push(entry.point(sample.Stats.Processes, sample.Timestamp))
+	}
+}
+
+// watchMetricFields are the fields of the points that alert rules can use,
+// as metrics named watch.<id>.<field>
+var watchMetricFields = map[string]func(WatchPoint) float64{
+	"count":       func(p WatchPoint) float64 { return float64(p.Count) },
+	"cpuPercent":  func(p WatchPoint) float64 { return p.CPUPercent },
+	"memoryUsage": func(p WatchPoint) float64 { return float64(p.MemoryUsage) },
+}
+
+// parseWatchMetric splits a watch metric, e.g. watch.nginx.cpuPercent, into
+// the watch ID and the field
+func parseWatchMetric(name string) (id, field string, ok bool) {
+	rest, ok := strings.CutPrefix(name, "watch.")
+	if !ok {
+		return "", "", false
+	}
+	i := strings.LastIndexByte(rest, '.')
+	if i < 0 {
+		return "", "", false
+	}
+	id, field = rest[:i], rest[i+1:]
+	if _, ok := watchMetricFields[field]; !ok || !watchIDPattern.MatchString(id) {
+		return "", "", false
+	}
+	return id, field, true
+}
+
+// Metric returns the alert metric of a watch, measured on the processes of
+// each sample. Once the watch is removed it matches no process.
+func (w *watcher) Metric(name string) (queryMetric, error) {
+	id, field, ok := parseWatchMetric(name)
+	if !ok {
+		return queryMetric{}, fmt.Errorf("unknown metric %q", name)
+	}
+	w.mu.RLock()
+	_, exists := w.entries[id]
+	w.mu.RUnlock()
+	if !exists {
+		return queryMetric{}, fmt.Errorf("metric %q: %w: %q", name, errWatchNotFound, id)
+	}
+
+	value := watchMetricFields[field]
+	return queryMetric{topic: collector.TopicProcesses, value: func(stats *models.SystemStats) float64 {
+		w.mu.RLock()
+		entry, ok := w.entries[id]
+		w.mu.RUnlock()
+		if !ok {
+			return 0
+		}
+		return value(entry.point(stats.Processes, time.Time{}))
+	}}, nil
+}
+
+// watchHandler dispatches /watch requests by method
+func (s *Server) watchHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.watchListHandler(w, r)
+	case http.MethodPost:
+		s.auditMiddleware("watch.create", s.adminMiddleware(s.watchCreateHandler))(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// watchItemHandler dispatches /watch/{id} requests by method
+func (s *Server) watchItemHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.auditMiddleware("watch.delete", s.adminMiddleware(s.watchDeleteHandler))(w, r)
+}
+
+// watchListHandler godoc
+// @Summary List watches
+// @Description Returns all registered process watches with their most recent point
+// @Tags watch
+// @Produce json
+// @Success 200 {array} Watch
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /watch [get]
+func (s *Server) watchListHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.watcher.List()); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
+
+// watchCreateHandler godoc
+// @Summary Register a watch
+// @Description Registers a PID or process name pattern to be tracked on every tick. Requires the admin token.
+// @Tags watch
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param request body WatchTarget true "Watch to register"
+// @Success 201 {object} Watch
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 409 {string} string "Conflict"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /watch [post]
+func (s *Server) watchCreateHandler(w http.ResponseWriter, r *http.Request) {
+	var target WatchTarget
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.watcher.Add(target); err != nil {
+		if errors.Is(err, errWatchExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(Watch{WatchTarget: target}); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
+
+// watchDeleteHandler godoc
+// @Summary Remove a watch
+// @Description Unregisters a watch and discards its history. Requires the admin token.
+// @Tags watch
+// @Security AdminToken
+// @Param id path string true "Watch ID"
+// @Success 204
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not Found"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /watch/{id} [delete]
+func (s *Server) watchDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.watcher.Remove(r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// watchHistoryHandler godoc
+// @Summary Get watch history
+// @Description Returns the per-tick time series of combined CPU and memory usage for the processes matched by a watch
+// @Tags watch
+// @Produce json
+// @Param id path string true "Watch ID"
+// @Success 200 {object} WatchHistory
+// @Failure 404 {string} string "Not Found"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /watch/{id}/history [get]
+func (s *Server) watchHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	history, err := s.watcher.History(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(history); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+func TestParseWatchMetric(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantID    string
+		wantField string
+		wantOK    bool
+	}{
+		{"watch.nginx.cpuPercent", "nginx", "cpuPercent", true},
+		{"watch.db.v2.count", "db.v2", "count", true},
+		{"watch.nginx.memoryUsage", "nginx", "memoryUsage", true},
+		{"watch.nginx.uptime", "", "", false},
+		{"watch.nginx", "", "", false},
+		{"watch..count", "", "", false},
+		{"cpuUsage", "", "", false},
+	}
+	for _, tt := range tests {
+		id, field, ok := parseWatchMetric(tt.name)
+		if id != tt.wantID || field != tt.wantField || ok != tt.wantOK {
+			t.Errorf("parseWatchMetric(%q) = %q, %q, %v, want %q, %q, %v", tt.name, id, field, ok, tt.wantID, tt.wantField, tt.wantOK)
+		}
+	}
+}
+
+func TestWatcherObserve(t *testing.T) {
+	w, err := newWatcher(WatchConfig{
+		Interval:    5 * time.Second,
+		HistorySize: 10,
+		Targets:     []WatchTarget{{ID: "nginx", Name: "^nginx"}, {ID: "db", PID: 42}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	procs := []models.ProcessInfo{
+		{PID: 10, Name: "nginx", CPUPercent: 10, MemoryUsage: 50},
+		{PID: 11, Name: "nginx", CPUPercent: 5, MemoryUsage: 30},
+		{PID: 42, Name: "postgres", CPUPercent: 20, MemoryUsage: 400},
+	}
+	start := time.Unix(1000, 0)
+	for _, tt := range []struct {
+		offset time.Duration
+		failed bool
+	}{
+		{0, false},
+		{2 * time.Second, false}, // within the interval
+		{5 * time.Second, true},  // processes failed to collect
+		{6 * time.Second, false},
+	} {
+		stats := &models.SystemStats{Processes: procs}
+		if tt.failed {
+			stats.Errors = map[string]string{collector.TopicProcesses: "timeout"}
+		}
+		w.observe(models.Sample{Timestamp: start.Add(tt.offset), Stats: stats})
+	}
+
+	history, err := w.History("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Points) != 2 {
+		t.Fatalf("points = %d, want 2", len(history.Points))
+	}
+	want := WatchPoint{Timestamp: start.Add(6 * time.Second), Count: 2, CPUPercent: 15, MemoryUsage: 80}
+	if got := history.Points[1]; got != want {
+		t.Errorf("point = %+v, want %+v", got, want)
+	}
+
+	metric, err := w.Metric("watch.db.memoryUsage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := metric.value(&models.SystemStats{Processes: procs}); got != 400 {
+		t.Errorf("watch.db.memoryUsage = %v, want 400", got)
+	}
+	if _, err := w.Metric("watch.missing.count"); err == nil {
+		t.Error("Metric() of an unknown watch succeeded")
+	}
+}
+
+func TestAlertEngineWatchMetric(t *testing.T) {
+	w, err := newWatcher(WatchConfig{Interval: time.Second, HistorySize: 10, Targets: []WatchTarget{{ID: "nginx", Name: "^nginx"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := []AlertRule{{Name: "nginx-down", Metric: "watch.nginx.count", Op: "<", Value: 1}}
+	e, err := newAlertEngine(AlertsConfig{HistorySize: 10, Rules: rules}, nil, newHistory(10, 0), w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var alerts []Alert
+	e.publish = func(eventType string, data interface{}) { alerts = append(alerts, data.(Alert)) }
+	e.observe(models.Sample{Timestamp: time.Unix(1000, 0), Stats: &models.SystemStats{Processes: []models.ProcessInfo{{PID: 1, Name: "nginx"}}}})
+	e.observe(models.Sample{Timestamp: time.Unix(1001, 0), Stats: &models.SystemStats{}})
+	if len(alerts) != 1 || alerts[0].State != alertFiring {
+		t.Fatalf("alerts = %+v, want one firing alert", alerts)
+	}
+
+	rules[0].Metric = "watch.apache.count"
+	if _, err := newAlertEngine(AlertsConfig{HistorySize: 10, Rules: rules}, nil, newHistory(10, 0), w); err == nil {
+		t.Error("newAlertEngine() accepted a rule on an unknown watch")
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/thatbeautifuldream/system-stats-backend/collector"
+	"github.com/thatbeautifuldream/system-stats-backend/models"
+)
+
+// zfsStats returns the ZFS statistics of a sample, or nil when it has none
+func zfsStats(stats *models.SystemStats) *models.ZFSStats {
+	zfs, ok := stats.Extra[collector.TopicZFS].(models.ZFSStats)
+	if !ok {
+		return nil
+	}
+	return &zfs
+}
+
+// zfsHandler godoc
+// @Summary Get ZFS pool health
+// @Description Returns the health of the imported ZFS pools with their scrub or resilver in progress or last finished, and the hit rate of the ARC, from the last sample. Pools that are not ONLINE are counted in degraded, which alert rules watch as the zfsDegradedPools metric. Scans are read from zpool status and left out when it is not installed. Only available on Linux hosts with the ZFS module loaded.
+// @Tags stats
+// @Produce json
+// @Success 200 {object} models.ZFSStats
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 429 {string} string "Too Many Requests"
+// @Router /zfs [get]
+func (s *Server) zfsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !slices.Contains(collector.Topics(), collector.TopicZFS) {
+		http.Error(w, "ZFS is not available on this host", http.StatusNotFound)
+		return
+	}
+
+	sample, ok := s.history.Latest()
+	stats := sample.Stats
+	if !ok {
+		cached, err := s.cache.Get(r.Context(), collector.TopicSet{collector.TopicZFS: true}, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stats = cached
+	}
+	if err, failed := stats.Errors[collector.TopicZFS]; failed {
+		http.Error(w, err, http.StatusInternalServerError)
+		return
+	}
+	zfs := zfsStats(stats)
+	if zfs == nil {
+		http.Error(w, "ZFS is not available on this host", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, r, zfs)
+}